@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"ues-lite/datastore"
+	"ues-lite/datastore/conformance"
+)
+
+// Прогоняет набор conformance против локального датастора и
+// RemoteDatastoreAdapter, подключенного к серверу в этом же процессе.
+func main() {
+	only := flag.String("only", "", "Проверки через запятую (по умолчанию все)")
+	target := flag.String("target", "", "openapi, local или remote (по умолчанию все)")
+	flag.Parse()
+
+	var names []string
+	if *only != "" {
+		names = strings.Split(*only, ",")
+	}
+
+	targets := []struct {
+		name    string
+		factory conformance.Factory
+	}{
+		{"local", localFactory},
+		{"remote", remoteFactory},
+	}
+
+	failed := false
+	if *target == "" || *target == "openapi" {
+		// Каждый маршрут API должен быть описан в спецификации OpenAPI
+		if err := datastore.NewAPIServer(nil, testServerConfig()).ValidateOpenAPI(); err != nil {
+			failed = true
+			fmt.Printf("❌ openapi:\n%s\n", indent(err.Error()))
+		} else {
+			fmt.Println("✅ openapi")
+		}
+	}
+
+	for _, t := range targets {
+		if *target != "" && *target != t.name {
+			continue
+		}
+		if err := conformance.Run(context.Background(), t.factory, names...); err != nil {
+			failed = true
+			fmt.Printf("❌ %s:\n%s\n", t.name, indent(err.Error()))
+			continue
+		}
+		fmt.Printf("✅ %s\n", t.name)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func localFactory() (datastore.Datastore, func(), error) {
+	dir, err := os.MkdirTemp("", "ues-conformance-")
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := datastore.NewDatastorage(dir, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func remoteFactory() (datastore.Datastore, func(), error) {
+	store, cleanupStore, err := localFactory()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server := httptest.NewServer(datastore.NewAPIServer(store, testServerConfig()).Handler())
+
+	remote, err := datastore.NewRemoteDatastoreAdapter(server.URL)
+	if err != nil {
+		server.Close()
+		cleanupStore()
+		return nil, nil, err
+	}
+	return remote, func() {
+		remote.Close()
+		server.Close()
+		cleanupStore()
+	}, nil
+}
+
+func testServerConfig() *datastore.Config {
+	config := datastore.DefaultConfig()
+	// Метрики регистрируются глобально и не допускают несколько серверов
+	config.EnableMetrics = false
+	config.LogRequests = false
+	config.RateLimitRPS = 0
+	config.WriteRateLimitRPS = 0
+	config.ExpensiveRateLimitRPS = 0
+	return config
+}
+
+func indent(s string) string {
+	return "   " + strings.ReplaceAll(s, "\n", "\n   ")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func backup(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется путь к файлу снимка")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	path := ctx.Args().Get(0)
+	since := ctx.Uint64("since")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла: %w", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	version, err := app.ds.Snapshot(context.Background(), w, since)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("ошибка записи файла: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if since > 0 {
+		fmt.Printf("💾 Инкрементальный снимок с версии %d сохранен: %s (%s)\n", since, path, formatBytes(info.Size()))
+	} else {
+		fmt.Printf("💾 Снимок сохранен: %s (%s)\n", path, formatBytes(info.Size()))
+	}
+	fmt.Printf("🔖 Следующий инкрементальный снимок: %s backup --since %d FILE\n", AppName, version)
+
+	return nil
+}
+
+func restore(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется путь к файлу снимка")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	// Полный снимок и инкрементальные загружаются в порядке аргументов
+	for _, path := range ctx.Args().Slice() {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("ошибка открытия файла: %w", err)
+		}
+		err = app.ds.Restore(context.Background(), bufio.NewReader(file))
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("ошибка восстановления %s: %w", path, err)
+		}
+		fmt.Printf("♻️  Снимок восстановлен: %s\n", path)
+	}
+
+	return nil
+}
+
+func init() {
+	commands = append(commands, &cli.Command{
+		Name:      "backup",
+		Usage:     "Сохранить снимок датастора в файл",
+		ArgsUsage: "FILE",
+		Flags: []cli.Flag{
+			&cli.Uint64Flag{
+				Name:  "since",
+				Usage: "Версия из предыдущего снимка для инкрементального снимка",
+			},
+		},
+		Action: backup,
+	})
+	commands = append(commands, &cli.Command{
+		Name:      "restore",
+		Usage:     "Восстановить датастор из снимков (полный, затем инкрементальные)",
+		ArgsUsage: "FILE [FILE...]",
+		Action:    restore,
+	})
+}
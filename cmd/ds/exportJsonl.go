@@ -1,35 +1,20 @@
 package main
 
 import (
-	"archive/zip"
 	"bufio"
 	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 	"ues-lite/datastore"
 
 	ds "github.com/ipfs/go-datastore"
-	"github.com/itchyny/gojq"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 	"github.com/urfave/cli/v2"
 )
 
-// ExportRecord представляет запись для экспорта
-type ExportRecord struct {
-	Key       string            `json:"key"`
-	Value     string            `json:"value"`
-	Timestamp int64             `json:"timestamp,omitempty"`
-	Size      int               `json:"size,omitempty"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
-}
-
 func exportJSONL(ctx *cli.Context) error {
 
 	app, err := initApp(ctx)
@@ -38,30 +23,45 @@ func exportJSONL(ctx *cli.Context) error {
 	}
 	defer app.Close()
 
-	// Параметры команды
-	prefix := ctx.String("prefix")
 	output := ctx.String("output")
-	format := ctx.String("format")
-	patch := ctx.StringSlice("patch")
-	extract := ctx.String("extract")
-	jqExpr := ctx.String("jq")
-	limit := ctx.Int("limit")
-	startKey := ctx.String("start")
-	endKey := ctx.String("end")
-	includeMetadata := ctx.Bool("metadata")
-	skipSystem := ctx.Bool("skip-system")
-	compress := ctx.Bool("compress")
-	batchSize := ctx.Int("batch-size")
-
-	// Компилируем jq выражение если указано
-	var jqQuery *gojq.Query
-	if jqExpr != "" {
-		query, err := gojq.Parse(jqExpr)
-		if err != nil {
-			return fmt.Errorf("ошибка парсинга jq выражения '%s': %w", jqExpr, err)
+	opts := datastore.ExportOptions{
+		Prefix:      ds.NewKey(ctx.String("prefix")),
+		Format:      ctx.String("format"),
+		Encoding:    ctx.String("encoding"),
+		Compression: compressionFromPath(output),
+		Extract:     ctx.String("extract"),
+		Patch:       ctx.StringSlice("patch"),
+		JQ:          ctx.String("jq"),
+		Limit:       ctx.Int("limit"),
+		Start:       ctx.String("start"),
+		End:         ctx.String("end"),
+		Metadata:    ctx.Bool("metadata"),
+		SkipSystem:  ctx.Bool("skip-system"),
+		Progress: func(p datastore.TransferStats) {
+			if !p.Done {
+				fmt.Printf("📈 Экспортировано: %d записей\n", p.Processed)
+			}
+		},
+		OnError: func(key string, err error) {
+			fmt.Printf("⚠️  Ошибка при обработке ключа %s: %v\n", key, err)
+		},
+	}
+	if opts.Compression == "" && ctx.Bool("compress") {
+		opts.Compression = datastore.CompressionGzip
+	}
+	if opts.Compression == datastore.CompressionZip || opts.Compression == datastore.CompressionTar {
+		// Имя файла в архиве: имя архива без расширения архива
+		opts.Name = filepath.Base(output)
+		for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+			opts.Name = strings.TrimSuffix(opts.Name, ext)
 		}
-		jqQuery = query
-		fmt.Printf("🔍 jq выражение: %s\n", jqExpr)
+		if filepath.Ext(opts.Name) == "" {
+			opts.Name += "." + opts.Encoding
+		}
+	}
+
+	if opts.JQ != "" {
+		fmt.Printf("🔍 jq выражение: %s\n", opts.JQ)
 	}
 
 	// Создаем контекст с таймаутом
@@ -69,290 +69,55 @@ func exportJSONL(ctx *cli.Context) error {
 	defer cancel()
 
 	fmt.Printf("📤 Экспорт данных в JSON Lines\n")
-	fmt.Printf("🏷️  Префикс: %s\n", prefix)
+	fmt.Printf("🏷️  Префикс: %s\n", opts.Prefix)
 	if output != "" {
 		fmt.Printf("📄 Вывод: %s\n", output)
 	} else {
 		fmt.Printf("📄 Вывод: консоль\n")
 	}
-	fmt.Printf("📋 Формат: %s\n", format)
+	fmt.Printf("📋 Формат: %s\n", opts.Format)
 
-	// Получаем итератор
-	dsPrefix := ds.NewKey(prefix)
-	kvChan, errChan, err := app.ds.Iterator(ctxTimeout, dsPrefix, false)
-	if err != nil {
-		return fmt.Errorf("ошибка при создании итератора: %w", err)
-	}
-
-	// Создаем писатель
-	writer, closer, err := createWriter(output, compress)
+	writer, closer, err := createWriter(output)
 	if err != nil {
 		return fmt.Errorf("ошибка при создании писателя: %w", err)
 	}
 	defer closer()
 
-	exported := 0
-	skipped := 0
-	batch := make([]string, 0, batchSize)
-
-	for {
-		select {
-		case <-ctxTimeout.Done():
-			return fmt.Errorf("таймаут при экспорте: %w", ctxTimeout.Err())
-
-		case kv, ok := <-kvChan:
-			if !ok {
-				// Записываем оставшийся batch
-				if len(batch) > 0 {
-					if err := writeBatch(writer, batch); err != nil {
-						return fmt.Errorf("ошибка записи финального batch: %w", err)
-					}
-				}
-				goto done
-			}
-
-			keyStr := kv.Key.String()
-
-			// Проверяем диапазон ключей
-			if startKey != "" && keyStr < startKey {
-				skipped++
-				continue
-			}
-			if endKey != "" && keyStr > endKey {
-				// Достигли конца диапазона
-				if len(batch) > 0 {
-					if err := writeBatch(writer, batch); err != nil {
-						return fmt.Errorf("ошибка записи batch: %w", err)
-					}
-				}
-				goto done
-			}
-
-			// Пропускаем системные ключи если нужно
-			if skipSystem && strings.HasPrefix(keyStr, "/_system/") {
-				skipped++
-				continue
-			}
-
-			// Проверяем лимит
-			if limit > 0 && exported >= limit {
-				if len(batch) > 0 {
-					if err := writeBatch(writer, batch); err != nil {
-						return fmt.Errorf("ошибка записи batch: %w", err)
-					}
-				}
-				goto done
-			}
-
-			var jsonBytes []byte
-			if format == "value-only" {
-				jsonBytes = kv.Value
-			} else {
-				record, err := createExportRecord(kv, format, includeMetadata)
-				if err != nil {
-					fmt.Printf("⚠️  Ошибка при обработке ключа %s: %v\n", keyStr, err)
-					skipped++
-					continue
-				}
-				jsonBytes, err = json.Marshal(record)
-				if err != nil {
-					fmt.Printf("⚠️  Ошибка сериализации ключа %s: %v\n", keyStr, err)
-					skipped++
-					continue
-				}
-			}
-
-			// Применяем extract
-			if extract != "" {
-				jsonBytes = []byte(gjson.GetBytes(jsonBytes, extract).String())
-			}
-
-			// Применяем patch операции
-			if len(patch) > 0 {
-				for _, p := range patch {
-					var err error
-					k, v, ok := strings.Cut(p, "=")
-					if ok {
-						var value any = v
-						var t string
-						t, v, ok = strings.Cut(v, "#")
-						if ok {
-							switch t {
-							case "int":
-								value = parseInt(v)
-							case "float":
-								value = parseFloat(v)
-							case "bool":
-								value = parseBool(v)
-							case "json":
-								var jsonVal any
-								if err := json.Unmarshal([]byte(v), &jsonVal); err != nil {
-									fmt.Printf("⚠️  Ошибка разбора JSON в патче '%s' для ключа %s: %v\n", p, keyStr, err)
-									skipped++
-									continue
-								}
-								value = jsonVal
-							default:
-								value = v // по умолчанию строка
-							}
-						}
-						jsonBytes, err = sjson.SetBytes(jsonBytes, k, value)
-						if err != nil {
-							fmt.Printf("⚠️  Ошибка применения патча '%s' к ключу %s: %v\n", p, keyStr, err)
-							skipped++
-							continue
-						}
-					}
-				}
-			}
-
-			// Применяем jq выражение
-			if jqQuery != nil {
-				transformedBytes, err := applyJQExpression(jqQuery, jsonBytes, keyStr)
-				if err != nil {
-					fmt.Printf("⚠️  Ошибка применения jq к ключу %s: %v\n", keyStr, err)
-					skipped++
-					continue
-				}
-				if string(transformedBytes) == "null" {
-					skipped++
-					continue
-				}
-				jsonBytes = transformedBytes
-			}
-
-			batch = append(batch, string(jsonBytes))
-			exported++
-
-			// Записываем batch если достигли размера
-			if len(batch) >= batchSize {
-				if err := writeBatch(writer, batch); err != nil {
-					return fmt.Errorf("ошибка записи batch: %w", err)
-				}
-				batch = batch[:0] // Очищаем batch
-
-				// Показываем прогресс
-				if exported%10000 == 0 {
-					fmt.Printf("📈 Экспортировано: %d записей\n", exported)
-				}
-			}
-
-		case err := <-errChan:
-			if err != nil {
-				return fmt.Errorf("ошибка при итерации: %w", err)
-			}
-		}
+	stats, err := app.ds.Export(ctxTimeout, writer, opts)
+	if err != nil {
+		return fmt.Errorf("ошибка экспорта: %w", err)
 	}
 
-done:
 	fmt.Printf("\n✅ Экспорт завершён!\n")
-	fmt.Printf("📊 Экспортировано: %d записей\n", exported)
-	if skipped > 0 {
-		fmt.Printf("⏭️  Пропущено: %d записей\n", skipped)
+	fmt.Printf("📊 Экспортировано: %d записей\n", stats.Processed)
+	if stats.Skipped > 0 {
+		fmt.Printf("⏭️  Пропущено: %d записей\n", stats.Skipped)
 	}
 
 	return nil
 }
 
-// applyJQExpression применяет jq выражение к JSON данным
-func applyJQExpression(query *gojq.Query, jsonBytes []byte, keyStr string) ([]byte, error) {
-	
-	// Парсим JSON в interface{}
-	var input interface{}
-	if err := json.Unmarshal(jsonBytes, &input); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
-	}
-
-	// Применяем jq выражение
-	iter := query.Run(input)
-
-	// Получаем первый результат
-	result, ok := iter.Next()
-	if !ok {
-		// Если нет результата, возвращаем null
-		return []byte("null"), nil
-	}
-
-	// Проверяем на ошибку
-	if err, ok := result.(error); ok {
-		return nil, fmt.Errorf("ошибка выполнения jq: %w", err)
-	}
-
-	// Сериализуем результат обратно в JSON
-	transformedBytes, err := json.Marshal(result)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка сериализации результата jq: %w", err)
-	}
-
-	return transformedBytes, nil
-}
-
-func createExportRecord(kv datastore.KeyValue, format string, includeMetadata bool) (interface{}, error) {
-
-	keyStr := kv.Key.String()
-	valueStr := string(kv.Value)
-
-	switch format {
-	case "simple":
-		// Простой формат: только ключ и значение
-		return map[string]string{
-			"key":   keyStr,
-			"value": valueStr,
-		}, nil
-
-	case "full":
-		// Полный формат с метаданными
-		record := ExportRecord{
-			Key:       keyStr,
-			Value:     valueStr,
-			Timestamp: time.Now().Unix(),
-			Size:      len(kv.Value),
-		}
-
-		if includeMetadata {
-			record.Metadata = make(map[string]string)
-
-			// Определяем тип контента
-			if json.Valid(kv.Value) {
-				record.Metadata["content_type"] = "json"
-			} else if isUTF8(kv.Value) {
-				record.Metadata["content_type"] = "text"
-			} else {
-				record.Metadata["content_type"] = "binary"
-			}
-
-			// Добавляем части ключа как метаданные
-			parts := strings.Split(strings.Trim(keyStr, "/"), "/")
-			for i, part := range parts {
-				if part != "" {
-					record.Metadata[fmt.Sprintf("key_part_%d", i)] = part
-				}
-			}
-		}
-
-		return record, nil
-
-	case "value-only":
-		// Только значения (для восстановления структуры)
-		var jsonValue interface{}
-		if json.Valid(kv.Value) {
-			if err := json.Unmarshal(kv.Value, &jsonValue); err == nil {
-				return jsonValue, nil
-			}
-		}
-		return valueStr, nil
-
-	default:
-		return nil, fmt.Errorf("неизвестный формат: %s", format)
+// compressionFromPath определяет сжатие экспорта по расширению файла.
+func compressionFromPath(output string) string {
+	name := strings.ToLower(output)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return datastore.CompressionTar
+	case strings.HasSuffix(name, ".gz"):
+		return datastore.CompressionGzip
+	case strings.HasSuffix(name, ".zip"):
+		return datastore.CompressionZip
+	case strings.HasSuffix(name, ".tar"):
+		return datastore.CompressionTar
 	}
+	return ""
 }
 
-func createWriter(output string, compress bool) (*bufio.Writer, func() error, error) {
+func createWriter(output string) (*bufio.Writer, func() error, error) {
 	if output == "" || output == "-" {
 		// Вывод в консоль
-		return bufio.NewWriter(os.Stdout), func() error {
-			return nil
-		}, nil
+		writer := bufio.NewWriter(os.Stdout)
+		return writer, writer.Flush, nil
 	}
 
 	// Создаем директорию если нужно
@@ -361,116 +126,33 @@ func createWriter(output string, compress bool) (*bufio.Writer, func() error, er
 		return nil, nil, fmt.Errorf("создание директории: %w", err)
 	}
 
-	// Определяем тип файла по расширению
-	ext := strings.ToLower(filepath.Ext(output))
-
-	switch ext {
-	case ".zip":
-		return createZipWriter(output)
-	case ".gz":
-		return createGzipWriter(output)
-	default:
-		// Обычный файл
-		file, err := os.Create(output)
-		if err != nil {
-			return nil, nil, fmt.Errorf("создание файла: %w", err)
-		}
+	file, err := os.Create(output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("создание файла: %w", err)
+	}
 
-		writer := bufio.NewWriter(file)
+	// tar.gz: ExportOptions упаковывает в tar, сжатие добавляется здесь
+	name := strings.ToLower(output)
+	if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+		gzipWriter := gzip.NewWriter(file)
+		writer := bufio.NewWriter(gzipWriter)
 		closer := func() error {
 			writer.Flush()
+			gzipWriter.Close()
 			return file.Close()
 		}
-
 		return writer, closer, nil
 	}
-}
-
-func createGzipWriter(filename string) (*bufio.Writer, func() error, error) {
-	file, err := os.Create(filename)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	gzipWriter := gzip.NewWriter(file)
-	writer := bufio.NewWriter(gzipWriter)
 
+	writer := bufio.NewWriter(file)
 	closer := func() error {
 		writer.Flush()
-		gzipWriter.Close()
 		return file.Close()
 	}
 
 	return writer, closer, nil
 }
 
-func createZipWriter(filename string) (*bufio.Writer, func() error, error) {
-	file, err := os.Create(filename)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	zipWriter := zip.NewWriter(file)
-
-	// Создаем файл внутри архива
-	baseName := strings.TrimSuffix(filepath.Base(filename), ".zip")
-	if !strings.HasSuffix(baseName, ".jsonl") {
-		baseName += ".jsonl"
-	}
-
-	zipFile, err := zipWriter.Create(baseName)
-	if err != nil {
-		zipWriter.Close()
-		file.Close()
-		return nil, nil, err
-	}
-
-	writer := bufio.NewWriter(zipFile)
-	closer := func() error {
-		writer.Flush()
-		zipWriter.Close()
-		return file.Close()
-	}
-
-	return writer, closer, nil
-}
-
-func writeBatch(writer *bufio.Writer, batch []string) error {
-	for _, line := range batch {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return err
-		}
-	}
-	return writer.Flush()
-}
-
-// parseInt converts a string to int64, returns 0 on error
-func parseInt(s string) int64 {
-	i, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
-		return 0
-	}
-	return i
-}
-
-// parseFloat converts a string to float64, returns 0.0 on error
-func parseFloat(s string) float64 {
-	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return 0.0
-	}
-	return f
-}
-
-// parseBool converts a string to bool, returns false on error
-func parseBool(s string) bool {
-	b, err := strconv.ParseBool(s)
-	if err != nil {
-		return false
-	}
-	return b
-}
-
 func init() {
 	commands = append(commands, &cli.Command{
 		Name:    "export",
@@ -498,7 +180,7 @@ func init() {
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
-				Usage:   "Путь к выходному файлу (по умолчанию консоль). Поддерживает .jsonl, .gz, .zip",
+				Usage:   "Путь к выходному файлу (по умолчанию консоль). Поддерживает .jsonl, .gz, .zip, .tar, .tar.gz",
 			},
 			&cli.StringFlag{
 				Name:    "format",
@@ -506,6 +188,11 @@ func init() {
 				Value:   "value-only",
 				Usage:   "Формат экспорта: 'simple', 'full', 'value-only'",
 			},
+			&cli.StringFlag{
+				Name:  "encoding",
+				Value: "jsonl",
+				Usage: "Кодировка вывода: 'jsonl', 'json' (массив), 'csv' (key,value)",
+			},
 			&cli.IntFlag{
 				Name:    "limit",
 				Aliases: []string{"n"},
@@ -532,13 +219,14 @@ func init() {
 			&cli.BoolFlag{
 				Name:    "compress",
 				Aliases: []string{"z"},
-				Usage:   "Использовать сжатие (автоматически для .gz/.zip)",
+				Usage:   "Использовать gzip сжатие (автоматически для .gz/.zip/.tar)",
 			},
 			&cli.IntFlag{
 				Name:    "batch-size",
 				Aliases: []string{"b"},
 				Value:   1000,
-				Usage:   "Размер batch для записи",
+				Usage:   "Не используется, оставлен для совместимости",
+				Hidden:  true,
 			},
 		},
 		Action:    exportJSONL,
@@ -555,6 +243,9 @@ func init() {
 - Обычные файлы (.jsonl)
 - Сжатые файлы (.gz)
 - ZIP архивы (.zip)
+- TAR архивы (.tar, .tar.gz)
+
+Кодировки (--encoding): jsonl (по умолчанию), json (массив), csv (key,value)
 
 Обработка данных (применяется в порядке):
 1. extract: извлечение части JSON по JSONPath
@@ -592,6 +283,9 @@ jq выражения:
   .users[]                   - развертывание массива
   select(has("email"))       - проверка наличия поля
   map(select(.active))       - фильтрация массива
-  select(. != null)          - исключение null значений`,
+  select(. != null)          - исключение null значений
+  {key: $key} + .            - $key содержит исходный ключ
+  $key | key_name            - функции key_name, key_parent, key_namespaces, key_child(s)
+  .rev | tid_time            - функции tid_time, tid_decode, cid_parse`,
 	})
 }
@@ -1,25 +1,15 @@
 package main
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"bufio"
-	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
-	"ues-lite/tid"
+	"ues-lite/datastore"
 
 	ds "github.com/ipfs/go-datastore"
-	"github.com/itchyny/gojq"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 	"github.com/urfave/cli/v2"
 )
 
@@ -35,45 +25,44 @@ func loadJSONL(ctx *cli.Context) error {
 	defer app.Close()
 
 	sourcePath := ctx.Args().Get(0)
-	prefix := ctx.String("prefix")
-	idType := ctx.String("id-type")
-	batchSize := ctx.Int("batch-size")
-	clockID := ctx.Uint("clock-id")
-	patch := ctx.StringSlice("patch")
-	extract := ctx.String("extract")
-	jqExpr := ctx.String("jq")
 	silent := ctx.Bool("silent")
 	if silent {
 		app.ds.SetSilentMode(true)
 		defer app.ds.SetSilentMode(false)
 	}
 
-	// Компилируем jq выражение если указано
-	var jqQuery *gojq.Query
-	if jqExpr != "" {
-		query, err := gojq.Parse(jqExpr)
-		if err != nil {
-			return fmt.Errorf("ошибка парсинга jq выражения '%s': %w", jqExpr, err)
-		}
-		jqQuery = query
-		fmt.Printf("🔍 jq выражение: %s\n", jqExpr)
+	opts := datastore.ImportOptions{
+		Prefix:    ds.NewKey(ctx.String("prefix")),
+		IDType:    ctx.String("id-type"),
+		ClockID:   ctx.Uint("clock-id"),
+		Extract:   ctx.String("extract"),
+		Patch:     ctx.StringSlice("patch"),
+		JQ:        ctx.String("jq"),
+		BatchSize: ctx.Int("batch-size"),
+		Progress: func(p datastore.TransferStats) {
+			if p.Done {
+				fmt.Printf("✅ %s: обработано строк: %d, ошибок: %d\n", p.File, p.Processed, p.Errors)
+			} else {
+				fmt.Printf("📈 Обработано: %d записей\n", p.Processed)
+			}
+		},
+		OnError: func(key string, err error) {
+			fmt.Printf("⚠️  Ошибка при обработке ключа %s: %v\n", key, err)
+		},
 	}
 
-	// Создаем TID clock если нужен TID
-	var tidClock tid.TIDClock
-	if idType == "tid" {
-		tidClock = tid.NewTIDClock(clockID)
+	if opts.JQ != "" {
+		fmt.Printf("🔍 jq выражение: %s\n", opts.JQ)
 	}
 
 	ctxTimeout, cancel := context.WithTimeout(context.Background(), 300*time.Second)
 	defer cancel()
 
 	fmt.Printf("📥 Загрузка JSON Lines из: %s\n", sourcePath)
-	fmt.Printf("🏷️ Префикс ключей: %s\n", prefix)
-	fmt.Printf("🆔 Тип ID: %s\n", idType)
+	fmt.Printf("🏷️ Префикс ключей: %s\n", opts.Prefix)
+	fmt.Printf("🆔 Тип ID: %s\n", opts.IDType)
 
-	// Определяем тип источника
-	readers, err := getReaders(sourcePath)
+	sources, err := importSources(sourcePath)
 	if err != nil {
 		return fmt.Errorf("ошибка при открытии источника: %w", err)
 	}
@@ -81,20 +70,26 @@ func loadJSONL(ctx *cli.Context) error {
 	totalProcessed := 0
 	totalErrors := 0
 
-	// Обрабатываем каждый файл
-	for filename, reader := range readers {
-		fmt.Printf("\n📄 Обработка файла: %s\n", filename)
+	// Обрабатываем каждый файл; архивы распаковываются в Import
+	for _, path := range sources {
+		fmt.Printf("\n📄 Обработка файла: %s\n", path)
 
-		processed, errors, err := processJSONLFile(ctxTimeout, app, reader, prefix, idType, extract, patch, jqQuery, &tidClock, batchSize)
+		file, err := os.Open(path)
 		if err != nil {
-			fmt.Printf("❌ Ошибка при обработке файла %s: %v\n", filename, err)
+			fmt.Printf("❌ Ошибка при открытии файла %s: %v\n", path, err)
+			continue
+		}
+		opts.Name = filepath.Base(path)
+		stats, err := app.ds.Import(ctxTimeout, file, opts)
+		file.Close()
+		if stats != nil {
+			totalProcessed += stats.Processed
+			totalErrors += stats.Errors
+		}
+		if err != nil {
+			fmt.Printf("❌ Ошибка при обработке файла %s: %v\n", path, err)
 			continue
 		}
-
-		totalProcessed += processed
-		totalErrors += errors
-
-		fmt.Printf("✅ Обработано строк: %d, ошибок: %d\n", processed, errors)
 	}
 
 	fmt.Printf("\n📊 Итого загружено: %d записей\n", totalProcessed)
@@ -105,337 +100,30 @@ func loadJSONL(ctx *cli.Context) error {
 	return nil
 }
 
-func getReaders(sourcePath string) (map[string]io.Reader, error) {
-	readers := make(map[string]io.Reader)
-
-	file, err := os.Open(sourcePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close() // Закрываем файл в конце функции
-
-	// Получаем информацию о файле
-	info, err := file.Stat()
+// importSources возвращает файл или все JSON Lines файлы директории.
+func importSources(sourcePath string) ([]string, error) {
+	info, err := os.Stat(sourcePath)
 	if err != nil {
 		return nil, err
 	}
-
-	// Если это директория - обрабатываем все .jsonl файлы
-	if info.IsDir() {
-		return getReadersFromDir(sourcePath)
-	}
-
-	ext := strings.ToLower(filepath.Ext(sourcePath))
-	baseName := filepath.Base(sourcePath)
-
-	switch ext {
-	case ".zip":
-		return getReadersFromZip(file)
-
-	case ".tar", ".tgz":
-		return getReadersFromTar(file, false)
-
-	case ".gz":
-		if strings.HasSuffix(strings.ToLower(baseName), ".tar.gz") {
-			return getReadersFromTar(file, true)
-		} else {
-			// Обычный gzip файл - читаем в память
-			gzipReader, err := gzip.NewReader(file)
-			if err != nil {
-				return nil, err
-			}
-			defer gzipReader.Close()
-
-			data, err := io.ReadAll(gzipReader)
-			if err != nil {
-				return nil, err
-			}
-			readers[baseName] = strings.NewReader(string(data))
-		}
-
-	case ".jsonl", ".ndjson", ".json":
-		// Читаем файл в память
-		data, err := io.ReadAll(file)
-		if err != nil {
-			return nil, err
-		}
-		readers[baseName] = strings.NewReader(string(data))
-
-	default:
-		// Пробуем как обычный текстовый файл - читаем в память
-		data, err := io.ReadAll(file)
-		if err != nil {
-			return nil, err
-		}
-		readers[baseName] = strings.NewReader(string(data))
+	if !info.IsDir() {
+		return []string{sourcePath}, nil
 	}
 
-	return readers, nil
-}
-
-func getReadersFromDir(dirPath string) (map[string]io.Reader, error) {
-	readers := make(map[string]io.Reader)
-
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	var sources []string
+	err = filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-
 		if !info.IsDir() {
 			ext := strings.ToLower(filepath.Ext(path))
 			if ext == ".jsonl" || ext == ".ndjson" || ext == ".json" {
-				file, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
-
-				// Читаем файл в память
-				data, err := io.ReadAll(file)
-				if err != nil {
-					return err
-				}
-
-				relPath, _ := filepath.Rel(dirPath, path)
-				readers[relPath] = strings.NewReader(string(data))
+				sources = append(sources, path)
 			}
 		}
-
 		return nil
 	})
-
-	return readers, err
-}
-
-func getReadersFromZip(file *os.File) (map[string]io.Reader, error) {
-	readers := make(map[string]io.Reader)
-
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	zipReader, err := zip.NewReader(file, stat.Size())
-	if err != nil {
-		return nil, err
-	}
-
-	for _, zipFile := range zipReader.File {
-		if !zipFile.FileInfo().IsDir() {
-			ext := strings.ToLower(filepath.Ext(zipFile.Name))
-			if ext == ".jsonl" || ext == ".ndjson" || ext == ".json" {
-				rc, err := zipFile.Open()
-				if err != nil {
-					continue
-				}
-
-				// Читаем содержимое в память
-				data, err := io.ReadAll(rc)
-				rc.Close()
-				if err != nil {
-					continue
-				}
-
-				readers[zipFile.Name] = strings.NewReader(string(data))
-			}
-		}
-	}
-
-	return readers, nil
-}
-
-func getReadersFromTar(file *os.File, isGzip bool) (map[string]io.Reader, error) {
-	readers := make(map[string]io.Reader)
-
-	var tarReader *tar.Reader
-	if isGzip {
-		gzipReader, err := gzip.NewReader(file)
-		if err != nil {
-			return nil, err
-		}
-		defer gzipReader.Close()
-		tarReader = tar.NewReader(gzipReader)
-	} else {
-		tarReader = tar.NewReader(file)
-	}
-
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		if header.Typeflag == tar.TypeReg {
-			ext := strings.ToLower(filepath.Ext(header.Name))
-			if ext == ".jsonl" || ext == ".ndjson" || ext == ".json" {
-				// Читаем весь файл в память (так как tar reader последовательный)
-				data, err := io.ReadAll(tarReader)
-				if err != nil {
-					continue
-				}
-				readers[header.Name] = strings.NewReader(string(data))
-			}
-		}
-	}
-
-	return readers, nil
-}
-
-func processJSONLFile(ctx context.Context, app *app, reader io.Reader, prefix, idType, extract string, patch []string, jqQuery *gojq.Query, tidClock *tid.TIDClock, batchSize int) (int, int, error) {
-	scanner := bufio.NewScanner(reader)
-
-	// Увеличиваем буфер для больших строк
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024) // 1MB max line size
-
-	batch, err := app.ds.Batch(ctx)
-	if err != nil {
-		return 0, 0, fmt.Errorf("ошибка создания batch: %w", err)
-	}
-
-	processed := 0
-	errors := 0
-	batchCount := 0
-
-	for scanner.Scan() {
-
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		// Проверяем валидность JSON
-		var jsonData interface{}
-		if err := json.Unmarshal([]byte(line), &jsonData); err != nil {
-			errors++
-			continue
-		}
-
-		// Генерируем ID
-		var keyID string
-		switch idType {
-		case "tid":
-			keyID = tidClock.Next().String()
-		case "unix-nano":
-			keyID = strconv.FormatInt(time.Now().UnixNano(), 10)
-		default:
-			keyID = strconv.FormatInt(time.Now().UnixNano(), 10)
-		}
-
-		// Создаем ключ
-		var key ds.Key
-		if prefix == "" || prefix == "/" {
-			key = ds.NewKey(keyID)
-		} else {
-			key = ds.NewKey(prefix).ChildString(keyID)
-		}
-
-		if extract != "" {
-			line = gjson.Get(line, extract).String()
-		}
-
-		if len(patch) > 0 {
-			for _, p := range patch {
-				var err error
-				k, v, ok := strings.Cut(p, "=")
-				if ok {
-					var value any = v
-					var t string
-					t, v, ok = strings.Cut(v, "#")
-					if ok {
-						switch t {
-						case "int":
-							value = parseInt(v)
-						case "float":
-							value = parseFloat(v)
-						case "bool":
-							value = parseBool(v)
-						case "json":
-							var jsonVal any
-							if err := json.Unmarshal([]byte(v), &jsonVal); err != nil {
-								fmt.Printf("⚠️  Ошибка разбора JSON в патче '%s' для ключа %s: %v\n", p, key.String(), err)
-								continue
-							}
-							value = jsonVal
-						default:
-							value = v // по умолчанию строка
-						}
-					}
-					line, err = sjson.Set(line, k, value)
-					if err != nil {
-						fmt.Printf("⚠️  Ошибка применения патча '%s' к ключу %s: %v\n", p, key.String(), err)
-						continue
-					}
-				}
-			}
-		}
-
-		// Применяем jq выражение
-		if jqQuery != nil {
-			transformedBytes, err := applyJQExpression(jqQuery, []byte(line), key.String())
-			if err != nil {
-				fmt.Printf("⚠️  Ошибка применения jq к ключу %s: %v\n", key.String(), err)
-				continue
-			}
-			if string(transformedBytes) == "null" {
-				continue
-			}
-			line = string(transformedBytes)
-		}
-
-		// Добавляем в batch
-		err := batch.Put(ctx, key, []byte(line))
-		if err != nil {
-			errors++
-			continue
-		}
-
-		batchCount++
-		processed++
-
-		// Коммитим batch если достигли размера
-		if batchCount >= batchSize {
-			if err := batch.Commit(ctx); err != nil {
-				return processed, errors, fmt.Errorf("ошибка коммита batch: %w", err)
-			}
-
-			// Создаем новый batch
-			batch, err = app.ds.Batch(ctx)
-			if err != nil {
-				return processed, errors, fmt.Errorf("ошибка создания нового batch: %w", err)
-			}
-
-			batchCount = 0
-
-			// Показываем прогресс
-			if processed%10000 == 0 {
-				fmt.Printf("📈 Обработано: %d записей\n", processed)
-			}
-		}
-
-		// Проверяем контекст
-		select {
-		case <-ctx.Done():
-			return processed, errors, ctx.Err()
-		default:
-		}
-	}
-
-	// Коммитим оставшиеся данные
-	if batchCount > 0 {
-		if err := batch.Commit(ctx); err != nil {
-			return processed, errors, fmt.Errorf("ошибка финального коммита: %w", err)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return processed, errors, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-
-	return processed, errors, nil
+	return sources, err
 }
 
 func init() {
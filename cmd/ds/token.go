@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"ues-lite/datastore"
+
+	"github.com/urfave/cli/v2"
+)
+
+func tokenCreate(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется имя токена")
+	}
+
+	spec := datastore.TokenSpec{
+		Name:     ctx.Args().Get(0),
+		TTL:      ctx.Duration("ttl"),
+		MaxKeys:  ctx.Int64("max-keys"),
+		MaxBytes: ctx.Int64("max-bytes"),
+	}
+	for _, s := range ctx.StringSlice("scope") {
+		scope, err := datastore.ParseTokenScope(s)
+		if err != nil {
+			return fmt.Errorf("неверная область %q: %w", s, err)
+		}
+		spec.Scopes = append(spec.Scopes, scope)
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	secret, token, err := app.ds.CreateToken(context.Background(), spec)
+	if err != nil {
+		return fmt.Errorf("ошибка создания токена: %w", err)
+	}
+
+	fmt.Printf("🔑 Токен '%s' создан (ID: %s)\n", token.Name, token.ID)
+	fmt.Printf("   Области: %s\n", formatScopes(token.Scopes))
+	if token.ExpiresAt != nil {
+		fmt.Printf("   Истекает: %s\n", token.ExpiresAt.Format(time.RFC3339))
+	}
+	if token.MaxKeys > 0 || token.MaxBytes > 0 {
+		fmt.Printf("   Квота: %s\n", formatQuota(token))
+	}
+	fmt.Println("\nСохраните токен, он больше не будет показан:")
+	fmt.Println(secret)
+
+	return nil
+}
+
+func tokenList(ctx *cli.Context) error {
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	tokens, err := app.ds.ListTokens(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка получения токенов: %w", err)
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("📭 Токены не найдены")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tИМЯ\tОБЛАСТИ\tКВОТА\tСОЗДАН\tИСТЕКАЕТ\tСТАТУС")
+	for _, token := range tokens {
+		expires := "-"
+		if token.ExpiresAt != nil {
+			expires = token.ExpiresAt.Format(time.RFC3339)
+		}
+		status := "активен"
+		switch {
+		case token.RevokedAt != nil:
+			status = "отозван"
+		case !token.Active():
+			status = "истек"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, formatScopes(token.Scopes),
+			formatQuota(&token), token.CreatedAt.Format(time.RFC3339), expires, status)
+	}
+	return tw.Flush()
+}
+
+func tokenRevoke(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется ID токена")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	id := ctx.Args().Get(0)
+	if err := app.ds.RevokeToken(context.Background(), id); err != nil {
+		return fmt.Errorf("ошибка отзыва токена: %w", err)
+	}
+
+	fmt.Printf("🚫 Токен '%s' отозван\n", id)
+
+	return nil
+}
+
+func formatScopes(scopes []datastore.TokenScope) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope.Permission) + ":" + scope.Prefix
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatQuota(token *datastore.APIToken) string {
+	var parts []string
+	if token.MaxKeys > 0 {
+		parts = append(parts, fmt.Sprintf("%d ключей", token.MaxKeys))
+	}
+	if token.MaxBytes > 0 {
+		parts = append(parts, formatBytes(token.MaxBytes))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	commands = append(commands, &cli.Command{
+		Name:  "token",
+		Usage: "Управление токенами доступа к REST API",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Создать токен",
+				ArgsUsage: "<name>",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "scope",
+						Aliases:  []string{"s"},
+						Required: true,
+						Usage:    "Область в формате 'permission:/prefix' (permission: read, write, subscribe, admin)",
+					},
+					&cli.DurationFlag{
+						Name:  "ttl",
+						Usage: "Срок действия токена (0 - бессрочный)",
+					},
+					&cli.Int64Flag{
+						Name:  "max-keys",
+						Usage: "Квота ключей под префиксами с правом записи (0 - без ограничения)",
+					},
+					&cli.Int64Flag{
+						Name:  "max-bytes",
+						Usage: "Квота байт под префиксами с правом записи (0 - без ограничения)",
+					},
+				},
+				Action: tokenCreate,
+			},
+			{
+				Name:   "list",
+				Usage:  "Показать токены",
+				Action: tokenList,
+			},
+			{
+				Name:      "revoke",
+				Usage:     "Отозвать токен",
+				ArgsUsage: "<id>",
+				Action:    tokenRevoke,
+			},
+		},
+		Description: `Токены проверяются сервером при включенной авторизации. Право admin
+включает остальные права под префиксом; admin:/ нужен для системных операций
+(clear, gc, снимки, управление токенами).
+
+Примеры:
+   ues-ds token create reader --scope read:/users --ttl 720h
+   ues-ds token create ops --scope admin:/
+   ues-ds token revoke 3f2a9c1d0b7e4a65`,
+	})
+}
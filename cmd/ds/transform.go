@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+)
+
+func transform(ctx *cli.Context) error {
+
+	prefix := ctx.String("prefix")
+	key := ctx.String("key")
+	jqExpr := ctx.String("jq")
+	extract := ctx.String("extract")
+	patch := ctx.StringSlice("patch")
+
+	var script string
+	if scriptFile := ctx.String("js-file"); scriptFile != "" {
+		scriptBytes, err := os.ReadFile(scriptFile)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения файла скрипта: %w", err)
+		}
+		script = string(scriptBytes)
+	} else {
+		script = ctx.String("js")
+	}
+
+	if jqExpr == "" && extract == "" && len(patch) == 0 && script == "" {
+		return fmt.Errorf("требуется хотя бы одно из: --jq, --extract, --patch, --js")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	if ctx.Bool("silent") {
+		app.ds.SetSilentMode(true)
+		defer app.ds.SetSilentMode(false)
+	}
+
+	opts := &datastore.TransformOptions{
+		Prefix:       ds.NewKey(prefix),
+		Extract:      extract,
+		Patches:      patch,
+		JQ:           jqExpr,
+		Script:       script,
+		DryRun:       ctx.Bool("dry-run"),
+		IgnoreErrors: ctx.Bool("ignore-errors"),
+		NoJournal:    ctx.Bool("no-journal"),
+		MaxChanges:   ctx.Int("max-changes"),
+		BatchSize:    ctx.Int("batch-size"),
+	}
+	if key != "" {
+		opts.Key = ds.NewKey(key)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), ctx.Duration("timeout"))
+	defer cancel()
+
+	summary, err := app.ds.RunTransform(ctxTimeout, opts)
+	if summary != nil {
+		printTransformSummary(summary)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка трансформации: %w", err)
+	}
+
+	return nil
+}
+
+func printTransformSummary(summary *datastore.TransformSummary) {
+	if summary.DryRun {
+		for _, change := range summary.Changes {
+			before, _ := json.Marshal(change.Before)
+			after, _ := json.Marshal(change.After)
+			fmt.Printf("🔑 %s\n  - %s\n  + %s\n", change.Key, before, after)
+		}
+		if len(summary.Changes) < summary.Changed {
+			fmt.Printf("… показано %d из %d изменений\n", len(summary.Changes), summary.Changed)
+		}
+	}
+
+	for _, failure := range summary.Failures {
+		fmt.Printf("⚠️  %s: %s\n", failure.Key, failure.Error)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	if summary.DryRun {
+		t.SetTitle("🔍 Трансформация (dry-run)")
+	} else {
+		t.SetTitle("🔄 Трансформация")
+	}
+	t.AppendRow(table.Row{"Просмотрено", summary.Scanned})
+	t.AppendRow(table.Row{"Изменено", summary.Changed})
+	t.AppendRow(table.Row{"Без изменений", summary.Unchanged})
+	t.AppendRow(table.Row{"Ошибок", summary.Errors})
+	t.AppendRow(table.Row{"Время", summary.Duration.Round(time.Millisecond)})
+	if summary.JournalID != "" {
+		t.AppendRow(table.Row{"Журнал", summary.JournalID})
+	}
+	t.Render()
+}
+
+func transformJournal(ctx *cli.Context) error {
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	journals, err := app.ds.ListTransformJournals(ctxTimeout)
+	if err != nil {
+		return fmt.Errorf("ошибка получения журнала: %w", err)
+	}
+
+	if len(journals) == 0 {
+		fmt.Println("📭 Журнал трансформаций пуст")
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleColoredBright)
+	t.SetTitle("📜 Журнал трансформаций")
+	t.AppendHeader(table.Row{"ID", "Статус", "Префикс", "Изменено", "Создан"})
+	for _, j := range journals {
+		target := j.Options.Prefix.String()
+		if k := j.Options.Key.String(); k != "" && k != "/" {
+			target = k
+		}
+		t.AppendRow(table.Row{j.ID, j.Status, target, j.Changed, j.CreatedAt.Format(time.RFC3339)})
+	}
+	t.Render()
+
+	return nil
+}
+
+func transformRevert(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется ID журнала")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), ctx.Duration("timeout"))
+	defer cancel()
+
+	summary, err := app.ds.RevertTransform(ctxTimeout, ctx.Args().Get(0))
+	if err != nil {
+		return fmt.Errorf("ошибка отката трансформации: %w", err)
+	}
+
+	for _, failure := range summary.Failures {
+		fmt.Printf("⚠️  %s: %s\n", failure.Key, failure.Error)
+	}
+	fmt.Printf("↩️  Восстановлено ключей: %d, пропущено: %d\n", summary.Changed, summary.Errors)
+
+	return nil
+}
+
+func transformJournalDelete(ctx *cli.Context) error {
+
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("требуется ID журнала")
+	}
+
+	app, err := initApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	id := ctx.Args().Get(0)
+	if err := app.ds.DeleteTransformJournal(ctxTimeout, id); err != nil {
+		return fmt.Errorf("ошибка удаления журнала: %w", err)
+	}
+
+	fmt.Printf("🗑️  Журнал '%s' удалён\n", id)
+
+	return nil
+}
+
+func init() {
+	commands = append(commands, &cli.Command{
+		Name:  "transform",
+		Usage: "Трансформировать значения под префиксом (jq, js, extract, patch)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "prefix",
+				Aliases: []string{"p"},
+				Value:   "/",
+				Usage:   "Префикс ключей для трансформации",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Трансформировать только один ключ",
+			},
+			&cli.StringFlag{
+				Name:  "jq",
+				Usage: "jq выражение для трансформации значения",
+			},
+			&cli.StringFlag{
+				Name:  "js",
+				Usage: "Тело JS-функции (key, value), возвращающей новое значение, null или список {key, value}",
+			},
+			&cli.StringFlag{
+				Name:  "js-file",
+				Usage: "Файл с телом JS-функции трансформации",
+			},
+			&cli.StringFlag{
+				Name:  "extract",
+				Usage: "JSONPath для извлечения части значения",
+			},
+			&cli.StringSliceFlag{
+				Name:  "patch",
+				Usage: "Патчи для JSON в формате 'path=value' или 'path=type#value' (type: int, float, bool, json)",
+			},
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Aliases: []string{"n"},
+				Usage:   "Показать изменения без записи",
+			},
+			&cli.IntFlag{
+				Name:  "max-changes",
+				Value: 20,
+				Usage: "Сколько diff показывать в режиме dry-run",
+			},
+			&cli.BoolFlag{
+				Name:  "ignore-errors",
+				Usage: "Пропускать значения, которые не удалось трансформировать",
+			},
+			&cli.BoolFlag{
+				Name:  "no-journal",
+				Usage: "Не сохранять исходные значения для отката",
+			},
+			&cli.IntFlag{
+				Name:    "batch-size",
+				Aliases: []string{"b"},
+				Value:   datastore.BatchSize,
+				Usage:   "Размер batch для записи в датастор",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: 10 * time.Minute,
+				Usage: "Таймаут операции",
+			},
+			&cli.BoolFlag{
+				Name:  "silent",
+				Usage: "Отключить публикацию событий для этой операции (только для этой команды)",
+			},
+		},
+		Action: transform,
+		Subcommands: []*cli.Command{
+			{
+				Name:   "journal",
+				Usage:  "Показать журнал примененных трансформаций",
+				Action: transformJournal,
+			},
+			{
+				Name:      "revert",
+				Usage:     "Откатить трансформацию по ID журнала",
+				ArgsUsage: "<id>",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: 10 * time.Minute,
+						Usage: "Таймаут операции",
+					},
+				},
+				Action: transformRevert,
+			},
+			{
+				Name:      "drop",
+				Usage:     "Удалить запись журнала и сохраненные значения",
+				ArgsUsage: "<id>",
+				Action:    transformJournalDelete,
+			},
+		},
+		Description: `Применяет jq выражение, JS-функцию или extract/patch к значениям
+под префиксом.
+
+JS-функция получает key и value (JSON разобран, иначе строка) и может вернуть
+новое значение, null для удаления ключа, список записей {key, value} (value:
+null удаляет ключ) или ничего, чтобы оставить значение без изменений.
+Доступны хелперы $lo и lancet ($strutil, $slice, ...).
+
+Перед записью можно посмотреть изменения с --dry-run. Каждая примененная
+трансформация сохраняет исходные значения в журнал, откатить ее можно
+командой 'transform revert <id>'. Ключи, измененные после трансформации,
+при откате пропускаются.
+
+Примеры:
+  ues-ds transform --prefix=/users --jq '.name |= ascii_upcase' --dry-run
+  ues-ds transform --prefix=/users --patch 'active=bool#true'
+  ues-ds transform --prefix=/users --js 'if (!value.legacy) return; return null'
+  ues-ds transform journal
+  ues-ds transform revert 3l2x4k6abcd2e`,
+	})
+}
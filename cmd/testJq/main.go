@@ -36,11 +36,11 @@ func main() {
 		}
 	}
 
-	// res, err := ds.QueryJQ(ctx, "reduce inputs as $dev ({sum: 0, count: 0}; .sum += $dev.salary | .count += 1) | {A: .sum, B: .count, C:  .sum / .count}", &datastore.JQQueryOptions{
+	// res, err := ds.AggregateJQ(ctx, "reduce inputs as $dev ({sum: 0, count: 0}; .sum += $dev.salary | .count += 1) | {A: .sum, B: .count, C:  .sum / .count}", &datastore.JQQueryOptions{
 	// 	Prefix: dst.NewKey("developers/"),
 	// })
 
-	res, err := ds.QueryJQ(ctx, "reduce inputs as $dev ([]; . + [{x:$dev.name}])", &datastore.JQQueryOptions{
+	res, err := ds.AggregateJQ(ctx, "reduce inputs as $dev ([]; . + [{x:$dev.name}])", &datastore.JQQueryOptions{
 		Prefix: dst.NewKey("developers/"),
 	})
 
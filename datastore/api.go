@@ -0,0 +1,4419 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config конфигурация сервера
+type Config struct {
+	Host                 string        `json:"host"`
+	Port                 int           `json:"port"`
+	EnableCORS           bool          `json:"enable_cors"`
+	EnableMetrics        bool          `json:"enable_metrics"`
+	EnableAuth           bool          `json:"enable_auth"`
+	AuthToken            string        `json:"auth_token"`
+	LogRequests          bool          `json:"log_requests"`
+	RequestTimeout       time.Duration `json:"request_timeout"`
+	ReadTimeout          time.Duration `json:"read_timeout"`
+	WriteTimeout         time.Duration `json:"write_timeout"`
+	IdleTimeout          time.Duration `json:"idle_timeout"`
+	ShutdownTimeout      time.Duration `json:"shutdown_timeout"`
+	MaxRequestSize       int64         `json:"max_request_size"`
+	RateLimitRPS         float64       `json:"rate_limit_rps"`
+	RateLimitBurst       int           `json:"rate_limit_burst"`
+	EnableCompression    bool          `json:"enable_compression"`
+	EnableStructuredLogs bool          `json:"enable_structured_logs"`
+	TxnTTL               time.Duration `json:"txn_ttl"`
+	MaxTxnTTL            time.Duration `json:"max_txn_ttl"`
+	MaxTransactions      int           `json:"max_transactions"`
+	// Listeners - слушатели сервера; если не заданы, используется Host:Port
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+	// Лимиты ведутся по токену или адресу клиента: RateLimit* - чтение,
+	// WriteRateLimit* - запись, ExpensiveRateLimit* - /query, /search и
+	// /transform. RPS 0 отключает лимит.
+	WriteRateLimitRPS       float64       `json:"write_rate_limit_rps"`
+	WriteRateLimitBurst     int           `json:"write_rate_limit_burst"`
+	ExpensiveRateLimitRPS   float64       `json:"expensive_rate_limit_rps"`
+	ExpensiveRateLimitBurst int           `json:"expensive_rate_limit_burst"`
+	RateLimitIdleTTL        time.Duration `json:"rate_limit_idle_ttl"`
+	// TrustForwardedFor - определять клиента по X-Forwarded-For (за прокси)
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+	// QuotaCheckInterval - как часто пересчитывается использование квот токенов
+	QuotaCheckInterval time.Duration `json:"quota_check_interval"`
+	// EventLogSize - сколько последних событий хранится для продолжения
+	// WebSocket подписок; WSMaxUnacked - окно неподтвержденных событий
+	EventLogSize int `json:"event_log_size"`
+	WSMaxUnacked int `json:"ws_max_unacked"`
+}
+
+// DefaultConfig возвращает конфигурацию по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		Host:                 "localhost",
+		Port:                 8080,
+		EnableCORS:           true,
+		EnableMetrics:        true,
+		EnableAuth:           false,
+		LogRequests:          true,
+		RequestTimeout:       30 * time.Second,
+		ReadTimeout:          30 * time.Second,
+		WriteTimeout:         30 * time.Second,
+		IdleTimeout:          60 * time.Second,
+		ShutdownTimeout:      30 * time.Second,
+		MaxRequestSize:       32 << 20, // 32MB
+		RateLimitRPS:         100,
+		RateLimitBurst:       200,
+		EnableCompression:    true,
+		EnableStructuredLogs: true,
+		TxnTTL:               30 * time.Second,
+		MaxTxnTTL:            5 * time.Minute,
+		MaxTransactions:      100,
+
+		WriteRateLimitRPS:       50,
+		WriteRateLimitBurst:     100,
+		ExpensiveRateLimitRPS:   5,
+		ExpensiveRateLimitBurst: 10,
+		RateLimitIdleTTL:        10 * time.Minute,
+		QuotaCheckInterval:      10 * time.Second,
+		EventLogSize:            10000,
+		WSMaxUnacked:            1000,
+	}
+}
+
+// APIServer полноценный API сервер
+type APIServer struct {
+	ds       Datastore
+	config   *Config
+	server   *http.Server
+	logger   *log.Logger
+	metrics  *Metrics
+	limiters *clientLimiters
+	quotas   quotaTracker
+	events   *eventLog
+	shutdown chan os.Signal
+	wg       sync.WaitGroup
+	txns     txnRegistry
+	openapi  openAPICache
+}
+
+// Metrics метрики Prometheus
+type Metrics struct {
+	RequestsTotal       prometheus.Counter
+	RequestDuration     prometheus.Histogram
+	ActiveConnections   prometheus.Gauge
+	ErrorsTotal         prometheus.Counter
+	DatastoreOperations prometheus.CounterVec
+	DatastoreSize       prometheus.Gauge
+	DatastoreKeys       prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		RequestsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "datastore_api_requests_total",
+			Help: "Общее количество HTTP запросов",
+		}),
+		RequestDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name: "datastore_api_request_duration_seconds",
+			Help: "Продолжительность HTTP запросов",
+		}),
+		ActiveConnections: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "datastore_api_active_connections",
+			Help: "Количество активных соединений",
+		}),
+		ErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "datastore_api_errors_total",
+			Help: "Общее количество ошибок",
+		}),
+		DatastoreOperations: *promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "datastore_operations_total",
+				Help: "Операции с датастором по типам",
+			},
+			[]string{"operation", "status"},
+		),
+		DatastoreSize: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "datastore_size_bytes",
+			Help: "Размер датастора в байтах",
+		}),
+		DatastoreKeys: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "datastore_keys_total",
+			Help: "Общее количество ключей в датасторе",
+		}),
+	}
+}
+
+// APIResponse стандартный ответ API
+type APIResponse struct {
+	Success   bool        `json:"success"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// NewAPIServer создает новый API сервер
+func NewAPIServer(ds Datastore, config *Config) *APIServer {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	server := &APIServer{
+		ds:       ds,
+		config:   config,
+		logger:   log.New(os.Stdout, "[API] ", log.LstdFlags|log.Lshortfile),
+		shutdown: make(chan os.Signal, 1),
+		txns:     txnRegistry{txns: make(map[string]*serverTxn)},
+		quotas:   quotaTracker{usage: make(map[string]*quotaUsage)},
+		events:   newEventLog(config.EventLogSize),
+	}
+
+	if config.WSMaxUnacked <= 0 {
+		config.WSMaxUnacked = 1000
+	}
+
+	if config.EnableMetrics {
+		server.metrics = NewMetrics()
+	}
+
+	if config.RateLimitRPS > 0 || config.WriteRateLimitRPS > 0 || config.ExpensiveRateLimitRPS > 0 {
+		server.limiters = newClientLimiters(config)
+	}
+
+	return server
+}
+
+// Start запускает сервер
+func (s *APIServer) Start(ctx context.Context) error {
+	handler := s.Handler()
+
+	configs := s.config.listenerConfigs()
+	listeners, err := openListeners(configs)
+	if err != nil {
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler:      handler,
+		ReadTimeout:  s.config.ReadTimeout,
+		WriteTimeout: s.config.WriteTimeout,
+		IdleTimeout:  s.config.IdleTimeout,
+	}
+
+	signal.Notify(s.shutdown, os.Interrupt, syscall.SIGTERM)
+
+	// Запускаем каждый слушатель в отдельной горутине
+	for i, ln := range listeners {
+		s.wg.Add(1)
+		go func(ln net.Listener, lc ListenerConfig) {
+			defer s.wg.Done()
+			s.logger.Printf("Сервер запущен на %s", lc)
+
+			if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				s.logger.Printf("Ошибка сервера %s: %v", lc, err)
+			}
+		}(ln, configs[i])
+	}
+
+	// Запускаем обновление метрик
+	if s.metrics != nil {
+		s.wg.Add(1)
+		go s.metricsUpdater(ctx)
+	}
+
+	// Ожидаем сигнал завершения
+	<-s.shutdown
+	return s.gracefulShutdown()
+}
+
+// Handler возвращает обработчик маршрутов API без слушателей, например для
+// httptest.NewServer. С этого момента сервер пишет события в журнал
+// WebSocket подписок.
+func (s *APIServer) Handler() http.Handler {
+	router := s.newRouter()
+	s.ds.SubscribeFunc(wsEventsSubscriberID, s.events.append)
+	return router
+}
+
+// newRouter создает маршрутизатор со всеми маршрутами API
+func (s *APIServer) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	s.setupRoutes(router)
+	return router
+}
+
+// gracefulShutdown graceful shutdown сервера
+func (s *APIServer) gracefulShutdown() error {
+	s.logger.Println("Начинается graceful shutdown...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	// WebSocket соединения не отслеживаются http.Server, закрываем их сами
+	s.ds.Unsubscribe(wsEventsSubscriberID)
+	s.events.close()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Printf("Ошибка при shutdown: %v", err)
+		return err
+	}
+
+	s.discardAllTxns(ctx)
+
+	s.wg.Wait()
+	s.logger.Println("Сервер остановлен")
+	return nil
+}
+
+// setupRoutes настраивает маршруты
+func (s *APIServer) setupRoutes(router *mux.Router) {
+	// Middleware
+	router.Use(s.recoveryMiddleware)
+	router.Use(s.requestIDMiddleware)
+	router.Use(s.corsMiddleware)
+	router.Use(s.authMiddleware)
+	router.Use(s.rateLimitMiddleware)
+	router.Use(s.metricsMiddleware)
+	router.Use(s.compressionMiddleware)
+
+	if s.config.LogRequests {
+		router.Use(s.loggingMiddleware)
+	}
+
+	// API routes
+	api := router.PathPrefix("/api/v1").Subrouter()
+
+	// Basic operations
+	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	api.HandleFunc("/keys", s.scoped(PermissionRead, queryScope("prefix"), s.handleListKeys)).Methods("GET")
+	api.HandleFunc("/keys/{key:.*}/info", s.scoped(PermissionRead, pathScope("key"), s.handleKeyInfo)).Methods("GET")
+	api.HandleFunc("/keys/{key:.*}/query", s.scoped(PermissionRead, pathScope("key"), s.handleJQSingle)).Methods("POST")
+	api.HandleFunc("/keys/{key:.*}", s.scoped(PermissionRead, pathScope("key"), s.handleGetKey)).Methods("GET")
+	api.HandleFunc("/keys/{key:.*}", s.scoped(PermissionWrite, pathScope("key"), s.handlePutKey)).Methods("PUT", "POST")
+	api.HandleFunc("/keys/{key:.*}", s.scoped(PermissionWrite, pathScope("key"), s.handleDeleteKey)).Methods("DELETE")
+	api.HandleFunc("/search", s.scoped(PermissionRead, rootScope, s.handleSearch)).Methods("POST")
+	api.HandleFunc("/stats", s.scoped(PermissionRead, rootScope, s.handleStats)).Methods("GET")
+	api.HandleFunc("/clear", s.scoped(PermissionAdmin, rootScope, s.handleClear)).Methods("DELETE")
+
+	// JQ queries
+	api.HandleFunc("/query", s.scoped(PermissionRead, anyScope, s.handleJQQuery)).Methods("POST")
+	api.HandleFunc("/query/aggregate", s.scoped(PermissionRead, anyScope, s.handleJQAggregate)).Methods("POST")
+
+	// Transactions
+	api.HandleFunc("/txn", s.scoped(PermissionWrite, anyScope, s.handleBeginTxn)).Methods("POST")
+	api.HandleFunc("/txn/{id}/keys", s.scoped(PermissionRead, queryScope("prefix"), s.handleTxnListKeys)).Methods("GET")
+	api.HandleFunc("/txn/{id}/keys/{key:.*}", s.scoped(PermissionRead, pathScope("key"), s.handleTxnGetKey)).Methods("GET")
+	api.HandleFunc("/txn/{id}/keys/{key:.*}", s.scoped(PermissionWrite, pathScope("key"), s.handleTxnPutKey)).Methods("PUT", "POST")
+	api.HandleFunc("/txn/{id}/keys/{key:.*}", s.scoped(PermissionWrite, pathScope("key"), s.handleTxnDeleteKey)).Methods("DELETE")
+	api.HandleFunc("/txn/{id}/commit", s.scoped(PermissionWrite, anyScope, s.handleCommitTxn)).Methods("POST")
+	api.HandleFunc("/txn/{id}/discard", s.scoped(PermissionWrite, anyScope, s.handleDiscardTxn)).Methods("POST")
+
+	// Key-space schemas
+	api.HandleFunc("/schemas", s.scoped(PermissionRead, queryScope("key"), s.handleListSchemas)).Methods("GET")
+	api.HandleFunc("/schemas", s.scoped(PermissionAdmin, rootScope, s.handleRegisterSchema)).Methods("POST")
+	api.HandleFunc("/schemas/validate", s.scoped(PermissionRead, anyScope, s.handleValidateValue)).Methods("POST")
+	api.HandleFunc("/schemas/{name}", s.scoped(PermissionAdmin, rootScope, s.handleRemoveSchema)).Methods("DELETE")
+
+	// Views
+	api.HandleFunc("/views", s.scoped(PermissionRead, rootScope, s.handleListViews)).Methods("GET")
+	api.HandleFunc("/views", s.scoped(PermissionAdmin, rootScope, s.handleCreateView)).Methods("POST")
+	api.HandleFunc("/views/{id}", s.scoped(PermissionRead, rootScope, s.handleGetView)).Methods("GET")
+	api.HandleFunc("/views/{id}", s.scoped(PermissionAdmin, rootScope, s.handleUpdateView)).Methods("PUT")
+	api.HandleFunc("/views/{id}", s.scoped(PermissionAdmin, rootScope, s.handleDeleteView)).Methods("DELETE")
+	api.HandleFunc("/views/{id}/execute", s.scoped(PermissionRead, rootScope, s.handleExecuteView)).Methods("POST")
+	api.HandleFunc("/views/{id}/refresh", s.scoped(PermissionAdmin, rootScope, s.handleRefreshView)).Methods("POST")
+	api.HandleFunc("/views/refresh", s.scoped(PermissionAdmin, rootScope, s.handleRefreshAllViews)).Methods("POST")
+	api.HandleFunc("/views/{id}/stats", s.scoped(PermissionRead, rootScope, s.handleViewStats)).Methods("GET")
+
+	// Secondary indexes
+	api.HandleFunc("/indexes", s.scoped(PermissionRead, anyScope, s.handleListIndexes)).Methods("GET")
+	api.HandleFunc("/indexes", s.scoped(PermissionAdmin, rootScope, s.handleCreateIndex)).Methods("POST")
+	api.HandleFunc("/indexes/{name}", s.scoped(PermissionAdmin, rootScope, s.handleDropIndex)).Methods("DELETE")
+	api.HandleFunc("/indexes/{name}/rebuild", s.scoped(PermissionAdmin, rootScope, s.handleRebuildIndex)).Methods("POST")
+	api.HandleFunc("/indexes/{name}/lookup", s.scoped(PermissionRead, rootScope, s.handleLookupIndex)).Methods("GET")
+	api.HandleFunc("/indexes/{name}/range", s.scoped(PermissionRead, rootScope, s.handleRangeIndex)).Methods("GET")
+
+	// Transform operations
+	api.HandleFunc("/transform", s.scoped(PermissionWrite, anyScope, s.handleTransform)).Methods("POST")
+	api.HandleFunc("/transform/jq", s.scoped(PermissionWrite, anyScope, s.handleTransformJQ)).Methods("POST")
+	api.HandleFunc("/transform/patch", s.scoped(PermissionWrite, anyScope, s.handleTransformPatch)).Methods("POST")
+	api.HandleFunc("/transform/js", s.scoped(PermissionWrite, anyScope, s.handleTransformJS)).Methods("POST")
+	api.HandleFunc("/transform/journal", s.scoped(PermissionAdmin, rootScope, s.handleListTransformJournals)).Methods("GET")
+	api.HandleFunc("/transform/journal/{id}/revert", s.scoped(PermissionAdmin, rootScope, s.handleRevertTransform)).Methods("POST")
+	api.HandleFunc("/transform/journal/{id}", s.scoped(PermissionAdmin, rootScope, s.handleDeleteTransformJournal)).Methods("DELETE")
+	api.HandleFunc("/transform/jobs", s.scoped(PermissionWrite, anyScope, s.handleListTransformJobs)).Methods("GET")
+	api.HandleFunc("/transform/jobs", s.scoped(PermissionWrite, anyScope, s.handleStartTransformJob)).Methods("POST")
+	api.HandleFunc("/transform/jobs/{id}", s.scoped(PermissionWrite, anyScope, s.handleGetTransformJob)).Methods("GET")
+	api.HandleFunc("/transform/jobs/{id}", s.scoped(PermissionAdmin, rootScope, s.handleDeleteTransformJob)).Methods("DELETE")
+	api.HandleFunc("/transform/jobs/{id}/cancel", s.scoped(PermissionWrite, anyScope, s.handleCancelTransformJob)).Methods("POST")
+	api.HandleFunc("/transform/jobs/{id}/resume", s.scoped(PermissionWrite, anyScope, s.handleResumeTransformJob)).Methods("POST")
+	api.HandleFunc("/transform/jobs/{id}/throttle", s.scoped(PermissionWrite, anyScope, s.handleThrottleTransformJob)).Methods("POST")
+
+	// TTL operations
+	api.HandleFunc("/ttl/stats", s.scoped(PermissionRead, queryScope("prefix"), s.handleTTLStats)).Methods("GET")
+	api.HandleFunc("/ttl/keys", s.scoped(PermissionRead, queryScope("prefix"), s.handleTTLKeys)).Methods("GET")
+	api.HandleFunc("/ttl/cleanup", s.scoped(PermissionAdmin, rootScope, s.handleTTLCleanup)).Methods("DELETE")
+	api.HandleFunc("/ttl/batch", s.scoped(PermissionWrite, anyScope, s.handleSetTTLBatch)).Methods("POST")
+	api.HandleFunc("/ttl/policies", s.scoped(PermissionRead, queryScope("key"), s.handleListTTLPolicies)).Methods("GET")
+	api.HandleFunc("/ttl/policies", s.scoped(PermissionAdmin, anyScope, s.handleSetTTLPolicy)).Methods("POST")
+	api.HandleFunc("/ttl/policies/{prefix:.*}", s.scoped(PermissionAdmin, pathScope("prefix"), s.handleRemoveTTLPolicy)).Methods("DELETE")
+	api.HandleFunc("/ttl/{key:.*}/extend", s.scoped(PermissionWrite, pathScope("key"), s.handleExtendTTL)).Methods("POST")
+	api.HandleFunc("/ttl/{key:.*}/refresh", s.scoped(PermissionWrite, pathScope("key"), s.handleRefreshTTL)).Methods("POST")
+
+	// Streaming
+	api.HandleFunc("/stream", s.scoped(PermissionRead, queryScope("prefix"), s.handleStream)).Methods("GET")
+	api.HandleFunc("/stream/events", s.scoped(PermissionSubscribe, rootScope, s.handleStreamEvents)).Methods("GET")
+	api.HandleFunc("/stream/json", s.scoped(PermissionRead, queryScope("prefix"), s.handleStreamJSON)).Methods("GET")
+	api.HandleFunc("/stream/jsonl", s.scoped(PermissionRead, queryScope("prefix"), s.handleStreamJSONL)).Methods("GET")
+	api.HandleFunc("/stream/csv", s.scoped(PermissionRead, queryScope("prefix"), s.handleStreamCSV)).Methods("GET")
+	api.HandleFunc("/stream/sse", s.scoped(PermissionSubscribe, rootScope, s.handleStreamSSE)).Methods("GET")
+	api.HandleFunc("/ws", s.scoped(PermissionSubscribe, anyScope, s.handleWebSocket)).Methods("GET")
+
+	// Batch operations
+	api.HandleFunc("/batch", s.scoped(PermissionWrite, anyScope, s.handleBatch)).Methods("POST")
+
+	// Subscriptions
+	api.HandleFunc("/subscriptions", s.scoped(PermissionAdmin, rootScope, s.handleListSubscriptions)).Methods("GET")
+	api.HandleFunc("/subscriptions", s.scoped(PermissionAdmin, rootScope, s.handleCreateSubscription)).Methods("POST")
+	api.HandleFunc("/subscriptions/{id}", s.scoped(PermissionAdmin, rootScope, s.handleDeleteSubscription)).Methods("DELETE")
+
+	// Export/Import
+	api.HandleFunc("/export", s.scoped(PermissionRead, queryScope("prefix"), s.handleExport)).Methods("GET")
+	api.HandleFunc("/import", s.scoped(PermissionWrite, queryScope("prefix"), s.handleImport)).Methods("POST")
+
+	// System operations
+	api.HandleFunc("/system/mode", s.scoped(PermissionAdmin, rootScope, s.handleSetMode)).Methods("POST")
+	api.HandleFunc("/system/gc", s.scoped(PermissionAdmin, rootScope, s.handleGC)).Methods("POST")
+	api.HandleFunc("/system/backup", s.scoped(PermissionAdmin, rootScope, s.handleBackup)).Methods("GET")
+	api.HandleFunc("/system/restore", s.scoped(PermissionAdmin, rootScope, s.handleRestore)).Methods("POST")
+
+	// Tokens
+	api.HandleFunc("/system/tokens", s.scoped(PermissionAdmin, rootScope, s.handleListTokens)).Methods("GET")
+	api.HandleFunc("/system/tokens", s.scoped(PermissionAdmin, rootScope, s.handleCreateToken)).Methods("POST")
+	api.HandleFunc("/system/tokens/{id}", s.scoped(PermissionAdmin, rootScope, s.handleRevokeToken)).Methods("DELETE")
+	api.HandleFunc("/system/whoami", s.handleWhoAmI).Methods("GET")
+
+	// Metrics endpoint
+	if s.metrics != nil {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
+
+	// Documentation
+	api.HandleFunc("/docs", s.handleDocs).Methods("GET")
+	api.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET")
+
+	// Root redirect
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/api/v1/docs", http.StatusTemporaryRedirect)
+		} else {
+			s.sendErrorResponse(w, r, "Эндпоинт не найден", http.StatusNotFound)
+		}
+	})
+}
+
+// Middleware
+
+func (s *APIServer) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				s.logger.Printf("PANIC: %v", err)
+				if s.metrics != nil {
+					s.metrics.ErrorsTotal.Inc()
+				}
+				s.sendErrorResponse(w, r, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = fmt.Sprintf("%d", time.Now().UnixNano())
+		}
+		ctx := context.WithValue(r.Context(), "request_id", requestID)
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.EnableCORS {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-Match, If-None-Match")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, "+SnapshotVersionHeader+", "+ExportProcessedHeader+", "+ExportSkippedHeader)
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.EnableAuth {
+			// Skip auth for health check and metrics
+			if r.URL.Path == "/api/v1/health" || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := s.authenticate(r)
+			if err != nil {
+				s.sendErrorResponse(w, r, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.metrics != nil {
+			start := time.Now()
+			s.metrics.RequestsTotal.Inc()
+			s.metrics.ActiveConnections.Inc()
+
+			defer func() {
+				s.metrics.ActiveConnections.Dec()
+				s.metrics.RequestDuration.Observe(time.Since(start).Seconds())
+			}()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.config.EnableCompression || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" ||
+			!strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter сжимает тело ответа. Решение принимается при записи
+// заголовка: частичные ответы, ответы без тела и с собственным
+// Content-Encoding или уже сжатым Content-Type отдаются как есть.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		gw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	gw.wroteHeader = true
+
+	h := gw.Header()
+	h.Add("Vary", "Accept-Encoding")
+	contentType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if code != http.StatusNoContent && code != http.StatusNotModified && code != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" && contentType != "application/gzip" && contentType != "application/zip" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !gw.wroteHeader {
+		// Тип определяется по несжатым данным, иначе net/http увидит gzip
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(p)
+	}
+	return gw.ResponseWriter.Write(p)
+}
+
+// Flush отдает клиенту уже сжатые данные потоковых ответов
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz != nil {
+		_ = gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+func (gw *gzipResponseWriter) close() {
+	if gw.gz != nil {
+		_ = gw.gz.Close()
+	}
+}
+
+func (s *APIServer) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Создаем wrapper для ResponseWriter чтобы захватить статус
+		wrapper := &responseWrapper{ResponseWriter: w, status: 200}
+
+		next.ServeHTTP(wrapper, r)
+
+		duration := time.Since(start)
+		requestID := r.Context().Value("request_id")
+
+		if s.config.EnableStructuredLogs {
+			s.logger.Printf(`{"method":"%s","path":"%s","status":%d,"duration":"%v","request_id":"%v","remote_addr":"%s"}`,
+				r.Method, r.URL.Path, wrapper.status, duration, requestID, r.RemoteAddr)
+		} else {
+			s.logger.Printf("%s %s %d %v %v", r.Method, r.URL.Path, wrapper.status, duration, requestID)
+		}
+	})
+}
+
+type responseWrapper struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWrapper) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (rw *responseWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush пробрасывает http.Flusher для потоковых ответов
+func (rw *responseWrapper) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack пробрасывает http.Hijacker для WebSocket
+func (rw *responseWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// Response helpers
+
+func (s *APIServer) sendResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+	s.sendResponseWithMessage(w, r, data, "", http.StatusOK)
+}
+
+func (s *APIServer) sendResponseWithMessage(w http.ResponseWriter, r *http.Request, data interface{}, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	requestID := r.Context().Value("request_id")
+	response := APIResponse{
+		Success:   statusCode < 400,
+		Data:      data,
+		Message:   message,
+		RequestID: fmt.Sprintf("%v", requestID),
+		Timestamp: time.Now(),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *APIServer) sendErrorResponse(w http.ResponseWriter, r *http.Request, error string, statusCode int) {
+	if s.metrics != nil {
+		s.metrics.ErrorsTotal.Inc()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	requestID := r.Context().Value("request_id")
+	response := APIResponse{
+		Success:   false,
+		Error:     error,
+		RequestID: fmt.Sprintf("%v", requestID),
+		Timestamp: time.Now(),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendStoreError отвечает на ошибку записи: нарушение схемы - 422 с
+// перечнем нарушений в data, несовпадение ETag - 412 с текущим ETag,
+// конфликт транзакции - 409, остальное - с кодом statusCode.
+func (s *APIServer) sendStoreError(w http.ResponseWriter, r *http.Request, prefix string, err error, statusCode int) {
+	var verr *SchemaValidationError
+	var perr *PreconditionFailedError
+	var data error
+	switch {
+	case errors.As(err, &verr):
+		statusCode = http.StatusUnprocessableEntity
+		data = verr
+	case errors.As(err, &perr):
+		statusCode = http.StatusPreconditionFailed
+		data = perr
+		if perr.ETag != "" {
+			w.Header().Set("ETag", quoteETag(perr.ETag))
+		}
+	case errors.Is(err, ErrTxnConflict):
+		s.sendErrorResponse(w, r, fmt.Sprintf("%s: %v", prefix, err), http.StatusConflict)
+		return
+	default:
+		s.sendErrorResponse(w, r, fmt.Sprintf("%s: %v", prefix, err), statusCode)
+		return
+	}
+
+	s.sendErrorWithData(w, r, data.Error(), data, statusCode)
+}
+
+// sendErrorWithData отправляет ошибку с подробностями в data.
+func (s *APIServer) sendErrorWithData(w http.ResponseWriter, r *http.Request, message string, data interface{}, statusCode int) {
+	if s.metrics != nil {
+		s.metrics.ErrorsTotal.Inc()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:   false,
+		Data:      data,
+		Error:     message,
+		RequestID: fmt.Sprintf("%v", r.Context().Value("request_id")),
+		Timestamp: time.Now(),
+	})
+}
+
+// storeErrorStatus возвращает HTTP код ошибки записи с теми же правилами,
+// что и sendStoreError.
+func storeErrorStatus(err error, statusCode int) int {
+	var verr *SchemaValidationError
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrTxnConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrBatchTooBig):
+		return http.StatusRequestEntityTooLarge
+	}
+	return statusCode
+}
+
+// Request helpers
+
+func (s *APIServer) parseJSONBody(r *http.Request, target interface{}) error {
+	if r.ContentLength > s.config.MaxRequestSize {
+		return fmt.Errorf("тело запроса слишком большое")
+	}
+
+	body := http.MaxBytesReader(nil, r.Body, s.config.MaxRequestSize)
+	return json.NewDecoder(body).Decode(target)
+}
+
+func (s *APIServer) getContextWithTimeout(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), s.config.RequestTimeout)
+}
+
+// Handlers implementation
+
+func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	// Проверяем состояние датастора
+	testKey := ds.NewKey("/_health_check")
+	testValue := []byte("test")
+
+	if err := s.ds.Put(ctx, testKey, testValue); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка записи в датастор: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.ds.Delete(ctx, testKey); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления из датастора: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"status":    "healthy",
+		"timestamp": time.Now().Format(time.RFC3339),
+		"version":   "1.0.0",
+		"uptime":    time.Since(time.Now()).String(), // В реальности нужно сохранить время запуска
+	})
+}
+
+func (s *APIServer) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	keysOnly := q.Get("keys_only") == "true"
+	reverse := q.Get("reverse") == "true"
+	limit := 0
+	if limitStr := q.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	filter := cursorFilter("keys", prefix, q.Get("start"), q.Get("end"), strconv.FormatBool(reverse), strconv.FormatBool(keysOnly))
+	page, err := newPager(limit, q.Get("cursor"), filter)
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("list_keys", "started").Inc()
+	}
+
+	opts := ScanOptions{Prefix: ds.NewKey(prefix), Reverse: reverse, KeysOnly: keysOnly}
+	opts.Start, opts.End = page.bounds(rangeKey(q.Get("start")), rangeKey(q.Get("end")), reverse)
+
+	// Отмена останавливает чтение badger после заполнения страницы
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	kvChan, errChan, err := s.ds.Scan(scanCtx, opts)
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.DatastoreOperations.WithLabelValues("list_keys", "error").Inc()
+		}
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания итератора: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	keys := []interface{}{}
+	sendPage := func() {
+		if s.metrics != nil {
+			s.metrics.DatastoreOperations.WithLabelValues("list_keys", "success").Inc()
+		}
+		s.sendResponse(w, r, APIListKeysResponse{
+			Keys:       keys,
+			Total:      len(keys),
+			Truncated:  page.truncated(),
+			NextCursor: page.next,
+		})
+	}
+
+	for {
+		select {
+		case kv, ok := <-kvChan:
+			if !ok {
+				sendPage()
+				return
+			}
+
+			include, done := page.accept(kv.Key.String())
+			if done {
+				sendPage()
+				return
+			}
+			if !include {
+				continue
+			}
+
+			if keysOnly {
+				keys = append(keys, kv.Key.String())
+			} else {
+				keys = append(keys, keyValueEntry(kv.Key.String(), kv.Value))
+			}
+
+		case err := <-errChan:
+			if err != nil {
+				if s.metrics != nil {
+					s.metrics.DatastoreOperations.WithLabelValues("list_keys", "error").Inc()
+				}
+				s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка итерации: %v", err), http.StatusInternalServerError)
+				return
+			}
+		case <-ctx.Done():
+			if s.metrics != nil {
+				s.metrics.DatastoreOperations.WithLabelValues("list_keys", "timeout").Inc()
+			}
+			s.sendErrorResponse(w, r, "Таймаут запроса", http.StatusRequestTimeout)
+			return
+		}
+	}
+}
+
+// rangeKey - граница диапазона из параметра запроса, пустая - без границы.
+func rangeKey(key string) ds.Key {
+	if key == "" {
+		return ds.Key{}
+	}
+	return ds.NewKey(key)
+}
+
+func (s *APIServer) handleGetKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("get", "started").Inc()
+	}
+
+	dsKey := ds.NewKey(key)
+	data, etag, err := s.ds.GetWithETag(ctx, dsKey)
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.DatastoreOperations.WithLabelValues("get", "error").Inc()
+		}
+		if err == ds.ErrNotFound {
+			s.sendErrorResponse(w, r, "Ключ не найден", http.StatusNotFound)
+		} else {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения ключа: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("get", "success").Inc()
+	}
+
+	w.Header().Set("ETag", quoteETag(etag))
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	mediaType, err := s.ds.GetContentType(ctx, dsKey)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения ключа: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if wantsRawValue(r, mediaType) {
+		writeRawValue(w, r, data, mediaType)
+		return
+	}
+
+	value, encoding := encodeValue(data, r.URL.Query().Get("format") == "base64")
+	s.sendResponse(w, r, APIKeyInfo{
+		Key:         key,
+		Value:       value,
+		Encoding:    encoding,
+		Size:        len(data),
+		ContentType: valueKind(data),
+		MediaType:   mediaType,
+		ETag:        etag,
+	})
+}
+
+func (s *APIServer) handlePutKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := s.readPutBody(w, r)
+	if !ok {
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("put", "started").Inc()
+	}
+
+	opts := PutOptions{
+		ContentType:     body.contentType,
+		KeepContentType: body.keepContentType,
+		TTL:             body.ttl,
+		IfMatch:         r.Header.Get("If-Match"),
+		IfNoneMatch:     r.Header.Get("If-None-Match"),
+	}
+	switch {
+	case (opts.IfMatch != "" || opts.IfNoneMatch != "") && opts.TTL > 0:
+		s.sendErrorResponse(w, r, "Условная запись с TTL не поддерживается", http.StatusBadRequest)
+		return
+	case opts.IfMatch != "" && opts.IfNoneMatch != "":
+		s.sendErrorResponse(w, r, "Нельзя указывать If-Match и If-None-Match одновременно", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.PutWithOptions(ctx, ds.NewKey(key), body.value, opts); err != nil {
+		if s.metrics != nil {
+			s.metrics.DatastoreOperations.WithLabelValues("put", "error").Inc()
+		}
+		s.sendStoreError(w, r, "Ошибка сохранения ключа", err, http.StatusInternalServerError)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("put", "success").Inc()
+	}
+
+	message := "Ключ сохранен"
+	if opts.TTL > 0 {
+		message = fmt.Sprintf("Ключ сохранен с TTL %v", opts.TTL)
+	}
+
+	etag := ETag(body.value)
+	w.Header().Set("ETag", quoteETag(etag))
+	s.sendResponseWithMessage(w, r, map[string]string{"etag": etag}, message, http.StatusCreated)
+}
+
+// putBody - значение для записи с его типом и TTL.
+type putBody struct {
+	value           []byte
+	contentType     string
+	keepContentType bool
+	ttl             time.Duration
+}
+
+// readPutBody читает значение для записи: JSON {value, encoding,
+// content_type, keep_content_type, ttl} при Content-Type application/json,
+// иначе тело целиком с типом из Content-Type без параметров, TTL из ?ttl= и
+// ?keep_content_type=true.
+func (s *APIServer) readPutBody(w http.ResponseWriter, r *http.Request) (putBody, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxRequestSize))
+	if err != nil {
+		s.sendErrorResponse(w, r, "Ошибка чтения тела запроса", http.StatusBadRequest)
+		return putBody{}, false
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil && contentType != "" {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Неверный Content-Type: %v", err), http.StatusBadRequest)
+		return putBody{}, false
+	}
+	if mediaType != "application/json" {
+		// Тип формы выставляют клиенты вроде curl -d по умолчанию, он не
+		// описывает значение
+		if mediaType == "application/x-www-form-urlencoded" {
+			mediaType = ""
+		}
+		body := putBody{
+			value:           data,
+			contentType:     mediaType,
+			keepContentType: r.URL.Query().Get("keep_content_type") == "true",
+		}
+		if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
+			if t, err := time.ParseDuration(ttlStr); err == nil {
+				body.ttl = t
+			}
+		}
+		return body, true
+	}
+
+	var req APIPutRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return putBody{}, false
+	}
+	if _, _, err := mime.ParseMediaType(req.ContentType); err != nil && req.ContentType != "" {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Неверный content_type: %v", err), http.StatusBadRequest)
+		return putBody{}, false
+	}
+	value, err := decodeValue(req.Value, req.Encoding)
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return putBody{}, false
+	}
+	return putBody{value: value, contentType: req.ContentType, keepContentType: req.KeepContentType, ttl: req.TTL}, true
+}
+
+func (s *APIServer) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("delete", "started").Inc()
+	}
+
+	dsKey := ds.NewKey(key)
+	var err error
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		err = s.ds.DeleteIfMatch(ctx, dsKey, ifMatch)
+	} else {
+		err = s.ds.Delete(ctx, dsKey)
+	}
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.DatastoreOperations.WithLabelValues("delete", "error").Inc()
+		}
+		s.sendStoreError(w, r, "Ошибка удаления ключа", err, http.StatusInternalServerError)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.DatastoreOperations.WithLabelValues("delete", "success").Inc()
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Ключ удален", http.StatusOK)
+}
+
+func (s *APIServer) handleKeyInfo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	dsKey := ds.NewKey(key)
+
+	exists, err := s.ds.Has(ctx, dsKey)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка проверки ключа: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		s.sendErrorResponse(w, r, "Ключ не найден", http.StatusNotFound)
+		return
+	}
+
+	data, err := s.ds.Get(ctx, dsKey)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения данных: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var ttlInfo string
+	// badger возвращает для ключа без TTL начало эпохи
+	if expiration, err := s.ds.GetExpiration(ctx, dsKey); err == nil && expiration.Unix() > 0 {
+		remaining := time.Until(expiration)
+		if remaining > 0 {
+			ttlInfo = remaining.String()
+		} else {
+			ttlInfo = "expired"
+		}
+	}
+
+	mediaType, err := s.ds.GetContentType(ctx, dsKey)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения данных: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	value, encoding := encodeValue(data, r.URL.Query().Get("format") == "base64")
+	keyInfo := map[string]interface{}{
+		"key":          key,
+		"value":        value,
+		"size":         len(data),
+		"content_type": valueKind(data),
+		"ttl":          ttlInfo,
+		"etag":         ETag(data),
+		"metadata":     make(map[string]string),
+	}
+
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	metadata := make(map[string]string)
+	for i, part := range parts {
+		if part != "" {
+			metadata[fmt.Sprintf("key_part_%d", i)] = part
+		}
+	}
+	keyInfo["metadata"] = metadata
+	if encoding != "" {
+		keyInfo["encoding"] = encoding
+	}
+	if mediaType != "" {
+		keyInfo["media_type"] = mediaType
+	}
+
+	if schemas := s.ds.SchemasFor(dsKey); len(schemas) > 0 {
+		var violations []SchemaViolation
+		var verr *SchemaValidationError
+		if err := s.ds.ValidateValue(dsKey, data); errors.As(err, &verr) {
+			violations = verr.Violations
+		}
+		schemaInfo := make([]map[string]interface{}, 0, len(schemas))
+		for _, schema := range schemas {
+			own := []SchemaViolation{}
+			for _, v := range violations {
+				if v.Schema == schema.Name {
+					own = append(own, v)
+				}
+			}
+			schemaInfo = append(schemaInfo, map[string]interface{}{
+				"name":       schema.Name,
+				"pattern":    schema.Pattern,
+				"valid":      len(own) == 0,
+				"violations": own,
+			})
+		}
+		keyInfo["schemas"] = schemaInfo
+	}
+
+	s.sendResponse(w, r, keyInfo)
+}
+
+func (s *APIServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req SearchRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		s.sendErrorResponse(w, r, "Требуется поисковый запрос", http.StatusBadRequest)
+		return
+	}
+
+	filter := cursorFilter("search", req.Query, strconv.FormatBool(req.CaseSensitive), strconv.FormatBool(req.KeysOnly),
+		req.Start, req.End, strconv.FormatBool(req.Reverse))
+	page, err := newPager(req.Limit, req.Cursor, filter)
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	searchStr := req.Query
+	if !req.CaseSensitive {
+		searchStr = strings.ToLower(searchStr)
+	}
+
+	opts := ScanOptions{Prefix: ds.NewKey("/"), Reverse: req.Reverse, KeysOnly: req.KeysOnly}
+	opts.Start, opts.End = page.bounds(rangeKey(req.Start), rangeKey(req.End), req.Reverse)
+
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	kvChan, errChan, err := s.ds.Scan(scanCtx, opts)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания итератора: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	results := []interface{}{}
+	total := 0
+	sendPage := func() {
+		s.sendResponse(w, r, APISearchResponse{
+			Results:    results,
+			Found:      len(results),
+			Total:      total,
+			Truncated:  page.truncated(),
+			NextCursor: page.next,
+		})
+	}
+
+	for {
+		select {
+		case kv, ok := <-kvChan:
+			if !ok {
+				sendPage()
+				return
+			}
+
+			total++
+			keyStr := kv.Key.String()
+			searchKey := keyStr
+
+			if !req.CaseSensitive {
+				searchKey = strings.ToLower(searchKey)
+			}
+
+			if !strings.Contains(searchKey, searchStr) {
+				continue
+			}
+
+			include, done := page.accept(keyStr)
+			if done {
+				sendPage()
+				return
+			}
+			if !include {
+				continue
+			}
+
+			if req.KeysOnly {
+				results = append(results, keyStr)
+			} else {
+				results = append(results, keyValueEntry(keyStr, kv.Value))
+			}
+
+		case err := <-errChan:
+			if err != nil {
+				s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка итерации: %v", err), http.StatusInternalServerError)
+				return
+			}
+		case <-ctx.Done():
+			s.sendErrorResponse(w, r, "Таймаут запроса", http.StatusRequestTimeout)
+			return
+		}
+	}
+}
+
+func (s *APIServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	keysChan, errChan, err := s.ds.Keys(ctx, ds.NewKey("/"))
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения ключей: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	totalKeys := 0
+	for {
+		select {
+		case _, ok := <-keysChan:
+			if !ok {
+				goto countDone
+			}
+			totalKeys++
+		case err := <-errChan:
+			if err != nil {
+				s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка подсчета ключей: %v", err), http.StatusInternalServerError)
+				return
+			}
+		case <-ctx.Done():
+			s.sendErrorResponse(w, r, "Таймаут запроса", http.StatusRequestTimeout)
+			return
+		}
+	}
+
+countDone:
+	kvChan, errChan2, err := s.ds.Iterator(ctx, ds.NewKey("/"), false)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания итератора: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var totalSize int64
+	for {
+		select {
+		case kv, ok := <-kvChan:
+			if !ok {
+				goto sizeDone
+			}
+			totalSize += int64(len(kv.Value))
+		case err := <-errChan2:
+			if err != nil {
+				s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка подсчета размера: %v", err), http.StatusInternalServerError)
+				return
+			}
+		case <-ctx.Done():
+			s.sendErrorResponse(w, r, "Таймаут запроса", http.StatusRequestTimeout)
+			return
+		}
+	}
+
+sizeDone:
+	var avgSize int64
+	if totalKeys > 0 {
+		avgSize = totalSize / int64(totalKeys)
+	}
+
+	// Обновляем метрики
+	if s.metrics != nil {
+		s.metrics.DatastoreSize.Set(float64(totalSize))
+		s.metrics.DatastoreKeys.Set(float64(totalKeys))
+	}
+
+	stats := map[string]interface{}{
+		"total_keys":         totalKeys,
+		"total_size_bytes":   totalSize,
+		"total_size_human":   formatBytes(totalSize),
+		"average_size":       avgSize,
+		"average_size_human": formatBytes(avgSize),
+		"timestamp":          time.Now().Format(time.RFC3339),
+	}
+
+	s.sendResponse(w, r, stats)
+}
+
+func (s *APIServer) handleClear(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if r.URL.Query().Get("confirm") != "true" {
+		s.sendErrorResponse(w, r, "Требуется параметр ?confirm=true для подтверждения", http.StatusBadRequest)
+		return
+	}
+
+	err := s.ds.Clear(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка очистки: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Датастор очищен", http.StatusOK)
+}
+
+// JQ Query handlers
+
+func (s *APIServer) handleJQQuery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req JQQueryRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		s.sendErrorResponse(w, r, "Требуется JQ запрос", http.StatusBadRequest)
+		return
+	}
+
+	prefix := ds.NewKey("/")
+	if req.Prefix != "" {
+		prefix = ds.NewKey(req.Prefix)
+	}
+	if !s.authorize(w, r, PermissionRead, prefix) {
+		return
+	}
+
+	filter := cursorFilter("query", req.Query, prefix.String(), req.Start, req.End, strconv.FormatBool(req.Reverse),
+		strconv.FormatBool(req.KeysOnly), strconv.FormatBool(req.TreatAsString), strconv.FormatBool(req.IgnoreParseError))
+	page, err := newPager(req.Limit, req.Cursor, filter)
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := &JQQueryOptions{
+		Prefix:           prefix,
+		Limit:            page.scanLimit(),
+		KeysOnly:         req.KeysOnly,
+		Reverse:          req.Reverse,
+		Timeout:          req.Timeout,
+		TreatAsString:    req.TreatAsString,
+		IgnoreParseError: req.IgnoreParseError,
+	}
+	opts.Start, opts.End = page.bounds(rangeKey(req.Start), rangeKey(req.End), req.Reverse)
+
+	queryCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	resultChan, errorChan, err := s.ds.QueryJQ(queryCtx, req.Query, opts)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка выполнения JQ запроса: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Stream || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		s.streamJQResults(ctx, w, page, resultChan, errorChan)
+		return
+	}
+
+	results := []map[string]interface{}{}
+	for result := range resultChan {
+		include, done := page.accept(result.Key.String())
+		if done {
+			stop()
+			break
+		}
+		if include {
+			results = append(results, map[string]interface{}{
+				"key":   result.Key.String(),
+				"value": result.Value,
+			})
+		}
+	}
+
+	if !page.truncated() {
+		if err := <-errorChan; err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				s.sendErrorResponse(w, r, "Таймаут запроса", http.StatusRequestTimeout)
+				return
+			}
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка JQ запроса: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.sendResponse(w, r, APIJQQueryResponse{
+		Results:    results,
+		Total:      len(results),
+		Truncated:  page.truncated(),
+		NextCursor: page.next,
+	})
+}
+
+// streamJQResults пишет результаты jq-запроса в формате NDJSON по мере
+// поступления. Ошибка, возникшая после начала ответа, передается последней
+// строкой {"error": "..."}, курсор неполной выборки - строкой
+// {"next_cursor": "..."}.
+func (s *APIServer) streamJQResults(ctx context.Context, w http.ResponseWriter, page *pager, results <-chan JQResult, errc <-chan error) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for result := range results {
+		include, done := page.accept(result.Key.String())
+		if done {
+			encoder.Encode(map[string]interface{}{"next_cursor": page.next})
+			return
+		}
+		if !include {
+			continue
+		}
+		if err := encoder.Encode(map[string]interface{}{
+			"key":   result.Key.String(),
+			"value": result.Value,
+		}); err != nil {
+			s.logger.Printf("Ошибка записи NDJSON: %v", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := <-errc; err != nil {
+		encoder.Encode(map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func (s *APIServer) handleJQAggregate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req APIJQAggregateRequest
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		s.sendErrorResponse(w, r, "Требуется JQ запрос", http.StatusBadRequest)
+		return
+	}
+
+	prefix := ds.NewKey("/")
+	if req.Prefix != "" {
+		prefix = ds.NewKey(req.Prefix)
+	}
+	if !s.authorize(w, r, PermissionRead, prefix) {
+		return
+	}
+
+	opts := &JQQueryOptions{
+		Prefix:           prefix,
+		Timeout:          req.Timeout,
+		TreatAsString:    req.TreatAsString,
+		IgnoreParseError: req.IgnoreParseError,
+	}
+
+	result, err := s.ds.AggregateJQ(ctx, req.Query, opts)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка выполнения JQ агрегации: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"result": result,
+	})
+}
+
+func (s *APIServer) handleJQSingle(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	if key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Query string `json:"query"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		s.sendErrorResponse(w, r, "Требуется JQ запрос", http.StatusBadRequest)
+		return
+	}
+
+	dsKey := ds.NewKey(key)
+	result, err := s.ds.QueryJQSingle(ctx, dsKey, req.Query)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка выполнения JQ запроса: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"key":    key,
+		"result": result,
+	})
+}
+
+// Views handlers
+
+func (s *APIServer) handleListViews(w http.ResponseWriter, r *http.Request) {
+	views := s.ds.ListViews()
+	viewData := make([]map[string]interface{}, len(views))
+
+	for i, view := range views {
+		config := view.Config()
+		stats := view.Stats()
+		viewData[i] = map[string]interface{}{
+			"id":     config.ID,
+			"name":   config.Name,
+			"config": config,
+			"stats":  stats,
+		}
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"views": viewData,
+		"total": len(views),
+	})
+}
+
+func (s *APIServer) handleCreateView(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var config ViewConfig
+	if err := s.parseJSONBody(r, &config); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	view, err := s.ds.CreateView(ctx, config)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"id":     view.ID(),
+		"config": view.Config(),
+	}, "View создан", http.StatusCreated)
+}
+
+func (s *APIServer) handleGetView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	view, exists := s.ds.GetView(id)
+	if !exists {
+		s.sendErrorResponse(w, r, "View не найден", http.StatusNotFound)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"id":     view.ID(),
+		"config": view.Config(),
+		"stats":  view.Stats(),
+	})
+}
+
+func (s *APIServer) handleUpdateView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	view, exists := s.ds.GetView(id)
+	if !exists {
+		s.sendErrorResponse(w, r, "View не найден", http.StatusNotFound)
+		return
+	}
+
+	var config ViewConfig
+	if err := s.parseJSONBody(r, &config); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	config.ID = id // ID не может быть изменен
+	if err := view.UpdateConfig(config); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка обновления view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"id":     view.ID(),
+		"config": view.Config(),
+	}, "View обновлен", http.StatusOK)
+}
+
+func (s *APIServer) handleDeleteView(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := s.ds.RemoveView(ctx, id); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "View удален", http.StatusOK)
+}
+
+func (s *APIServer) handleExecuteView(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	q := r.URL.Query()
+	start := q.Get("start")
+	end := q.Get("end")
+	reverse := q.Get("reverse") == "true"
+	limit := 0
+	if limitStr := q.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	page, err := newPager(limit, q.Get("cursor"), cursorFilter("view", id, start, end, strconv.FormatBool(reverse)))
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var results []ViewResult
+	startKey, endKey := page.bounds(rangeKey(start), rangeKey(end), reverse)
+	if startKey.String() != "" || endKey.String() != "" {
+		results, err = s.ds.ExecuteViewWithRange(ctx, id, startKey, endKey)
+	} else {
+		results, err = s.ds.ExecuteView(ctx, id)
+	}
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка выполнения view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Курсор опирается на порядок ключей; результаты одного ключа
+	// сохраняют порядок view
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Key.String() < results[j].Key.String()
+	})
+
+	pageResults := []ViewResult{}
+	for i := range results {
+		result := results[i]
+		if reverse {
+			result = results[len(results)-1-i]
+		}
+		include, done := page.accept(result.Key.String())
+		if done {
+			break
+		}
+		if include {
+			pageResults = append(pageResults, result)
+		}
+	}
+
+	s.sendResponse(w, r, APIViewExecuteResponse{
+		Results:    pageResults,
+		Total:      len(pageResults),
+		Truncated:  page.truncated(),
+		NextCursor: page.next,
+	})
+}
+
+func (s *APIServer) handleRefreshView(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := s.ds.RefreshView(ctx, id); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка обновления view: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "View обновлен", http.StatusOK)
+}
+
+func (s *APIServer) handleRefreshAllViews(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if err := s.ds.RefreshAllViews(ctx); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка обновления views: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Все views обновлены", http.StatusOK)
+}
+
+func (s *APIServer) handleViewStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	stats, exists := s.ds.GetViewStats(id)
+	if !exists {
+		s.sendErrorResponse(w, r, "View не найден", http.StatusNotFound)
+		return
+	}
+
+	s.sendResponse(w, r, stats)
+}
+
+// Index handlers
+
+func (s *APIServer) handleListIndexes(w http.ResponseWriter, r *http.Request) {
+	indexes := s.ds.ListIndexes()
+	if token := requestToken(r); token != nil {
+		visible := indexes[:0]
+		for _, index := range indexes {
+			if token.Allows(PermissionRead, ds.NewKey(index.Prefix)) {
+				visible = append(visible, index)
+			}
+		}
+		indexes = visible
+	}
+	s.sendResponse(w, r, map[string]interface{}{
+		"indexes": indexes,
+		"total":   len(indexes),
+	})
+}
+
+func (s *APIServer) handleCreateIndex(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var config IndexConfig
+	if err := s.parseJSONBody(r, &config); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.CreateIndex(ctx, config); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания индекса: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, config, "Индекс создан", http.StatusCreated)
+}
+
+func (s *APIServer) handleDropIndex(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	name := mux.Vars(r)["name"]
+	if err := s.ds.DropIndex(ctx, name); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления индекса: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Индекс удален", http.StatusOK)
+}
+
+func (s *APIServer) handleRebuildIndex(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	name := mux.Vars(r)["name"]
+	if err := s.ds.RebuildIndex(ctx, name); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка перестроения индекса: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Индекс перестроен", http.StatusOK)
+}
+
+func (s *APIServer) handleLookupIndex(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	name := mux.Vars(r)["name"]
+	if !r.URL.Query().Has("value") {
+		s.sendErrorResponse(w, r, "Параметр value обязателен", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := s.ds.LookupIndex(ctx, name, r.URL.Query().Get("value"))
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка поиска по индексу: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result := make([]string, len(keys))
+	for i, key := range keys {
+		result[i] = key.String()
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"keys":  result,
+		"total": len(result),
+	})
+}
+
+func (s *APIServer) handleRangeIndex(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	name := mux.Vars(r)["name"]
+	var from, to any
+	if v := r.URL.Query().Get("from"); v != "" {
+		from = v
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		to = v
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	entries, err := s.ds.RangeIndex(ctx, name, from, to)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка поиска по индексу: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	truncated := false
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+		truncated = true
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"entries":   entries,
+		"total":     len(entries),
+		"truncated": truncated,
+	})
+}
+
+// Transaction handlers
+
+// serverTxn - транзакция датастора, открытая через POST /txn. Запросы к
+// одной транзакции выполняются последовательно; по истечении TTL она
+// откатывается автоматически. Транзакция доступна только токену, который
+// ее открыл.
+type serverTxn struct {
+	mu        sync.Mutex
+	txn       ds.Txn
+	readOnly  bool
+	owner     string
+	expiresAt time.Time
+	timer     *time.Timer
+	done      bool
+}
+
+type txnRegistry struct {
+	mu   sync.Mutex
+	txns map[string]*serverTxn
+}
+
+func (s *APIServer) handleBeginTxn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req APIBeginTxnRequest
+	if r.ContentLength != 0 {
+		if err := s.parseJSONBody(r, &req); err != nil {
+			s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = s.config.TxnTTL
+	}
+	if s.config.MaxTxnTTL > 0 && ttl > s.config.MaxTxnTTL {
+		ttl = s.config.MaxTxnTTL
+	}
+
+	s.txns.mu.Lock()
+	defer s.txns.mu.Unlock()
+
+	if s.config.MaxTransactions > 0 && len(s.txns.txns) >= s.config.MaxTransactions {
+		s.sendErrorResponse(w, r, "Слишком много открытых транзакций", http.StatusTooManyRequests)
+		return
+	}
+
+	txn, err := s.ds.NewTransaction(ctx, req.ReadOnly)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка открытия транзакции: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := newTxnID()
+	if err != nil {
+		txn.Discard(ctx)
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка открытия транзакции: %v", err), http.StatusInternalServerError)
+		return
+	}
+	st := &serverTxn{txn: txn, readOnly: req.ReadOnly, owner: txnOwner(r), expiresAt: time.Now().Add(ttl)}
+	st.timer = time.AfterFunc(ttl, func() {
+		if s.takeTxn(id) == st {
+			st.finish(context.Background())
+		}
+	})
+	s.txns.txns[id] = st
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"id":         id,
+		"read_only":  req.ReadOnly,
+		"expires_at": st.expiresAt,
+	}, "Транзакция открыта", http.StatusCreated)
+}
+
+// newTxnID - случайный 128-битный ID: по нему нельзя угадать чужую
+// транзакцию.
+func newTxnID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// txnOwner - ID токена запроса; пусто, если авторизация отключена.
+func txnOwner(r *http.Request) string {
+	if token := requestToken(r); token != nil {
+		return token.ID
+	}
+	return ""
+}
+
+// takeTxn удаляет транзакцию из реестра; после этого ее нельзя найти по ID.
+func (s *APIServer) takeTxn(id string) *serverTxn {
+	s.txns.mu.Lock()
+	defer s.txns.mu.Unlock()
+	st := s.txns.txns[id]
+	delete(s.txns.txns, id)
+	return st
+}
+
+// requestTxn находит транзакцию из пути запроса, с take - удаляя ее из
+// реестра. Ответ 410, если транзакции нет, и 404, если ее открыл другой
+// токен; в обоих случаях возвращается nil.
+func (s *APIServer) requestTxn(w http.ResponseWriter, r *http.Request, take bool) *serverTxn {
+	id := mux.Vars(r)["id"]
+
+	s.txns.mu.Lock()
+	st := s.txns.txns[id]
+	owned := st != nil && st.owner == txnOwner(r)
+	if owned && take {
+		delete(s.txns.txns, id)
+	}
+	s.txns.mu.Unlock()
+
+	switch {
+	case st == nil:
+		s.sendErrorResponse(w, r, "Транзакция не найдена или истекла", http.StatusGone)
+		return nil
+	case !owned:
+		s.sendErrorResponse(w, r, "Транзакция не найдена", http.StatusNotFound)
+		return nil
+	}
+	return st
+}
+
+// finish откатывает транзакцию, если она еще не завершена.
+func (st *serverTxn) finish(ctx context.Context) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		return
+	}
+	st.done = true
+	st.timer.Stop()
+	st.txn.Discard(ctx)
+}
+
+func (s *APIServer) discardAllTxns(ctx context.Context) {
+	s.txns.mu.Lock()
+	txns := s.txns.txns
+	s.txns.txns = make(map[string]*serverTxn)
+	s.txns.mu.Unlock()
+	for _, st := range txns {
+		st.finish(ctx)
+	}
+}
+
+// withTxn выполняет fn под блокировкой транзакции из пути запроса.
+// Ответ 410, если транзакция не найдена, уже завершена или истекла.
+func (s *APIServer) withTxn(w http.ResponseWriter, r *http.Request, fn func(st *serverTxn)) {
+	st := s.requestTxn(w, r, false)
+	if st == nil {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		s.sendErrorResponse(w, r, "Транзакция не найдена или истекла", http.StatusGone)
+		return
+	}
+	fn(st)
+}
+
+func (s *APIServer) handleTxnGetKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	key := mux.Vars(r)["key"]
+	s.withTxn(w, r, func(st *serverTxn) {
+		data, err := st.txn.Get(ctx, ds.NewKey(key))
+		if err == ds.ErrNotFound {
+			s.sendErrorResponse(w, r, "Ключ не найден", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения ключа: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if wantsRawValue(r, "") {
+			writeRawValue(w, r, data, "")
+			return
+		}
+
+		value, encoding := encodeValue(data, r.URL.Query().Get("format") == "base64")
+		s.sendResponse(w, r, APIKeyInfo{
+			Key:         key,
+			Value:       value,
+			Encoding:    encoding,
+			Size:        len(data),
+			ContentType: valueKind(data),
+			ETag:        ETag(data),
+		})
+	})
+}
+
+func (s *APIServer) handleTxnPutKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	key := mux.Vars(r)["key"]
+	body, ok := s.readPutBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.withTxn(w, r, func(st *serverTxn) {
+		if st.readOnly {
+			s.sendErrorResponse(w, r, "Транзакция открыта только для чтения", http.StatusBadRequest)
+			return
+		}
+		var err error
+		switch txn := st.txn.(type) {
+		case ContentTypeTxn:
+			err = txn.PutWithOptions(ctx, ds.NewKey(key), body.value, PutOptions{
+				ContentType:     body.contentType,
+				KeepContentType: body.keepContentType,
+				TTL:             body.ttl,
+				IfMatch:         r.Header.Get("If-Match"),
+				IfNoneMatch:     r.Header.Get("If-None-Match"),
+			})
+		case ds.TTL:
+			if body.ttl > 0 {
+				err = txn.PutWithTTL(ctx, ds.NewKey(key), body.value, body.ttl)
+				break
+			}
+			err = st.txn.Put(ctx, ds.NewKey(key), body.value)
+		default:
+			err = st.txn.Put(ctx, ds.NewKey(key), body.value)
+		}
+		if err != nil {
+			s.sendStoreError(w, r, "Ошибка сохранения ключа", err, http.StatusInternalServerError)
+			return
+		}
+		s.sendResponseWithMessage(w, r, nil, "Ключ записан в транзакцию", http.StatusOK)
+	})
+}
+
+func (s *APIServer) handleTxnDeleteKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	key := mux.Vars(r)["key"]
+	s.withTxn(w, r, func(st *serverTxn) {
+		if st.readOnly {
+			s.sendErrorResponse(w, r, "Транзакция открыта только для чтения", http.StatusBadRequest)
+			return
+		}
+		if err := st.txn.Delete(ctx, ds.NewKey(key)); err != nil {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления ключа: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.sendResponseWithMessage(w, r, nil, "Ключ удален в транзакции", http.StatusOK)
+	})
+}
+
+func (s *APIServer) handleTxnListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+	keysOnly := r.URL.Query().Get("keys_only") == "true"
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	s.withTxn(w, r, func(st *serverTxn) {
+		results, err := st.txn.Query(ctx, query.Query{Prefix: prefix, KeysOnly: keysOnly, Limit: limit})
+		if err != nil {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка запроса: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer results.Close()
+
+		keys := []interface{}{}
+		for res := range results.Next() {
+			if res.Error != nil {
+				s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка запроса: %v", res.Error), http.StatusInternalServerError)
+				return
+			}
+			if keysOnly {
+				keys = append(keys, res.Key)
+			} else {
+				keys = append(keys, keyValueEntry(res.Key, res.Value))
+			}
+		}
+
+		s.sendResponse(w, r, map[string]interface{}{
+			"keys":  keys,
+			"total": len(keys),
+		})
+	})
+}
+
+func (s *APIServer) handleCommitTxn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	st := s.requestTxn(w, r, true)
+	if st == nil {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		s.sendErrorResponse(w, r, "Транзакция не найдена или истекла", http.StatusGone)
+		return
+	}
+	st.done = true
+	st.timer.Stop()
+
+	if st.readOnly {
+		st.txn.Discard(ctx)
+		s.sendResponseWithMessage(w, r, nil, "Транзакция завершена", http.StatusOK)
+		return
+	}
+
+	if err := st.txn.Commit(ctx); err != nil {
+		st.txn.Discard(ctx)
+		s.sendStoreError(w, r, "Ошибка коммита транзакции", err, http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Транзакция зафиксирована", http.StatusOK)
+}
+
+func (s *APIServer) handleDiscardTxn(w http.ResponseWriter, r *http.Request) {
+	st := s.requestTxn(w, r, true)
+	if st == nil {
+		return
+	}
+	st.finish(r.Context())
+	s.sendResponseWithMessage(w, r, nil, "Транзакция отменена", http.StatusOK)
+}
+
+// Schema handlers
+
+func (s *APIServer) handleListSchemas(w http.ResponseWriter, r *http.Request) {
+	var schemas []KeySchema
+	if key := r.URL.Query().Get("key"); key != "" {
+		schemas = s.ds.SchemasFor(ds.NewKey(key))
+	} else {
+		schemas = s.ds.ListSchemas()
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"schemas": schemas,
+		"total":   len(schemas),
+	})
+}
+
+func (s *APIServer) handleRegisterSchema(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var schema KeySchema
+	if err := s.parseJSONBody(r, &schema); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.RegisterSchema(ctx, schema); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка регистрации схемы: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Схема зарегистрирована", http.StatusCreated)
+}
+
+func (s *APIServer) handleRemoveSchema(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if err := s.ds.RemoveSchema(ctx, mux.Vars(r)["name"]); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления схемы: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Схема удалена", http.StatusOK)
+}
+
+func (s *APIServer) handleValidateValue(w http.ResponseWriter, r *http.Request) {
+	var req APIValidateRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Key == "" {
+		s.sendErrorResponse(w, r, "Требуется ключ", http.StatusBadRequest)
+		return
+	}
+
+	key := ds.NewKey(req.Key)
+	if !s.authorize(w, r, PermissionRead, key) {
+		return
+	}
+	violations := []SchemaViolation{}
+	var verr *SchemaValidationError
+	if err := s.ds.ValidateValue(key, []byte(req.Value)); errors.As(err, &verr) {
+		violations = verr.Violations
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"key":        key.String(),
+		"valid":      len(violations) == 0,
+		"schemas":    s.ds.SchemasFor(key),
+		"violations": violations,
+	})
+}
+
+// Transform handlers
+
+func (s *APIServer) handleTransform(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req struct {
+		Key     string            `json:"key,omitempty"`
+		Prefix  string            `json:"prefix,omitempty"`
+		Options *TransformOptions `json:"options"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	s.runTransform(ctx, w, r, req.Key, req.Prefix, req.Options)
+}
+
+func (s *APIServer) handleTransformJQ(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req struct {
+		Key          string            `json:"key,omitempty"`
+		Prefix       string            `json:"prefix,omitempty"`
+		JQExpression string            `json:"jq_expression"`
+		Options      *TransformOptions `json:"options,omitempty"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.JQExpression == "" {
+		s.sendErrorResponse(w, r, "Требуется JQ выражение", http.StatusBadRequest)
+		return
+	}
+
+	if req.Options == nil {
+		req.Options = &TransformOptions{}
+	}
+	req.Options.JQ = req.JQExpression
+
+	s.runTransform(ctx, w, r, req.Key, req.Prefix, req.Options)
+}
+
+func (s *APIServer) handleTransformPatch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req struct {
+		Key      string            `json:"key,omitempty"`
+		Prefix   string            `json:"prefix,omitempty"`
+		PatchOps []PatchOp         `json:"patch_ops"`
+		Options  *TransformOptions `json:"options,omitempty"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.PatchOps) == 0 {
+		s.sendErrorResponse(w, r, "Требуются patch операции", http.StatusBadRequest)
+		return
+	}
+
+	if req.Options == nil {
+		req.Options = &TransformOptions{}
+	}
+	req.Options.PatchOps = req.PatchOps
+
+	s.runTransform(ctx, w, r, req.Key, req.Prefix, req.Options)
+}
+
+func (s *APIServer) handleTransformJS(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req struct {
+		Key     string            `json:"key,omitempty"`
+		Prefix  string            `json:"prefix,omitempty"`
+		Script  string            `json:"script"`
+		Options *TransformOptions `json:"options,omitempty"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Script) == "" {
+		s.sendErrorResponse(w, r, "Требуется скрипт", http.StatusBadRequest)
+		return
+	}
+
+	if req.Options == nil {
+		req.Options = &TransformOptions{}
+	}
+	req.Options.Script = req.Script
+
+	s.runTransform(ctx, w, r, req.Key, req.Prefix, req.Options)
+}
+
+func (s *APIServer) runTransform(ctx context.Context, w http.ResponseWriter, r *http.Request, key, prefix string, opts *TransformOptions) {
+	if opts == nil {
+		opts = &TransformOptions{}
+	}
+	if key != "" {
+		opts.Key = ds.NewKey(key)
+	}
+	if prefix != "" {
+		opts.Prefix = ds.NewKey(prefix)
+	}
+	if !s.authorize(w, r, PermissionWrite, transformScope(opts)) {
+		return
+	}
+	allowTransformKeys(r, opts)
+
+	summary, err := s.ds.RunTransform(ctx, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrTransformKeyForbidden) {
+			status = http.StatusForbidden
+		}
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка трансформации: %v", err), status)
+		return
+	}
+
+	s.sendResponse(w, r, summary)
+}
+
+func (s *APIServer) handleListTransformJournals(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	journals, err := s.ds.ListTransformJournals(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения журнала: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"journals": journals,
+		"total":    len(journals),
+	})
+}
+
+func (s *APIServer) handleRevertTransform(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+	summary, err := s.ds.RevertTransform(ctx, id)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка отката трансформации: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, summary, "Трансформация откачена", http.StatusOK)
+}
+
+func (s *APIServer) handleDeleteTransformJournal(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+	if err := s.ds.DeleteTransformJournal(ctx, id); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления журнала: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Журнал трансформации удален", http.StatusOK)
+}
+
+func (s *APIServer) handleListTransformJobs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	jobs, err := s.ds.ListTransformJobs(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения заданий: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Токен видит только задания, которые мог бы запустить сам
+	if token := requestToken(r); token != nil {
+		allowed := jobs[:0]
+		for _, job := range jobs {
+			if token.Allows(PermissionWrite, transformScope(&job.Options)) {
+				allowed = append(allowed, job)
+			}
+		}
+		jobs = allowed
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"jobs":  jobs,
+		"total": len(jobs),
+	})
+}
+
+func (s *APIServer) handleStartTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req TransformJobRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	opts := req.Options
+	if opts == nil {
+		opts = &TransformOptions{}
+	}
+	if req.Prefix != "" {
+		opts.Prefix = ds.NewKey(req.Prefix)
+	}
+	if req.JQExpression != "" {
+		opts.JQ = req.JQExpression
+	}
+	if len(req.PatchOps) > 0 {
+		opts.PatchOps = req.PatchOps
+	}
+	if req.Script != "" {
+		opts.Script = req.Script
+	}
+	if !s.authorize(w, r, PermissionWrite, transformScope(opts)) {
+		return
+	}
+	allowTransformKeys(r, opts)
+
+	job, err := s.ds.StartTransformJob(ctx, opts, req.RateLimit)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка запуска задания: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, job, "Задание трансформации запущено", http.StatusAccepted)
+}
+
+func (s *APIServer) handleGetTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	job, ok := s.authorizeTransformJob(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	s.sendResponse(w, r, job)
+}
+
+func (s *APIServer) handleDeleteTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if err := s.ds.DeleteTransformJob(ctx, mux.Vars(r)["id"]); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления задания: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Задание трансформации удалено", http.StatusOK)
+}
+
+func (s *APIServer) handleCancelTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if _, ok := s.authorizeTransformJob(ctx, w, r); !ok {
+		return
+	}
+
+	if err := s.ds.CancelTransformJob(ctx, mux.Vars(r)["id"]); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка отмены задания: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Задание трансформации отменяется", http.StatusAccepted)
+}
+
+func (s *APIServer) handleResumeTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if _, ok := s.authorizeTransformJob(ctx, w, r); !ok {
+		return
+	}
+
+	job, err := s.ds.ResumeTransformJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка возобновления задания: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, job, "Задание трансформации возобновлено", http.StatusAccepted)
+}
+
+func (s *APIServer) handleThrottleTransformJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if _, ok := s.authorizeTransformJob(ctx, w, r); !ok {
+		return
+	}
+
+	var req APIThrottleRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.ThrottleTransformJob(ctx, mux.Vars(r)["id"], req.RateLimit); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка изменения скорости: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Скорость задания изменена", http.StatusOK)
+}
+
+// TTL handlers
+
+func (s *APIServer) handleTTLStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	stats, err := s.ds.GetTTLStats(ctx, ds.NewKey(prefix))
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения TTL статистики: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, stats)
+}
+
+// handleTTLKeys возвращает ключи с TTL под префиксом; с within - только
+// еще не истекшие ключи, которые истекут в течение within.
+func (s *APIServer) handleTTLKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := ds.NewKey(r.URL.Query().Get("prefix"))
+
+	var keys []TTLKeyStatus
+	var err error
+	if withinStr := r.URL.Query().Get("within"); withinStr != "" {
+		within, perr := time.ParseDuration(withinStr)
+		if perr != nil {
+			s.sendErrorResponse(w, r, "Неверный формат within", http.StatusBadRequest)
+			return
+		}
+		keys, err = s.ds.GetExpiringKeys(ctx, prefix, within)
+	} else {
+		var all []TTLKeyStatus
+		all, err = s.ds.ListTTLKeys(ctx)
+		for _, status := range all {
+			if prefix.String() == "/" || prefix.Equal(status.Key) || prefix.IsAncestorOf(status.Key) {
+				keys = append(keys, status)
+			}
+		}
+	}
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения TTL ключей: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []TTLKeyStatus{}
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"keys":  keys,
+		"total": len(keys),
+	})
+}
+
+func (s *APIServer) handleTTLCleanup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	removed, err := s.ds.CleanupExpiredKeys(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка очистки TTL ключей: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{"removed": removed})
+}
+
+func (s *APIServer) handleExtendTTL(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req APIExtendTTLRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	key := ds.NewKey(mux.Vars(r)["key"])
+	if err := s.ds.ExtendTTL(ctx, key, req.Extension); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка продления TTL: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "TTL продлен", http.StatusOK)
+}
+
+func (s *APIServer) handleSetTTLBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req APITTLBatchRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	keys := make([]ds.Key, len(req.Keys))
+	for i, key := range req.Keys {
+		keys[i] = ds.NewKey(key)
+		if !s.authorize(w, r, PermissionWrite, keys[i]) {
+			return
+		}
+	}
+
+	if err := s.ds.SetTTLBatch(ctx, keys, req.TTL); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка установки TTL: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "TTL установлен", http.StatusOK)
+}
+
+func (s *APIServer) handleRefreshTTL(w http.ResponseWriter, r *http.Request) {
+	// TODO: Implement RefreshTTL method
+	s.sendErrorResponse(w, r, "Обновление TTL не реализовано", http.StatusNotImplemented)
+}
+
+func (s *APIServer) handleListTTLPolicies(w http.ResponseWriter, r *http.Request) {
+	policies := s.ds.ListTTLPolicies()
+	if key := r.URL.Query().Get("key"); key != "" {
+		policies = []TTLPolicy{}
+		if policy, ok := s.ds.TTLPolicyFor(ds.NewKey(key)); ok {
+			policies = append(policies, policy)
+		}
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"policies": policies,
+		"total":    len(policies),
+	})
+}
+
+func (s *APIServer) handleSetTTLPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var policy TTLPolicy
+	if err := s.parseJSONBody(r, &policy); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+	if !s.authorize(w, r, PermissionAdmin, ds.NewKey(policy.Prefix)) {
+		return
+	}
+
+	if err := s.ds.SetTTLPolicy(ctx, policy); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка установки политики TTL: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Политика TTL установлена", http.StatusCreated)
+}
+
+func (s *APIServer) handleRemoveTTLPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := "/" + strings.TrimPrefix(mux.Vars(r)["prefix"], "/")
+	if err := s.ds.RemoveTTLPolicy(ctx, ds.NewKey(prefix)); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления политики TTL: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Политика TTL удалена", http.StatusOK)
+}
+
+// Streaming handlers
+
+func (s *APIServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	format := StreamFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = StreamFormatJSON
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	jqFilter := r.URL.Query().Get("jq")
+	includeKeys := r.URL.Query().Get("include_keys") == "true"
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	opts := &StreamOptions{
+		Format:      format,
+		Prefix:      ds.NewKey(prefix),
+		JQFilter:    jqFilter,
+		IncludeKeys: includeKeys,
+		Limit:       limit,
+	}
+
+	// Устанавливаем подходящий Content-Type
+	switch format {
+	case StreamFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case StreamFormatJSONL:
+		w.Header().Set("Content-Type", "application/x-jsonlines")
+	case StreamFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case StreamFormatSSE:
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	if err := s.ds.StreamTo(ctx, w, opts); err != nil {
+		s.logger.Printf("Ошибка стрима: %v", err)
+	}
+}
+
+func (s *APIServer) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	opts := &StreamOptions{
+		Format:     StreamFormatSSE,
+		BufferSize: 100,
+	}
+
+	if err := s.ds.StreamEvents(ctx, w, opts); err != nil {
+		s.logger.Printf("Ошибка стрима событий: %v", err)
+	}
+}
+
+func (s *APIServer) handleStreamJSON(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+	includeKeys := r.URL.Query().Get("include_keys") == "true"
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.ds.StreamJSON(ctx, w, ds.NewKey(prefix), includeKeys); err != nil {
+		s.logger.Printf("Ошибка JSON стрима: %v", err)
+	}
+}
+
+func (s *APIServer) handleStreamJSONL(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+	includeKeys := r.URL.Query().Get("include_keys") == "true"
+
+	w.Header().Set("Content-Type", "application/x-jsonlines")
+
+	if err := s.ds.StreamJSONL(ctx, w, ds.NewKey(prefix), includeKeys); err != nil {
+		s.logger.Printf("Ошибка JSONL стрима: %v", err)
+	}
+}
+
+func (s *APIServer) handleStreamCSV(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+	includeKeys := r.URL.Query().Get("include_keys") == "true"
+
+	w.Header().Set("Content-Type", "text/csv")
+
+	if err := s.ds.StreamCSV(ctx, w, ds.NewKey(prefix), includeKeys); err != nil {
+		s.logger.Printf("Ошибка CSV стрима: %v", err)
+	}
+}
+
+func (s *APIServer) handleStreamSSE(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+
+	if err := s.ds.StreamSSE(ctx, w, headers); err != nil {
+		s.logger.Printf("Ошибка SSE стрима: %v", err)
+	}
+}
+
+// Batch operations
+
+func (s *APIServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req BatchRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		s.sendErrorResponse(w, r, "Требуются операции", http.StatusBadRequest)
+		return
+	}
+	for _, op := range req.Operations {
+		if !s.authorize(w, r, PermissionWrite, ds.NewKey(op.Key)) {
+			return
+		}
+	}
+
+	ops := make([]apiBatchOp, len(req.Operations))
+	results := make([]APIBatchResult, len(req.Operations))
+	invalid := false
+	for i, op := range req.Operations {
+		results[i] = APIBatchResult{Index: i, Op: op.Op, Key: op.Key}
+		parsed, err := parseBatchOperation(op)
+		if err != nil {
+			results[i].fail(http.StatusBadRequest, err)
+			invalid = true
+			continue
+		}
+		ops[i] = parsed
+	}
+
+	if !req.Atomic {
+		for i, op := range ops {
+			if results[i].Status != 0 {
+				continue
+			}
+			if err := writeBatchOp(ctx, s.ds, op); err != nil {
+				results[i].fail(storeErrorStatus(err, http.StatusInternalServerError), err)
+				continue
+			}
+			results[i].succeed(op)
+		}
+		if status := allFailedStatus(results); status != 0 {
+			s.sendBatchResponse(w, r, false, results, status, "Ни одна операция batch не выполнена")
+			return
+		}
+		s.sendBatchResponse(w, r, false, results, http.StatusOK, "Batch операции выполнены")
+		return
+	}
+
+	if invalid {
+		cancelBatchResults(results, -1)
+		s.sendBatchResponse(w, r, true, results, http.StatusBadRequest, "Batch содержит неверные операции")
+		return
+	}
+
+	if err := s.commitAtomicBatch(ctx, ops); err != nil {
+		status := storeErrorStatus(err, http.StatusInternalServerError)
+		failed := failedBatchOp(ops, err)
+		for i := range results {
+			if failed < 0 || i == failed {
+				results[i].fail(status, err)
+			}
+		}
+		cancelBatchResults(results, failed)
+		s.sendBatchResponse(w, r, true, results, status, fmt.Sprintf("Ошибка коммита batch: %v", err))
+		return
+	}
+	for i, op := range ops {
+		results[i].succeed(op)
+	}
+	s.sendBatchResponse(w, r, true, results, http.StatusOK, "Batch операции выполнены")
+}
+
+// apiBatchOp - проверенная операция batch с декодированным значением.
+type apiBatchOp struct {
+	BatchOperation
+	key   ds.Key
+	value []byte
+}
+
+func parseBatchOperation(op BatchOperation) (apiBatchOp, error) {
+	parsed := apiBatchOp{BatchOperation: op, key: ds.NewKey(op.Key)}
+	if op.Key == "" {
+		return parsed, fmt.Errorf("требуется ключ")
+	}
+	if op.IfMatch != "" && op.IfNoneMatch != "" {
+		return parsed, fmt.Errorf("нельзя указывать if_match и if_none_match одновременно")
+	}
+
+	switch op.Op {
+	case "put":
+		if (op.IfMatch != "" || op.IfNoneMatch != "") && op.TTL > 0 {
+			return parsed, fmt.Errorf("условная запись с TTL не поддерживается")
+		}
+		value, err := decodeValue(op.Value, op.Encoding)
+		if err != nil {
+			return parsed, err
+		}
+		parsed.value = value
+	case "delete":
+		if op.IfNoneMatch != "" {
+			return parsed, fmt.Errorf("if_none_match не поддерживается для delete")
+		}
+	default:
+		return parsed, fmt.Errorf("неизвестная операция: %s", op.Op)
+	}
+	return parsed, nil
+}
+
+// batchWriter - общие методы датастора и пакета, которыми выполняются
+// операции batch.
+type batchWriter interface {
+	Put(ctx context.Context, key ds.Key, value []byte) error
+	PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key ds.Key) error
+	PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error
+}
+
+func writeBatchOp(ctx context.Context, target batchWriter, op apiBatchOp) error {
+	switch {
+	case op.Op == "delete" && op.IfMatch != "":
+		return target.DeleteIfMatch(ctx, op.key, op.IfMatch)
+	case op.Op == "delete":
+		return target.Delete(ctx, op.key)
+	case op.IfMatch != "":
+		return target.PutIfMatch(ctx, op.key, op.value, op.IfMatch)
+	case op.IfNoneMatch != "":
+		return target.PutIfNoneMatch(ctx, op.key, op.value, op.IfNoneMatch)
+	case op.TTL > 0:
+		return target.PutWithTTL(ctx, op.key, op.value, op.TTL)
+	default:
+		return target.Put(ctx, op.key, op.value)
+	}
+}
+
+// commitAtomicBatch применяет операции одной транзакцией датастора.
+func (s *APIServer) commitAtomicBatch(ctx context.Context, ops []apiBatchOp) error {
+	b, err := s.ds.AtomicBatch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	batch, ok := b.(batchWriter)
+	if !ok {
+		return fmt.Errorf("batch %T не поддерживает TTL и условные операции", b)
+	}
+	for _, op := range ops {
+		if err := writeBatchOp(ctx, batch, op); err != nil {
+			return err
+		}
+	}
+	return b.Commit(ctx)
+}
+
+// failedBatchOp находит операцию, отменившую пакет, по ключу в ошибке;
+// -1 - ошибка не относится к одной операции.
+func failedBatchOp(ops []apiBatchOp, err error) int {
+	var verr *SchemaValidationError
+	var perr *PreconditionFailedError
+	var key ds.Key
+	conditional := false
+	switch {
+	case errors.As(err, &perr):
+		key, conditional = perr.Key, true
+	case errors.As(err, &verr):
+		key = verr.Key
+	default:
+		return -1
+	}
+	for i, op := range ops {
+		if !op.key.Equal(key) {
+			continue
+		}
+		if conditional && (op.IfMatch != "" || op.IfNoneMatch != "") || !conditional && op.Op == "put" {
+			return i
+		}
+	}
+	return -1
+}
+
+// allFailedStatus возвращает код ответа пакета, в котором не выполнена ни
+// одна операция: общий код ошибок или наибольший из них; 0 - если хотя бы
+// одна операция выполнена.
+func allFailedStatus(results []APIBatchResult) int {
+	status := 0
+	for _, res := range results {
+		if res.Status < http.StatusBadRequest {
+			return 0
+		}
+		if res.Status > status {
+			status = res.Status
+		}
+	}
+	return status
+}
+
+// cancelBatchResults отмечает операции атомарного пакета, отмененные
+// из-за ошибки другой операции.
+func cancelBatchResults(results []APIBatchResult, failed int) {
+	for i := range results {
+		if i != failed && results[i].Status == 0 {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = "пакет отменен ошибкой другой операции"
+		}
+	}
+}
+
+func (res *APIBatchResult) succeed(op apiBatchOp) {
+	res.Status = http.StatusOK
+	if op.Op == "put" {
+		res.Status = http.StatusCreated
+		res.ETag = ETag(op.value)
+	}
+}
+
+func (res *APIBatchResult) fail(status int, err error) {
+	res.Status = status
+	res.Error = err.Error()
+	var verr *SchemaValidationError
+	var perr *PreconditionFailedError
+	switch {
+	case errors.As(err, &verr):
+		res.Violations = verr.Violations
+	case errors.As(err, &perr):
+		res.ETag = perr.ETag
+	}
+}
+
+// sendBatchResponse отвечает результатами операций; при statusCode ошибки
+// результаты передаются в data ответа с ошибкой.
+func (s *APIServer) sendBatchResponse(w http.ResponseWriter, r *http.Request, atomic bool, results []APIBatchResult, statusCode int, message string) {
+	response := APIBatchResponse{
+		OperationsCount: len(results),
+		Atomic:          atomic,
+		Results:         results,
+	}
+	for _, res := range results {
+		if res.Status < http.StatusMultipleChoices {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	if statusCode >= http.StatusBadRequest {
+		s.sendErrorWithData(w, r, message, response, statusCode)
+		return
+	}
+	if response.Failed > 0 {
+		message = fmt.Sprintf("Выполнено операций: %d из %d", response.Succeeded, response.OperationsCount)
+	}
+	s.sendResponseWithMessage(w, r, response, message, statusCode)
+}
+
+// Subscription handlers
+
+func (s *APIServer) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	subscriptions, err := s.ds.ListJSSubscriptions(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения подписок: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, map[string]interface{}{
+		"subscriptions": subscriptions,
+		"total":         len(subscriptions),
+	})
+}
+
+func (s *APIServer) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req struct {
+		ID               string   `json:"id"`
+		Script           string   `json:"script"`
+		ExecutionTimeout int      `json:"execution_timeout,omitempty"`
+		EnableNetworking bool     `json:"enable_networking,omitempty"`
+		EnableLogging    bool     `json:"enable_logging,omitempty"`
+		EventFilters     []string `json:"event_filters,omitempty"`
+		StrictMode       bool     `json:"strict_mode,omitempty"`
+	}
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ID == "" || req.Script == "" {
+		s.sendErrorResponse(w, r, "Требуются поля ID и Script", http.StatusBadRequest)
+		return
+	}
+
+	var eventFilters []EventType
+	for _, eventStr := range req.EventFilters {
+		switch strings.ToLower(eventStr) {
+		case "put":
+			eventFilters = append(eventFilters, EventPut)
+		case "delete":
+			eventFilters = append(eventFilters, EventDelete)
+		case "batch":
+			eventFilters = append(eventFilters, EventBatch)
+		case "ttl_expired":
+			eventFilters = append(eventFilters, EventTTLExpired)
+		case "transform_job":
+			eventFilters = append(eventFilters, EventTransformJob)
+		}
+	}
+
+	timeout := time.Duration(req.ExecutionTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	config := &JSSubscriberConfig{
+		ID:               req.ID,
+		Script:           req.Script,
+		ExecutionTimeout: timeout,
+		EnableNetworking: req.EnableNetworking,
+		EnableLogging:    req.EnableLogging,
+		EventFilters:     eventFilters,
+		StrictMode:       req.StrictMode,
+	}
+
+	err := s.ds.CreateJSSubscription(ctx, req.ID, req.Script, config)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания подписки: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Подписка создана", http.StatusCreated)
+}
+
+func (s *APIServer) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		s.sendErrorResponse(w, r, "Требуется ID подписки", http.StatusBadRequest)
+		return
+	}
+
+	err := s.ds.RemoveJSSubscription(ctx, id)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка удаления подписки: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Подписка удалена", http.StatusOK)
+}
+
+// System handlers
+
+func (s *APIServer) handleSetMode(w http.ResponseWriter, r *http.Request) {
+	var req APISetModeRequest
+
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	s.ds.SetSilentMode(req.Silent)
+
+	mode := "normal"
+	if req.Silent {
+		mode = "silent"
+	}
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"mode": mode,
+	}, "Режим изменен", http.StatusOK)
+}
+
+func (s *APIServer) handleGC(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if gcds, ok := s.ds.(ds.GCDatastore); ok {
+		if err := gcds.CollectGarbage(ctx); err != nil {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка сборки мусора: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Сборка мусора выполнена", http.StatusOK)
+}
+
+// SnapshotVersionHeader - трейлер ответа /system/backup с версией для
+// следующего инкрементального снимка.
+const SnapshotVersionHeader = "X-Snapshot-Version"
+
+// handleBackup отдает снимок потоком. Версия известна только после записи
+// снимка, поэтому передается в трейлере; ответ без трейлера - оборванный снимок.
+func (s *APIServer) handleBackup(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		v, err := strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			s.sendErrorResponse(w, r, "Неверная версия since", http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+
+	// Снимок может писаться дольше WriteTimeout сервера
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="ues-ds.backup"`)
+	w.Header().Set("Trailer", SnapshotVersionHeader)
+
+	version, err := s.ds.Snapshot(r.Context(), w, since)
+	if err != nil {
+		s.logger.Printf("Ошибка создания снимка: %v", err)
+		return
+	}
+	w.Header().Set(SnapshotVersionHeader, strconv.FormatUint(version, 10))
+}
+
+func (s *APIServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	if err := s.ds.Restore(r.Context(), r.Body); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка восстановления: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Снимок восстановлен", http.StatusOK)
+}
+
+// Export/Import handlers
+
+// Трейлеры ответа /export с итогом экспорта
+const (
+	ExportProcessedHeader = "X-Export-Processed"
+	ExportSkippedHeader   = "X-Export-Skipped"
+)
+
+func (s *APIServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	opts, err := exportOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Системные ключи выгружаются только администратору
+	if token := requestToken(r); token != nil && !token.Allows(PermissionAdmin, ds.NewKey("/_system")) {
+		opts.SkipSystem = true
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename, contentType := exportFileType(opts)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Trailer", ExportProcessedHeader+", "+ExportSkippedHeader)
+
+	// Ошибку до начала потока еще можно вернуть обычным ответом
+	out := &startedWriter{w: w}
+	stats, err := s.ds.Export(r.Context(), out, opts)
+	if err != nil {
+		if !out.started {
+			w.Header().Del("Trailer")
+			w.Header().Del("Content-Disposition")
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка экспорта: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.logger.Printf("Ошибка экспорта: %v", err)
+		return
+	}
+	w.Header().Set(ExportProcessedHeader, strconv.Itoa(stats.Processed))
+	w.Header().Set(ExportSkippedHeader, strconv.Itoa(stats.Skipped))
+}
+
+// exportFileType возвращает имя файла и Content-Type ответа экспорта.
+func exportFileType(opts ExportOptions) (string, string) {
+	encoding := opts.Encoding
+	if encoding == "" {
+		encoding = ExportEncodingJSONL
+	}
+	filename := "export." + encoding
+	switch opts.Compression {
+	case CompressionGzip:
+		return filename + ".gz", "application/gzip"
+	case CompressionZip:
+		return filename + ".zip", "application/zip"
+	case CompressionTar:
+		return filename + ".tar", "application/x-tar"
+	}
+	switch encoding {
+	case ExportEncodingJSON:
+		return filename, "application/json"
+	case ExportEncodingCSV:
+		return filename, "text/csv"
+	}
+	return filename, "application/x-ndjson"
+}
+
+// startedWriter отмечает начало записи тела ответа.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (sw *startedWriter) Write(p []byte) (int, error) {
+	sw.started = true
+	return sw.w.Write(p)
+}
+
+func exportOptionsFromQuery(q url.Values) (ExportOptions, error) {
+	opts := ExportOptions{
+		Prefix:      ds.NewKey(q.Get("prefix")),
+		Format:      q.Get("format"),
+		Encoding:    q.Get("encoding"),
+		Compression: q.Get("compression"),
+		Name:        q.Get("name"),
+		Extract:     q.Get("extract"),
+		Patch:       q["patch"],
+		JQ:          q.Get("jq"),
+		Start:       q.Get("start"),
+		End:         q.Get("end"),
+		Metadata:    q.Get("metadata") == "true",
+		SkipSystem:  q.Get("skip_system") != "false",
+	}
+	if limit := q.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return opts, fmt.Errorf("неверный limit")
+		}
+		opts.Limit = l
+	}
+	return opts, nil
+}
+
+func importOptionsFromQuery(q url.Values) (ImportOptions, error) {
+	opts := ImportOptions{
+		Prefix:  ds.NewKey(q.Get("prefix")),
+		IDType:  q.Get("id_type"),
+		Extract: q.Get("extract"),
+		Patch:   q["patch"],
+		JQ:      q.Get("jq"),
+		Name:    q.Get("name"),
+	}
+	if v := q.Get("clock_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("неверный clock_id")
+		}
+		opts.ClockID = uint(id)
+	}
+	if v := q.Get("batch_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("неверный batch_size")
+		}
+		opts.BatchSize = size
+	}
+	return opts, nil
+}
+
+// ImportEvent - строка потока прогресса /import?progress=true.
+type ImportEvent struct {
+	Type  string         `json:"type"` // progress, file, done, error
+	Stats *TransferStats `json:"stats,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+// handleImport принимает JSON Lines (в том числе gzip, zip, tar) телом
+// запроса или файлами multipart/form-data. С progress=true ответ - поток
+// ImportEvent в формате JSON Lines.
+func (s *APIServer) handleImport(w http.ResponseWriter, r *http.Request) {
+	opts, err := importOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	streaming := r.URL.Query().Get("progress") == "true"
+	var enc *json.Encoder
+	emit := func(event ImportEvent) {
+		if err := enc.Encode(event); err == nil {
+			_ = rc.Flush()
+		}
+	}
+	files := []TransferStats{}
+	opts.Progress = func(stats TransferStats) {
+		if stats.Done {
+			files = append(files, stats)
+		}
+		if streaming {
+			event := ImportEvent{Type: "progress", Stats: &stats}
+			if stats.Done {
+				event.Type = "file"
+			}
+			emit(event)
+		}
+	}
+	if streaming {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		enc = json.NewEncoder(w)
+	}
+
+	total := &TransferStats{}
+	importOne := func(name string, body io.Reader) error {
+		fileOpts := opts
+		if name != "" {
+			fileOpts.Name = name
+		}
+		stats, err := s.ds.Import(r.Context(), body, fileOpts)
+		if stats != nil {
+			total.Processed += stats.Processed
+			total.Skipped += stats.Skipped
+			total.Errors += stats.Errors
+		}
+		return err
+	}
+
+	if mr, mErr := r.MultipartReader(); mErr == nil {
+		for {
+			part, perr := mr.NextPart()
+			if perr == io.EOF {
+				break
+			}
+			if perr != nil {
+				err = perr
+				break
+			}
+			if part.FileName() != "" {
+				err = importOne(part.FileName(), part)
+			}
+			part.Close()
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		err = importOne("", r.Body)
+	}
+
+	total.Done = err == nil
+	if streaming {
+		if err != nil {
+			emit(ImportEvent{Type: "error", Stats: total, Error: err.Error()})
+			return
+		}
+		emit(ImportEvent{Type: "done", Stats: total})
+		return
+	}
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка импорта: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"total": total,
+		"files": files,
+	}, fmt.Sprintf("Импортировано записей: %d", total.Processed), http.StatusOK)
+}
+
+// Documentation handler
+
+func (s *APIServer) handleDocs(w http.ResponseWriter, r *http.Request) {
+	docs := `<!DOCTYPE html>
+<html>
+<head>
+    <title>UES Datastore API v1 Documentation</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 40px; line-height: 1.6; }
+        .endpoint { margin: 20px 0; padding: 20px; border: 1px solid #e0e0e0; border-radius: 8px; background: #fafafa; }
+        .method { display: inline-block; padding: 6px 12px; border-radius: 4px; color: white; font-weight: bold; margin-right: 12px; }
+        .GET { background: #28a745; }
+        .POST { background: #007bff; }
+        .PUT { background: #ffc107; color: #212529; }
+        .DELETE { background: #dc3545; }
+        pre { background: #f8f9fa; padding: 15px; border-radius: 5px; overflow-x: auto; border: 1px solid #e9ecef; }
+        .section { margin: 30px 0; }
+        h1 { color: #2c3e50; border-bottom: 3px solid #3498db; padding-bottom: 10px; }
+        h2 { color: #34495e; margin-top: 40px; }
+        .description { color: #666; margin: 10px 0; }
+    </style>
+</head>
+<body>
+    <h1>🗄️ UES Datastore REST API v1</h1>
+    <p class="description">Полнофункциональный API для работы с датастором, включающий JQ queries, Views, Transform операции и многое другое.</p>
+
+    <div class="section">
+        <h2>📊 Basic Operations</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/health</code>
+            <p>Проверка состояния сервера и датастора</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/keys?prefix=/&keys_only=false&limit=100</code>
+            <p>Получить список ключей с фильтрацией. start/end - диапазон ключей включительно, reverse=true - по убыванию. Если страница неполная, ответ содержит next_cursor: следующая страница запрашивается с теми же параметрами и cursor=next_cursor</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/keys/{key}?format=json</code>
+            <p>Получить значение ключа (format: json|base64|raw). В JSON значение не в UTF-8 передается в base64 (encoding: base64). С format=raw, Accept: application/octet-stream или сохраненным типом тело отдается как есть с этим типом; Range: bytes=... - часть значения (206). Возвращает заголовок ETag, с If-None-Match - 304 при совпадении</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method PUT">PUT</span><code>/api/v1/keys/{key}?ttl=1h</code>
+            <p>Установить значение ключа с TTL. Тело сохраняется как есть, Content-Type без параметров запоминается как тип значения (пустой и application/x-www-form-urlencoded - без типа, сохраненный тип сбрасывается, если не указан keep_content_type=true); application/json - обертка {value, encoding: base64, content_type, ttl}. If-Match: "etag" или * - запись только при совпадении, If-None-Match: * - только создание; иначе 412</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/keys/{key}</code>
+            <p>Удалить ключ. С If-Match удаляет только при совпадении ETag, иначе 412</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/keys/{key}/info</code>
+            <p>Получить подробную информацию о ключе (размер, сохраненный тип media_type, TTL, метаданные)</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/stats</code>
+            <p>Статистика датастора (количество ключей, размер, и т.д.)</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🔍 Search & Query</h2>
+        
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/search</code>
+            <p>Поиск по ключам; start/end, reverse и cursor - как у списка ключей</p>
+            <pre>{"query": "user", "case_sensitive": false, "limit": 100, "cursor": "..."}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/query</code>
+            <p>JQ запрос к каждому ключу выборки ($key - текущий ключ). Prefix, start/end, limit и keys_only выполняются на уровне хранилища.
+            reverse - обход по убыванию ключей, next_cursor/cursor - продолжение выборки после limit результатов.
+            С заголовком <code>Accept: application/x-ndjson</code> или <code>"stream": true</code> результаты передаются потоком NDJSON, курсор - последней строкой {"next_cursor": "..."}.</p>
+            <pre>{"query": "select(.active == true) | .name", "prefix": "/users/", "start": "/users/a", "end": "/users/m", "limit": 100, "stream": true}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/query/aggregate</code>
+            <p>JQ агрегация данных</p>
+            <pre>{"query": "reduce inputs as $p (0; . + $p.price)", "prefix": "/products/"}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/keys/{key}/query</code>
+            <p>JQ запрос для одного ключа</p>
+            <pre>{"query": ".name + \" (\" + .email + \")\""}</pre>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>👁️ Views</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/views</code>
+            <p>Список всех view</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/views</code>
+            <p>Создать новый view</p>
+            <pre>{
+  "id": "active_users",
+  "name": "Active Users",
+  "source_prefix": "/users/",
+  "filter_script": "data.json && data.json.active === true",
+  "enable_caching": true,
+  "auto_refresh": true
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/views/{id}</code>
+            <p>Получить конфигурацию view</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/views/{id}/execute?start=/users/a&end=/users/m&limit=100</code>
+            <p>Выполнить view и получить результаты (start/end - необязательный диапазон исходных ключей, reverse, limit и cursor - постраничная выдача по next_cursor)</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/views/{id}/refresh</code>
+            <p>Принудительно обновить view</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🗂️ Secondary Indexes</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/indexes</code>
+            <p>Список вторичных индексов</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/indexes</code>
+            <p>Создать индекс по gjson-пути или jq-выражению (type: string | number)</p>
+            <pre>{
+  "name": "users_by_age",
+  "prefix": "/users",
+  "path": "age",
+  "type": "number"
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/indexes/{name}</code>
+            <p>Удалить индекс</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/indexes/{name}/rebuild</code>
+            <p>Перестроить индекс по текущим данным</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/indexes/{name}/lookup?value=30</code>
+            <p>Найти ключи с точным значением</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/indexes/{name}/range?from=18&to=65&limit=100</code>
+            <p>Найти ключи со значениями в диапазоне [from, to]</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🔄 Transform Operations</h2>
+        
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/jq</code>
+            <p>Трансформация данных с помощью JQ</p>
+            <pre>{
+  "prefix": "/users/",
+  "jq_expression": ".name = (.first_name + \" \" + .last_name) | del(.first_name, .last_name)",
+  "options": {"dry_run": false}
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/patch</code>
+            <p>JSON Patch операции</p>
+            <pre>{
+  "key": "/user/123",
+  "patch_ops": [{"op": "replace", "path": "/status", "value": "active"}]
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/js</code>
+            <p>Трансформация JS-функцией с аргументами <code>key</code> и <code>value</code> (доступны <code>$lo</code> и lancet).
+            Функция возвращает новое значение, <code>null</code> для удаления ключа, массив записей
+            <code>{key, value}</code> (value: null удаляет ключ) или ничего, чтобы оставить значение.
+            Записи применяются атомарно в пределах пачки</p>
+            <pre>{
+  "prefix": "/users",
+  "script": "const [first, last] = value.name.split(' ');\nreturn [{key: key + '/profile', value: {first, last}}, {key: key, value: null}];"
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <p>Все операции трансформации принимают <code>options.dry_run</code>: изменения не записываются,
+            в ответе возвращаются счетчики и diff (before/after) по ключам. Примененная трансформация
+            возвращает <code>journal_id</code> для отката.</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/transform/journal</code>
+            <p>Журнал примененных трансформаций</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/journal/{id}/revert</code>
+            <p>Откатить трансформацию (ключи, измененные после нее, пропускаются)</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/transform/journal/{id}</code>
+            <p>Удалить запись журнала вместе с сохраненными значениями</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/transform/jobs</code>
+            <p>Список фоновых заданий трансформации</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/jobs</code>
+            <p>Запустить фоновую трансформацию префикса. Изменения коммитятся пачками вместе с курсором,
+            прогресс публикуется событиями <code>transform_job</code></p>
+            <pre>{
+  "prefix": "/users",
+  "jq_expression": ".name |= ascii_upcase",
+  "rate_limit": 500,
+  "options": {"batch_size": 1000, "ignore_errors": true}
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/transform/jobs/{id}</code>
+            <p>Состояние задания: статус, курсор, счетчики</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/jobs/{id}/cancel</code>
+            <p>Отменить задание</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/jobs/{id}/resume</code>
+            <p>Продолжить прерванное или отмененное задание с сохраненного курсора</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/transform/jobs/{id}/throttle</code>
+            <p>Изменить ограничение скорости (ключей в секунду, 0 - без ограничения)</p>
+            <pre>{"rate_limit": 100}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/transform/jobs/{id}</code>
+            <p>Удалить запись завершенного задания (журнал сохраняется)</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>📡 Streaming</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/stream?format=json&prefix=/users/&include_keys=true</code>
+            <p>Стрим данных в различных форматах (json, jsonl, csv, sse)</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/stream/events</code>
+            <p>Server-Sent Events для реального времени</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/stream/sse</code>
+            <p>SSE поток событий датастора</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/ws</code>
+            <p>WebSocket подписки на события. Сервер начинает с welcome (epoch, seq последнего события), события приходят с номерами seq.
+            Шаблон без * ? [ - префикс, "/**" в конце - любые потомки. Since продолжает после указанного seq в пределах того же epoch;
+            если события уже вытеснены из журнала (event_log_size), приходит gap. При "ack": true сервер держит не больше max_unacked
+            неподтвержденных событий; подтверждение накопительное</p>
+            <pre>{"type": "subscribe", "id": "users", "patterns": ["/users/**"], "events": ["put", "delete"], "since": 1200, "ack": true}
+{"type": "ack", "id": "users", "seq": 1250}
+{"type": "unsubscribe", "id": "users"}</pre>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>📦 Batch Operations</h2>
+        
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/batch</code>
+            <p>Выполнить несколько операций: с atomic=true все или ни одной одной транзакцией (пакет, не помещающийся в транзакцию, отклоняется с 413), без atomic - каждую независимо (best-effort, по умолчанию): ошибка операции не отменяет остальные, если не выполнена ни одна - ответ с кодом ошибки. Операции put поддерживают TTL, условия if_match/if_none_match (* - ключ существует/отсутствует) и двоичные значения с encoding=base64. В ответе - статус каждой операции, в атомарном пакете после ошибки остальные получают 424</p>
+            <pre>{
+  "atomic": true,
+  "operations": [
+    {"op": "put", "key": "/user/1", "value": "{\"name\":\"John\"}"},
+    {"op": "put", "key": "/session/1", "value": "active", "ttl": 3600000000000},
+    {"op": "put", "key": "/lock/1", "value": "owner", "if_none_match": "*"},
+    {"op": "put", "key": "/blob/1", "value": "AAEC", "encoding": "base64"},
+    {"op": "delete", "key": "/temp/old_data", "if_match": "3f2a..."}
+  ]
+}</pre>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🔒 Transactions</h2>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/txn</code>
+            <p>Открыть транзакцию. Не завершенная до истечения TTL транзакция откатывается</p>
+            <pre>{"read_only": false, "ttl": 30000000000}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/txn/{id}/keys/{key}</code>
+            <p>Прочитать ключ в транзакции (снимок на момент начала и собственные записи)</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method PUT">PUT</span><code>/api/v1/txn/{id}/keys/{key}</code>
+            <p>Записать ключ в транзакции: тело, Content-Type, keep_content_type, ttl и If-Match/If-None-Match - как у PUT /api/v1/keys/{key}</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/txn/{id}/keys/{key}</code>
+            <p>Удалить ключ в транзакции</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/txn/{id}/keys?prefix=/&keys_only=false&limit=100</code>
+            <p>Список ключей в транзакции</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/txn/{id}/commit</code>
+            <p>Зафиксировать транзакцию. 409 - прочитанные ключи изменены другой записью, 410 - транзакция истекла</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/txn/{id}/discard</code>
+            <p>Отменить транзакцию</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>📤 Export / Import</h2>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/export?prefix=/users&format=simple&encoding=jsonl&compression=gzip</code>
+            <p>Потоковый экспорт. format: simple, full, value-only; encoding: jsonl, json, csv; compression: gzip, zip, tar. Обработка: extract, patch (несколько), jq; отбор: start, end, limit, skip_system, metadata. Итог - в трейлерах X-Export-Processed и X-Export-Skipped</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/import?prefix=/events&id_type=tid&progress=true</code>
+            <p>Импорт JSON Lines из тела запроса или файлов multipart/form-data; gzip, zip и tar определяются по содержимому. Параметры: id_type, clock_id, extract, patch, jq, batch_size. С progress=true ответ - поток событий</p>
+            <pre>{"type":"file","stats":{"file":"events.jsonl","processed":1000,"skipped":0,"errors":2,"done":true}}
+{"type":"done","stats":{"processed":1000,"skipped":0,"errors":2,"done":true}}</pre>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>⏳ TTL</h2>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/ttl/stats?prefix=/</code>
+            <p>Статистика ключей с TTL под префиксом, состояние мониторинга и действующие политики</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/ttl/keys?prefix=/session&within=5m</code>
+            <p>Ключи с TTL под префиксом; с within - еще не истекшие ключи, которые истекут в течение within</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/ttl/{key}/extend</code>
+            <p>Продлить TTL ключа на extension (в наносекундах)</p>
+            <pre>{"extension": 600000000000}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/ttl/batch</code>
+            <p>Установить одинаковый TTL для нескольких ключей</p>
+            <pre>{"keys": ["/session/1", "/session/2"], "ttl": 1800000000000}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/ttl/cleanup</code>
+            <p>Удалить истекшие ключи; в ответе - количество удаленных</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/ttl/policies?key=/session/1</code>
+            <p>Список политик TTL; с key - политика, действующая для ключа</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/ttl/policies</code>
+            <p>Установить политику TTL для префикса. default_ttl применяется к записи без TTL, sliding продлевает TTL при каждом чтении, idle_timeout - срок без обращений, max_lifetime - предел от последней записи</p>
+            <pre>{
+  "prefix": "/session",
+  "default_ttl": 1800000000000,
+  "sliding": true,
+  "max_lifetime": 86400000000000
+}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/ttl/policies/{prefix}</code>
+            <p>Удалить политику TTL. TTL уже записанных ключей не меняется</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🔔 Subscriptions</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/subscriptions</code>
+            <p>Список JavaScript подписок на события</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/subscriptions</code>
+            <p>Создать JavaScript подписку</p>
+            <pre>{
+  "id": "logger",
+  "script": "console.log('Event:', event.type, event.key);",
+  "enable_logging": true,
+  "event_filters": ["put", "delete"]
+}</pre>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>⚙️ System</h2>
+        
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/clear?confirm=true</code>
+            <p>Очистить весь датастор</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/system/mode</code>
+            <p>Установить режим работы</p>
+            <pre>{"silent": true}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/system/gc</code>
+            <p>Запустить сборку мусора</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/system/backup?since=0</code>
+            <p>Скачать снимок хранилища (формат badger backup, с TTL и служебными ключами). since - версия из трейлера X-Snapshot-Version предыдущего снимка для инкрементального снимка</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/system/restore</code>
+            <p>Загрузить снимок из тела запроса. Инкрементальные снимки загружаются по порядку после полного</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>📈 Monitoring</h2>
+        
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/metrics</code>
+            <p>Prometheus метрики</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>🔐 Authentication</h2>
+        <p>Если включена аутентификация, добавьте заголовок:</p>
+        <pre>Authorization: Bearer YOUR_TOKEN</pre>
+        <p>Токен - общий auth_token сервера (полный доступ) или именованный токен с областями read, write, subscribe, admin по префиксам ключей. admin включает остальные права под префиксом; admin на / нужен для clear, gc, снимков и управления токенами</p>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/system/tokens</code>
+            <p>Список токенов</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method POST">POST</span><code>/api/v1/system/tokens</code>
+            <p>Создать токен. Секрет возвращается только в этом ответе. max_keys и max_bytes - квота данных под префиксами с правом записи; при превышении запись отклоняется с 507</p>
+            <pre>{"name": "app", "scopes": [{"permission": "write", "prefix": "/app"}], "ttl": "720h", "max_keys": 10000, "max_bytes": 104857600}</pre>
+        </div>
+
+        <div class="endpoint">
+            <span class="method DELETE">DELETE</span><code>/api/v1/system/tokens/{id}</code>
+            <p>Отозвать токен</p>
+        </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/system/whoami</code>
+            <p>Токен текущего запроса, его области и использование квоты</p>
+    
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/openapi.json</code>
+            <p>Спецификация OpenAPI 3 всех маршрутов API</p>
+        </div>
+    </div>
+
+        <div class="endpoint">
+            <span class="method GET">GET</span><code>/api/v1/openapi.json</code>
+            <p>Спецификация OpenAPI 3 всех маршрутов API</p>
+        </div>
+    </div>
+
+    <div class="section">
+        <h2>📝 Notes</h2>
+        <ul>
+            <li>Все ответы содержат <code>request_id</code> для трейсинга</li>
+            <li>Поддерживается CORS для cross-origin запросов</li>
+            <li>Rate limiting по токену или IP клиента с отдельными бюджетами чтения, записи и /query, /search, /transform; ответы содержат заголовки RateLimit-*, при превышении - 429 и Retry-After</li>
+            <li>Request timeout</li>
+            <li>Graceful shutdown при получении SIGTERM</li>
+            <li>Структурированное логирование</li>
+            <li>Compression для больших ответов</li>
+        </ul>
+    </div>
+
+</body>
+</html>`
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docs))
+}
+
+// metricsUpdater обновляет метрики
+func (s *APIServer) metricsUpdater(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Обновляем метрики датастора
+			ctxTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+
+			keysChan, errChan, err := s.ds.Keys(ctxTimeout, ds.NewKey("/"))
+			if err != nil {
+				cancel()
+				continue
+			}
+
+			totalKeys := 0
+			for {
+				select {
+				case _, ok := <-keysChan:
+					if !ok {
+						goto keysCountDone
+					}
+					totalKeys++
+				case <-errChan:
+					goto keysCountDone
+				case <-ctxTimeout.Done():
+					goto keysCountDone
+				}
+			}
+
+		keysCountDone:
+			s.metrics.DatastoreKeys.Set(float64(totalKeys))
+			cancel()
+		}
+	}
+}
+
+// Utility functions
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d Б", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cБ", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func isUTF8(data []byte) bool {
+	return string(data) == strings.ToValidUTF8(string(data), "")
+}
+
+// valueKind классифицирует значение для поля content_type.
+func valueKind(data []byte) string {
+	switch {
+	case json.Valid(data):
+		return "json"
+	case isUTF8(data):
+		return "text"
+	default:
+		return "binary"
+	}
+}
+
+// encodeValue возвращает значение для JSON ответа и его кодировку:
+// строку как есть или base64, если значение не является корректным UTF-8.
+func encodeValue(data []byte, forceBase64 bool) (string, string) {
+	if forceBase64 || !isUTF8(data) {
+		return base64.StdEncoding.EncodeToString(data), "base64"
+	}
+	return string(data), ""
+}
+
+// decodeValue - обратное к encodeValue преобразование значения из запроса.
+func decodeValue(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(value), nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("неверное base64 значение: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("неизвестная кодировка: %s", encoding)
+	}
+}
+
+// keyValueEntry - запись ключа со значением в списках и результатах поиска.
+func keyValueEntry(key string, data []byte) map[string]interface{} {
+	value, encoding := encodeValue(data, false)
+	entry := map[string]interface{}{
+		"key":          key,
+		"value":        value,
+		"size":         len(data),
+		"content_type": valueKind(data),
+	}
+	if encoding != "" {
+		entry["encoding"] = encoding
+	}
+	return entry
+}
+
+// wantsRawValue определяет, отдать ли значение телом ответа как есть:
+// format=raw, Accept с text/plain, application/octet-stream или сохраненным
+// типом значения, либо запрос диапазона байт.
+func wantsRawValue(r *http.Request, mediaType string) bool {
+	switch r.URL.Query().Get("format") {
+	case "raw":
+		return true
+	case "json", "base64":
+		return false
+	}
+	if r.Header.Get("Range") != "" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/octet-stream") {
+		return true
+	}
+	if base, _, err := mime.ParseMediaType(mediaType); err == nil && base != "application/json" {
+		return strings.Contains(accept, base)
+	}
+	return false
+}
+
+// writeRawValue отдает значение как есть с сохраненным типом, а без него -
+// с типом по содержимому. Range и If-Range обрабатывает http.ServeContent.
+func writeRawValue(w http.ResponseWriter, r *http.Request, data []byte, mediaType string) {
+	if mediaType == "" {
+		switch valueKind(data) {
+		case "json":
+			mediaType = "application/json"
+		case "text":
+			mediaType = "text/plain; charset=utf-8"
+		default:
+			mediaType = "application/octet-stream"
+		}
+	}
+	w.Header().Set("Content-Type", mediaType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+// etagMatches проверяет заголовок If-None-Match: "*" или список ETag через запятую.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,2241 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// Структуры для API запросов и ответов
+type SearchRequest struct {
+	Query         string `json:"query"`
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+	KeysOnly      bool   `json:"keys_only,omitempty"`
+	Limit         int    `json:"limit,omitempty"`
+	Start         string `json:"start,omitempty"`
+	End           string `json:"end,omitempty"`
+	Reverse       bool   `json:"reverse,omitempty"`
+	// Cursor - next_cursor предыдущей страницы с теми же параметрами
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type SubscriptionRequest struct {
+	ID               string   `json:"id"`
+	Script           string   `json:"script"`
+	ExecutionTimeout int      `json:"execution_timeout,omitempty"`
+	EnableNetworking bool     `json:"enable_networking,omitempty"`
+	EnableLogging    bool     `json:"enable_logging,omitempty"`
+	EventFilters     []string `json:"event_filters,omitempty"`
+	StrictMode       bool     `json:"strict_mode,omitempty"`
+}
+
+// BatchRequest - пакет операций. С Atomic пакет применяется целиком или не
+// применяется вовсе, иначе каждая операция выполняется независимо.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+	Atomic     bool             `json:"atomic,omitempty"`
+}
+
+type BatchOperation struct {
+	Op    string `json:"op"` // put, delete
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Encoding - кодировка Value: пусто - строка как есть, base64 - двоичное значение
+	Encoding string        `json:"encoding,omitempty"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	// IfMatch - выполнить, только если текущий ETag совпадает; * - если ключ существует
+	IfMatch string `json:"if_match,omitempty"`
+	// IfNoneMatch - записать, только если ETag не совпадает; * - если ключа нет
+	IfNoneMatch string `json:"if_none_match,omitempty"`
+}
+
+type JQQueryRequest struct {
+	Query            string        `json:"query"`
+	Prefix           string        `json:"prefix,omitempty"`
+	Start            string        `json:"start,omitempty"`
+	End              string        `json:"end,omitempty"`
+	Limit            int           `json:"limit,omitempty"`
+	KeysOnly         bool          `json:"keys_only,omitempty"`
+	Timeout          time.Duration `json:"timeout,omitempty"`
+	TreatAsString    bool          `json:"treat_as_string,omitempty"`
+	IgnoreParseError bool          `json:"ignore_parse_error,omitempty"`
+	Stream           bool          `json:"stream,omitempty"`
+	Reverse          bool          `json:"reverse,omitempty"`
+	// Cursor - next_cursor предыдущей страницы с теми же параметрами
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type JQSingleRequest struct {
+	Query string `json:"query"`
+}
+
+type TransformRequest struct {
+	Key     string            `json:"key,omitempty"`
+	Prefix  string            `json:"prefix,omitempty"`
+	Options *TransformOptions `json:"options"`
+}
+
+type TransformJQRequest struct {
+	Key          string            `json:"key,omitempty"`
+	Prefix       string            `json:"prefix,omitempty"`
+	JQExpression string            `json:"jq_expression"`
+	Options      *TransformOptions `json:"options,omitempty"`
+}
+
+type TransformPatchRequest struct {
+	Key      string            `json:"key,omitempty"`
+	Prefix   string            `json:"prefix,omitempty"`
+	PatchOps []PatchOp         `json:"patch_ops"`
+	Options  *TransformOptions `json:"options,omitempty"`
+}
+
+type TransformJSRequest struct {
+	Key     string            `json:"key,omitempty"`
+	Prefix  string            `json:"prefix,omitempty"`
+	Script  string            `json:"script"`
+	Options *TransformOptions `json:"options,omitempty"`
+}
+
+type TransformJobRequest struct {
+	Prefix       string            `json:"prefix,omitempty"`
+	JQExpression string            `json:"jq_expression,omitempty"`
+	PatchOps     []PatchOp         `json:"patch_ops,omitempty"`
+	Script       string            `json:"script,omitempty"`
+	RateLimit    float64           `json:"rate_limit,omitempty"`
+	Options      *TransformOptions `json:"options,omitempty"`
+}
+
+type ViewRequest struct {
+	Config ViewConfig `json:",inline"`
+}
+
+// APIClient представляет клиент для работы с REST API
+type APIClient struct {
+	client  *http.Client
+	baseURL string
+	isUnix  bool
+	token   string
+}
+
+// NewAPIClient создает новый API клиент
+func NewAPIClient(endpoint string) (*APIClient, error) {
+	return newAPIClient(endpoint, nil)
+}
+
+// NewAPIClientWithTLS создает API клиент для HTTPS эндпоинта с собственным
+// CA и, при необходимости, клиентским сертификатом для mTLS. Для Unix
+// сокета TLS используется поверх сокета.
+func NewAPIClientWithTLS(endpoint string, tlsConfig *ClientTLSConfig) (*APIClient, error) {
+	if tlsConfig == nil {
+		return newAPIClient(endpoint, nil)
+	}
+	config, err := tlsConfig.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newAPIClient(endpoint, config)
+}
+
+func newAPIClient(endpoint string, tlsConfig *tls.Config) (*APIClient, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	client.Transport = transport
+
+	baseURL := strings.TrimSuffix(endpoint, "/")
+	isUnix := false
+
+	// Проверяем, это Unix socket или HTTP URL
+	if strings.HasPrefix(endpoint, "unix://") {
+		socketPath := strings.TrimPrefix(endpoint, "unix://")
+		if socketPath == "" {
+			return nil, fmt.Errorf("не указан путь к Unix сокету")
+		}
+
+		// Подключаемся к Unix socket вместо TCP
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		}
+
+		baseURL = "http://unix"
+		if tlsConfig != nil {
+			baseURL = "https://unix"
+		}
+		isUnix = true
+	} else if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		baseURL = "http://" + baseURL
+		if tlsConfig != nil {
+			baseURL = "https://" + strings.TrimSuffix(endpoint, "/")
+		}
+	}
+
+	return &APIClient{
+		client:  client,
+		baseURL: baseURL,
+		isUnix:  isUnix,
+	}, nil
+}
+
+// NewAPIClientWithAuth создает API клиент с авторизацией
+func NewAPIClientWithAuth(endpoint, token string) (*APIClient, error) {
+	client, err := NewAPIClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	client.token = token
+	return client, nil
+}
+
+// Вспомогательные методы для HTTP запросов
+
+func (c *APIClient) get(endpoint string) (*APIResponse, error) {
+	url := c.baseURL + "/api/v1" + endpoint
+	return c.doRequest("GET", url, nil)
+}
+
+func (c *APIClient) post(endpoint string, body interface{}) (*APIResponse, error) {
+	return c.request("POST", endpoint, body)
+}
+
+func (c *APIClient) put(endpoint string, body interface{}) (*APIResponse, error) {
+	return c.request("PUT", endpoint, body)
+}
+
+func (c *APIClient) delete(endpoint string) (*APIResponse, error) {
+	return c.request("DELETE", endpoint, nil)
+}
+
+func (c *APIClient) request(method, endpoint string, body interface{}) (*APIResponse, error) {
+	url := c.baseURL + "/api/v1" + endpoint
+
+	var reqBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации JSON: %w", err)
+		}
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	return c.doRequest(method, url, reqBody)
+}
+
+func (c *APIClient) doRequest(method, url string, body io.Reader) (*APIResponse, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Добавляем авторизацию если есть токен
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP %s ошибка: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	return c.parseResponse(resp)
+}
+
+func (c *APIClient) parseResponse(resp *http.Response) (*APIResponse, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
+	}
+
+	var apiResp APIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+
+	if !apiResp.Success {
+		if resp.StatusCode == http.StatusUnprocessableEntity && apiResp.Data != nil {
+			if data, err := json.Marshal(apiResp.Data); err == nil {
+				var verr SchemaValidationError
+				if json.Unmarshal(data, &verr) == nil && len(verr.Violations) > 0 {
+					return nil, &verr
+				}
+			}
+		}
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, fmt.Errorf("API ошибка: %s: %w", apiResp.Error, ds.ErrNotFound)
+		case http.StatusConflict:
+			return nil, ErrTxnConflict
+		case http.StatusGone:
+			return nil, ErrTxnNotFound
+		}
+		if resp.StatusCode == http.StatusPreconditionFailed && apiResp.Data != nil {
+			if data, err := json.Marshal(apiResp.Data); err == nil {
+				var perr PreconditionFailedError
+				if json.Unmarshal(data, &perr) == nil && perr.Key.String() != "" {
+					return nil, &perr
+				}
+			}
+		}
+		// Ответ возвращается вместе с ошибкой: data может описывать ее
+		// подробнее, например результаты операций batch
+		return &apiResp, fmt.Errorf("API ошибка: %s", apiResp.Error)
+	}
+
+	return &apiResp, nil
+}
+
+// Базовые методы датастора
+
+// keyPath кодирует ключ для пути запроса: в ключе допустимы '?', '#' и '%'.
+func keyPath(key ds.Key) string {
+	segments := strings.Split(key.String(), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (c *APIClient) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	value, _, err := c.getValue(ctx, key, "")
+	return value, err
+}
+
+// GetRange возвращает length байт значения начиная с offset;
+// length <= 0 - до конца значения.
+func (c *APIClient) GetRange(ctx context.Context, key ds.Key, offset, length int64) ([]byte, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	value, _, err := c.getValue(ctx, key, byteRange)
+	return value, err
+}
+
+// getValue читает значение ключа телом ответа как есть, без JSON обертки.
+func (c *APIClient) getValue(ctx context.Context, key ds.Key, byteRange string) ([]byte, http.Header, error) {
+	endpoint := fmt.Sprintf("/keys%s?format=raw", keyPath(key))
+	url := c.baseURL + "/api/v1" + endpoint
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Accept", "application/octet-stream")
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		value, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return value, resp.Header, nil
+	case http.StatusNotFound:
+		return nil, nil, ds.ErrNotFound
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+}
+
+func (c *APIClient) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return c.PutWithOptions(ctx, key, value, PutOptions{})
+}
+
+func (c *APIClient) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	return c.PutWithOptions(ctx, key, value, PutOptions{TTL: ttl})
+}
+
+// PutWithOptions передает значение телом запроса как есть, тип - в
+// Content-Type. Из заголовка сервер берет тип без параметров, а
+// application/json принимает только в JSON обертке, поэтому такие значения
+// передаются в обертке в base64.
+func (c *APIClient) PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error {
+	return c.putWithOptions(ctx, fmt.Sprintf("/keys%s", keyPath(key)), value, opts)
+}
+
+func (c *APIClient) putWithOptions(ctx context.Context, endpoint string, value []byte, opts PutOptions) error {
+	contentType := opts.ContentType
+	body := value
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" || mediaType == "application/x-www-form-urlencoded" || len(params) > 0 {
+		contentType = "application/json"
+		var err error
+		body, err = json.Marshal(APIPutRequest{
+			Value:           base64.StdEncoding.EncodeToString(value),
+			Encoding:        "base64",
+			ContentType:     opts.ContentType,
+			KeepContentType: opts.KeepContentType,
+			TTL:             opts.TTL,
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации: %w", err)
+		}
+	} else {
+		params := url.Values{}
+		if opts.TTL > 0 {
+			params.Set("ttl", opts.TTL.String())
+		}
+		if opts.KeepContentType {
+			params.Set("keep_content_type", "true")
+		}
+		if len(params) > 0 {
+			endpoint += "?" + params.Encode()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.baseURL+"/api/v1"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	// Без Content-Type сервер сохраняет тело как есть и сбрасывает тип
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if opts.IfMatch != "" {
+		req.Header.Set("If-Match", etagHeader(opts.IfMatch))
+	}
+	if opts.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", etagHeader(opts.IfNoneMatch))
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = c.parseResponse(resp)
+	return err
+}
+
+// GetContentType возвращает MIME-тип, сохраненный при записи ключа.
+func (c *APIClient) GetContentType(ctx context.Context, key ds.Key) (string, error) {
+	endpoint := fmt.Sprintf("/keys%s/info", keyPath(key))
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	data, ok := apiResp.Data.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("неожиданный формат ответа")
+	}
+	mediaType, _ := data["media_type"].(string)
+	return mediaType, nil
+}
+
+func (c *APIClient) Delete(ctx context.Context, key ds.Key) error {
+	endpoint := fmt.Sprintf("/keys%s", keyPath(key))
+	_, err := c.delete(endpoint)
+	return err
+}
+
+func (c *APIClient) Has(ctx context.Context, key ds.Key) (bool, error) {
+	endpoint := fmt.Sprintf("/keys%s/info", keyPath(key))
+	_, err := c.get(endpoint)
+	if err != nil {
+		if strings.Contains(err.Error(), "Ключ не найден") || strings.Contains(err.Error(), "404") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *APIClient) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	endpoint := fmt.Sprintf("/keys%s/info", keyPath(key))
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if size, ok := data["size"].(float64); ok {
+			return int(size), nil
+		}
+	}
+
+	return 0, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	endpoint := fmt.Sprintf("/keys%s/info", keyPath(key))
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	data, ok := apiResp.Data.(map[string]interface{})
+	if !ok {
+		return time.Time{}, fmt.Errorf("неожиданный формат ответа")
+	}
+	ttl, _ := data["ttl"].(string)
+	switch ttl {
+	case "":
+		// Ключ без TTL: как и локальный датастор, возвращаем время не в
+		// будущем без ошибки
+		return time.Time{}, nil
+	case "expired":
+		return time.Now(), nil
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(duration), nil
+}
+
+// SetTTL меняет TTL через /ttl/batch: сервер переносит его и на тип
+// содержимого, а перезапись значения тип бы сбросила.
+func (c *APIClient) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	exists, err := c.Has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ds.ErrNotFound
+	}
+	return c.SetTTLBatch(ctx, []ds.Key{key}, ttl)
+}
+
+// ListTTLKeys возвращает ключи с TTL под prefix; within > 0 - только еще не
+// истекшие ключи, которые истекут в течение within.
+func (c *APIClient) ListTTLKeys(ctx context.Context, prefix ds.Key, within time.Duration) ([]TTLKeyStatus, error) {
+	params := url.Values{}
+	if prefix.String() != "" {
+		params.Set("prefix", prefix.String())
+	}
+	if within > 0 {
+		params.Set("within", within.String())
+	}
+	endpoint := "/ttl/keys"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if keys, ok := data["keys"].([]interface{}); ok {
+			bytes, err := json.Marshal(keys)
+			if err != nil {
+				return nil, err
+			}
+			var result []TTLKeyStatus
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) ExtendTTL(ctx context.Context, key ds.Key, extension time.Duration) error {
+	_, err := c.post("/ttl"+keyPath(key)+"/extend", map[string]interface{}{"extension": extension})
+	return err
+}
+
+func (c *APIClient) SetTTLBatch(ctx context.Context, keys []ds.Key, ttl time.Duration) error {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.String()
+	}
+	_, err := c.post("/ttl/batch", map[string]interface{}{"keys": names, "ttl": ttl})
+	return err
+}
+
+func (c *APIClient) CleanupExpiredKeys(ctx context.Context) (int, error) {
+	apiResp, err := c.delete("/ttl/cleanup")
+	if err != nil {
+		return 0, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if removed, ok := data["removed"].(float64); ok {
+			return int(removed), nil
+		}
+	}
+
+	return 0, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Расширенные методы
+
+func (c *APIClient) ListKeys(ctx context.Context, prefix string, keysOnly bool, limit int) ([]interface{}, error) {
+	endpoint := fmt.Sprintf("/keys?prefix=%s&keys_only=%t", url.QueryEscape(prefix), keysOnly)
+	if limit > 0 {
+		endpoint += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if keys, ok := data["keys"].([]interface{}); ok {
+			return keys, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// defaultKeysPageSize - размер страницы IterateKeys без явного Limit.
+const defaultKeysPageSize = 1000
+
+// ListKeysOptions - параметры постраничного списка ключей.
+type ListKeysOptions struct {
+	Prefix   string
+	Start    string
+	End      string
+	Reverse  bool
+	KeysOnly bool
+	// Limit - размер страницы, 0 - без ограничения
+	Limit  int
+	Cursor string
+}
+
+// KeysPage - страница списка ключей.
+type KeysPage struct {
+	Keys []KeyValue
+	// NextCursor - курсор следующей страницы, пустой на последней
+	NextCursor string
+}
+
+// ListKeysPage получает одну страницу ключей; значения в base64 декодируются.
+func (c *APIClient) ListKeysPage(ctx context.Context, opts ListKeysOptions) (*KeysPage, error) {
+	params := url.Values{}
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "/"
+	}
+	params.Set("prefix", prefix)
+	params.Set("keys_only", strconv.FormatBool(opts.KeysOnly))
+	if opts.Start != "" {
+		params.Set("start", opts.Start)
+	}
+	if opts.End != "" {
+		params.Set("end", opts.End)
+	}
+	if opts.Reverse {
+		params.Set("reverse", "true")
+	}
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		params.Set("cursor", opts.Cursor)
+	}
+
+	apiResp, err := c.get("/keys?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, err
+	}
+	var resp APIListKeysResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("неожиданный формат ответа: %w", err)
+	}
+
+	page := &KeysPage{NextCursor: resp.NextCursor}
+	for _, item := range resp.Keys {
+		kv, err := entryKeyValue(item)
+		if err != nil {
+			return nil, err
+		}
+		page.Keys = append(page.Keys, kv)
+	}
+	return page, nil
+}
+
+// IterateKeys обходит ключи диапазона, запрашивая страницы по курсору
+// продолжения. Каналы закрываются по окончании обхода или ошибке.
+func (c *APIClient) IterateKeys(ctx context.Context, opts ListKeysOptions) (<-chan KeyValue, <-chan error) {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultKeysPageSize
+	}
+
+	out := make(chan KeyValue, opts.Limit)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		for {
+			page, err := c.ListKeysPage(ctx, opts)
+			if err != nil {
+				errc <- err
+				return
+			}
+			for _, kv := range page.Keys {
+				select {
+				case out <- kv:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}()
+
+	return out, errc
+}
+
+// entryKeyValue разбирает элемент списка ключей: строку ключа или запись
+// со значением.
+func entryKeyValue(item interface{}) (KeyValue, error) {
+	switch entry := item.(type) {
+	case string:
+		return KeyValue{Key: ds.NewKey(entry)}, nil
+	case map[string]interface{}:
+		keyStr, _ := entry["key"].(string)
+		valueStr, _ := entry["value"].(string)
+		encoding, _ := entry["encoding"].(string)
+		value, err := decodeValue(valueStr, encoding)
+		if err != nil {
+			return KeyValue{}, fmt.Errorf("ошибка декодирования значения %s: %w", keyStr, err)
+		}
+		return KeyValue{Key: ds.NewKey(keyStr), Value: value}, nil
+	default:
+		return KeyValue{}, fmt.Errorf("неожиданный формат ответа")
+	}
+}
+
+func (c *APIClient) Search(ctx context.Context, query string, caseSensitive, keysOnly bool, limit int) ([]interface{}, error) {
+	resp, err := c.SearchPage(ctx, SearchRequest{
+		Query:         query,
+		CaseSensitive: caseSensitive,
+		KeysOnly:      keysOnly,
+		Limit:         limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// SearchPage выполняет поиск с диапазоном, порядком и курсором продолжения.
+func (c *APIClient) SearchPage(ctx context.Context, req SearchRequest) (*APISearchResponse, error) {
+	apiResp, err := c.post("/search", req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, err
+	}
+	var resp APISearchResponse
+	if err := json.Unmarshal(data, &resp); err != nil || resp.Results == nil {
+		return nil, fmt.Errorf("неожиданный формат ответа")
+	}
+	return &resp, nil
+}
+
+func (c *APIClient) GetStats(ctx context.Context) (map[string]interface{}, error) {
+	apiResp, err := c.get("/stats")
+	if err != nil {
+		return nil, err
+	}
+
+	if stats, ok := apiResp.Data.(map[string]interface{}); ok {
+		return stats, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) Clear(ctx context.Context) error {
+	_, err := c.delete("/clear?confirm=true")
+	return err
+}
+
+// Batch операции
+
+// ExecuteBatch выполняет операции атомарно.
+func (c *APIClient) ExecuteBatch(ctx context.Context, operations []BatchOperation) error {
+	_, err := c.Batch(ctx, BatchRequest{Operations: operations, Atomic: true})
+	return err
+}
+
+// Batch выполняет пакет и возвращает результат каждой операции. Если
+// атомарный пакет отменен, вместе с результатами возвращается ошибка
+// отменившей его операции: PreconditionFailedError, SchemaValidationError
+// или ErrTxnConflict.
+func (c *APIClient) Batch(ctx context.Context, req BatchRequest) (*APIBatchResponse, error) {
+	apiResp, err := c.post("/batch", req)
+	if apiResp == nil || apiResp.Data == nil {
+		if err == nil {
+			err = fmt.Errorf("неожиданный формат ответа")
+		}
+		return nil, err
+	}
+
+	data, merr := json.Marshal(apiResp.Data)
+	if merr != nil {
+		return nil, merr
+	}
+	var result APIBatchResponse
+	if uerr := json.Unmarshal(data, &result); uerr != nil {
+		return nil, fmt.Errorf("неожиданный формат ответа: %w", uerr)
+	}
+	if err != nil {
+		return &result, batchResultError(result.Results, err)
+	}
+	return &result, nil
+}
+
+// batchResultError восстанавливает ошибку операции, отменившей пакет.
+func batchResultError(results []APIBatchResult, err error) error {
+	for _, res := range results {
+		switch res.Status {
+		case http.StatusPreconditionFailed:
+			return &PreconditionFailedError{Key: ds.NewKey(res.Key), ETag: res.ETag}
+		case http.StatusUnprocessableEntity:
+			return &SchemaValidationError{Key: ds.NewKey(res.Key), Violations: res.Violations}
+		case http.StatusConflict:
+			return ErrTxnConflict
+		case http.StatusRequestEntityTooLarge:
+			return ErrBatchTooBig
+		}
+	}
+	return err
+}
+
+// JQ запросы
+
+// QueryJQ выполняет jq-запрос и читает результаты потоком NDJSON
+func (c *APIClient) QueryJQ(ctx context.Context, query string, opts *JQQueryOptions) (<-chan JQResult, <-chan error, error) {
+	req := JQQueryRequest{
+		Query:  query,
+		Stream: true,
+	}
+
+	if opts != nil {
+		req.Prefix = opts.Prefix.String()
+		req.Start = opts.Start.String()
+		req.End = opts.End.String()
+		req.Limit = opts.Limit
+		req.KeysOnly = opts.KeysOnly
+		req.Reverse = opts.Reverse
+		req.Timeout = opts.Timeout
+		req.TreatAsString = opts.TreatAsString
+		req.IgnoreParseError = opts.IgnoreParseError
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка сериализации JSON: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/query", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/x-ndjson")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HTTP POST ошибка: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		_, err := c.parseResponse(resp)
+		if err == nil {
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		return nil, nil, err
+	}
+
+	results := make(chan JQResult, 100)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(results)
+		defer close(errc)
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var line struct {
+				Key        string      `json:"key"`
+				Value      interface{} `json:"value"`
+				Error      string      `json:"error"`
+				NextCursor string      `json:"next_cursor"`
+			}
+			if err := decoder.Decode(&line); err != nil {
+				if err != io.EOF {
+					errc <- fmt.Errorf("ошибка чтения потока: %w", err)
+				}
+				return
+			}
+			if line.Error != "" {
+				errc <- fmt.Errorf("API ошибка: %s", line.Error)
+				return
+			}
+			if line.NextCursor != "" {
+				// Лимит opts.Limit исчерпан, продолжение не запрашивается
+				return
+			}
+			select {
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			case results <- JQResult{Key: ds.NewKey(line.Key), Value: line.Value}:
+			}
+		}
+	}()
+
+	return results, errc, nil
+}
+
+func (c *APIClient) AggregateJQ(ctx context.Context, query string, opts *JQQueryOptions) (interface{}, error) {
+	req := JQQueryRequest{
+		Query: query,
+	}
+
+	if opts != nil {
+		req.Prefix = opts.Prefix.String()
+		req.Timeout = opts.Timeout
+		req.TreatAsString = opts.TreatAsString
+		req.IgnoreParseError = opts.IgnoreParseError
+	}
+
+	apiResp, err := c.post("/query/aggregate", req)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if result, ok := data["result"]; ok {
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) QueryJQSingle(ctx context.Context, key ds.Key, query string) (interface{}, error) {
+	endpoint := fmt.Sprintf("/keys%s/query", keyPath(key))
+	req := JQSingleRequest{Query: query}
+
+	apiResp, err := c.post(endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if result, ok := data["result"]; ok {
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Transform операции
+
+func (c *APIClient) Transform(ctx context.Context, key ds.Key, opts *TransformOptions) (*TransformSummary, error) {
+	req := TransformRequest{
+		Options: opts,
+	}
+	if key.String() != "" && key.String() != "/" {
+		req.Key = key.String()
+	}
+
+	apiResp, err := c.post("/transform", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary TransformSummary
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &summary); err != nil {
+			return nil, err
+		}
+		return &summary, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) TransformWithJQ(ctx context.Context, key ds.Key, jqExpression string, opts *TransformOptions) (*TransformSummary, error) {
+	req := TransformJQRequest{
+		JQExpression: jqExpression,
+		Options:      opts,
+	}
+	if key.String() != "" && key.String() != "/" {
+		req.Key = key.String()
+	}
+
+	apiResp, err := c.post("/transform/jq", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary TransformSummary
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &summary); err != nil {
+			return nil, err
+		}
+		return &summary, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) TransformWithPatch(ctx context.Context, key ds.Key, patchOps []PatchOp, opts *TransformOptions) (*TransformSummary, error) {
+	req := TransformPatchRequest{
+		PatchOps: patchOps,
+		Options:  opts,
+	}
+	if key.String() != "" && key.String() != "/" {
+		req.Key = key.String()
+	}
+
+	apiResp, err := c.post("/transform/patch", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary TransformSummary
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &summary); err != nil {
+			return nil, err
+		}
+		return &summary, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) TransformWithJS(ctx context.Context, key ds.Key, script string, opts *TransformOptions) (*TransformSummary, error) {
+	req := TransformJSRequest{
+		Script:  script,
+		Options: opts,
+	}
+	if key.String() != "" && key.String() != "/" {
+		req.Key = key.String()
+	}
+
+	apiResp, err := c.post("/transform/js", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary TransformSummary
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &summary); err != nil {
+			return nil, err
+		}
+		return &summary, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) RevertTransform(ctx context.Context, journalID string) (*TransformSummary, error) {
+	endpoint := fmt.Sprintf("/transform/journal/%s/revert", url.PathEscape(journalID))
+	apiResp, err := c.post(endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary TransformSummary
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &summary); err != nil {
+			return nil, err
+		}
+		return &summary, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) ListTransformJournals(ctx context.Context) ([]TransformJournal, error) {
+	apiResp, err := c.get("/transform/journal")
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if journals, ok := data["journals"].([]interface{}); ok {
+			bytes, err := json.Marshal(journals)
+			if err != nil {
+				return nil, err
+			}
+			var result []TransformJournal
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) DeleteTransformJournal(ctx context.Context, journalID string) error {
+	endpoint := fmt.Sprintf("/transform/journal/%s", url.PathEscape(journalID))
+	_, err := c.delete(endpoint)
+	return err
+}
+
+func (c *APIClient) StartTransformJob(ctx context.Context, opts *TransformOptions, rateLimit float64) (*TransformJob, error) {
+	apiResp, err := c.post("/transform/jobs", TransformJobRequest{
+		RateLimit: rateLimit,
+		Options:   opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeTransformJob(apiResp)
+}
+
+func (c *APIClient) GetTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	apiResp, err := c.get(fmt.Sprintf("/transform/jobs/%s", url.PathEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+	return decodeTransformJob(apiResp)
+}
+
+func (c *APIClient) ListTransformJobs(ctx context.Context) ([]TransformJob, error) {
+	apiResp, err := c.get("/transform/jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if jobs, ok := data["jobs"].([]interface{}); ok {
+			bytes, err := json.Marshal(jobs)
+			if err != nil {
+				return nil, err
+			}
+			var result []TransformJob
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) CancelTransformJob(ctx context.Context, id string) error {
+	_, err := c.post(fmt.Sprintf("/transform/jobs/%s/cancel", url.PathEscape(id)), nil)
+	return err
+}
+
+func (c *APIClient) ResumeTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	apiResp, err := c.post(fmt.Sprintf("/transform/jobs/%s/resume", url.PathEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTransformJob(apiResp)
+}
+
+func (c *APIClient) ThrottleTransformJob(ctx context.Context, id string, rateLimit float64) error {
+	endpoint := fmt.Sprintf("/transform/jobs/%s/throttle", url.PathEscape(id))
+	_, err := c.post(endpoint, map[string]float64{"rate_limit": rateLimit})
+	return err
+}
+
+func (c *APIClient) DeleteTransformJob(ctx context.Context, id string) error {
+	_, err := c.delete(fmt.Sprintf("/transform/jobs/%s", url.PathEscape(id)))
+	return err
+}
+
+func decodeTransformJob(apiResp *APIResponse) (*TransformJob, error) {
+	data, ok := apiResp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("неожиданный формат ответа")
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var job TransformJob
+	if err := json.Unmarshal(bytes, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Schemas
+
+func (c *APIClient) RegisterSchema(ctx context.Context, schema KeySchema) error {
+	_, err := c.post("/schemas", schema)
+	return err
+}
+
+func (c *APIClient) RemoveSchema(ctx context.Context, name string) error {
+	_, err := c.delete(fmt.Sprintf("/schemas/%s", url.PathEscape(name)))
+	return err
+}
+
+// ListSchemas возвращает схемы; если key не пустой - только схемы этого ключа.
+func (c *APIClient) ListSchemas(ctx context.Context, key ds.Key) ([]KeySchema, error) {
+	endpoint := "/schemas"
+	if key.String() != "" && key.String() != "/" {
+		endpoint += "?key=" + url.QueryEscape(key.String())
+	}
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if schemas, ok := data["schemas"].([]interface{}); ok {
+			bytes, err := json.Marshal(schemas)
+			if err != nil {
+				return nil, err
+			}
+			var result []KeySchema
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// ValidateValue проверяет значение по схемам ключа на сервере без записи.
+func (c *APIClient) ValidateValue(ctx context.Context, key ds.Key, value []byte) error {
+	apiResp, err := c.post("/schemas/validate", map[string]interface{}{
+		"key":   key.String(),
+		"value": string(value),
+	})
+	if err != nil {
+		return err
+	}
+
+	data, ok := apiResp.Data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("неожиданный формат ответа")
+	}
+	if valid, _ := data["valid"].(bool); valid {
+		return nil
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var verr SchemaValidationError
+	if err := json.Unmarshal(bytes, &verr); err != nil {
+		return err
+	}
+	verr.Key = key
+	return &verr
+}
+
+// Conditional writes
+
+func (c *APIClient) GetWithETag(ctx context.Context, key ds.Key) ([]byte, string, error) {
+	value, header, err := c.getValue(ctx, key, "")
+	if err != nil {
+		return nil, "", err
+	}
+	return value, strings.Trim(header.Get("ETag"), `"`), nil
+}
+
+func (c *APIClient) PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	return c.conditionalRequest(ctx, "PUT", key, value, "If-Match", etag)
+}
+
+func (c *APIClient) PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	return c.conditionalRequest(ctx, "PUT", key, value, "If-None-Match", etag)
+}
+
+func (c *APIClient) DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error {
+	return c.conditionalRequest(ctx, "DELETE", key, nil, "If-Match", etag)
+}
+
+// etagHeader оформляет ETag для заголовков If-Match и If-None-Match.
+func etagHeader(etag string) string {
+	if etag == ETagAny {
+		return etag
+	}
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
+
+func (c *APIClient) conditionalRequest(ctx context.Context, method string, key ds.Key, value []byte, header, etag string) error {
+	url := c.baseURL + "/api/v1" + fmt.Sprintf("/keys%s", keyPath(key))
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(header, etagHeader(etag))
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = c.parseResponse(resp)
+	return err
+}
+
+// Snapshots
+
+// streamClient - клиент без общего таймаута для длительной передачи снимков.
+func (c *APIClient) streamClient() *http.Client {
+	return &http.Client{Transport: c.client.Transport}
+}
+
+// Snapshot скачивает снимок в w и возвращает версию для следующего
+// инкрементального снимка.
+func (c *APIClient) Snapshot(ctx context.Context, w io.Writer, sinceVersion uint64) (uint64, error) {
+	url := c.baseURL + "/api/v1" + fmt.Sprintf("/system/backup?since=%d", sinceVersion)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.streamClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, err := c.parseResponse(resp)
+		return 0, err
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return 0, fmt.Errorf("ошибка получения снимка: %w", err)
+	}
+	version, err := strconv.ParseUint(resp.Trailer.Get(SnapshotVersionHeader), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("снимок получен не полностью")
+	}
+	return version, nil
+}
+
+func (c *APIClient) Restore(ctx context.Context, r io.Reader) error {
+	url := c.baseURL + "/api/v1/system/restore"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.streamClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = c.parseResponse(resp)
+	return err
+}
+
+// Export/Import
+
+// Export скачивает экспорт в w; итог передается сервером в трейлерах.
+func (c *APIClient) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*TransferStats, error) {
+	url := c.baseURL + "/api/v1/export?" + exportQuery(opts).Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.streamClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, err := c.parseResponse(resp)
+		return nil, err
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return nil, fmt.Errorf("ошибка получения экспорта: %w", err)
+	}
+	processed, err := strconv.Atoi(resp.Trailer.Get(ExportProcessedHeader))
+	if err != nil {
+		return nil, fmt.Errorf("экспорт получен не полностью")
+	}
+	skipped, _ := strconv.Atoi(resp.Trailer.Get(ExportSkippedHeader))
+
+	stats := &TransferStats{File: opts.Name, Processed: processed, Skipped: skipped, Done: true}
+	if opts.Progress != nil {
+		opts.Progress(*stats)
+	}
+	return stats, nil
+}
+
+func exportQuery(opts ExportOptions) url.Values {
+	q := url.Values{}
+	if opts.Prefix.String() != "" {
+		q.Set("prefix", opts.Prefix.String())
+	}
+	for name, value := range map[string]string{
+		"format":      opts.Format,
+		"encoding":    opts.Encoding,
+		"compression": opts.Compression,
+		"name":        opts.Name,
+		"extract":     opts.Extract,
+		"jq":          opts.JQ,
+		"start":       opts.Start,
+		"end":         opts.End,
+	} {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	q["patch"] = opts.Patch
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Metadata {
+		q.Set("metadata", "true")
+	}
+	q.Set("skip_system", strconv.FormatBool(opts.SkipSystem))
+	return q
+}
+
+// Import загружает поток на сервер. Прогресс читается из потока событий
+// сервера и передается в opts.Progress; OnError удаленно не вызывается.
+func (c *APIClient) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*TransferStats, error) {
+	q := url.Values{"progress": {"true"}}
+	if opts.Prefix.String() != "" {
+		q.Set("prefix", opts.Prefix.String())
+	}
+	for name, value := range map[string]string{
+		"id_type": opts.IDType,
+		"extract": opts.Extract,
+		"jq":      opts.JQ,
+		"name":    opts.Name,
+	} {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	q["patch"] = opts.Patch
+	if opts.ClockID > 0 {
+		q.Set("clock_id", strconv.FormatUint(uint64(opts.ClockID), 10))
+	}
+	if opts.BatchSize > 0 {
+		q.Set("batch_size", strconv.Itoa(opts.BatchSize))
+	}
+
+	url := c.baseURL + "/api/v1/import?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.streamClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, err := c.parseResponse(resp)
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event ImportEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("импорт прерван без итога")
+			}
+			return nil, fmt.Errorf("ошибка чтения прогресса импорта: %w", err)
+		}
+		switch event.Type {
+		case "progress", "file":
+			if opts.Progress != nil && event.Stats != nil {
+				opts.Progress(*event.Stats)
+			}
+		case "done":
+			return event.Stats, nil
+		case "error":
+			return event.Stats, errors.New(event.Error)
+		}
+	}
+}
+
+// Transactions
+
+// ErrTxnNotFound - транзакция на сервере не найдена: завершена или истекла.
+var ErrTxnNotFound = errors.New("транзакция не найдена или истекла")
+
+// BeginTxn открывает транзакцию на сервере; ttl <= 0 - TTL по умолчанию.
+func (c *APIClient) BeginTxn(ctx context.Context, readOnly bool, ttl time.Duration) (string, error) {
+	reqBody := struct {
+		ReadOnly bool          `json:"read_only"`
+		TTL      time.Duration `json:"ttl,omitempty"`
+	}{
+		ReadOnly: readOnly,
+		TTL:      ttl,
+	}
+
+	apiResp, err := c.post("/txn", reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if id, ok := data["id"].(string); ok {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) TxnGet(ctx context.Context, id string, key ds.Key) ([]byte, error) {
+	url := c.baseURL + "/api/v1" + fmt.Sprintf("/txn/%s/keys%s", id, keyPath(key))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/octet-stream")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ds.ErrNotFound
+	case http.StatusGone:
+		return nil, ErrTxnNotFound
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+}
+
+func (c *APIClient) TxnPut(ctx context.Context, id string, key ds.Key, value []byte) error {
+	return c.TxnPutWithOptions(ctx, id, key, value, PutOptions{})
+}
+
+// TxnPutWithOptions записывает значение в транзакцию с типом, TTL и
+// условием ETag, как PutWithOptions.
+func (c *APIClient) TxnPutWithOptions(ctx context.Context, id string, key ds.Key, value []byte, opts PutOptions) error {
+	return c.putWithOptions(ctx, fmt.Sprintf("/txn/%s/keys%s", id, keyPath(key)), value, opts)
+}
+
+func (c *APIClient) TxnDelete(ctx context.Context, id string, key ds.Key) error {
+	_, err := c.delete(fmt.Sprintf("/txn/%s/keys%s", id, keyPath(key)))
+	return err
+}
+
+func (c *APIClient) TxnListKeys(ctx context.Context, id, prefix string, keysOnly bool, limit int) ([]interface{}, error) {
+	endpoint := fmt.Sprintf("/txn/%s/keys?prefix=%s&keys_only=%t", id, url.QueryEscape(prefix), keysOnly)
+	if limit > 0 {
+		endpoint += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if keys, ok := data["keys"].([]interface{}); ok {
+			return keys, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// TxnCommit фиксирует транзакцию; при конфликте возвращает ErrTxnConflict.
+func (c *APIClient) TxnCommit(ctx context.Context, id string) error {
+	_, err := c.post(fmt.Sprintf("/txn/%s/commit", id), nil)
+	return err
+}
+
+func (c *APIClient) TxnDiscard(ctx context.Context, id string) error {
+	_, err := c.post(fmt.Sprintf("/txn/%s/discard", id), nil)
+	return err
+}
+
+// Views
+
+func (c *APIClient) ListViews(ctx context.Context) ([]ViewConfig, error) {
+	apiResp, err := c.get("/views")
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if views, ok := data["views"].([]interface{}); ok {
+			var configs []ViewConfig
+			for _, view := range views {
+				if viewMap, ok := view.(map[string]interface{}); ok {
+					if config, ok := viewMap["config"].(map[string]interface{}); ok {
+						bytes, err := json.Marshal(config)
+						if err != nil {
+							continue
+						}
+						var viewConfig ViewConfig
+						if err := json.Unmarshal(bytes, &viewConfig); err != nil {
+							continue
+						}
+						configs = append(configs, viewConfig)
+					}
+				}
+			}
+			return configs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) CreateView(ctx context.Context, config ViewConfig) error {
+	_, err := c.post("/views", config)
+	return err
+}
+
+func (c *APIClient) GetView(ctx context.Context, id string) (*ViewConfig, error) {
+	endpoint := fmt.Sprintf("/views/%s", id)
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if config, ok := data["config"].(map[string]interface{}); ok {
+			bytes, err := json.Marshal(config)
+			if err != nil {
+				return nil, err
+			}
+			var viewConfig ViewConfig
+			if err := json.Unmarshal(bytes, &viewConfig); err != nil {
+				return nil, err
+			}
+			return &viewConfig, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) UpdateView(ctx context.Context, id string, config ViewConfig) error {
+	endpoint := fmt.Sprintf("/views/%s", id)
+	config.ID = id
+	_, err := c.put(endpoint, config)
+	return err
+}
+
+func (c *APIClient) DeleteView(ctx context.Context, id string) error {
+	endpoint := fmt.Sprintf("/views/%s", id)
+	_, err := c.delete(endpoint)
+	return err
+}
+
+func (c *APIClient) ExecuteView(ctx context.Context, id string) ([]ViewResult, error) {
+	endpoint := fmt.Sprintf("/views/%s/execute", id)
+	apiResp, err := c.post(endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if results, ok := data["results"].([]interface{}); ok {
+			var viewResults []ViewResult
+			bytes, err := json.Marshal(results)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(bytes, &viewResults); err != nil {
+				return nil, err
+			}
+			return viewResults, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) ExecuteViewWithRange(ctx context.Context, id string, start, end ds.Key) ([]ViewResult, error) {
+	params := url.Values{}
+	if start.String() != "" {
+		params.Set("start", start.String())
+	}
+	if end.String() != "" {
+		params.Set("end", end.String())
+	}
+	endpoint := fmt.Sprintf("/views/%s/execute", id)
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	apiResp, err := c.post(endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if results, ok := data["results"].([]interface{}); ok {
+			var viewResults []ViewResult
+			bytes, err := json.Marshal(results)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(bytes, &viewResults); err != nil {
+				return nil, err
+			}
+			return viewResults, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) RefreshView(ctx context.Context, id string) error {
+	endpoint := fmt.Sprintf("/views/%s/refresh", id)
+	_, err := c.post(endpoint, nil)
+	return err
+}
+
+func (c *APIClient) RefreshAllViews(ctx context.Context) error {
+	_, err := c.post("/views/refresh", nil)
+	return err
+}
+
+func (c *APIClient) GetViewStats(ctx context.Context, id string) (*ViewStats, error) {
+	endpoint := fmt.Sprintf("/views/%s/stats", id)
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats ViewStats
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &stats); err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Индексы
+
+func (c *APIClient) ListIndexes(ctx context.Context) ([]IndexConfig, error) {
+	apiResp, err := c.get("/indexes")
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if indexes, ok := data["indexes"].([]interface{}); ok {
+			bytes, err := json.Marshal(indexes)
+			if err != nil {
+				return nil, err
+			}
+			var configs []IndexConfig
+			if err := json.Unmarshal(bytes, &configs); err != nil {
+				return nil, err
+			}
+			return configs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) CreateIndex(ctx context.Context, config IndexConfig) error {
+	_, err := c.post("/indexes", config)
+	return err
+}
+
+func (c *APIClient) DropIndex(ctx context.Context, name string) error {
+	endpoint := fmt.Sprintf("/indexes/%s", url.PathEscape(name))
+	_, err := c.delete(endpoint)
+	return err
+}
+
+func (c *APIClient) RebuildIndex(ctx context.Context, name string) error {
+	endpoint := fmt.Sprintf("/indexes/%s/rebuild", url.PathEscape(name))
+	_, err := c.post(endpoint, nil)
+	return err
+}
+
+func (c *APIClient) LookupIndex(ctx context.Context, name string, value any) ([]ds.Key, error) {
+	params := url.Values{}
+	params.Set("value", fmt.Sprint(value))
+	endpoint := fmt.Sprintf("/indexes/%s/lookup?%s", url.PathEscape(name), params.Encode())
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if keys, ok := data["keys"].([]interface{}); ok {
+			result := make([]ds.Key, 0, len(keys))
+			for _, key := range keys {
+				if keyStr, ok := key.(string); ok {
+					result = append(result, ds.NewKey(keyStr))
+				}
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) RangeIndex(ctx context.Context, name string, from, to any) ([]IndexEntry, error) {
+	params := url.Values{}
+	if from != nil {
+		params.Set("from", fmt.Sprint(from))
+	}
+	if to != nil {
+		params.Set("to", fmt.Sprint(to))
+	}
+	endpoint := fmt.Sprintf("/indexes/%s/range", url.PathEscape(name))
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if entries, ok := data["entries"].([]interface{}); ok {
+			bytes, err := json.Marshal(entries)
+			if err != nil {
+				return nil, err
+			}
+			var result []IndexEntry
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Подписки
+
+func (c *APIClient) CreateSubscription(ctx context.Context, id, script string, config *JSSubscriberConfig) error {
+	req := SubscriptionRequest{
+		ID:     id,
+		Script: script,
+	}
+
+	if config != nil {
+		req.ExecutionTimeout = int(config.ExecutionTimeout.Seconds())
+		req.EnableNetworking = config.EnableNetworking
+		req.EnableLogging = config.EnableLogging
+		req.StrictMode = config.StrictMode
+
+		// Преобразуем EventType в строки
+		for _, eventType := range config.EventFilters {
+			switch eventType {
+			case EventPut:
+				req.EventFilters = append(req.EventFilters, "put")
+			case EventDelete:
+				req.EventFilters = append(req.EventFilters, "delete")
+			case EventBatch:
+				req.EventFilters = append(req.EventFilters, "batch")
+			case EventTTLExpired:
+				req.EventFilters = append(req.EventFilters, "ttl_expired")
+			case EventTransformJob:
+				req.EventFilters = append(req.EventFilters, "transform_job")
+			}
+		}
+	}
+
+	_, err := c.post("/subscriptions", req)
+	return err
+}
+
+func (c *APIClient) RemoveSubscription(ctx context.Context, id string) error {
+	endpoint := fmt.Sprintf("/subscriptions/%s", id)
+	_, err := c.delete(endpoint)
+	return err
+}
+
+func (c *APIClient) ListSubscriptions(ctx context.Context) ([]jsSubscription, error) {
+	apiResp, err := c.get("/subscriptions")
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if subsData, ok := data["subscriptions"].([]interface{}); ok {
+			var subscriptions []jsSubscription
+
+			// Конвертируем через JSON для корректного парсинга
+			jsonData, err := json.Marshal(subsData)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := json.Unmarshal(jsonData, &subscriptions); err != nil {
+				return nil, err
+			}
+
+			return subscriptions, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Система
+
+func (c *APIClient) SetMode(ctx context.Context, silent bool) error {
+	req := map[string]bool{"silent": silent}
+	_, err := c.post("/system/mode", req)
+	return err
+}
+
+func (c *APIClient) GC(ctx context.Context) error {
+	_, err := c.post("/system/gc", nil)
+	return err
+}
+
+// Утилиты
+
+func (c *APIClient) Health() error {
+	_, err := c.get("/health")
+	return err
+}
+
+func (c *APIClient) GetDocs() (string, error) {
+	url := c.baseURL + "/api/v1/docs"
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// Стрим операции (упрощенные версии)
+
+func (c *APIClient) StreamTo(ctx context.Context, writer io.Writer, opts *StreamOptions) error {
+	endpoint := "/stream"
+	params := []string{}
+
+	if opts != nil {
+		if opts.Format != "" {
+			params = append(params, fmt.Sprintf("format=%s", opts.Format))
+		}
+		if opts.Prefix.String() != "" {
+			params = append(params, fmt.Sprintf("prefix=%s", opts.Prefix.String()))
+		}
+		if opts.JQFilter != "" {
+			params = append(params, fmt.Sprintf("jq=%s", opts.JQFilter))
+		}
+		if opts.IncludeKeys {
+			params = append(params, "include_keys=true")
+		}
+		if opts.Limit > 0 {
+			params = append(params, fmt.Sprintf("limit=%d", opts.Limit))
+		}
+	}
+
+	if len(params) > 0 {
+		endpoint += "?" + strings.Join(params, "&")
+	}
+
+	url := c.baseURL + "/api/v1" + endpoint
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	_, err = io.Copy(writer, resp.Body)
+	return err
+}
+
+func (c *APIClient) GetTTLStats(ctx context.Context, prefix ds.Key) (*TTLStats, error) {
+	endpoint := "/ttl/stats"
+	if prefix.String() != "" {
+		endpoint += fmt.Sprintf("?prefix=%s", url.QueryEscape(prefix.String()))
+	}
+
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats TTLStats
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &stats); err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+func (c *APIClient) SetTTLPolicy(ctx context.Context, policy TTLPolicy) error {
+	_, err := c.post("/ttl/policies", policy)
+	return err
+}
+
+func (c *APIClient) RemoveTTLPolicy(ctx context.Context, prefix ds.Key) error {
+	_, err := c.delete("/ttl/policies" + keyPath(prefix))
+	return err
+}
+
+// ListTTLPolicies возвращает политики TTL; если key не пустой - только
+// политику, действующую для ключа.
+func (c *APIClient) ListTTLPolicies(ctx context.Context, key ds.Key) ([]TTLPolicy, error) {
+	endpoint := "/ttl/policies"
+	if key.String() != "" {
+		endpoint += "?key=" + url.QueryEscape(key.String())
+	}
+	apiResp, err := c.get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := apiResp.Data.(map[string]interface{}); ok {
+		if policies, ok := data["policies"].([]interface{}); ok {
+			bytes, err := json.Marshal(policies)
+			if err != nil {
+				return nil, err
+			}
+			var result []TTLPolicy
+			if err := json.Unmarshal(bytes, &result); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("неожиданный формат ответа")
+}
+
+// Токены доступа
+
+func (c *APIClient) CreateToken(ctx context.Context, spec TokenSpec) (string, *APIToken, error) {
+	body := map[string]interface{}{
+		"name":   spec.Name,
+		"scopes": spec.Scopes,
+	}
+	if spec.TTL > 0 {
+		body["ttl"] = spec.TTL.String()
+	}
+	if spec.MaxKeys > 0 {
+		body["max_keys"] = spec.MaxKeys
+	}
+	if spec.MaxBytes > 0 {
+		body["max_bytes"] = spec.MaxBytes
+	}
+	apiResp, err := c.post("/system/tokens", body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result struct {
+		Token  string   `json:"token"`
+		Record APIToken `json:"record"`
+	}
+	data, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", nil, err
+	}
+	return result.Token, &result.Record, nil
+}
+
+func (c *APIClient) ListTokens(ctx context.Context) ([]APIToken, error) {
+	apiResp, err := c.get("/system/tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *APIClient) RevokeToken(ctx context.Context, id string) error {
+	_, err := c.delete("/system/tokens/" + url.PathEscape(id))
+	return err
+}
+
+// AuthenticateToken проверяет секрет на сервере и возвращает его токен.
+func (c *APIClient) AuthenticateToken(ctx context.Context, secret string) (*APIToken, error) {
+	other := *c
+	other.token = secret
+	apiResp, err := other.get("/system/whoami")
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		AuthEnabled bool      `json:"auth_enabled"`
+		Token       *APIToken `json:"token"`
+	}
+	data, err := json.Marshal(apiResp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if !result.AuthEnabled || result.Token == nil {
+		return nil, fmt.Errorf("авторизация на сервере отключена")
+	}
+	return result.Token, nil
+}
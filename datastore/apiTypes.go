@@ -28,12 +28,45 @@ type APIStatsResponse struct {
 
 // APIKeyInfo информация о ключе
 type APIKeyInfo struct {
-	Key         string                 `json:"key"`
-	Value       string                 `json:"value"`
-	Size        int                    `json:"size"`
-	ContentType string                 `json:"content_type"`
-	TTL         string                 `json:"ttl,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Encoding - base64, если значение не является корректным UTF-8
+	// или запрошено format=base64
+	Encoding string `json:"encoding,omitempty"`
+	Size     int    `json:"size"`
+	// ContentType - вид значения: json, text или binary
+	ContentType string `json:"content_type"`
+	// MediaType - MIME-тип, сохраненный при записи
+	MediaType string                 `json:"media_type,omitempty"`
+	TTL       string                 `json:"ttl,omitempty"`
+	ETag      string                 `json:"etag"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Schemas   []APIKeySchemaStatus   `json:"schemas,omitempty"`
+}
+
+// APIKeySchemaStatus соответствие значения ключа одной из его схем
+type APIKeySchemaStatus struct {
+	Name       string            `json:"name"`
+	Pattern    string            `json:"pattern"`
+	Valid      bool              `json:"valid"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+// APIPutRequest тело записи ключа при Content-Type application/json
+type APIPutRequest struct {
+	Value string `json:"value"`
+	// Encoding - кодировка Value: пусто - строка как есть, base64 - двоичное значение
+	Encoding string `json:"encoding,omitempty"`
+	// ContentType - MIME-тип значения, сохраняется вместе с ним
+	ContentType string `json:"content_type,omitempty"`
+	// KeepContentType оставляет сохраненный тип при пустом ContentType
+	KeepContentType bool          `json:"keep_content_type,omitempty"`
+	TTL             time.Duration `json:"ttl,omitempty"`
+}
+
+// APIPutResponse ответ записи ключа
+type APIPutResponse struct {
+	ETag string `json:"etag"`
 }
 
 // APISearchResponse ответ поиска
@@ -42,6 +75,8 @@ type APISearchResponse struct {
 	Found     int           `json:"found"`
 	Total     int           `json:"total"`
 	Truncated bool          `json:"truncated,omitempty"`
+	// NextCursor - курсор следующей страницы, если Truncated
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // APIListKeysResponse ответ со списком ключей
@@ -49,12 +84,25 @@ type APIListKeysResponse struct {
 	Keys      []interface{} `json:"keys"`
 	Total     int           `json:"total"`
 	Truncated bool          `json:"truncated,omitempty"`
+	// NextCursor - курсор следующей страницы, если Truncated
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // APIJQQueryResponse ответ JQ запроса
 type APIJQQueryResponse struct {
-	Results []map[string]interface{} `json:"results"`
-	Total   int                      `json:"total"`
+	Results    []map[string]interface{} `json:"results"`
+	Total      int                      `json:"total"`
+	Truncated  bool                     `json:"truncated,omitempty"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// APIJQAggregateRequest запрос JQ агрегации
+type APIJQAggregateRequest struct {
+	Query            string        `json:"query"`
+	Prefix           string        `json:"prefix,omitempty"`
+	Timeout          time.Duration `json:"timeout,omitempty"`
+	TreatAsString    bool          `json:"treat_as_string,omitempty"`
+	IgnoreParseError bool          `json:"ignore_parse_error,omitempty"`
 }
 
 // APIJQAggregateResponse ответ JQ агрегации
@@ -91,8 +139,10 @@ type APIViewResponse struct {
 
 // APIViewExecuteResponse ответ выполнения view
 type APIViewExecuteResponse struct {
-	Results []ViewResult `json:"results"`
-	Total   int          `json:"total"`
+	Results    []ViewResult `json:"results"`
+	Total      int          `json:"total"`
+	Truncated  bool         `json:"truncated,omitempty"`
+	NextCursor string       `json:"next_cursor,omitempty"`
 }
 
 // APISubscriptionsListResponse ответ со списком подписок
@@ -103,7 +153,24 @@ type APISubscriptionsListResponse struct {
 
 // APIBatchResponse ответ batch операции
 type APIBatchResponse struct {
-	OperationsCount int `json:"operations_count"`
+	OperationsCount int              `json:"operations_count"`
+	Atomic          bool             `json:"atomic"`
+	Succeeded       int              `json:"succeeded"`
+	Failed          int              `json:"failed"`
+	Results         []APIBatchResult `json:"results"`
+}
+
+// APIBatchResult результат операции batch. Status - HTTP код операции:
+// 201 для записи, 200 для удаления, 424 для операции отмененного
+// атомарного пакета. ETag - новый ETag записи или текущий при 412.
+type APIBatchResult struct {
+	Index      int               `json:"index"`
+	Op         string            `json:"op"`
+	Key        string            `json:"key"`
+	Status     int               `json:"status"`
+	ETag       string            `json:"etag,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Violations []SchemaViolation `json:"violations,omitempty"`
 }
 
 // APITransformResponse ответ трансформации
@@ -116,6 +183,136 @@ type APISystemModeResponse struct {
 	Mode string `json:"mode"`
 }
 
+// APISetModeRequest запрос смены режима системы
+type APISetModeRequest struct {
+	Silent bool `json:"silent"`
+}
+
+// APIBeginTxnRequest запрос открытия транзакции
+type APIBeginTxnRequest struct {
+	ReadOnly bool          `json:"read_only"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+}
+
+// APITxnResponse ответ открытия транзакции
+type APITxnResponse struct {
+	ID        string    `json:"id"`
+	ReadOnly  bool      `json:"read_only"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// APISchemasListResponse ответ со списком схем
+type APISchemasListResponse struct {
+	Schemas []KeySchema `json:"schemas"`
+	Total   int         `json:"total"`
+}
+
+// APIValidateRequest запрос проверки значения по схемам ключа
+type APIValidateRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// APIValidateResponse ответ проверки значения по схемам ключа
+type APIValidateResponse struct {
+	Key        string            `json:"key"`
+	Valid      bool              `json:"valid"`
+	Schemas    []KeySchema       `json:"schemas"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+// APIIndexesListResponse ответ со списком индексов
+type APIIndexesListResponse struct {
+	Indexes []IndexConfig `json:"indexes"`
+	Total   int           `json:"total"`
+}
+
+// APIIndexLookupResponse ответ поиска по индексу
+type APIIndexLookupResponse struct {
+	Keys  []string `json:"keys"`
+	Total int      `json:"total"`
+}
+
+// APIIndexRangeResponse ответ выборки диапазона индекса
+type APIIndexRangeResponse struct {
+	Entries   []IndexEntry `json:"entries"`
+	Total     int          `json:"total"`
+	Truncated bool         `json:"truncated"`
+}
+
+// APITransformJournalsResponse ответ со списком журналов трансформаций
+type APITransformJournalsResponse struct {
+	Journals []TransformJournal `json:"journals"`
+	Total    int                `json:"total"`
+}
+
+// APITransformJobsResponse ответ со списком заданий трансформации
+type APITransformJobsResponse struct {
+	Jobs  []TransformJob `json:"jobs"`
+	Total int            `json:"total"`
+}
+
+// APIThrottleRequest запрос изменения скорости задания
+type APIThrottleRequest struct {
+	RateLimit float64 `json:"rate_limit"`
+}
+
+// APITTLKeysResponse ответ со списком ключей с TTL
+type APITTLKeysResponse struct {
+	Keys  []TTLKeyStatus `json:"keys"`
+	Total int            `json:"total"`
+}
+
+// APITTLCleanupResponse ответ очистки истекших ключей
+type APITTLCleanupResponse struct {
+	Removed int `json:"removed"`
+}
+
+// APITTLBatchRequest запрос установки TTL для нескольких ключей
+type APITTLBatchRequest struct {
+	Keys []string      `json:"keys"`
+	TTL  time.Duration `json:"ttl"`
+}
+
+// APIExtendTTLRequest запрос продления TTL
+type APIExtendTTLRequest struct {
+	Extension time.Duration `json:"extension"`
+}
+
+// APITTLPoliciesResponse ответ со списком политик TTL
+type APITTLPoliciesResponse struct {
+	Policies []TTLPolicy `json:"policies"`
+	Total    int         `json:"total"`
+}
+
+// APIImportResponse ответ импорта
+type APIImportResponse struct {
+	Total *TransferStats  `json:"total"`
+	Files []TransferStats `json:"files"`
+}
+
+// APICreateTokenRequest запрос создания токена
+type APICreateTokenRequest struct {
+	Name     string       `json:"name"`
+	Scopes   []TokenScope `json:"scopes"`
+	TTL      string       `json:"ttl,omitempty"`
+	MaxKeys  int64        `json:"max_keys,omitempty"`
+	MaxBytes int64        `json:"max_bytes,omitempty"`
+}
+
+// APICreateTokenResponse ответ создания токена: секрет показывается один раз
+type APICreateTokenResponse struct {
+	Token  string    `json:"token"`
+	Record *APIToken `json:"record"`
+}
+
+// APIWhoAmIResponse токен текущего запроса и использование его квоты
+type APIWhoAmIResponse struct {
+	AuthEnabled bool        `json:"auth_enabled"`
+	Token       *APIToken   `json:"token,omitempty"`
+	Quota       *quotaUsage `json:"quota,omitempty"`
+}
+
 // Дополнительные вспомогательные функции
 
 // NewKey создает новый ключ из строки
@@ -166,6 +363,8 @@ func EventTypeToString(eventType EventType) string {
 		return "batch"
 	case EventTTLExpired:
 		return "ttl_expired"
+	case EventTransformJob:
+		return "transform_job"
 	default:
 		return "unknown"
 	}
@@ -182,6 +381,8 @@ func StringToEventType(s string) EventType {
 		return EventBatch
 	case "ttl_expired":
 		return EventTTLExpired
+	case "transform_job":
+		return EventTransformJob
 	default:
 		return EventPut // дефолтный тип
 	}
@@ -244,11 +445,10 @@ func DefaultStreamOptions() *StreamOptions {
 // DefaultTransformOptions возвращает опции трансформации по умолчанию
 func DefaultTransformOptions() *TransformOptions {
 	return &TransformOptions{
-		TreatAsString: false,
-		IgnoreErrors:  false,
-		DryRun:        false,
-		Timeout:       30 * time.Second,
-		BatchSize:     100,
+		IgnoreErrors: false,
+		DryRun:       false,
+		Timeout:      30 * time.Second,
+		BatchSize:    100,
 	}
 }
 
@@ -0,0 +1,343 @@
+package datastore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// newTestAPI поднимает сервер с авторизацией по токенам поверх временного
+// датастора.
+func newTestAPI(t *testing.T) (Datastore, *httptest.Server) {
+	t.Helper()
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	config := DefaultConfig()
+	config.EnableMetrics = false
+	config.LogRequests = false
+	config.EnableAuth = true
+	config.RateLimitRPS = 0
+	config.WriteRateLimitRPS = 0
+	config.ExpensiveRateLimitRPS = 0
+	server := httptest.NewServer(NewAPIServer(store, config).Handler())
+	t.Cleanup(server.Close)
+	return store, server
+}
+
+func createTestToken(t *testing.T, store Datastore, scopes ...TokenScope) string {
+	t.Helper()
+	secret, _, err := store.CreateToken(context.Background(), TokenSpec{Name: t.Name(), Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// testRequest выполняет запрос к API с токеном secret; body кодируется в JSON.
+func testRequest(t *testing.T, server *httptest.Server, secret, method, path string, body any) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	s := &APIServer{config: &Config{EnableCompression: true}}
+	body := `{"success":true}`
+	handler := s.compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("partial") == "true" {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/keys/a", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding %q, ожидался gzip", rec.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Fatalf("тело %q, ожидалось %q", got, body)
+	}
+
+	// Частичный ответ отдается без сжатия
+	req = httptest.NewRequest("GET", "/api/v1/keys/a?partial=true", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Fatalf("частичный ответ сжат: %q %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestTransformJSKeyScope(t *testing.T) {
+	store, server := newTestAPI(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, ds.NewKey("/data/a"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	secret := createTestToken(t, store, TokenScope{Permission: PermissionWrite, Prefix: "/data"})
+
+	for _, target := range []string{"/other/a", "/_system/ds-tokens/a"} {
+		script := `return [{key: "` + target + `", value: 1}]`
+		status, body := testRequest(t, server, secret, "POST", "/api/v1/transform/js", map[string]any{"prefix": "/data", "script": script})
+		if status != http.StatusForbidden {
+			t.Fatalf("запись в %s: статус %d, ожидался 403: %s", target, status, body)
+		}
+		if has, _ := store.Has(ctx, ds.NewKey(target)); has {
+			t.Fatalf("скрипт записал %s", target)
+		}
+	}
+
+	script := `return [{key: "/data/a/copy", value: value}]`
+	status, body := testRequest(t, server, secret, "POST", "/api/v1/transform/js", map[string]any{"prefix": "/data", "script": script})
+	if status != http.StatusOK {
+		t.Fatalf("запись внутри префикса: статус %d: %s", status, body)
+	}
+	if has, _ := store.Has(ctx, ds.NewKey("/data/a/copy")); !has {
+		t.Fatal("запись внутри префикса не выполнена")
+	}
+}
+
+func TestTxnOwner(t *testing.T) {
+	store, server := newTestAPI(t)
+	owner := createTestToken(t, store, TokenScope{Permission: PermissionWrite, Prefix: "/data"}, TokenScope{Permission: PermissionRead, Prefix: "/data"})
+	other := createTestToken(t, store, TokenScope{Permission: PermissionWrite, Prefix: "/data"}, TokenScope{Permission: PermissionRead, Prefix: "/data"})
+
+	status, body := testRequest(t, server, owner, "POST", "/api/v1/txn", map[string]any{})
+	if status != http.StatusCreated {
+		t.Fatalf("открытие транзакции: статус %d: %s", status, body)
+	}
+	var resp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	id := resp.Data.ID
+	if len(id) != 32 {
+		t.Fatalf("ID транзакции %q, ожидалось 128 бит в hex", id)
+	}
+
+	for _, op := range []struct{ method, path string }{
+		{"PUT", "/keys/data/a"},
+		{"GET", "/keys/data/a"},
+		{"POST", "/commit"},
+		{"POST", "/discard"},
+	} {
+		if status, body := testRequest(t, server, other, op.method, "/api/v1/txn/"+id+op.path, map[string]any{"value": "1"}); status != http.StatusNotFound {
+			t.Fatalf("%s %s чужим токеном: статус %d, ожидался 404: %s", op.method, op.path, status, body)
+		}
+	}
+	// Право на ключ по-прежнему проверяется для каждой операции
+	if status, body := testRequest(t, server, owner, "PUT", "/api/v1/txn/"+id+"/keys/other/a", map[string]any{"value": "1"}); status != http.StatusForbidden {
+		t.Fatalf("запись вне области токена: статус %d, ожидался 403: %s", status, body)
+	}
+	if status, body := testRequest(t, server, owner, "PUT", "/api/v1/txn/"+id+"/keys/data/a", map[string]any{"value": "1"}); status != http.StatusOK {
+		t.Fatalf("запись владельцем: статус %d: %s", status, body)
+	}
+	if status, body := testRequest(t, server, owner, "POST", "/api/v1/txn/"+id+"/commit", nil); status != http.StatusOK {
+		t.Fatalf("коммит владельцем: статус %d: %s", status, body)
+	}
+	if has, _ := store.Has(context.Background(), ds.NewKey("/data/a")); !has {
+		t.Fatal("транзакция не зафиксирована")
+	}
+}
+
+// Маршруты без области в пути проверяют ключи и префиксы из тела запроса сами.
+func TestAnyScopeRoutes(t *testing.T) {
+	store, server := newTestAPI(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, ds.NewKey("/other/a"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	secret := createTestToken(t, store,
+		TokenScope{Permission: PermissionRead, Prefix: "/data"},
+		TokenScope{Permission: PermissionWrite, Prefix: "/data"},
+		TokenScope{Permission: PermissionSubscribe, Prefix: "/data"},
+		TokenScope{Permission: PermissionAdmin, Prefix: "/data"})
+
+	for _, tc := range []struct {
+		method, path string
+		body         any
+	}{
+		{"POST", "/query", map[string]any{"prefix": "/other", "query": "."}},
+		{"POST", "/query/aggregate", map[string]any{"prefix": "/other", "query": "."}},
+		{"POST", "/batch", map[string]any{"operations": []map[string]any{{"op": "put", "key": "/data/a", "value": "1"}, {"op": "put", "key": "/other/b", "value": "1"}}}},
+		{"POST", "/transform", map[string]any{"prefix": "/other", "options": map[string]any{"jq": "."}}},
+		{"POST", "/transform/jq", map[string]any{"prefix": "/other", "jq_expression": "."}},
+		{"POST", "/transform/patch", map[string]any{"prefix": "/other", "patch_ops": []map[string]any{{"op": "add", "path": "/x", "value": 1}}}},
+		{"POST", "/transform/js", map[string]any{"prefix": "/other", "script": "return value"}},
+		{"POST", "/transform/jobs", map[string]any{"prefix": "/other", "jq": "."}},
+		{"POST", "/ttl/batch", map[string]any{"keys": []string{"/data/a", "/other/a"}, "ttl": int64(time.Hour)}},
+		{"POST", "/ttl/policies", map[string]any{"prefix": "/other", "default_ttl": int64(time.Hour)}},
+		{"POST", "/schemas/validate", map[string]any{"key": "/other/a", "value": "{}"}},
+		{"GET", "/subscriptions", nil},
+		{"POST", "/subscriptions", map[string]any{"id": "s", "script": "return"}},
+	} {
+		if status, body := testRequest(t, server, secret, tc.method, "/api/v1"+tc.path, tc.body); status != http.StatusForbidden {
+			t.Errorf("%s %s вне области токена: статус %d, ожидался 403: %s", tc.method, tc.path, status, body)
+		}
+	}
+	if has, _ := store.Has(ctx, ds.NewKey("/data/a")); has {
+		t.Error("пакет выполнен частично при запрете одной из операций")
+	}
+	if value, _ := store.Get(ctx, ds.NewKey("/other/a")); string(value) != `{"n":1}` {
+		t.Errorf("значение вне области изменено: %s", value)
+	}
+
+	// JS подписки - серверные скрипты, их создает только администратор
+	subscriber := createTestToken(t, store, TokenScope{Permission: PermissionSubscribe, Prefix: "/"})
+	if status, body := testRequest(t, server, subscriber, "POST", "/api/v1/subscriptions", map[string]any{"id": "s", "script": "return"}); status != http.StatusForbidden {
+		t.Errorf("создание подписки без права admin: статус %d, ожидался 403: %s", status, body)
+	}
+
+	// /indexes показывает только индексы в области токена
+	if err := store.CreateIndex(ctx, IndexConfig{Name: "other_n", Prefix: "/other", Path: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	status, body := testRequest(t, server, secret, "GET", "/api/v1/indexes", nil)
+	if status != http.StatusOK || bytes.Contains(body, []byte("other_n")) {
+		t.Errorf("список индексов: статус %d, индекс вне области виден: %s", status, body)
+	}
+
+	// Экспорт без права admin не отдает системные ключи
+	reader := createTestToken(t, store, TokenScope{Permission: PermissionRead, Prefix: "/"})
+	status, body = testRequest(t, server, reader, "GET", "/api/v1/export?prefix=/&skip_system=false&format=simple", nil)
+	if status != http.StatusOK || !bytes.Contains(body, []byte("/other/a")) || bytes.Contains(body, []byte("/_system")) {
+		t.Errorf("экспорт: статус %d, ожидались только пользовательские ключи: %s", status, body)
+	}
+
+	// /ws отклоняет подписку вне области токена
+	header := http.Header{"Authorization": {"Bearer " + secret}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(WSClientMessage{Type: "subscribe", ID: "other", Patterns: []string{"/other/*"}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg WSServerMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != "other" {
+			continue
+		}
+		if msg.Type != "error" {
+			t.Errorf("подписка вне области токена: %q, ожидалась ошибка", msg.Type)
+		}
+		break
+	}
+}
+
+func TestQuotaChunkedBody(t *testing.T) {
+	store, server := newTestAPI(t)
+	ctx := context.Background()
+	secret, _, err := store.CreateToken(ctx, TokenSpec{
+		Name:     t.Name(),
+		Scopes:   []TokenScope{{Permission: PermissionWrite, Prefix: "/data"}},
+		MaxBytes: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// put отправляет тело без Content-Length, как chunked загрузка
+	put := func(key string, size int) int {
+		t.Helper()
+		body := io.MultiReader(strings.NewReader(strings.Repeat("x", size)))
+		req, err := http.NewRequest("PUT", server.URL+"/api/v1/keys"+key, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+secret)
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := put("/data/big", 200); status != http.StatusInsufficientStorage {
+		t.Fatalf("тело больше квоты: статус %d, ожидался 507", status)
+	}
+	if has, _ := store.Has(ctx, ds.NewKey("/data/big")); has {
+		t.Fatal("значение сверх квоты записано")
+	}
+	if status := put("/data/a", 60); status != http.StatusCreated {
+		t.Fatalf("тело в пределах квоты: статус %d", status)
+	}
+	// Принятые 60 байт учтены, хотя Content-Length не был известен
+	if status := put("/data/b", 60); status != http.StatusInsufficientStorage {
+		t.Fatalf("суммарно больше квоты: статус %d, ожидался 507", status)
+	}
+
+	// Запись преобразованием учитывается при следующей проверке
+	if err := store.Delete(ctx, ds.NewKey("/data/a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, ds.NewKey("/data/c"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	script := `return [{key: "/data/c/copy", value: "` + strings.Repeat("y", 150) + `"}]`
+	if status, body := testRequest(t, server, secret, "POST", "/api/v1/transform/js", map[string]any{"prefix": "/data", "script": script}); status != http.StatusOK {
+		t.Fatalf("преобразование: статус %d: %s", status, body)
+	}
+	if status := put("/data/d", 1); status != http.StatusInsufficientStorage {
+		t.Fatalf("запись после преобразования сверх квоты: статус %d, ожидался 507", status)
+	}
+}
@@ -0,0 +1,212 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	ds "github.com/ipfs/go-datastore"
+)
+
+type tokenContextKey struct{}
+
+// rootToken - принципал для общего Config.AuthToken с полным доступом.
+var rootToken = &APIToken{
+	ID:     "root",
+	Name:   "config auth_token",
+	Scopes: []TokenScope{{Permission: PermissionAdmin, Prefix: "/"}},
+}
+
+// requestToken возвращает токен запроса; nil - авторизация отключена.
+func requestToken(r *http.Request) *APIToken {
+	token, _ := r.Context().Value(tokenContextKey{}).(*APIToken)
+	return token
+}
+
+// authenticate сопоставляет Bearer токен с общим AuthToken или токеном из
+// хранилища.
+func (s *APIServer) authenticate(r *http.Request) (*APIToken, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return nil, errors.New("Требуется авторизация")
+	}
+
+	secret := strings.TrimPrefix(auth, "Bearer ")
+	if s.config.AuthToken != "" && secret == s.config.AuthToken {
+		return rootToken, nil
+	}
+
+	token, err := s.ds.AuthenticateToken(r.Context(), secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTokenExpired):
+			return nil, errors.New("Срок действия токена истек")
+		case errors.Is(err, ErrTokenRevoked):
+			return nil, errors.New("Токен отозван")
+		case errors.Is(err, ErrTokenInvalid):
+			return nil, errors.New("Недействительный токен")
+		}
+		return nil, fmt.Errorf("Ошибка проверки токена: %v", err)
+	}
+	return token, nil
+}
+
+// authorize проверяет право токена запроса на ключ и при отказе отправляет 403.
+func (s *APIServer) authorize(w http.ResponseWriter, r *http.Request, permission TokenPermission, key ds.Key) bool {
+	token := requestToken(r)
+	if token == nil || token.Allows(permission, key) {
+		return true
+	}
+	s.sendErrorResponse(w, r, fmt.Sprintf("Недостаточно прав: требуется %s для %s", permission, key), http.StatusForbidden)
+	return false
+}
+
+// scopeKey извлекает ключ, на который проверяется право маршрута; false -
+// ключ проверяет сам обработчик, а маршрут требует право на любой префикс.
+type scopeKey func(r *http.Request) (ds.Key, bool)
+
+func pathScope(name string) scopeKey {
+	return func(r *http.Request) (ds.Key, bool) {
+		return ds.NewKey(mux.Vars(r)[name]), true
+	}
+}
+
+func queryScope(name string) scopeKey {
+	return func(r *http.Request) (ds.Key, bool) {
+		return ds.NewKey(r.URL.Query().Get(name)), true
+	}
+}
+
+func rootScope(r *http.Request) (ds.Key, bool) {
+	return ds.NewKey("/"), true
+}
+
+func anyScope(r *http.Request) (ds.Key, bool) {
+	return ds.Key{}, false
+}
+
+// allowTransformKeys ограничивает записи скрипта трансформации ключами, на
+// которые у токена запроса есть право записи.
+func allowTransformKeys(r *http.Request, opts *TransformOptions) {
+	if token := requestToken(r); token != nil {
+		opts.AllowKey = func(key ds.Key) bool {
+			return token.Allows(PermissionWrite, key)
+		}
+	}
+}
+
+// authorizeTransformJob загружает задание из пути запроса и проверяет право
+// записи на его префикс; при ошибке ответ уже отправлен.
+func (s *APIServer) authorizeTransformJob(ctx context.Context, w http.ResponseWriter, r *http.Request) (*TransformJob, bool) {
+	job, err := s.ds.GetTransformJob(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		s.sendErrorResponse(w, r, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if !s.authorize(w, r, PermissionWrite, transformScope(&job.Options)) {
+		return nil, false
+	}
+	return job, true
+}
+
+// scoped оборачивает обработчик проверкой права токена.
+func (s *APIServer) scoped(permission TokenPermission, scope scopeKey, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token != nil {
+			key, ok := scope(r)
+			if !ok {
+				if !token.AllowsAny(permission) {
+					s.sendErrorResponse(w, r, fmt.Sprintf("Недостаточно прав: требуется %s", permission), http.StatusForbidden)
+					return
+				}
+			} else if !s.authorize(w, r, permission, key) {
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// Token handlers
+
+func (s *APIServer) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	var req APICreateTokenRequest
+	if err := s.parseJSONBody(r, &req); err != nil {
+		s.sendErrorResponse(w, r, "Неверный JSON", http.StatusBadRequest)
+		return
+	}
+
+	spec := TokenSpec{Name: req.Name, Scopes: req.Scopes, MaxKeys: req.MaxKeys, MaxBytes: req.MaxBytes}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			s.sendErrorResponse(w, r, "Неверный формат TTL", http.StatusBadRequest)
+			return
+		}
+		spec.TTL = ttl
+	}
+
+	secret, token, err := s.ds.CreateToken(ctx, spec)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка создания токена: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, map[string]interface{}{
+		"token":  secret,
+		"record": token,
+	}, "Токен создан", http.StatusCreated)
+}
+
+func (s *APIServer) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	tokens, err := s.ds.ListTokens(ctx)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка получения токенов: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendResponse(w, r, tokens)
+}
+
+func (s *APIServer) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.getContextWithTimeout(r)
+	defer cancel()
+
+	if err := s.ds.RevokeToken(ctx, mux.Vars(r)["id"]); err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка отзыва токена: %v", err), http.StatusNotFound)
+		return
+	}
+
+	s.sendResponseWithMessage(w, r, nil, "Токен отозван", http.StatusOK)
+}
+
+// handleWhoAmI возвращает токен текущего запроса и использование его квот.
+func (s *APIServer) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	if token == nil {
+		s.sendResponse(w, r, map[string]interface{}{"auth_enabled": false})
+		return
+	}
+
+	result := map[string]interface{}{"auth_enabled": true, "token": token}
+	if hasQuota(token) {
+		usage, err := s.quotaUsage(r.Context(), token)
+		if err != nil {
+			s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка проверки квоты: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result["quota"] = usage
+	}
+	s.sendResponse(w, r, result)
+}
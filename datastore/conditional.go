@@ -0,0 +1,202 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// --- Optimistic concurrency
+
+// ETagAny в условии совпадает с любым существующим значением.
+const ETagAny = "*"
+
+// ErrPreconditionFailed - базовая ошибка несовпадения ETag,
+// проверяется через errors.Is.
+var ErrPreconditionFailed = errors.New("условие записи не выполнено")
+
+// PreconditionFailedError возвращается PutIfMatch, PutIfNoneMatch и
+// DeleteIfMatch, если текущее значение ключа не соответствует условию.
+// ETag - текущий ETag ключа, пустой если ключ отсутствует.
+type PreconditionFailedError struct {
+	Key  ds.Key `json:"key"`
+	ETag string `json:"etag,omitempty"`
+}
+
+func (e *PreconditionFailedError) Error() string {
+	if e.ETag == "" {
+		return fmt.Sprintf("%v: ключ %s не существует", ErrPreconditionFailed, e.Key)
+	}
+	return fmt.Sprintf("%v: текущий ETag ключа %s - %s", ErrPreconditionFailed, e.Key, e.ETag)
+}
+
+func (e *PreconditionFailedError) Is(target error) bool {
+	return target == ErrPreconditionFailed
+}
+
+// ConditionalFeatures - запись и удаление с проверкой ETag. ETag
+// вычисляется по содержимому значения, поэтому не меняется при повторной
+// записи того же значения. Проверка и запись выполняются в одной
+// транзакции: конкурентная запись между ними приводит к повторной проверке.
+type ConditionalFeatures interface {
+	GetWithETag(ctx context.Context, key ds.Key) ([]byte, string, error)
+	// PutIfMatch записывает значение, только если текущий ETag равен etag;
+	// ETagAny - если ключ существует.
+	PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	// PutIfNoneMatch записывает значение, только если текущий ETag не равен
+	// etag; ETagAny - только если ключа нет.
+	PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error
+}
+
+// ConditionalBatch - пакет с условными операциями. Условия проверяются при
+// Commit в порядке добавления операций, с учетом предыдущих записей пакета;
+// невыполненное условие отменяет весь пакет с PreconditionFailedError.
+type ConditionalBatch interface {
+	ds.Batch
+	PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error
+	DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error
+}
+
+var _ ConditionalBatch = (*pubsubBatch)(nil)
+
+// ErrBatchTooBig возвращает Commit атомарного пакета, операции которого не
+// помещаются в одну транзакцию badger.
+var ErrBatchTooBig = errors.New("пакет не помещается в одну транзакцию")
+
+// AtomicBatching - пакеты, применяемые целиком одной транзакцией.
+type AtomicBatching interface {
+	// AtomicBatch возвращает пакет, который никогда не делится на части:
+	// он применяется одной транзакцией или отклоняется с ErrBatchTooBig.
+	AtomicBatch(ctx context.Context) (ConditionalBatch, error)
+}
+
+// ETag возвращает ETag значения.
+func ETag(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:16])
+}
+
+type etagCondition struct {
+	match     string
+	noneMatch string
+}
+
+func (c *etagCondition) check(key ds.Key, current []byte) error {
+	var etag string
+	if current != nil {
+		etag = ETag(current)
+	}
+	ok := true
+	switch {
+	case c.match == ETagAny:
+		ok = current != nil
+	case c.match != "":
+		ok = current != nil && etag == c.match
+	}
+	switch {
+	case c.noneMatch == ETagAny:
+		ok = ok && current == nil
+	case c.noneMatch != "":
+		ok = ok && etag != c.noneMatch
+	}
+	if !ok {
+		return &PreconditionFailedError{Key: key, ETag: etag}
+	}
+	return nil
+}
+
+func normalizeETag(etag string) (string, error) {
+	etag = strings.TrimSpace(etag)
+	if etag == "" {
+		return "", fmt.Errorf("ETag не может быть пустым")
+	}
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), nil
+}
+
+func (s *datastorage) GetWithETag(ctx context.Context, key ds.Key) ([]byte, string, error) {
+	value, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, ETag(value), nil
+}
+
+func (s *datastorage) PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	return s.putConditional(ctx, key, value, &etagCondition{match: etag})
+}
+
+func (s *datastorage) PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	return s.putConditional(ctx, key, value, &etagCondition{noneMatch: etag})
+}
+
+func (s *datastorage) putConditional(ctx context.Context, key ds.Key, value []byte, cond *etagCondition) error {
+	if err := s.ValidateValue(key, value); err != nil {
+		return err
+	}
+	op := s.withTTLPolicy(batchOp{key: key, value: value, cond: cond, clearContentType: true})
+	if err := s.applyOp(ctx, op); err != nil {
+		return err
+	}
+	if !s.silentMode {
+		s.publishEvent(EventPut, key, value)
+	}
+	s.trackTTLWrite(op)
+	return nil
+}
+
+func (s *datastorage) DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	if err := s.applyOp(ctx, batchOp{isDelete: true, key: key, cond: &etagCondition{match: etag}}); err != nil {
+		return err
+	}
+	if !s.silentMode {
+		s.publishEvent(EventDelete, key, nil)
+	}
+	s.unregisterTTLKey(ctx, key)
+	return nil
+}
+
+func (b *pubsubBatch) PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: key, value: value, cond: &etagCondition{match: etag}})
+	return nil
+}
+
+func (b *pubsubBatch) PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: key, value: value, cond: &etagCondition{noneMatch: etag}})
+	return nil
+}
+
+func (b *pubsubBatch) DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error {
+	etag, err := normalizeETag(etag)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{isDelete: true, key: key, cond: &etagCondition{match: etag}})
+	return nil
+}
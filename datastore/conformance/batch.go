@@ -0,0 +1,379 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+var batchChecks = []Check{
+	{"batch/commit", checkBatchCommit},
+	{"batch/empty", checkEmptyBatch},
+	{"batch/last-write-wins", checkBatchLastWriteWins},
+	{"batch/conditional", checkConditionalBatch},
+	{"batch/conditional-abort", checkConditionalBatchAbort},
+	{"batch/binary", checkBatchBinary},
+}
+
+var txnChecks = []Check{
+	{"txn/commit", checkTxnCommit},
+	{"txn/discard", checkTxnDiscard},
+	{"txn/read-only", checkTxnReadOnly},
+	{"txn/snapshot", checkTxnSnapshot},
+	{"txn/conflict", checkTxnConflict},
+	{"txn/query", checkTxnQuery},
+}
+
+func checkBatchCommit(ctx context.Context, store datastore.Datastore) error {
+	a := ds.NewKey("/conformance/batch/a")
+	b := ds.NewKey("/conformance/batch/b")
+	old := ds.NewKey("/conformance/batch/old")
+	if err := store.Put(ctx, old, []byte("v")); err != nil {
+		return err
+	}
+
+	batch, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, a, []byte("1")); err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, b, []byte("2")); err != nil {
+		return err
+	}
+	if err := batch.Delete(ctx, old); err != nil {
+		return err
+	}
+
+	// До Commit пакет не виден
+	if err := expectMissing(ctx, store, a); err != nil {
+		return fmt.Errorf("до Commit: %w", err)
+	}
+	if err := expectValue(ctx, store, old, []byte("v")); err != nil {
+		return fmt.Errorf("до Commit: %w", err)
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, a, []byte("1")); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, b, []byte("2")); err != nil {
+		return err
+	}
+	return expectMissing(ctx, store, old)
+}
+
+func checkEmptyBatch(ctx context.Context, store datastore.Datastore) error {
+	batch, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	return batch.Commit(ctx)
+}
+
+func checkBatchLastWriteWins(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/batch/key")
+	batch, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, key, []byte("1")); err != nil {
+		return err
+	}
+	if err := batch.Delete(ctx, key); err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, key, []byte("3")); err != nil {
+		return err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, []byte("3"))
+}
+
+func conditionalBatch(ctx context.Context, store datastore.Datastore) (datastore.ConditionalBatch, error) {
+	b, err := store.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batch, ok := b.(datastore.ConditionalBatch)
+	if !ok {
+		return nil, fmt.Errorf("пакет %T не поддерживает условные операции", b)
+	}
+	return batch, nil
+}
+
+func checkConditionalBatch(ctx context.Context, store datastore.Datastore) error {
+	existing := ds.NewKey("/conformance/batch/cond/existing")
+	created := ds.NewKey("/conformance/batch/cond/created")
+	removed := ds.NewKey("/conformance/batch/cond/removed")
+	if err := store.Put(ctx, existing, []byte("v1")); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, removed, []byte("v")); err != nil {
+		return err
+	}
+
+	batch, err := conditionalBatch(ctx, store)
+	if err != nil {
+		return err
+	}
+	if err := batch.PutIfMatch(ctx, existing, []byte("v2"), datastore.ETag([]byte("v1"))); err != nil {
+		return err
+	}
+	if err := batch.PutIfNoneMatch(ctx, created, []byte("new"), datastore.ETagAny); err != nil {
+		return err
+	}
+	if err := batch.DeleteIfMatch(ctx, removed, datastore.ETagAny); err != nil {
+		return err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("Commit: %w", err)
+	}
+
+	if err := expectValue(ctx, store, existing, []byte("v2")); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, created, []byte("new")); err != nil {
+		return err
+	}
+	return expectMissing(ctx, store, removed)
+}
+
+// checkConditionalBatchAbort: невыполненное условие отменяет весь пакет.
+func checkConditionalBatchAbort(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/batch/abort/key")
+	other := ds.NewKey("/conformance/batch/abort/other")
+	if err := store.Put(ctx, key, []byte("v1")); err != nil {
+		return err
+	}
+
+	batch, err := conditionalBatch(ctx, store)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, other, []byte("v")); err != nil {
+		return err
+	}
+	if err := batch.PutIfNoneMatch(ctx, key, []byte("v2"), datastore.ETagAny); err != nil {
+		return err
+	}
+	err = batch.Commit(ctx)
+	if err := expectPrecondition("Commit", err, datastore.ETag([]byte("v1"))); err != nil {
+		return err
+	}
+
+	if err := expectValue(ctx, store, key, []byte("v1")); err != nil {
+		return err
+	}
+	return expectMissing(ctx, store, other)
+}
+
+func checkBatchBinary(ctx context.Context, store datastore.Datastore) error {
+	value := make([]byte, 256)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	key := ds.NewKey("/conformance/batch/binary")
+
+	batch, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, key, value); err != nil {
+		return err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, value)
+}
+
+func checkTxnCommit(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/txn/a")
+	old := ds.NewKey("/conformance/txn/old")
+	if err := store.Put(ctx, old, []byte("v")); err != nil {
+		return err
+	}
+
+	txn, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+
+	if err := txn.Put(ctx, key, []byte("1")); err != nil {
+		return err
+	}
+	if err := txn.Delete(ctx, old); err != nil {
+		return err
+	}
+
+	// Транзакция видит свои записи, остальные - нет
+	value, err := txn.Get(ctx, key)
+	if err != nil || string(value) != "1" {
+		return fmt.Errorf("Get в транзакции: %q, %v", value, err)
+	}
+	if has, err := txn.Has(ctx, old); err != nil || has {
+		return fmt.Errorf("Has удаленного в транзакции ключа: %t, %v", has, err)
+	}
+	if size, err := txn.GetSize(ctx, key); err != nil || size != 1 {
+		return fmt.Errorf("GetSize в транзакции: %d, %v", size, err)
+	}
+	if err := expectMissing(ctx, store, key); err != nil {
+		return fmt.Errorf("до Commit: %w", err)
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("1")); err != nil {
+		return err
+	}
+	return expectMissing(ctx, store, old)
+}
+
+func checkTxnDiscard(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/txn/discarded")
+	txn, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	if err := txn.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+	txn.Discard(ctx)
+	return expectMissing(ctx, store, key)
+}
+
+func checkTxnReadOnly(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/txn/ro")
+	if err := store.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+	txn, err := store.NewTransaction(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+
+	value, err := txn.Get(ctx, key)
+	if err != nil || string(value) != "v" {
+		return fmt.Errorf("Get в транзакции только для чтения: %q, %v", value, err)
+	}
+	if err := txn.Put(ctx, key, []byte("changed")); err == nil {
+		return fmt.Errorf("Put в транзакции только для чтения без ошибки")
+	}
+	if err := txn.Delete(ctx, key); err == nil {
+		return fmt.Errorf("Delete в транзакции только для чтения без ошибки")
+	}
+	return expectValue(ctx, store, key, []byte("v"))
+}
+
+// checkTxnSnapshot: транзакция читает снимок на момент начала.
+func checkTxnSnapshot(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/txn/snapshot")
+	if err := store.Put(ctx, key, []byte("before")); err != nil {
+		return err
+	}
+	txn, err := store.NewTransaction(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+
+	if err := store.Put(ctx, key, []byte("after")); err != nil {
+		return err
+	}
+	created := ds.NewKey("/conformance/txn/created")
+	if err := store.Put(ctx, created, []byte("v")); err != nil {
+		return err
+	}
+
+	value, err := txn.Get(ctx, key)
+	if err != nil || string(value) != "before" {
+		return fmt.Errorf("Get в транзакции: %q, %v, ожидалось значение до ее начала", value, err)
+	}
+	if has, err := txn.Has(ctx, created); err != nil || has {
+		return fmt.Errorf("Has ключа, созданного после начала транзакции: %t, %v", has, err)
+	}
+	return nil
+}
+
+func checkTxnConflict(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/txn/counter")
+	if err := store.Put(ctx, key, []byte("0")); err != nil {
+		return err
+	}
+
+	first, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer first.Discard(ctx)
+	second, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer second.Discard(ctx)
+
+	for _, txn := range []ds.Txn{first, second} {
+		if _, err := txn.Get(ctx, key); err != nil {
+			return err
+		}
+	}
+	if err := first.Put(ctx, key, []byte("1")); err != nil {
+		return err
+	}
+	if err := second.Put(ctx, key, []byte("2")); err != nil {
+		return err
+	}
+	if err := first.Commit(ctx); err != nil {
+		return fmt.Errorf("Commit первой транзакции: %w", err)
+	}
+	if err := second.Commit(ctx); !errors.Is(err, datastore.ErrTxnConflict) {
+		return fmt.Errorf("Commit второй транзакции: %v, ожидалось ErrTxnConflict", err)
+	}
+	return expectValue(ctx, store, key, []byte("1"))
+}
+
+func checkTxnQuery(ctx context.Context, store datastore.Datastore) error {
+	if err := store.Put(ctx, ds.NewKey("/conformance/txn/q/a"), []byte("a")); err != nil {
+		return err
+	}
+	txn, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+	if err := txn.Put(ctx, ds.NewKey("/conformance/txn/q/b"), []byte("b")); err != nil {
+		return err
+	}
+
+	results, err := txn.Query(ctx, query.Query{Prefix: "/conformance/txn/q"})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for _, entry := range entries {
+		values[entry.Key] = string(entry.Value)
+	}
+	if len(values) != 2 || values["/conformance/txn/q/a"] != "a" || values["/conformance/txn/q/b"] != "b" {
+		return fmt.Errorf("Query в транзакции: %v", values)
+	}
+	return nil
+}
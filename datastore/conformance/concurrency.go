@@ -0,0 +1,213 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// concurrencyWorkers и concurrencyOps - размер нагрузки параллельных
+// проверок.
+var (
+	concurrencyWorkers = 8
+	concurrencyOps     = 25
+)
+
+var concurrencyChecks = []Check{
+	{"concurrency/writes", checkConcurrentWrites},
+	{"concurrency/same-key", checkConcurrentSameKey},
+	{"concurrency/events", checkConcurrentEvents},
+	{"concurrency/txn-counter", checkConcurrentTxnCounter},
+}
+
+// parallel запускает fn в concurrencyWorkers горутинах и возвращает первую
+// ошибку.
+func parallel(fn func(worker int) error) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrencyWorkers)
+	for w := 0; w < concurrencyWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := fn(w); err != nil {
+				errs <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func workerKey(prefix string, worker, op int) ds.Key {
+	return ds.NewKey(prefix).ChildString(strconv.Itoa(worker)).ChildString(strconv.Itoa(op))
+}
+
+func checkConcurrentWrites(ctx context.Context, store datastore.Datastore) error {
+	err := parallel(func(w int) error {
+		for i := 0; i < concurrencyOps; i++ {
+			key := workerKey("/conformance/concurrency", w, i)
+			value := []byte(key.String())
+			if err := store.Put(ctx, key, value); err != nil {
+				return fmt.Errorf("Put %s: %w", key, err)
+			}
+			got, err := store.Get(ctx, key)
+			if err != nil {
+				return fmt.Errorf("Get %s: %w", key, err)
+			}
+			if string(got) != string(value) {
+				return fmt.Errorf("Get %s: %q", key, got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys, err := collectKeys(ctx, store, ds.NewKey("/conformance/concurrency"))
+	if err != nil {
+		return err
+	}
+	if want := concurrencyWorkers * concurrencyOps; len(keys) != want {
+		return fmt.Errorf("Keys: %d ключей, ожидалось %d", len(keys), want)
+	}
+	return nil
+}
+
+// checkConcurrentSameKey: при параллельной записи одного ключа сохраняется
+// одно из записанных значений целиком.
+func checkConcurrentSameKey(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/concurrency/shared")
+	written := make(map[string]bool)
+	for w := 0; w < concurrencyWorkers; w++ {
+		written[fmt.Sprintf("worker-%d", w)] = true
+	}
+
+	err := parallel(func(w int) error {
+		value := []byte(fmt.Sprintf("worker-%d", w))
+		for i := 0; i < concurrencyOps; i++ {
+			if err := store.Put(ctx, key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	value, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !written[string(value)] {
+		return fmt.Errorf("итоговое значение %q не записывалось", value)
+	}
+	return nil
+}
+
+// checkConcurrentEvents: подписчик получает событие о каждой из
+// параллельных записей.
+func checkConcurrentEvents(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.SubscribeFunc("conformance-concurrency", rec.record)
+	defer store.Unsubscribe("conformance-concurrency")
+
+	err := parallel(func(w int) error {
+		for i := 0; i < concurrencyOps; i++ {
+			if err := store.Put(ctx, workerKey("/conformance/concurrency", w, i), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	want := concurrencyWorkers * concurrencyOps
+	events, err := rec.wait(ctx, want, underPrefix("/conformance/concurrency"))
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		if seen[event.Key.String()] {
+			return fmt.Errorf("повторное событие %s", event.Key)
+		}
+		seen[event.Key.String()] = true
+	}
+	return nil
+}
+
+// checkConcurrentTxnCounter: инкременты счетчика в транзакциях с повтором
+// при конфликте не теряются.
+func checkConcurrentTxnCounter(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/concurrency/counter")
+	if err := store.Put(ctx, key, []byte("0")); err != nil {
+		return err
+	}
+	const increments = 5
+
+	err := parallel(func(w int) error {
+		for i := 0; i < increments; i++ {
+			if err := incrementInTxn(ctx, store, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	value, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if want := strconv.Itoa(concurrencyWorkers * increments); string(value) != want {
+		return fmt.Errorf("счетчик %s, ожидалось %s", value, want)
+	}
+	return nil
+}
+
+func incrementInTxn(ctx context.Context, store datastore.Datastore, key ds.Key) error {
+	for {
+		txn, err := store.NewTransaction(ctx, false)
+		if err != nil {
+			return err
+		}
+		value, err := txn.Get(ctx, key)
+		if err != nil {
+			txn.Discard(ctx)
+			return err
+		}
+		n, err := strconv.Atoi(string(value))
+		if err != nil {
+			txn.Discard(ctx)
+			return err
+		}
+		if err := txn.Put(ctx, key, []byte(strconv.Itoa(n+1))); err != nil {
+			txn.Discard(ctx)
+			return err
+		}
+		err = txn.Commit(ctx)
+		txn.Discard(ctx)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, datastore.ErrTxnConflict) {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+var conditionalChecks = []Check{
+	{"conditional/etag", checkGetWithETag},
+	{"conditional/put-if-match", checkPutIfMatch},
+	{"conditional/put-if-none-match", checkPutIfNoneMatch},
+	{"conditional/delete-if-match", checkDeleteIfMatch},
+}
+
+// expectPrecondition проверяет, что операция отклонена условием и ошибка
+// содержит текущий ETag ключа.
+func expectPrecondition(what string, err error, etag string) error {
+	if !errors.Is(err, datastore.ErrPreconditionFailed) {
+		return fmt.Errorf("%s: %v, ожидалось ErrPreconditionFailed", what, err)
+	}
+	var perr *datastore.PreconditionFailedError
+	if !errors.As(err, &perr) {
+		return fmt.Errorf("%s: ошибка %T вместо PreconditionFailedError", what, err)
+	}
+	if perr.ETag != etag {
+		return fmt.Errorf("%s: ETag в ошибке %q, ожидался %q", what, perr.ETag, etag)
+	}
+	return nil
+}
+
+func checkGetWithETag(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/etag/a")
+	if err := store.Put(ctx, key, []byte("v1")); err != nil {
+		return err
+	}
+	value, etag, err := store.GetWithETag(ctx, key)
+	if err != nil {
+		return err
+	}
+	if string(value) != "v1" || etag != datastore.ETag([]byte("v1")) {
+		return fmt.Errorf("GetWithETag: %q, %q", value, etag)
+	}
+	if _, _, err := store.GetWithETag(ctx, ds.NewKey("/conformance/etag/missing")); !errors.Is(err, ds.ErrNotFound) {
+		return fmt.Errorf("GetWithETag отсутствующего ключа: %v, ожидалось ds.ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkPutIfMatch(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/etag/match")
+	err := store.PutIfMatch(ctx, key, []byte("v"), datastore.ETagAny)
+	if err := expectPrecondition("PutIfMatch * отсутствующего ключа", err, ""); err != nil {
+		return err
+	}
+
+	if err := store.Put(ctx, key, []byte("v1")); err != nil {
+		return err
+	}
+	current := datastore.ETag([]byte("v1"))
+	err = store.PutIfMatch(ctx, key, []byte("v2"), datastore.ETag([]byte("other")))
+	if err := expectPrecondition("PutIfMatch с чужим ETag", err, current); err != nil {
+		return err
+	}
+	if err := store.PutIfMatch(ctx, key, []byte("v2"), current); err != nil {
+		return fmt.Errorf("PutIfMatch с текущим ETag: %w", err)
+	}
+	if err := store.PutIfMatch(ctx, key, []byte("v3"), datastore.ETagAny); err != nil {
+		return fmt.Errorf("PutIfMatch *: %w", err)
+	}
+	return expectValue(ctx, store, key, []byte("v3"))
+}
+
+func checkPutIfNoneMatch(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/etag/none-match")
+	if err := store.PutIfNoneMatch(ctx, key, []byte("v1"), datastore.ETagAny); err != nil {
+		return fmt.Errorf("PutIfNoneMatch * отсутствующего ключа: %w", err)
+	}
+	current := datastore.ETag([]byte("v1"))
+	err := store.PutIfNoneMatch(ctx, key, []byte("v2"), datastore.ETagAny)
+	if err := expectPrecondition("PutIfNoneMatch * существующего ключа", err, current); err != nil {
+		return err
+	}
+	err = store.PutIfNoneMatch(ctx, key, []byte("v2"), current)
+	if err := expectPrecondition("PutIfNoneMatch с текущим ETag", err, current); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, []byte("v1"))
+}
+
+func checkDeleteIfMatch(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/etag/delete")
+	if err := store.Put(ctx, key, []byte("v1")); err != nil {
+		return err
+	}
+	current := datastore.ETag([]byte("v1"))
+	err := store.DeleteIfMatch(ctx, key, datastore.ETag([]byte("other")))
+	if err := expectPrecondition("DeleteIfMatch с чужим ETag", err, current); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v1")); err != nil {
+		return err
+	}
+	if err := store.DeleteIfMatch(ctx, key, current); err != nil {
+		return fmt.Errorf("DeleteIfMatch с текущим ETag: %w", err)
+	}
+	return expectMissing(ctx, store, key)
+}
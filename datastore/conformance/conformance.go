@@ -0,0 +1,84 @@
+// Package conformance - общий набор проверок для реализаций
+// datastore.Datastore: локального datastorage и RemoteDatastoreAdapter.
+// Одна и та же программа должна вести себя одинаково с любой из них.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ues-lite/datastore"
+)
+
+// Factory создает пустой датастор для одной проверки; cleanup закрывает
+// его и освобождает ресурсы.
+type Factory func() (store datastore.Datastore, cleanup func(), err error)
+
+// Check - одна проверка набора.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, store datastore.Datastore) error
+}
+
+// CheckTimeout ограничивает время одной проверки.
+var CheckTimeout = 30 * time.Second
+
+// Checks возвращает все проверки набора в порядке выполнения.
+func Checks() []Check {
+	var checks []Check
+	checks = append(checks, kvChecks...)
+	checks = append(checks, orderChecks...)
+	checks = append(checks, ttlChecks...)
+	checks = append(checks, batchChecks...)
+	checks = append(checks, txnChecks...)
+	checks = append(checks, conditionalChecks...)
+	checks = append(checks, contentTypeChecks...)
+	checks = append(checks, jqChecks...)
+	checks = append(checks, eventChecks...)
+	checks = append(checks, concurrencyChecks...)
+	return checks
+}
+
+// Run выполняет каждую проверку на свежем датасторе и возвращает все
+// расхождения одной ошибкой. Пустой names - все проверки.
+func Run(ctx context.Context, factory Factory, names ...string) error {
+	var errs []error
+	for _, check := range Checks() {
+		if len(names) > 0 && !contains(names, check.Name) {
+			continue
+		}
+		if err := runCheck(ctx, factory, check); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runCheck(ctx context.Context, factory Factory, check Check) (err error) {
+	store, cleanup, err := factory()
+	if err != nil {
+		return fmt.Errorf("ошибка создания датастора: %w", err)
+	}
+	defer cleanup()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	return check.Run(ctx, store)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package conformance_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"ues-lite/datastore"
+	"ues-lite/datastore/conformance"
+)
+
+func TestLocal(t *testing.T) {
+	if err := conformance.Run(context.Background(), localFactory(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	local := localFactory(t)
+	factory := func() (datastore.Datastore, func(), error) {
+		store, cleanupStore, err := local()
+		if err != nil {
+			return nil, nil, err
+		}
+		server := httptest.NewServer(datastore.NewAPIServer(store, testServerConfig()).Handler())
+		remote, err := datastore.NewRemoteDatastoreAdapter(server.URL)
+		if err != nil {
+			server.Close()
+			cleanupStore()
+			return nil, nil, err
+		}
+		return remote, func() {
+			remote.Close()
+			server.Close()
+			cleanupStore()
+		}, nil
+	}
+	if err := conformance.Run(context.Background(), factory); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func localFactory(t *testing.T) conformance.Factory {
+	return func() (datastore.Datastore, func(), error) {
+		store, err := datastore.NewDatastorage(t.TempDir(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() { store.Close() }, nil
+	}
+}
+
+func testServerConfig() *datastore.Config {
+	config := datastore.DefaultConfig()
+	// Метрики регистрируются глобально и не допускают несколько серверов
+	config.EnableMetrics = false
+	config.LogRequests = false
+	config.RateLimitRPS = 0
+	config.WriteRateLimitRPS = 0
+	config.ExpensiveRateLimitRPS = 0
+	return config
+}
@@ -0,0 +1,216 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+var contentTypeChecks = []Check{
+	{"content-type/put-get", checkContentType},
+	{"content-type/keep", checkContentTypeKept},
+	{"content-type/delete", checkContentTypeDeleted},
+	{"content-type/conditional", checkContentTypeConditional},
+	{"content-type/set-ttl", checkContentTypeSetTTL},
+	{"content-type/txn", checkContentTypeTxn},
+}
+
+func expectContentType(ctx context.Context, store datastore.Datastore, key ds.Key, contentType string) error {
+	got, err := store.GetContentType(ctx, key)
+	if err != nil {
+		return fmt.Errorf("GetContentType %s: %w", key, err)
+	}
+	if got != contentType {
+		return fmt.Errorf("GetContentType %s: %q, ожидался %q", key, got, contentType)
+	}
+	return nil
+}
+
+func checkContentType(ctx context.Context, store datastore.Datastore) error {
+	values := map[string]struct {
+		value       []byte
+		contentType string
+	}{
+		"/conformance/content-type/png":  {binaryValue(), "image/png"},
+		"/conformance/content-type/json": {[]byte(`{"a":1}`), "application/json"},
+		"/conformance/content-type/text": {[]byte("привет"), "text/plain; charset=utf-8"},
+	}
+	for name, v := range values {
+		if err := store.PutWithOptions(ctx, ds.NewKey(name), v.value, datastore.PutOptions{ContentType: v.contentType}); err != nil {
+			return fmt.Errorf("PutWithOptions %s: %w", name, err)
+		}
+	}
+	for name, v := range values {
+		if err := expectValue(ctx, store, ds.NewKey(name), v.value); err != nil {
+			return err
+		}
+		if err := expectContentType(ctx, store, ds.NewKey(name), v.contentType); err != nil {
+			return err
+		}
+	}
+
+	untyped := ds.NewKey("/conformance/content-type/untyped")
+	if err := store.Put(ctx, untyped, []byte("v")); err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, untyped, ""); err != nil {
+		return err
+	}
+	if _, err := store.GetContentType(ctx, ds.NewKey("/conformance/content-type/missing")); !errors.Is(err, ds.ErrNotFound) {
+		return fmt.Errorf("GetContentType отсутствующего ключа: %v, ожидалось ds.ErrNotFound", err)
+	}
+	return nil
+}
+
+// checkContentTypeKept: запись без типа с KeepContentType оставляет
+// сохраненный тип, Put его сбрасывает.
+func checkContentTypeKept(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/content-type/kept")
+	if err := store.PutWithOptions(ctx, key, []byte("v1"), datastore.PutOptions{ContentType: "image/gif"}); err != nil {
+		return err
+	}
+	if err := store.PutWithOptions(ctx, key, []byte("v2"), datastore.PutOptions{KeepContentType: true}); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v2")); err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, key, "image/gif"); err != nil {
+		return err
+	}
+
+	if err := store.Put(ctx, key, []byte("v3")); err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, key, ""); err != nil {
+		return fmt.Errorf("после Put: %w", err)
+	}
+	if err := store.PutWithOptions(ctx, key, []byte("v4"), datastore.PutOptions{ContentType: "image/gif"}); err != nil {
+		return err
+	}
+	if err := store.PutWithOptions(ctx, key, []byte("v5"), datastore.PutOptions{}); err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, key, ""); err != nil {
+		return fmt.Errorf("после PutWithOptions без типа: %w", err)
+	}
+	return nil
+}
+
+// checkContentTypeDeleted: тип удаляется вместе с ключом.
+func checkContentTypeDeleted(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/content-type/deleted")
+	if err := store.PutWithOptions(ctx, key, []byte("v"), datastore.PutOptions{ContentType: "image/gif"}); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+	return expectContentType(ctx, store, key, "")
+}
+
+// checkContentTypeConditional: невыполненное условие не меняет ни значение,
+// ни тип.
+func checkContentTypeConditional(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/content-type/conditional")
+	opts := datastore.PutOptions{ContentType: "image/png", IfNoneMatch: datastore.ETagAny}
+	if err := store.PutWithOptions(ctx, key, []byte("v1"), opts); err != nil {
+		return err
+	}
+	opts.ContentType = "image/jpeg"
+	err := store.PutWithOptions(ctx, key, []byte("v2"), opts)
+	if err := expectPrecondition("PutWithOptions If-None-Match *", err, datastore.ETag([]byte("v1"))); err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, key, "image/png"); err != nil {
+		return err
+	}
+
+	opts = datastore.PutOptions{ContentType: "image/jpeg", IfMatch: datastore.ETag([]byte("v1"))}
+	if err := store.PutWithOptions(ctx, key, []byte("v2"), opts); err != nil {
+		return fmt.Errorf("PutWithOptions If-Match: %w", err)
+	}
+	if err := expectValue(ctx, store, key, []byte("v2")); err != nil {
+		return err
+	}
+	return expectContentType(ctx, store, key, "image/jpeg")
+}
+
+// checkContentTypeSetTTL: SetTTL и SetTTLBatch переносят TTL и на тип.
+func checkContentTypeSetTTL(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/content-type/set-ttl")
+	typeKey := ds.NewKey(datastore.ContentTypesNamespace).ChildString(key.String())
+	if err := store.PutWithOptions(ctx, key, []byte("v"), datastore.PutOptions{ContentType: "image/gif"}); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := store.SetTTL(ctx, key, time.Hour); err != nil {
+		return fmt.Errorf("SetTTL: %w", err)
+	}
+	if err := expectContentType(ctx, store, key, "image/gif"); err != nil {
+		return err
+	}
+	if err := expectExpiration(ctx, store, typeKey, start, time.Hour); err != nil {
+		return fmt.Errorf("после SetTTL: %w", err)
+	}
+
+	start = time.Now()
+	if err := store.SetTTLBatch(ctx, []ds.Key{key}, 2*time.Hour); err != nil {
+		return fmt.Errorf("SetTTLBatch: %w", err)
+	}
+	if err := expectContentType(ctx, store, key, "image/gif"); err != nil {
+		return err
+	}
+	if err := expectExpiration(ctx, store, typeKey, start, 2*time.Hour); err != nil {
+		return fmt.Errorf("после SetTTLBatch: %w", err)
+	}
+	return nil
+}
+
+// checkContentTypeTxn: тип из записи в транзакции сохраняется при Commit,
+// Put в транзакции его сбрасывает.
+func checkContentTypeTxn(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/content-type/txn")
+	put := func(write func(txn ds.Txn) error) error {
+		txn, err := store.NewTransaction(ctx, false)
+		if err != nil {
+			return fmt.Errorf("NewTransaction: %w", err)
+		}
+		defer txn.Discard(ctx)
+		if err := write(txn); err != nil {
+			return err
+		}
+		return txn.Commit(ctx)
+	}
+
+	err := put(func(txn ds.Txn) error {
+		typed, ok := txn.(datastore.ContentTypeTxn)
+		if !ok {
+			return fmt.Errorf("транзакция %T не реализует ContentTypeTxn", txn)
+		}
+		return typed.PutWithOptions(ctx, key, []byte("v1"), datastore.PutOptions{ContentType: "image/png"})
+	})
+	if err != nil {
+		return err
+	}
+	if err := expectContentType(ctx, store, key, "image/png"); err != nil {
+		return err
+	}
+
+	if err := put(func(txn ds.Txn) error { return txn.Put(ctx, key, []byte("v2")) }); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v2")); err != nil {
+		return err
+	}
+	return expectContentType(ctx, store, key, "")
+}
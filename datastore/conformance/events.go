@@ -0,0 +1,291 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// eventWait - сколько ждать доставки события; quietWait - сколько ждать,
+// чтобы убедиться, что лишних событий нет.
+var (
+	eventWait = 5 * time.Second
+	quietWait = 300 * time.Millisecond
+)
+
+var eventChecks = []Check{
+	{"events/put-delete", checkPutDeleteEvents},
+	{"events/subscribe-channel", checkSubscribeChannel},
+	{"events/subscriber", checkSubscriber},
+	{"events/unsubscribe", checkUnsubscribe},
+	{"events/batch", checkBatchEvents},
+	{"events/silent-mode", checkSilentMode},
+}
+
+// recorder собирает события подписки; порядок доставки не гарантирован.
+type recorder struct {
+	mu     sync.Mutex
+	events []datastore.Event
+	added  chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{added: make(chan struct{}, 1)}
+}
+
+func (r *recorder) record(event datastore.Event) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+	select {
+	case r.added <- struct{}{}:
+	default:
+	}
+}
+
+// wait ждет, пока наберется n событий, подходящих под match.
+func (r *recorder) wait(ctx context.Context, n int, match func(datastore.Event) bool) ([]datastore.Event, error) {
+	timeout := time.NewTimer(eventWait)
+	defer timeout.Stop()
+	for {
+		matched := r.matching(match)
+		if len(matched) >= n {
+			return matched, nil
+		}
+		select {
+		case <-r.added:
+		case <-timeout.C:
+			return matched, fmt.Errorf("получено %d событий из %d", len(matched), n)
+		case <-ctx.Done():
+			return matched, ctx.Err()
+		}
+	}
+}
+
+func (r *recorder) matching(match func(datastore.Event) bool) []datastore.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []datastore.Event
+	for _, event := range r.events {
+		if match == nil || match(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+func underPrefix(prefix string) func(datastore.Event) bool {
+	return func(event datastore.Event) bool {
+		return ds.NewKey(prefix).IsAncestorOf(event.Key)
+	}
+}
+
+// expectEvent сравнивает событие с ожидаемым так, как его видит подписчик
+// локального датастора.
+func expectEvent(event datastore.Event, eventType datastore.EventType, key ds.Key, value []byte, since time.Time) error {
+	if event.Type != eventType {
+		return fmt.Errorf("событие %s: тип %d, ожидался %d", event.Key, event.Type, eventType)
+	}
+	if !event.Key.Equal(key) {
+		return fmt.Errorf("ключ события %s, ожидался %s", event.Key, key)
+	}
+	if !bytes.Equal(event.Value, value) || (event.Value == nil) != (value == nil) {
+		return fmt.Errorf("событие %s: значение %q, ожидалось %q", key, event.Value, value)
+	}
+	if event.Timestamp.Before(since.Add(-time.Second)) || event.Timestamp.After(time.Now().Add(time.Second)) {
+		return fmt.Errorf("событие %s: время %s вне интервала операции", key, event.Timestamp)
+	}
+	if event.Metadata != nil {
+		return fmt.Errorf("событие %s: неожиданные метаданные %v", key, event.Metadata)
+	}
+	return nil
+}
+
+func checkPutDeleteEvents(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.SubscribeFunc("conformance", rec.record)
+	defer store.Unsubscribe("conformance")
+
+	start := time.Now()
+	key := ds.NewKey("/conformance/events/a")
+	value := []byte(`{"n":1}`)
+	if err := store.Put(ctx, key, value); err != nil {
+		return err
+	}
+	empty := ds.NewKey("/conformance/events/empty")
+	if err := store.Put(ctx, empty, []byte{}); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	events, err := rec.wait(ctx, 3, underPrefix("/conformance/events"))
+	if err != nil {
+		return err
+	}
+	var put, putEmpty, del *datastore.Event
+	for i := range events {
+		switch {
+		case events[i].Type == datastore.EventPut && events[i].Key.Equal(key):
+			put = &events[i]
+		case events[i].Type == datastore.EventPut && events[i].Key.Equal(empty):
+			putEmpty = &events[i]
+		case events[i].Type == datastore.EventDelete:
+			del = &events[i]
+		}
+	}
+	if put == nil || putEmpty == nil || del == nil {
+		return fmt.Errorf("ожидались put, put пустого значения и delete, получено %v", events)
+	}
+	if err := expectEvent(*put, datastore.EventPut, key, value, start); err != nil {
+		return err
+	}
+	if err := expectEvent(*putEmpty, datastore.EventPut, empty, []byte{}, start); err != nil {
+		return err
+	}
+	return expectEvent(*del, datastore.EventDelete, key, nil, start)
+}
+
+func checkSubscribeChannel(ctx context.Context, store datastore.Datastore) error {
+	sub := store.SubscribeChannel("conformance-channel", 16)
+	defer store.Unsubscribe("conformance-channel")
+	if sub.ID() != "conformance-channel" {
+		return fmt.Errorf("ID подписчика %q", sub.ID())
+	}
+
+	start := time.Now()
+	key := ds.NewKey("/conformance/channel/a")
+	if err := store.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+
+	timeout := time.After(eventWait)
+	for {
+		select {
+		case event := <-sub.Events():
+			if !event.Key.Equal(key) {
+				continue
+			}
+			return expectEvent(event, datastore.EventPut, key, []byte("v"), start)
+		case <-timeout:
+			return fmt.Errorf("событие не получено")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// subscriberFunc - собственная реализация Subscriber, как у пользователей
+// библиотеки.
+type subscriberFunc struct {
+	id string
+	fn func(context.Context, datastore.Event)
+}
+
+func (s subscriberFunc) ID() string { return s.id }
+
+func (s subscriberFunc) OnEvent(ctx context.Context, event datastore.Event) { s.fn(ctx, event) }
+
+func checkSubscriber(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.Subscribe(subscriberFunc{id: "conformance-subscriber", fn: func(ctx context.Context, event datastore.Event) {
+		rec.record(event)
+	}})
+	defer store.Unsubscribe("conformance-subscriber")
+
+	if err := store.Put(ctx, ds.NewKey("/conformance/subscriber/a"), []byte("v")); err != nil {
+		return err
+	}
+	_, err := rec.wait(ctx, 1, underPrefix("/conformance/subscriber"))
+	return err
+}
+
+func checkUnsubscribe(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.SubscribeFunc("conformance-unsubscribe", rec.record)
+
+	if err := store.Put(ctx, ds.NewKey("/conformance/unsubscribe/a"), []byte("v")); err != nil {
+		return err
+	}
+	if _, err := rec.wait(ctx, 1, underPrefix("/conformance/unsubscribe")); err != nil {
+		return err
+	}
+
+	store.Unsubscribe("conformance-unsubscribe")
+	// Даем доставиться событиям, отправленным до Unsubscribe
+	time.Sleep(quietWait)
+	before := len(rec.matching(underPrefix("/conformance/unsubscribe")))
+	if err := store.Put(ctx, ds.NewKey("/conformance/unsubscribe/b"), []byte("v")); err != nil {
+		return err
+	}
+	time.Sleep(quietWait)
+	if after := len(rec.matching(underPrefix("/conformance/unsubscribe"))); after != before {
+		return fmt.Errorf("после Unsubscribe получено %d событий", after-before)
+	}
+	return nil
+}
+
+func checkBatchEvents(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.SubscribeFunc("conformance-batch", rec.record)
+	defer store.Unsubscribe("conformance-batch")
+
+	batch, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, ds.NewKey("/conformance/batch/a"), []byte("1")); err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, ds.NewKey("/conformance/batch/b"), []byte("2")); err != nil {
+		return err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+
+	if _, err := rec.wait(ctx, 2, underPrefix("/conformance/batch")); err != nil {
+		return fmt.Errorf("события записей пакета: %w", err)
+	}
+	_, err = rec.wait(ctx, 1, func(event datastore.Event) bool {
+		return event.Type == datastore.EventBatch
+	})
+	if err != nil {
+		return fmt.Errorf("событие пакета: %w", err)
+	}
+	return nil
+}
+
+func checkSilentMode(ctx context.Context, store datastore.Datastore) error {
+	rec := newRecorder()
+	store.SubscribeFunc("conformance-silent", rec.record)
+	defer store.Unsubscribe("conformance-silent")
+
+	store.SetSilentMode(true)
+	err := store.Put(ctx, ds.NewKey("/conformance/silent/a"), []byte("v"))
+	store.SetSilentMode(false)
+	if err != nil {
+		return err
+	}
+	time.Sleep(quietWait)
+	if events := rec.matching(underPrefix("/conformance/silent")); len(events) > 0 {
+		return fmt.Errorf("в тихом режиме получено %d событий", len(events))
+	}
+	// Тихий режим отключает только события, запись выполняется
+	if err := expectValue(ctx, store, ds.NewKey("/conformance/silent/a"), []byte("v")); err != nil {
+		return err
+	}
+
+	if err := store.Put(ctx, ds.NewKey("/conformance/silent/b"), []byte("v")); err != nil {
+		return err
+	}
+	_, err = rec.wait(ctx, 1, underPrefix("/conformance/silent"))
+	return err
+}
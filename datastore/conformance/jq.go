@@ -0,0 +1,95 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+var jqChecks = []Check{
+	{"jq/single", checkJQSingle},
+	{"jq/query", checkJQQuery},
+	{"jq/aggregate", checkJQAggregate},
+}
+
+var jqValues = map[string]string{
+	"/conformance/jq/a": `{"name":"alice","age":30}`,
+	"/conformance/jq/b": `{"name":"bob","age":25}`,
+	"/conformance/jq/c": `{"name":"carol","age":35}`,
+}
+
+func putJQValues(ctx context.Context, store datastore.Datastore) error {
+	for name, value := range jqValues {
+		if err := store.Put(ctx, ds.NewKey(name), []byte(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expectJSON сравнивает результаты jq по JSON-представлению: числа могут
+// прийти как int или float64.
+func expectJSON(what string, got any, want string) error {
+	data, err := json.Marshal(got)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	if string(data) != want {
+		return fmt.Errorf("%s: %s, ожидалось %s", what, data, want)
+	}
+	return nil
+}
+
+func checkJQSingle(ctx context.Context, store datastore.Datastore) error {
+	if err := putJQValues(ctx, store); err != nil {
+		return err
+	}
+	result, err := store.QueryJQSingle(ctx, ds.NewKey("/conformance/jq/a"), "{name, next: (.age + 1)}")
+	if err != nil {
+		return err
+	}
+	return expectJSON("QueryJQSingle", result, `{"name":"alice","next":31}`)
+}
+
+func checkJQQuery(ctx context.Context, store datastore.Datastore) error {
+	if err := putJQValues(ctx, store); err != nil {
+		return err
+	}
+	results, errs, err := store.QueryJQ(ctx, "select(.age >= 30) | .name", &datastore.JQQueryOptions{
+		Prefix: ds.NewKey("/conformance/jq"),
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for result := range results {
+		name, ok := result.Value.(string)
+		if !ok {
+			return fmt.Errorf("QueryJQ: значение %v для %s", result.Value, result.Key)
+		}
+		names = append(names, result.Key.String()+"="+name)
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+	sort.Strings(names)
+	return expectNames("QueryJQ", names, []string{"/conformance/jq/a=alice", "/conformance/jq/c=carol"})
+}
+
+func checkJQAggregate(ctx context.Context, store datastore.Datastore) error {
+	if err := putJQValues(ctx, store); err != nil {
+		return err
+	}
+	result, err := store.AggregateJQ(ctx, "[inputs | .age] | add", &datastore.JQQueryOptions{
+		Prefix: ds.NewKey("/conformance/jq"),
+	})
+	if err != nil {
+		return err
+	}
+	return expectJSON("AggregateJQ", result, "90")
+}
@@ -0,0 +1,316 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+var kvChecks = []Check{
+	{"kv/put-get", checkPutGet},
+	{"kv/overwrite", checkOverwrite},
+	{"kv/empty-value", checkEmptyValue},
+	{"kv/not-found", checkNotFound},
+	{"kv/delete", checkDelete},
+	{"kv/special-keys", checkSpecialKeys},
+	{"kv/large-value", checkLargeValue},
+	{"kv/binary", checkBinaryValue},
+	{"kv/stream-binary", checkStreamBinary},
+	{"kv/clear", checkClear},
+}
+
+// expectValue проверяет, что по ключу хранится value, и что Has и GetSize
+// с этим согласны.
+func expectValue(ctx context.Context, store datastore.Datastore, key ds.Key, value []byte) error {
+	got, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("Get %s: %w", key, err)
+	}
+	if !bytes.Equal(got, value) {
+		return fmt.Errorf("Get %s: %q, ожидалось %q", key, truncate(got), truncate(value))
+	}
+	has, err := store.Has(ctx, key)
+	if err != nil {
+		return fmt.Errorf("Has %s: %w", key, err)
+	}
+	if !has {
+		return fmt.Errorf("Has %s: false для существующего ключа", key)
+	}
+	size, err := store.GetSize(ctx, key)
+	if err != nil {
+		return fmt.Errorf("GetSize %s: %w", key, err)
+	}
+	if size != len(value) {
+		return fmt.Errorf("GetSize %s: %d, ожидалось %d", key, size, len(value))
+	}
+	return nil
+}
+
+// expectMissing проверяет, что ключа нет: Get и GetSize возвращают
+// ds.ErrNotFound, Has - false.
+func expectMissing(ctx context.Context, store datastore.Datastore, key ds.Key) error {
+	if _, err := store.Get(ctx, key); !errors.Is(err, ds.ErrNotFound) {
+		return fmt.Errorf("Get %s: %v, ожидалось ds.ErrNotFound", key, err)
+	}
+	has, err := store.Has(ctx, key)
+	if err != nil {
+		return fmt.Errorf("Has %s: %w", key, err)
+	}
+	if has {
+		return fmt.Errorf("Has %s: true для отсутствующего ключа", key)
+	}
+	if _, err := store.GetSize(ctx, key); !errors.Is(err, ds.ErrNotFound) {
+		return fmt.Errorf("GetSize %s: %v, ожидалось ds.ErrNotFound", key, err)
+	}
+	return nil
+}
+
+func truncate(value []byte) []byte {
+	if len(value) > 64 {
+		return append(value[:64:64], "..."...)
+	}
+	return value
+}
+
+func checkPutGet(ctx context.Context, store datastore.Datastore) error {
+	values := map[string][]byte{
+		"/conformance/kv/text": []byte("hello"),
+		"/conformance/kv/json": []byte(`{"name":"test","n":1,"tags":["a","b"]}`),
+		"/conformance/kv/utf8": []byte("привет, мир ✓"),
+	}
+	for name, value := range values {
+		if err := store.Put(ctx, ds.NewKey(name), value); err != nil {
+			return fmt.Errorf("Put %s: %w", name, err)
+		}
+	}
+	for name, value := range values {
+		if err := expectValue(ctx, store, ds.NewKey(name), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkOverwrite(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/kv/overwrite")
+	if err := store.Put(ctx, key, []byte("first value")); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key, []byte("2")); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, []byte("2"))
+}
+
+func checkEmptyValue(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/kv/empty")
+	if err := store.Put(ctx, key, []byte{}); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, []byte{})
+}
+
+func checkNotFound(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/kv/missing")
+	if err := expectMissing(ctx, store, key); err != nil {
+		return err
+	}
+	// Удаление отсутствующего ключа - не ошибка
+	if err := store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("Delete отсутствующего ключа: %w", err)
+	}
+	return nil
+}
+
+func checkDelete(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/kv/delete")
+	child := key.ChildString("child")
+	if err := store.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, child, []byte("v")); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if err := expectMissing(ctx, store, key); err != nil {
+		return err
+	}
+	// Удаление ключа не затрагивает дочерние ключи
+	return expectValue(ctx, store, child, []byte("v"))
+}
+
+func checkSpecialKeys(ctx context.Context, store datastore.Datastore) error {
+	names := []string{
+		"/conformance/keys/with space",
+		"/conformance/keys/юникод",
+		"/conformance/keys/a.b-c_d~e",
+		"/conformance/keys/query?x=1&y=2",
+		"/conformance/keys/hash#fragment",
+		"/conformance/keys/percent%20sign",
+		"/conformance/keys/plus+colon:semicolon;",
+		"/conformance/keys/deep/nested/path/to/key",
+	}
+	for _, name := range names {
+		key := ds.NewKey(name)
+		if err := store.Put(ctx, key, []byte(name)); err != nil {
+			return fmt.Errorf("Put %s: %w", name, err)
+		}
+		if err := expectValue(ctx, store, key, []byte(name)); err != nil {
+			return err
+		}
+	}
+
+	keys, err := collectKeys(ctx, store, ds.NewKey("/conformance/keys"))
+	if err != nil {
+		return err
+	}
+	if len(keys) != len(names) {
+		return fmt.Errorf("Keys: %d ключей, ожидалось %d: %v", len(keys), len(names), keys)
+	}
+	for _, name := range names {
+		if !containsKey(keys, ds.NewKey(name)) {
+			return fmt.Errorf("Keys: нет ключа %s", name)
+		}
+		if err := store.Delete(ctx, ds.NewKey(name)); err != nil {
+			return fmt.Errorf("Delete %s: %w", name, err)
+		}
+		if err := expectMissing(ctx, store, ds.NewKey(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkLargeValue(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/kv/large")
+	value := []byte(strings.Repeat("0123456789abcdef", 64*1024))
+	if err := store.Put(ctx, key, value); err != nil {
+		return err
+	}
+	return expectValue(ctx, store, key, value)
+}
+
+// binaryValue - все значения байта и некорректный UTF-8.
+func binaryValue() []byte {
+	value := make([]byte, 0, 260)
+	for i := 0; i < 256; i++ {
+		value = append(value, byte(i))
+	}
+	return append(value, 0xff, 0xfe, 0xc3, 0x28)
+}
+
+func checkBinaryValue(ctx context.Context, store datastore.Datastore) error {
+	value := binaryValue()
+	key := ds.NewKey("/conformance/kv/binary")
+	if err := store.Put(ctx, key, value); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, value); err != nil {
+		return err
+	}
+	withTTL := ds.NewKey("/conformance/kv/binary-ttl")
+	if err := store.PutWithTTL(ctx, withTTL, value, time.Hour); err != nil {
+		return fmt.Errorf("PutWithTTL: %w", err)
+	}
+	if err := expectValue(ctx, store, withTTL, value); err != nil {
+		return err
+	}
+	conditional := ds.NewKey("/conformance/kv/binary-conditional")
+	if err := store.PutIfNoneMatch(ctx, conditional, value, datastore.ETagAny); err != nil {
+		return fmt.Errorf("PutIfNoneMatch: %w", err)
+	}
+	_, etag, err := store.GetWithETag(ctx, conditional)
+	if err != nil {
+		return err
+	}
+	if etag != datastore.ETag(value) {
+		return fmt.Errorf("GetWithETag: ETag %q, ожидался %q", etag, datastore.ETag(value))
+	}
+	return expectValue(ctx, store, conditional, value)
+}
+
+// checkStreamBinary проверяет, что формат binary отдает значения байт в
+// байт, без разбора JSON и без кавычек у строк.
+func checkStreamBinary(ctx context.Context, store datastore.Datastore) error {
+	prefix := ds.NewKey("/conformance/kv/stream-binary")
+	values := map[string][]byte{
+		prefix.ChildString("bytes").String(): binaryValue(),
+		prefix.ChildString("json").String():  []byte(`{ "a" : 1 }`),
+		prefix.ChildString("text").String():  []byte(`"quoted" text`),
+	}
+	for key, value := range values {
+		if err := store.Put(ctx, ds.NewKey(key), value); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := store.StreamTo(ctx, &buf, &datastore.StreamOptions{Format: datastore.StreamFormatBinary, Prefix: prefix}); err != nil {
+		return fmt.Errorf("StreamTo: %w", err)
+	}
+	data := buf.Bytes()
+	frame := func() ([]byte, error) {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("StreamTo: обрезанный заголовок кадра")
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if len(data) < 4+size {
+			return nil, fmt.Errorf("StreamTo: обрезанный кадр")
+		}
+		out := data[4 : 4+size]
+		data = data[4+size:]
+		return out, nil
+	}
+	seen := 0
+	for len(data) > 0 {
+		key, err := frame()
+		if err != nil {
+			return err
+		}
+		value, err := frame()
+		if err != nil {
+			return err
+		}
+		want, ok := values[string(key)]
+		if !ok {
+			return fmt.Errorf("StreamTo: лишний ключ %s", key)
+		}
+		if !bytes.Equal(value, want) {
+			return fmt.Errorf("StreamTo %s: %q, ожидалось %q", key, truncate(value), truncate(want))
+		}
+		seen++
+	}
+	if seen != len(values) {
+		return fmt.Errorf("StreamTo: %d записей, ожидалось %d", seen, len(values))
+	}
+	return nil
+}
+
+func checkClear(ctx context.Context, store datastore.Datastore) error {
+	for _, name := range []string{"/conformance/clear/a", "/conformance/clear/b/c", "/other"} {
+		if err := store.Put(ctx, ds.NewKey(name), []byte("v")); err != nil {
+			return err
+		}
+	}
+	if err := store.Clear(ctx); err != nil {
+		return err
+	}
+	keys, err := collectKeys(ctx, store, ds.NewKey("/"))
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return fmt.Errorf("после Clear остались ключи %v", keys)
+	}
+	return expectMissing(ctx, store, ds.NewKey("/other"))
+}
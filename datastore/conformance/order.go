@@ -0,0 +1,368 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+var orderChecks = []Check{
+	{"order/iterator", checkIteratorOrder},
+	{"order/iterator-keys-only", checkIteratorKeysOnly},
+	{"order/keys", checkKeysOrder},
+	{"order/prefix", checkPrefixIsolation},
+	{"order/query", checkQuery},
+	{"order/query-limit-offset", checkQueryLimitOffset},
+	{"order/query-filter", checkQueryFilter},
+	{"order/scan-range", checkScanRange},
+	{"order/scan-reverse", checkScanReverse},
+}
+
+// orderedNames - ключи в порядке сортировки датастора: побайтово по
+// строке ключа.
+var orderedNames = []string{
+	"/conformance/order/A",
+	"/conformance/order/a",
+	"/conformance/order/a/1",
+	"/conformance/order/a/10",
+	"/conformance/order/a/2",
+	"/conformance/order/a0",
+	"/conformance/order/b",
+	"/conformance/order/z",
+	"/conformance/order/я",
+}
+
+// putShuffled записывает orderedNames в случайном порядке; значение ключа -
+// его имя.
+func putShuffled(ctx context.Context, store datastore.Datastore) error {
+	names := append([]string(nil), orderedNames...)
+	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	for _, name := range names {
+		if err := store.Put(ctx, ds.NewKey(name), []byte(name)); err != nil {
+			return fmt.Errorf("Put %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func collectIterator(ctx context.Context, store datastore.Datastore, prefix ds.Key, keysOnly bool) ([]datastore.KeyValue, error) {
+	kvs, errs, err := store.Iterator(ctx, prefix, keysOnly)
+	if err != nil {
+		return nil, fmt.Errorf("Iterator: %w", err)
+	}
+	var result []datastore.KeyValue
+	for kv := range kvs {
+		result = append(result, kv)
+	}
+	if err := <-errs; err != nil {
+		return result, fmt.Errorf("Iterator: %w", err)
+	}
+	return result, nil
+}
+
+func collectScan(ctx context.Context, store datastore.Datastore, opts datastore.ScanOptions) ([]string, error) {
+	kvs, errs, err := store.Scan(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Scan: %w", err)
+	}
+	var names []string
+	for kv := range kvs {
+		names = append(names, kv.Key.String())
+		if opts.KeysOnly && len(kv.Value) > 0 {
+			return names, fmt.Errorf("Scan KeysOnly: значение у %s", kv.Key)
+		}
+		if !opts.KeysOnly && !bytes.Equal(kv.Value, []byte(kv.Key.String())) {
+			return names, fmt.Errorf("Scan: значение %s - %q", kv.Key, kv.Value)
+		}
+	}
+	if err := <-errs; err != nil {
+		return names, fmt.Errorf("Scan: %w", err)
+	}
+	return names, nil
+}
+
+func collectKeys(ctx context.Context, store datastore.Datastore, prefix ds.Key) ([]ds.Key, error) {
+	keys, errs, err := store.Keys(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Keys: %w", err)
+	}
+	var result []ds.Key
+	for key := range keys {
+		result = append(result, key)
+	}
+	if err := <-errs; err != nil {
+		return result, fmt.Errorf("Keys: %w", err)
+	}
+	return result, nil
+}
+
+func collectQuery(ctx context.Context, store datastore.Datastore, q query.Query) ([]query.Entry, error) {
+	results, err := store.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("Query: %w", err)
+	}
+	defer results.Close()
+	entries, err := results.Rest()
+	if err != nil {
+		return entries, fmt.Errorf("Query: %w", err)
+	}
+	return entries, nil
+}
+
+func containsKey(keys []ds.Key, key ds.Key) bool {
+	for _, k := range keys {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func expectNames(what string, got, want []string) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("%s: %v, ожидалось %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return fmt.Errorf("%s: %v, ожидалось %v", what, got, want)
+		}
+	}
+	return nil
+}
+
+func checkIteratorOrder(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	kvs, err := collectIterator(ctx, store, ds.NewKey("/conformance/order"), false)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, kv := range kvs {
+		names = append(names, kv.Key.String())
+		if !bytes.Equal(kv.Value, []byte(kv.Key.String())) {
+			return fmt.Errorf("Iterator: значение %s - %q", kv.Key, kv.Value)
+		}
+	}
+	return expectNames("Iterator", names, orderedNames)
+}
+
+func checkIteratorKeysOnly(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	kvs, err := collectIterator(ctx, store, ds.NewKey("/conformance/order"), true)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, kv := range kvs {
+		names = append(names, kv.Key.String())
+		if len(kv.Value) > 0 {
+			return fmt.Errorf("Iterator keysOnly: значение у %s", kv.Key)
+		}
+	}
+	return expectNames("Iterator keysOnly", names, orderedNames)
+}
+
+func checkKeysOrder(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	keys, err := collectKeys(ctx, store, ds.NewKey("/conformance/order"))
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, key := range keys {
+		names = append(names, key.String())
+	}
+	return expectNames("Keys", names, orderedNames)
+}
+
+// checkPrefixIsolation: префикс /p/a выбирает /p/a/... но не /p/ab.
+func checkPrefixIsolation(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	want := []string{"/conformance/order/a/1", "/conformance/order/a/10", "/conformance/order/a/2"}
+
+	keys, err := collectKeys(ctx, store, ds.NewKey("/conformance/order/a"))
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, key := range keys {
+		names = append(names, key.String())
+	}
+	if err := expectNames("Keys /conformance/order/a", names, want); err != nil {
+		return err
+	}
+
+	entries, err := collectQuery(ctx, store, query.Query{Prefix: "/conformance/order/a", KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	names = names[:0]
+	for _, entry := range entries {
+		names = append(names, entry.Key)
+	}
+	sort.Strings(names)
+	return expectNames("Query /conformance/order/a", names, want)
+}
+
+func checkQuery(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+
+	entries, err := collectQuery(ctx, store, query.Query{
+		Prefix: "/conformance/order",
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Key)
+		if !bytes.Equal(entry.Value, []byte(entry.Key)) {
+			return fmt.Errorf("Query: значение %s - %q", entry.Key, entry.Value)
+		}
+	}
+	if err := expectNames("Query OrderByKey", names, orderedNames); err != nil {
+		return err
+	}
+
+	entries, err = collectQuery(ctx, store, query.Query{
+		Prefix:   "/conformance/order",
+		Orders:   []query.Order{query.OrderByKeyDescending{}},
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	names = names[:0]
+	for _, entry := range entries {
+		names = append(names, entry.Key)
+		if len(entry.Value) > 0 {
+			return fmt.Errorf("Query KeysOnly: значение у %s", entry.Key)
+		}
+	}
+	reversed := make([]string, len(orderedNames))
+	for i, name := range orderedNames {
+		reversed[len(orderedNames)-1-i] = name
+	}
+	return expectNames("Query OrderByKeyDescending", names, reversed)
+}
+
+func checkQueryLimitOffset(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	entries, err := collectQuery(ctx, store, query.Query{
+		Prefix:   "/conformance/order",
+		Orders:   []query.Order{query.OrderByKey{}},
+		Offset:   2,
+		Limit:    3,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Key)
+	}
+	return expectNames("Query Offset 2 Limit 3", names, orderedNames[2:5])
+}
+
+func checkQueryFilter(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	entries, err := collectQuery(ctx, store, query.Query{
+		Prefix:  "/conformance/order",
+		Orders:  []query.Order{query.OrderByKey{}},
+		Filters: []query.Filter{query.FilterKeyCompare{Op: query.GreaterThan, Key: "/conformance/order/a0"}},
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Key)
+	}
+	return expectNames("Query FilterKeyCompare", names, orderedNames[6:])
+}
+
+// checkScanRange: Start и End включительно, границы вне префикса не
+// расширяют выборку.
+func checkScanRange(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	names, err := collectScan(ctx, store, datastore.ScanOptions{
+		Prefix: ds.NewKey("/conformance/order"),
+		Start:  ds.NewKey("/conformance/order/a/1"),
+		End:    ds.NewKey("/conformance/order/b"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := expectNames("Scan Start/End", names, orderedNames[2:7]); err != nil {
+		return err
+	}
+
+	names, err = collectScan(ctx, store, datastore.ScanOptions{
+		Prefix:   ds.NewKey("/conformance/order/a"),
+		End:      ds.NewKey("/conformance/order/z"),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	return expectNames("Scan /conformance/order/a", names, orderedNames[2:5])
+}
+
+func checkScanReverse(ctx context.Context, store datastore.Datastore) error {
+	if err := putShuffled(ctx, store); err != nil {
+		return err
+	}
+	reversed := make([]string, len(orderedNames))
+	for i, name := range orderedNames {
+		reversed[len(orderedNames)-1-i] = name
+	}
+
+	names, err := collectScan(ctx, store, datastore.ScanOptions{
+		Prefix:  ds.NewKey("/conformance/order"),
+		Reverse: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := expectNames("Scan Reverse", names, reversed); err != nil {
+		return err
+	}
+
+	names, err = collectScan(ctx, store, datastore.ScanOptions{
+		Prefix:   ds.NewKey("/conformance/order"),
+		Start:    ds.NewKey("/conformance/order/a/1"),
+		End:      ds.NewKey("/conformance/order/b"),
+		Reverse:  true,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	// orderedNames[2:7] по убыванию
+	return expectNames("Scan Reverse Start/End", names, reversed[2:7])
+}
@@ -0,0 +1,272 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ues-lite/datastore"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// ttlPrecision - допуск при сравнении времени истечения: хранилище
+// округляет его до секунд.
+var ttlPrecision = 2 * time.Second
+
+var ttlChecks = []Check{
+	{"ttl/expiry", checkTTLExpiry},
+	{"ttl/no-ttl", checkNoTTL},
+	{"ttl/set-ttl", checkSetTTL},
+	{"ttl/extend", checkExtendTTL},
+	{"ttl/batch", checkSetTTLBatch},
+	{"ttl/batch-put", checkBatchPutWithTTL},
+	{"ttl/list", checkListTTLKeys},
+	{"ttl/cleanup", checkCleanupExpiredKeys},
+}
+
+// expectExpiration проверяет, что ключ истекает примерно через ttl после
+// момента since.
+func expectExpiration(ctx context.Context, store datastore.Datastore, key ds.Key, since time.Time, ttl time.Duration) error {
+	expiration, err := store.GetExpiration(ctx, key)
+	if err != nil {
+		return fmt.Errorf("GetExpiration %s: %w", key, err)
+	}
+	earliest := since.Add(ttl - ttlPrecision)
+	latest := time.Now().Add(ttl + ttlPrecision)
+	if expiration.Before(earliest) || expiration.After(latest) {
+		return fmt.Errorf("GetExpiration %s: %s, ожидалось около %s", key, expiration, since.Add(ttl))
+	}
+	return nil
+}
+
+// sleepUntil ждет момента t или отмены ctx.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func checkTTLExpiry(ctx context.Context, store datastore.Datastore) error {
+	start := time.Now()
+	key := ds.NewKey("/conformance/ttl/expiring")
+	if err := store.PutWithTTL(ctx, key, []byte("v"), time.Second); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v")); err != nil {
+		return err
+	}
+	if err := expectExpiration(ctx, store, key, start, time.Second); err != nil {
+		return err
+	}
+
+	if err := sleepUntil(ctx, start.Add(time.Second+ttlPrecision)); err != nil {
+		return err
+	}
+	if err := expectMissing(ctx, store, key); err != nil {
+		return fmt.Errorf("после истечения TTL: %w", err)
+	}
+	keys, err := collectKeys(ctx, store, ds.NewKey("/conformance/ttl"))
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return fmt.Errorf("Keys после истечения TTL: %v", keys)
+	}
+	return nil
+}
+
+// checkNoTTL: у ключа без TTL время истечения не в будущем, у
+// отсутствующего ключа - ds.ErrNotFound.
+func checkNoTTL(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/ttl/persistent")
+	if err := store.Put(ctx, key, []byte("v")); err != nil {
+		return err
+	}
+	expiration, err := store.GetExpiration(ctx, key)
+	if err != nil {
+		return fmt.Errorf("GetExpiration ключа без TTL: %w", err)
+	}
+	if expiration.After(time.Now()) {
+		return fmt.Errorf("GetExpiration ключа без TTL: %s", expiration)
+	}
+
+	if _, err := store.GetExpiration(ctx, ds.NewKey("/conformance/ttl/missing")); !errors.Is(err, ds.ErrNotFound) {
+		return fmt.Errorf("GetExpiration отсутствующего ключа: %v, ожидалось ds.ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkSetTTL(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/ttl/set")
+	if err := store.Put(ctx, key, []byte("value")); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := store.SetTTL(ctx, key, time.Minute); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("value")); err != nil {
+		return err
+	}
+	if err := expectExpiration(ctx, store, key, start, time.Minute); err != nil {
+		return err
+	}
+
+	if err := store.SetTTL(ctx, ds.NewKey("/conformance/ttl/missing"), time.Minute); err == nil {
+		return fmt.Errorf("SetTTL отсутствующего ключа без ошибки")
+	}
+	return nil
+}
+
+func checkExtendTTL(ctx context.Context, store datastore.Datastore) error {
+	key := ds.NewKey("/conformance/ttl/extend")
+	start := time.Now()
+	if err := store.PutWithTTL(ctx, key, []byte("v"), time.Minute); err != nil {
+		return err
+	}
+	if err := store.ExtendTTL(ctx, key, time.Minute); err != nil {
+		return err
+	}
+	if err := expectExpiration(ctx, store, key, start, 2*time.Minute); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v")); err != nil {
+		return err
+	}
+
+	if err := store.ExtendTTL(ctx, ds.NewKey("/conformance/ttl/missing"), time.Minute); err == nil {
+		return fmt.Errorf("ExtendTTL отсутствующего ключа без ошибки")
+	}
+	return nil
+}
+
+func checkSetTTLBatch(ctx context.Context, store datastore.Datastore) error {
+	keys := []ds.Key{ds.NewKey("/conformance/ttl/batch/a"), ds.NewKey("/conformance/ttl/batch/b")}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, []byte("v")); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	if err := store.SetTTLBatch(ctx, keys, time.Minute); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := expectExpiration(ctx, store, key, start, time.Minute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ttlBatch - пакет с поддержкой TTL.
+type ttlBatch interface {
+	ds.Batch
+	PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error
+}
+
+func checkBatchPutWithTTL(ctx context.Context, store datastore.Datastore) error {
+	b, err := store.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	batch, ok := b.(ttlBatch)
+	if !ok {
+		return fmt.Errorf("пакет %T не поддерживает PutWithTTL", b)
+	}
+
+	key := ds.NewKey("/conformance/ttl/batch-put")
+	start := time.Now()
+	if err := batch.PutWithTTL(ctx, key, []byte("v"), time.Minute); err != nil {
+		return err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	if err := expectValue(ctx, store, key, []byte("v")); err != nil {
+		return err
+	}
+	return expectExpiration(ctx, store, key, start, time.Minute)
+}
+
+func checkListTTLKeys(ctx context.Context, store datastore.Datastore) error {
+	soon := ds.NewKey("/conformance/ttl/list/soon")
+	later := ds.NewKey("/conformance/ttl/list/later")
+	other := ds.NewKey("/conformance/other/ttl")
+	if err := store.PutWithTTL(ctx, soon, []byte("v"), 30*time.Second); err != nil {
+		return err
+	}
+	if err := store.PutWithTTL(ctx, later, []byte("v"), time.Hour); err != nil {
+		return err
+	}
+	if err := store.PutWithTTL(ctx, other, []byte("v"), time.Hour); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, ds.NewKey("/conformance/ttl/list/persistent"), []byte("v")); err != nil {
+		return err
+	}
+
+	all, err := store.ListTTLKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("ListTTLKeys: %w", err)
+	}
+	if err := expectTTLKeys("ListTTLKeys", all, soon, later, other); err != nil {
+		return err
+	}
+
+	expiring, err := store.GetExpiringKeys(ctx, ds.NewKey("/conformance/ttl"), time.Minute)
+	if err != nil {
+		return fmt.Errorf("GetExpiringKeys: %w", err)
+	}
+	return expectTTLKeys("GetExpiringKeys", expiring, soon)
+}
+
+// expectTTLKeys сравнивает статусы TTL с ожидаемыми ключами без учета
+// порядка.
+func expectTTLKeys(what string, statuses []datastore.TTLKeyStatus, keys ...ds.Key) error {
+	if len(statuses) != len(keys) {
+		return fmt.Errorf("%s: %d ключей, ожидалось %d: %v", what, len(statuses), len(keys), statuses)
+	}
+	for _, key := range keys {
+		found := false
+		for _, status := range statuses {
+			if !status.Key.Equal(key) {
+				continue
+			}
+			found = true
+			if !status.HasTTL || status.IsExpired || status.ExpiresAt == nil || status.TimeLeft <= 0 {
+				return fmt.Errorf("%s: неверный статус %+v", what, status)
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: нет ключа %s", what, key)
+		}
+	}
+	return nil
+}
+
+func checkCleanupExpiredKeys(ctx context.Context, store datastore.Datastore) error {
+	start := time.Now()
+	key := ds.NewKey("/conformance/ttl/cleanup")
+	if err := store.PutWithTTL(ctx, key, []byte("v"), time.Second); err != nil {
+		return err
+	}
+	if err := sleepUntil(ctx, start.Add(time.Second+ttlPrecision)); err != nil {
+		return err
+	}
+	if _, err := store.CleanupExpiredKeys(ctx); err != nil {
+		return fmt.Errorf("CleanupExpiredKeys: %w", err)
+	}
+	statuses, err := store.ListTTLKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("ListTTLKeys: %w", err)
+	}
+	return expectTTLKeys("ListTTLKeys после очистки", statuses)
+}
@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// --- Content types
+
+// Тип содержимого ключа хранится записью /_system/ds-content-types/<key> и
+// пишется в одной транзакции со значением, с тем же TTL. Put и запись
+// PutWithOptions без типа сбрасывают сохраненный тип, пакеты его не меняют;
+// удаление ключа удаляет и его тип.
+const ContentTypesNamespace = "/_system/ds-content-types"
+
+// PutOptions - параметры записи PutWithOptions.
+type PutOptions struct {
+	// ContentType - MIME-тип значения; пустой сбрасывает сохраненный тип
+	ContentType string
+	// KeepContentType оставляет сохраненный тип при пустом ContentType
+	KeepContentType bool
+	TTL             time.Duration
+	// IfMatch и IfNoneMatch - условие ETag, как в PutIfMatch и PutIfNoneMatch
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// ContentTypeTxn - транзакция, которая пишет значения с типом и TTL, как
+// PutWithOptions; тип фиксируется вместе с транзакцией.
+type ContentTypeTxn interface {
+	PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error
+}
+
+var _ ContentTypeTxn = (*pubsubTxn)(nil)
+
+// ContentTypeFeatures - значения с сохраненным MIME-типом.
+type ContentTypeFeatures interface {
+	// PutWithOptions записывает значение, его тип, TTL и проверяет условие
+	// ETag одной транзакцией.
+	PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error
+	// GetContentType возвращает сохраненный тип значения ключа, пустой -
+	// если тип не задавался, и ds.ErrNotFound для отсутствующего ключа.
+	GetContentType(ctx context.Context, key ds.Key) (string, error)
+}
+
+func contentTypeKey(key ds.Key) ds.Key {
+	return ds.NewKey(ContentTypesNamespace).ChildString(key.String())
+}
+
+// normalizeContentType проверяет MIME-тип и приводит его к каноническому виду.
+func normalizeContentType(contentType string) (string, error) {
+	if contentType == "" {
+		return "", nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("неверный тип содержимого %q: %w", contentType, err)
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
+
+// putOptionsOp строит операцию записи по PutOptions.
+func putOptionsOp(key ds.Key, value []byte, opts PutOptions) (batchOp, error) {
+	contentType, err := normalizeContentType(opts.ContentType)
+	if err != nil {
+		return batchOp{}, err
+	}
+	op := batchOp{key: key, value: value, ttl: opts.TTL, contentType: contentType, clearContentType: !opts.KeepContentType}
+	if opts.IfMatch != "" || opts.IfNoneMatch != "" {
+		op.cond = &etagCondition{}
+		if opts.IfMatch != "" {
+			if op.cond.match, err = normalizeETag(opts.IfMatch); err != nil {
+				return batchOp{}, err
+			}
+		}
+		if opts.IfNoneMatch != "" {
+			if op.cond.noneMatch, err = normalizeETag(opts.IfNoneMatch); err != nil {
+				return batchOp{}, err
+			}
+		}
+	}
+	return op, nil
+}
+
+func (s *datastorage) PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error {
+	op, err := putOptionsOp(key, value, opts)
+	if err != nil {
+		return err
+	}
+	if err := s.ValidateValue(key, value); err != nil {
+		return err
+	}
+	op = s.withTTLPolicy(op)
+	if err := s.applyOp(ctx, op); err != nil {
+		return err
+	}
+	if !s.silentMode {
+		s.publishEvent(EventPut, key, value)
+	}
+	s.trackTTLWrite(op)
+	return nil
+}
+
+func (s *datastorage) GetContentType(ctx context.Context, key ds.Key) (string, error) {
+	data, err := s.Datastore.Get(ctx, contentTypeKey(key))
+	if err == ds.ErrNotFound {
+		has, err := s.Datastore.Has(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if !has {
+			return "", ds.ErrNotFound
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения типа содержимого: %w", err)
+	}
+	return string(data), nil
+}
+
+// writeContentTypeInTxn обновляет тип содержимого ключа вместе с операцией.
+func writeContentTypeInTxn(ctx context.Context, txn ds.Txn, op batchOp) error {
+	switch {
+	case op.isDelete:
+		return txn.Delete(ctx, contentTypeKey(op.key))
+	case op.contentType == "" && op.clearContentType:
+		// Has дешевле удаления: у большинства ключей типа нет
+		has, err := txn.Has(ctx, contentTypeKey(op.key))
+		if err != nil || !has {
+			return err
+		}
+		return txn.Delete(ctx, contentTypeKey(op.key))
+	case op.contentType == "":
+		return nil
+	case op.ttl > 0:
+		return txn.(ds.TTL).PutWithTTL(ctx, contentTypeKey(op.key), []byte(op.contentType), op.ttl)
+	default:
+		return txn.Put(ctx, contentTypeKey(op.key), []byte(op.contentType))
+	}
+}
+
+// setTTLWithContentType меняет TTL ключа и его типа содержимого одной
+// транзакцией, чтобы тип истекал вместе со значением.
+func (s *datastorage) setTTLWithContentType(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	txn, err := s.Datastore.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+
+	if err := setTTLInTxn(ctx, txn, key, ttl); err != nil {
+		return err
+	}
+	return txn.Commit(ctx)
+}
+
+// setTTLInTxn меняет TTL ключа и его типа содержимого в транзакции txn.
+func setTTLInTxn(ctx context.Context, txn ds.Txn, key ds.Key, ttl time.Duration) error {
+	if err := txn.(ds.TTL).SetTTL(ctx, key, ttl); err != nil {
+		return err
+	}
+	contentType, err := txn.Get(ctx, contentTypeKey(key))
+	switch {
+	case err == ds.ErrNotFound:
+	case err != nil:
+		return fmt.Errorf("ошибка чтения типа содержимого: %w", err)
+	default:
+		if err := txn.(ds.TTL).PutWithTTL(ctx, contentTypeKey(key), contentType, ttl); err != nil {
+			return fmt.Errorf("ошибка записи типа содержимого: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// --- Pagination cursors
+
+// Курсор продолжения - непрозрачная для клиента строка: последний отданный
+// ключ, число уже отданных результатов этого ключа (jq-программа и view могут
+// дать по ключу несколько результатов) и хэш параметров выборки. Следующая
+// страница запрашивается с теми же параметрами и cursor; limit может
+// меняться.
+
+var (
+	errInvalidCursor  = errors.New("неверный курсор")
+	errCursorMismatch = errors.New("курсор не соответствует параметрам запроса")
+)
+
+type pageCursor struct {
+	Key    string `json:"k"`
+	Skip   int    `json:"n"`
+	Filter string `json:"h"`
+}
+
+// cursorFilter - хэш параметров выборки, которые курсор должен сохранять.
+func cursorFilter(params ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(params, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и сверяет его с параметрами запроса;
+// пустая строка - первая страница.
+func decodeCursor(cursor, filter string) (*pageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Key == "" || c.Skip < 1 {
+		return nil, errInvalidCursor
+	}
+	if c.Filter != filter {
+		return nil, errCursorMismatch
+	}
+	return &c, nil
+}
+
+// pager отбирает одну страницу из упорядоченной по ключам выборки.
+type pager struct {
+	limit  int
+	filter string
+	cursor *pageCursor
+
+	key      string // ключ текущего результата
+	seen     int    // результатов текущего ключа, включая отданные ранее
+	count    int
+	lastKey  string
+	lastSeen int
+	next     string
+}
+
+func newPager(limit int, cursor, filter string) (*pager, error) {
+	c, err := decodeCursor(cursor, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &pager{limit: limit, filter: filter, cursor: c}, nil
+}
+
+// bounds сужает диапазон выборки до ключа курсора: выборка продолжается
+// с него включительно, уже отданные результаты пропускает accept.
+func (p *pager) bounds(start, end ds.Key, reverse bool) (ds.Key, ds.Key) {
+	if p.cursor == nil {
+		return start, end
+	}
+	switch {
+	case reverse && (end.String() == "" || p.cursor.Key < end.String()):
+		end = ds.RawKey(p.cursor.Key)
+	case !reverse && p.cursor.Key > start.String():
+		start = ds.RawKey(p.cursor.Key)
+	}
+	return start, end
+}
+
+// scanLimit - сколько результатов запросить у источника с limit, чтобы
+// пропустить отданные и узнать, есть ли следующая страница.
+func (p *pager) scanLimit() int {
+	if p.limit <= 0 {
+		return 0
+	}
+	if p.cursor != nil {
+		return p.limit + p.cursor.Skip + 1
+	}
+	return p.limit + 1
+}
+
+// accept решает судьбу очередного результата: include - добавить в
+// страницу, done - страница заполнена и выборку нужно остановить.
+func (p *pager) accept(key string) (include, done bool) {
+	if key != p.key {
+		p.key = key
+		p.seen = 0
+	}
+	p.seen++
+	if p.cursor != nil && key == p.cursor.Key && p.seen <= p.cursor.Skip {
+		return false, false
+	}
+	if p.limit > 0 && p.count >= p.limit {
+		p.next = encodeCursor(pageCursor{Key: p.lastKey, Skip: p.lastSeen, Filter: p.filter})
+		return false, true
+	}
+	p.count++
+	p.lastKey = key
+	p.lastSeen = p.seen
+	return true, false
+}
+
+// truncated - остались результаты после страницы.
+func (p *pager) truncated() bool {
+	return p.next != ""
+}
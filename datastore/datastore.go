@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"ues-lite/js"
 
+	"github.com/dgraph-io/badger/v4"
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 	badger4 "github.com/ipfs/go-ds-badger4"
@@ -30,14 +30,30 @@ type Datastore interface {
 	TTLFeature
 	SubscriptionFeatures
 	EventFeartures
+	ViewFeatures
+	IndexFeatures
+	TransformFeatures
+	TransformJobFeatures
+	SchemaFeatures
+	ConditionalFeatures
+	AtomicBatching
+	ContentTypeFeatures
+	TTLPolicyFeatures
+	SnapshotFeatures
+	ExportFeatures
+	TokenFeatures
+	StreamFeatures
 	//
 	Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error)
+	Scan(ctx context.Context, opts ScanOptions) (<-chan KeyValue, <-chan error, error)
 	Merge(ctx context.Context, other Datastore) error
 	Clear(ctx context.Context) error
 	Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <-chan error, error)
 	Close() error
 	SetSilentMode(silent bool)
-	QueryJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (any, error)
+	QueryJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (<-chan JQResult, <-chan error, error)
+	AggregateJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (any, error)
+	QueryJQSingle(ctx context.Context, key ds.Key, jqQuery string) (any, error)
 	Transform(ctx context.Context, prefix ds.Key, extract string, patchs []string, jqTransform string) error
 }
 
@@ -57,22 +73,42 @@ var _ ds.Batching = (*datastorage)(nil)
 var _ TTLFeature = (*datastorage)(nil)
 var _ SubscriptionFeatures = (*datastorage)(nil)
 var _ EventFeartures = (*datastorage)(nil)
+var _ ViewFeatures = (*datastorage)(nil)
+var _ IndexFeatures = (*datastorage)(nil)
+var _ TransformFeatures = (*datastorage)(nil)
+var _ TransformJobFeatures = (*datastorage)(nil)
+var _ SchemaFeatures = (*datastorage)(nil)
+var _ ConditionalFeatures = (*datastorage)(nil)
+var _ AtomicBatching = (*datastorage)(nil)
+var _ ContentTypeFeatures = (*datastorage)(nil)
+var _ TTLPolicyFeatures = (*datastorage)(nil)
+var _ SnapshotFeatures = (*datastorage)(nil)
+var _ ExportFeatures = (*datastorage)(nil)
+var _ TokenFeatures = (*datastorage)(nil)
 
 type datastorage struct {
 	*badger4.Datastore
-	subscribers map[string]Subscriber
-	mu          sync.RWMutex
-	eventQueue  chan Event
-	done        chan struct{}
-	wg          sync.WaitGroup
-	silentMode  bool
-	// viewOnce         sync.Once
+	subscribers      map[string]Subscriber
+	mu               sync.RWMutex
+	eventQueue       chan Event
+	done             chan struct{}
+	wg               sync.WaitGroup
+	silentMode       bool
 	ttlMonitorConfig *TTLMonitorConfig
 	ttlMu            sync.RWMutex
 	ttlDone          chan struct{} // для остановки TTL мониторинга
+	ttlWake          chan struct{} // пересчет времени следующей проверки
 	ttlWg            sync.WaitGroup
-	//
-	// viewManager ViewManager
+	ttlIndexMu       sync.Mutex
+	ttlPolicies      ttlPolicyRegistry
+	viewManager      ViewManager
+	indexReg         indexRegistry
+	schemaReg        schemaRegistry
+	jqCache          *jqCache
+	jobs             map[string]*transformJobRunner
+	jobsMu           sync.Mutex
+	jobsWg           sync.WaitGroup
+	jobsClosed       bool
 }
 
 func NewDatastorage(path string, opts *badger4.Options) (Datastore, error) {
@@ -88,10 +124,13 @@ func NewDatastorage(path string, opts *badger4.Options) (Datastore, error) {
 		eventQueue:  make(chan Event, 1000), // Buffer for event queue
 		done:        make(chan struct{}),
 		ttlDone:     make(chan struct{}),
-		//
-		// jqCache: newJQQueryCache(), // Инициализируем кэш
-
+		ttlWake:     make(chan struct{}, 1),
+		indexReg:    indexRegistry{indexes: make(map[string]*secondaryIndex)},
+		schemaReg:   schemaRegistry{schemas: make(map[string]*keySchema)},
+		ttlPolicies: ttlPolicyRegistry{policies: make(map[string]TTLPolicy)},
+		jobs:        make(map[string]*transformJobRunner),
 	}
+	ds.jqCache = newJQCache(DefaultJQCacheSize, append(jqFunctions(), ds.jqGetFunction())...)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -100,11 +139,30 @@ func NewDatastorage(path string, opts *badger4.Options) (Datastore, error) {
 		log.Printf("ошибка загрузки JS подписок: %v", err)
 	}
 
+	if err := ds.loadIndexes(ctx); err != nil {
+		log.Printf("ошибка загрузки индексов: %v", err)
+	}
+
+	if err := ds.loadSchemas(ctx); err != nil {
+		log.Printf("ошибка загрузки схем: %v", err)
+	}
+
+	if err := ds.loadTTLPolicies(ctx); err != nil {
+		log.Printf("ошибка загрузки политик TTL: %v", err)
+	}
+
+	if err := ds.loadTransformJobs(ctx); err != nil {
+		log.Printf("ошибка загрузки заданий трансформации: %v", err)
+	}
+
+	ds.viewManager = NewViewManager(ds)
+	if err := ds.viewManager.LoadViewConfigs(ctx); err != nil {
+		log.Printf("ошибка загрузки views: %v", err)
+	}
+
 	ds.wg.Add(1)
 	go ds.eventDispatcher()
 
-	// ds.viewManager = NewViewManager(ds)
-
 	return ds, nil
 }
 
@@ -159,34 +217,73 @@ func (s *datastorage) SetSilentMode(silent bool) {
 }
 
 func (s *datastorage) Put(ctx context.Context, key ds.Key, value []byte) error {
-	err := s.Datastore.Put(ctx, key, value)
+	if err := s.ValidateValue(key, value); err != nil {
+		return err
+	}
+	op := s.withTTLPolicy(batchOp{key: key, value: value, clearContentType: true})
+	err := s.applyOp(ctx, op)
 	if err == nil {
 		if !s.silentMode {
 			s.publishEvent(EventPut, key, value)
 		}
+		s.trackTTLWrite(op)
 	}
 	return err
 }
 
 func (s *datastorage) Delete(ctx context.Context, key ds.Key) error {
-	err := s.Datastore.Delete(ctx, key)
+	err := s.applyOp(ctx, batchOp{isDelete: true, key: key})
 	if err == nil {
 		if !s.silentMode {
 			s.publishEvent(EventDelete, key, nil)
 		}
 	}
-	s.ttlMu.Lock()
-	if s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled {
-		ttlKey := ds.NewKey(TTLNameSpace).ChildString(key.String())
-		err := s.Datastore.Delete(ctx, ttlKey)
-		if err != nil && err != ds.ErrNotFound {
-			log.Printf("ошибка удаления ключа из TTL мониторинга: %v", err)
-		}
-	}
-	s.ttlMu.Unlock()
+	s.unregisterTTLKey(ctx, key)
 	return err
 }
 
+// GetSize возвращает точный размер значения: badger для значений из value
+// log и для записей незавершенной транзакции отдает только оценку.
+func (s *datastorage) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	value, err := s.Datastore.Get(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (s *datastorage) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	return reverseSafeQuery(ctx, q, s.Datastore.Query)
+}
+
+// reverseSafeQuery выполняет запрос с OrderByKeyDescending без обратного
+// итератора badger: с префиксом он не находит ни одного ключа. Такие
+// запросы сортируются в памяти.
+func reverseSafeQuery(ctx context.Context, q query.Query, run func(context.Context, query.Query) (query.Results, error)) (query.Results, error) {
+	if len(q.Orders) == 0 {
+		return run(ctx, q)
+	}
+	switch q.Orders[0].(type) {
+	case query.OrderByKeyDescending, *query.OrderByKeyDescending:
+	default:
+		return run(ctx, q)
+	}
+
+	base := q
+	base.Orders = nil
+	base.Limit = 0
+	base.Offset = 0
+	res, err := run(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+
+	naive := q
+	naive.Prefix = ""
+	naive.Filters = nil
+	return query.NaiveQueryApply(naive, query.ResultsReplaceQuery(res, q)), nil
+}
+
 func (s *datastorage) Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error) {
 	q := query.Query{
 		Prefix:   prefix.String(),
@@ -321,12 +418,20 @@ func (s *datastorage) Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <
 
 func (s *datastorage) Close() error {
 
+	s.stopTransformJobs()
+
 	s.ttlMu.Lock()
 	if s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled {
 		s.stopTTLMonitoring()
 	}
 	s.ttlMu.Unlock()
 
+	if s.viewManager != nil {
+		if err := s.viewManager.Close(); err != nil {
+			log.Printf("ошибка закрытия ViewManager: %v", err)
+		}
+	}
+
 	close(s.done)
 	s.wg.Wait()
 
@@ -339,14 +444,6 @@ func (s *datastorage) Close() error {
 		}
 	}
 
-	// if s.viewManager != nil {
-	// 	if closer, ok := s.viewManager.(*DefaultViewManager); ok {
-	// 		if err := closer.Close(); err != nil {
-	// 			log.Printf("ошибка закрытия ViewManager: %v", err)
-	// 		}
-	// 	}
-	// }
-
 	return s.Datastore.Close()
 }
 
@@ -354,75 +451,17 @@ func (s *datastorage) Close() error {
 
 const BatchSize = 100
 
+// Transform применяет трансформацию ко всем ключам под префиксом, пропуская
+// значения с ошибками. Изменения записываются в журнал (см. RunTransform).
 func (s *datastorage) Transform(ctx context.Context, prefix ds.Key, extract string, patchs []string, jqTransform string) error {
-
-	q := query.Query{
-		Prefix: prefix.String(),
-	}
-
-	results, err := s.Datastore.Query(ctx, q)
-	if err != nil {
-		return fmt.Errorf("ошибка выполнения запроса: %w", err)
-	}
-	defer results.Close()
-
-	batch, err := s.Batch(ctx)
-	if err != nil {
-		return fmt.Errorf("ошибка создания batch: %w", err)
-	}
-
-	batchCount := 0
-
-	for {
-
-		select {
-
-		case <-ctx.Done():
-			return ctx.Err()
-
-		case res, ok := <-results.Next():
-
-			if !ok {
-				if batch != nil && batchCount > 0 {
-					if err := batch.Commit(ctx); err != nil {
-						return fmt.Errorf("ошибка коммита batch: %w", err)
-					}
-				}
-				return nil
-			}
-
-			if res.Error != nil {
-				fmt.Printf("Ошибка в результате запроса: %v\n", res.Error)
-				continue
-			}
-
-			originalData := res.Value
-
-			transformedValue, err := s.applyTransformation(ctx, originalData, extract, patchs, jqTransform)
-			if err != nil {
-				fmt.Printf("Ошибка трансформации для ключа %s: %v\n", res.Key, err)
-				continue
-			}
-
-			if err := batch.Put(ctx, ds.NewKey(res.Key), transformedValue); err != nil {
-				fmt.Printf("Ошибка добавления в batch для ключа %s: %v\n", res.Key, err)
-				continue
-			}
-
-			batchCount++
-
-			if batchCount >= BatchSize {
-				if err := batch.Commit(ctx); err != nil {
-					return fmt.Errorf("ошибка коммита batch: %w", err)
-				}
-				batch, err = s.Batch(ctx)
-				if err != nil {
-					return fmt.Errorf("ошибка создания batch: %w", err)
-				}
-				batchCount = 0
-			}
-		}
-	}
+	_, err := s.RunTransform(ctx, &TransformOptions{
+		Prefix:       prefix,
+		Extract:      extract,
+		Patches:      patchs,
+		JQ:           jqTransform,
+		IgnoreErrors: true,
+	})
+	return err
 }
 
 func (s *datastorage) applyTransformation(ctx context.Context, jsonBytes []byte, extract string, patch []string, jqTransform string) ([]byte, error) {
@@ -431,14 +470,9 @@ func (s *datastorage) applyTransformation(ctx context.Context, jsonBytes []byte,
 
 	if jqTransform != "" {
 
-		query, err := gojq.Parse(jqTransform)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка парсинга jq-запроса: %w", err)
-		}
-
-		code, err := gojq.Compile(query)
+		code, err := s.compileJQ(jqTransform)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка компиляции jq-запроса: %w", err)
+			return nil, err
 		}
 
 		var input any
@@ -475,44 +509,51 @@ func (s *datastorage) applyTransformation(ctx context.Context, jsonBytes []byte,
 
 		}
 
-		if len(patch) > 0 {
-			for _, p := range patch {
-				var err error
-				k, v, ok := strings.Cut(p, "=")
-				if ok {
-					var value any = v
-					var t string
-					t, v, ok = strings.Cut(v, "#")
-					if ok {
-						switch t {
-						case "int":
-							value = parseInt(v)
-						case "float":
-							value = parseFloat(v)
-						case "bool":
-							value = parseBool(v)
-						case "json":
-							var jsonVal any
-							if err := json.Unmarshal([]byte(v), &jsonVal); err != nil {
-								fmt.Printf("⚠️  Ошибка парсинга JSON значения '%s': %v\n", v, err)
-								continue
-							}
-							value = jsonVal
-						default:
-							value = v
-						}
-					}
-					out, err = sjson.SetBytes(out, k, value)
-					if err != nil {
-						fmt.Printf("⚠️  Ошибка применения patch '%s': %v\n", p, err)
-						continue
-					}
+		out = applyPatchStrings(out, patch)
+	}
+
+	return out, nil
+}
+
+// applyPatchStrings применяет патчи вида 'path=value' или 'path=type#value'
+// (type: int, float, bool, json); некорректные патчи пропускаются.
+func applyPatchStrings(value []byte, patch []string) []byte {
+	out := value
+	for _, p := range patch {
+		var err error
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		var patchValue any = v
+		var t string
+		t, v, ok = strings.Cut(v, "#")
+		if ok {
+			switch t {
+			case "int":
+				patchValue = parseInt(v)
+			case "float":
+				patchValue = parseFloat(v)
+			case "bool":
+				patchValue = parseBool(v)
+			case "json":
+				var jsonVal any
+				if err := json.Unmarshal([]byte(v), &jsonVal); err != nil {
+					fmt.Printf("⚠️  Ошибка парсинга JSON значения '%s': %v\n", v, err)
+					continue
 				}
+				patchValue = jsonVal
+			default:
+				patchValue = v
 			}
 		}
+		out, err = sjson.SetBytes(out, k, patchValue)
+		if err != nil {
+			fmt.Printf("⚠️  Ошибка применения patch '%s': %v\n", p, err)
+			continue
+		}
 	}
-
-	return out, nil
+	return out
 }
 
 // --- Batch with PubSub support
@@ -521,13 +562,22 @@ type pubsubBatch struct {
 	ds.Batch
 	parent     *datastorage
 	ops        []batchOp
+	system     []batchOp
 	silentMode bool
+	// atomic - пакет применяется одной транзакцией без деления на части
+	atomic bool
 }
 
 type batchOp struct {
 	isDelete bool
 	key      ds.Key
 	value    []byte
+	ttl      time.Duration
+	cond     *etagCondition
+	// contentType - новый тип содержимого ключа; пустой - тип не меняется,
+	// а с clearContentType сбрасывается
+	contentType      string
+	clearContentType bool
 }
 
 func (s *datastorage) Batch(ctx context.Context) (ds.Batch, error) {
@@ -543,32 +593,106 @@ func (s *datastorage) Batch(ctx context.Context) (ds.Batch, error) {
 	}, nil
 }
 
-func (b *pubsubBatch) Put(ctx context.Context, key ds.Key, value []byte) error {
-	err := b.Batch.Put(ctx, key, value)
-	if err == nil {
-		b.ops = append(b.ops, batchOp{
-			isDelete: false,
-			key:      key,
-			value:    value,
-		})
+func (s *datastorage) AtomicBatch(ctx context.Context) (ConditionalBatch, error) {
+	return s.newAtomicBatch(), nil
+}
+
+func (s *datastorage) newAtomicBatch() *pubsubBatch {
+	return &pubsubBatch{
+		parent:     s,
+		ops:        make([]batchOp, 0),
+		silentMode: s.silentMode,
+		atomic:     true,
 	}
-	return err
+}
+
+// Операции буферизуются до Commit: если какая-то из них затрагивает
+// индексируемый префикс, batch применяется в транзакции вместе с индексами.
+func (b *pubsubBatch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	b.ops = append(b.ops, batchOp{
+		isDelete: false,
+		key:      key,
+		value:    value,
+	})
+	return nil
+}
+
+// PutWithTTL добавляет запись с TTL; такой batch коммитится в транзакции.
+func (b *pubsubBatch) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	b.ops = append(b.ops, batchOp{
+		key:   key,
+		value: value,
+		ttl:   ttl,
+	})
+	return nil
 }
 
 func (b *pubsubBatch) Delete(ctx context.Context, key ds.Key) error {
-	err := b.Batch.Delete(ctx, key)
-	if err == nil {
-		b.ops = append(b.ops, batchOp{
-			isDelete: true,
-			key:      key,
-		})
+	b.ops = append(b.ops, batchOp{
+		isDelete: true,
+		key:      key,
+	})
+	return nil
+}
+
+// putSystem добавляет служебную запись, которая коммитится вместе с batch,
+// но не публикует событий.
+func (b *pubsubBatch) putSystem(key ds.Key, value []byte) {
+	b.system = append(b.system, batchOp{key: key, value: value})
+}
+
+// commit применяет операции пакета под opMu индексов.
+func (b *pubsubBatch) commit(ctx context.Context, ops []batchOp) error {
+	b.parent.indexReg.opMu.RLock()
+	defer b.parent.indexReg.opMu.RUnlock()
+	switch {
+	case b.atomic:
+		return b.parent.commitAtomic(ctx, ops)
+	case needsTxn(b.ops) || b.parent.hasIndexesFor(b.ops):
+		err := b.parent.commitWithIndexes(ctx, ops)
+		// Пакет badger не используется, освобождаем его ресурсы
+		if canceler, ok := b.Batch.(interface{ Cancel() error }); ok {
+			canceler.Cancel()
+		}
+		return err
+	default:
+		for _, op := range ops {
+			var err error
+			if op.isDelete {
+				err = b.Batch.Delete(ctx, op.key)
+				if err == nil {
+					err = b.Batch.Delete(ctx, contentTypeKey(op.key))
+				}
+			} else {
+				err = b.Batch.Put(ctx, op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return b.Batch.Commit(ctx)
 	}
-	return err
 }
 
 func (b *pubsubBatch) Commit(ctx context.Context) error {
-	err := b.Batch.Commit(ctx)
+	if err := b.parent.validateOps(b.ops); err != nil {
+		return err
+	}
+	for i := range b.ops {
+		b.ops[i] = b.parent.withTTLPolicy(b.ops[i])
+	}
+	ops := make([]batchOp, 0, len(b.system)+len(b.ops))
+	ops = append(append(ops, b.system...), b.ops...)
+	err := b.commit(ctx, ops)
 	if err == nil {
+		for _, op := range b.ops {
+			switch {
+			case op.isDelete:
+				b.parent.unregisterTTLKey(ctx, op.key)
+			default:
+				b.parent.trackTTLWrite(op)
+			}
+		}
 		if !b.silentMode {
 			for _, op := range b.ops {
 				if op.isDelete {
@@ -583,6 +707,17 @@ func (b *pubsubBatch) Commit(ctx context.Context) error {
 	return err
 }
 
+// needsTxn сообщает, что пакет содержит операции с TTL или условием:
+// пакет badger их не поддерживает.
+func needsTxn(ops []batchOp) bool {
+	for _, op := range ops {
+		if op.ttl > 0 || op.cond != nil || op.contentType != "" || op.clearContentType {
+			return true
+		}
+	}
+	return false
+}
+
 // --- Transform
 
 func parseInt(s string) int64 {
@@ -611,17 +746,32 @@ func parseBool(s string) bool {
 
 // --- JQ Query
 
+// JQQueryOptions задает область выборки для jq-запросов. Prefix, диапазон
+// [Start, End], порядок, Limit и KeysOnly выполняются на уровне итератора
+// badger.
 type JQQueryOptions struct {
-	Prefix  ds.Key
-	Limit   int
-	Timeout time.Duration
+	Prefix           ds.Key
+	Start            ds.Key
+	End              ds.Key
+	Limit            int
+	KeysOnly         bool
+	Reverse          bool // обход по убыванию ключей
+	Timeout          time.Duration
+	TreatAsString    bool // не-JSON значения передаются в jq как строки
+	IgnoreParseError bool // не-JSON значения пропускаются
+}
+
+type JQResult struct {
+	Key   ds.Key `json:"key"`
+	Value any    `json:"value"`
 }
 
 type iterator struct {
-	opts *JQQueryOptions
-	ctx  context.Context
-	out  <-chan KeyValue
-	errc <-chan error
+	opts  *JQQueryOptions
+	ctx   context.Context
+	out   <-chan KeyValue
+	errc  <-chan error
+	count int
 }
 
 func NewIterator(ctx context.Context, s *datastorage, opts *JQQueryOptions) *iterator {
@@ -631,59 +781,257 @@ func NewIterator(ctx context.Context, s *datastorage, opts *JQQueryOptions) *ite
 			Timeout: 30 * time.Second,
 		}
 	}
-	out, errc, _ := s.Iterator(ctx, opts.Prefix, false)
+	out, errc := s.scanRange(ctx, opts.scanOptions(), false)
 	return &iterator{opts: opts, ctx: ctx, out: out, errc: errc}
 }
 
 func (i *iterator) Next() (any, bool) {
+	for {
+		select {
 
-	select {
+		case <-i.ctx.Done():
+			return nil, false
+
+		case err, ok := <-i.errc:
+			if ok && err != nil {
+				return err, true
+			}
+			i.errc = nil
+
+		case kv, ok := <-i.out:
+			if !ok {
+				return nil, false
+			}
 
-	case <-i.ctx.Done():
-		return nil, false
+			if i.opts.Limit > 0 && i.count >= i.opts.Limit {
+				return nil, false
+			}
+
+			input, skip, err := i.opts.decode(kv)
+			if err != nil {
+				return err, true
+			}
+			if skip {
+				continue
+			}
+			i.count++
 
-	case err, ok := <-i.errc:
-		if ok && err != nil {
-			fmt.Printf("Iterator error: %v\n", err)
+			return input, true
 		}
-		return nil, false
+	}
+}
 
-	case kv, ok := <-i.out:
-		if !ok {
-			return nil, false
+// decode преобразует значение ключа во входные данные jq.
+func (opts *JQQueryOptions) decode(kv KeyValue) (input any, skip bool, err error) {
+	if opts.KeysOnly {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal(kv.Value, &input); err != nil {
+		switch {
+		case opts.TreatAsString:
+			return string(kv.Value), false, nil
+		case opts.IgnoreParseError:
+			return nil, true, nil
 		}
+		return nil, false, fmt.Errorf("ошибка парсинга JSON для ключа %s: %w", kv.Key.String(), err)
+	}
+	return input, false, nil
+}
 
-		if i.opts.Limit > 0 {
-			i.opts.Limit--
-			if i.opts.Limit < 0 {
-				return nil, false
-			}
+// ScanOptions задает упорядоченную выборку Scan: префикс, диапазон
+// [Start, End] и направление обхода.
+type ScanOptions struct {
+	Prefix   ds.Key
+	Start    ds.Key
+	End      ds.Key
+	Reverse  bool
+	KeysOnly bool
+}
+
+// Scan отдает ключи префикса из диапазона [Start, End] по возрастанию, с
+// Reverse - по убыванию. Пустой ключ означает отсутствие границы.
+func (s *datastorage) Scan(ctx context.Context, opts ScanOptions) (<-chan KeyValue, <-chan error, error) {
+	out, errc := s.scanRange(ctx, opts, true)
+	return out, errc, nil
+}
+
+func (opts *JQQueryOptions) scanOptions() ScanOptions {
+	return ScanOptions{
+		Prefix:   opts.Prefix,
+		Start:    opts.Start,
+		End:      opts.End,
+		Reverse:  opts.Reverse,
+		KeysOnly: opts.KeysOnly,
+	}
+}
+
+// scanRange итерирует ключи в пределах префикса и диапазона opts напрямую
+// по badger, не загружая значения при KeysOnly. Без withSystem системные
+// ключи пропускаются, если префикс не указывает внутрь /_system.
+func (s *datastorage) scanRange(ctx context.Context, opts ScanOptions, withSystem bool) (<-chan KeyValue, <-chan error) {
+	out := make(chan KeyValue, 100)
+	errc := make(chan error, 1)
+
+	prefix := "/"
+	if opts.Prefix.String() != "/" && opts.Prefix.String() != "" {
+		prefix = opts.Prefix.String() + "/"
+	}
+	start := opts.Start.String()
+	end := opts.End.String()
+	seek := prefix
+	if start > seek {
+		seek = start
+	}
+	// Обратный итератор badger встает на наибольший ключ не больше seek:
+	// без конца диапазона это ключ сразу за всеми ключами префикса
+	if opts.Reverse {
+		seek = prefix + "\xff"
+		if end != "" && end < seek {
+			seek = end
 		}
+	}
+	includeSystem := withSystem || strings.HasPrefix(prefix, "/_system/")
 
-		var input any
-		if err := json.Unmarshal(kv.Value, &input); err != nil {
-			fmt.Printf("JSON Unmarshal error for key %s: %v\n", kv.Key.String(), err)
-			return nil, false
+	go func() {
+		defer close(out)
+		defer close(errc)
+		err := s.Datastore.DB.View(func(txn *badger.Txn) error {
+			itOpts := badger.DefaultIteratorOptions
+			itOpts.PrefetchValues = !opts.KeysOnly
+			itOpts.Prefix = []byte(prefix)
+			itOpts.Reverse = opts.Reverse
+			it := txn.NewIterator(itOpts)
+			defer it.Close()
+			for it.Seek([]byte(seek)); it.Valid(); it.Next() {
+				item := it.Item()
+				key := string(item.Key())
+				if (opts.Reverse && key < start) || (!opts.Reverse && end != "" && key > end) {
+					break
+				}
+				if !includeSystem && strings.HasPrefix(key, "/_system/") {
+					continue
+				}
+				kv := KeyValue{Key: ds.RawKey(key)}
+				if !opts.KeysOnly {
+					value, err := item.ValueCopy(nil)
+					if err != nil {
+						return err
+					}
+					kv.Value = value
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- kv:
+				}
+			}
+			return nil
+		})
+		if err != nil && err != context.Canceled {
+			errc <- err
 		}
+	}()
+
+	return out, errc
+}
 
-		return input, true
+// QueryJQ выполняет jq-программу для каждого ключа в выборке и отдает
+// результаты потоком. Ключ доступен в программе как $key. Limit ограничивает
+// число результатов; закрытие ctx останавливает итерацию.
+func (s *datastorage) QueryJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (<-chan JQResult, <-chan error, error) {
+	if opts == nil {
+		opts = &JQQueryOptions{Prefix: ds.NewKey("/")}
+	}
+
+	code, err := s.compileJQ(jqQuery, "$key")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
 
+	results := make(chan JQResult, 100)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer cancel()
+		defer close(results)
+		defer close(errc)
+
+		in, scanErrc := s.scanRange(ctx, opts.scanOptions(), false)
+		sent := 0
+		for kv := range in {
+			input, skip, err := opts.decode(kv)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if skip {
+				continue
+			}
+			iter := code.RunWithContext(ctx, input, kv.Key.String())
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, isErr := v.(error); isErr {
+					errc <- fmt.Errorf("ошибка выполнения jq-запроса для ключа %s: %w", kv.Key.String(), err)
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case results <- JQResult{Key: kv.Key, Value: v}:
+				}
+				sent++
+				if opts.Limit > 0 && sent >= opts.Limit {
+					return
+				}
+			}
+		}
+		if err := <-scanErrc; err != nil {
+			errc <- err
+			return
+		}
+		if err := ctx.Err(); err != nil && err != context.Canceled {
+			errc <- err
+		}
+	}()
+
+	return results, errc, nil
 }
 
-func (s *datastorage) QueryJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (any, error) {
+// AggregateJQ выполняет jq-программу один раз, передавая значения выборки
+// через inputs (например, reduce inputs as $x (...)).
+func (s *datastorage) AggregateJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (any, error) {
+	var cancel context.CancelFunc
+	if opts != nil && opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
 
+	// Итератор входных данных задается при компиляции, поэтому агрегация
+	// компилируется на каждый вызов, минуя кэш
 	query, err := gojq.Parse(jqQuery)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка парсинга jq-запроса: %w", err)
 	}
 
-	code, err := gojq.Compile(query, gojq.WithInputIter(NewIterator(ctx, s, opts)))
+	options := append(jqFunctions(), s.jqGetFunction(), gojq.WithInputIter(NewIterator(ctx, s, opts)))
+	code, err := gojq.Compile(query, options...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка компиляции jq-запроса: %w", err)
 	}
 
-	resultIter := code.Run(nil)
+	resultIter := code.RunWithContext(ctx, nil)
 
 	results := []any{}
 
@@ -709,6 +1057,45 @@ func (s *datastorage) QueryJQ(ctx context.Context, jqQuery string, opts *JQQuery
 	return results, nil
 }
 
+// QueryJQSingle применяет jq-программу к значению одного ключа.
+func (s *datastorage) QueryJQSingle(ctx context.Context, key ds.Key, jqQuery string) (any, error) {
+	value, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var input any
+	if err := json.Unmarshal(value, &input); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+
+	code, err := s.compileJQ(jqQuery, "$key")
+	if err != nil {
+		return nil, err
+	}
+
+	results := []any{}
+	iter := code.RunWithContext(ctx, input, key.String())
+	for {
+		result, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := result.(error); isErr {
+			return nil, fmt.Errorf("ошибка выполнения jq-запроса: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return results[0], nil
+	}
+	return results, nil
+}
+
 // --- Events and Subscribers
 
 type EventType int
@@ -718,6 +1105,7 @@ const (
 	EventDelete
 	EventBatch
 	EventTTLExpired
+	EventTransformJob
 )
 
 type Event struct {
@@ -1205,6 +1593,8 @@ func (s *jsSubscriber) eventTypeToString(eventType EventType) string {
 		return "batch"
 	case EventTTLExpired:
 		return "ttl_expired"
+	case EventTransformJob:
+		return "transform_job"
 	default:
 		return "unknown"
 	}
@@ -1226,7 +1616,7 @@ type TTLFeature interface {
 }
 
 type TTLMonitorConfig struct {
-	CheckInterval time.Duration // Интервал проверки истекших ключей
+	CheckInterval time.Duration // Максимальный интервал между проверками истекших ключей
 	Enabled       bool          // Включен ли мониторинг
 	BufferSize    int           // Размер буфера для TTL событий
 }
@@ -1255,6 +1645,12 @@ func (s *datastorage) EnableTTLMonitoring(config *TTLMonitorConfig) error {
 	}
 	s.ttlMonitorConfig = config
 	if config.Enabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		err := s.migrateTTLIndex(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("ошибка построения индекса TTL: %w", err)
+		}
 		s.ttlWg.Add(1)
 		go s.ttlMonitorLoop()
 	}
@@ -1271,79 +1667,62 @@ func (s *datastorage) stopTTLMonitoring() {
 	s.ttlDone = make(chan struct{})
 }
 
+// ttlMonitorLoop при запуске восстанавливает регистрацию ключей с TTL,
+// затем спит до ближайшего истечения по индексу, но не дольше
+// CheckInterval. Регистрация нового TTL будит цикл для пересчета.
 func (s *datastorage) ttlMonitorLoop() {
 	defer s.ttlWg.Done()
-	ticker := time.NewTicker(s.ttlMonitorConfig.CheckInterval)
-	defer ticker.Stop()
+	if n, err := s.recoverTTLRegistrations(context.Background(), s.ttlDone); err != nil {
+		if err != context.Canceled {
+			log.Printf("ошибка восстановления TTL ключей: %v", err)
+		}
+	} else if n > 0 {
+		log.Printf("восстановлена регистрация TTL для %d ключей", n)
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 	for {
 		select {
 		case <-s.ttlDone:
 			return
-		case <-ticker.C:
+		case <-s.ttlWake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
 			s.checkExpiredTTLKeys()
 		}
+		timer.Reset(s.nextTTLCheck())
 	}
 }
 
-func (s *datastorage) checkExpiredTTLKeys() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	keysCh, errCh, err := s.Keys(ctx, ds.NewKey(TTLNameSpace))
-	if err != nil {
-		log.Printf("ошибка получения ключей для TTL проверки: %v", err)
-		return
+func (s *datastorage) nextTTLCheck() time.Duration {
+	interval := s.ttlMonitorConfig.CheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
 	}
-	now := time.Now()
-	expiredKeys := make([]ds.Key, 0)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case err, ok := <-errCh:
-			if ok && err != nil {
-				log.Printf("ошибка при проверке TTL ключей: %v", err)
-				return
-			}
-		case key, ok := <-keysCh:
-			if !ok {
-				s.processExpiredKeys(ctx, expiredKeys, now)
-				return
-			}
-			originalKeyStr := key.String()[len(TTLNameSpace)+1:] // +1 для слэша
-			key = ds.NewKey(originalKeyStr)
-			expiration, err := s.Datastore.GetExpiration(ctx, key)
-			if err != nil {
-				if err == ds.ErrNotFound {
-					expiredKeys = append(expiredKeys, key)
-				}
-				continue
-			}
-			if now.After(expiration) {
-				expiredKeys = append(expiredKeys, key)
-			}
-		}
+	next := s.nextTTLExpiry()
+	if next.IsZero() {
+		return interval
+	}
+	wait := time.Until(next)
+	if wait < 0 {
+		return 0
 	}
+	if wait > interval {
+		return interval
+	}
+	return wait
 }
 
-func (s *datastorage) processExpiredKeys(ctx context.Context, expiredKeys []ds.Key, expiredAt time.Time) {
-	for _, key := range expiredKeys {
-		var lastValue []byte
-		if value, err := s.Datastore.Get(ctx, key); err == nil {
-			lastValue = value
-		}
-		err := s.Datastore.Delete(ctx, key)
-		if err != nil {
-			log.Printf("ошибка удаления истекшего ключа %s: %v", key.String(), err)
-		}
-		ttlKey := ds.NewKey(TTLNameSpace).ChildString(key.String())
-		err = s.Datastore.Delete(ctx, ttlKey)
-		if err != nil {
-			log.Printf("ошибка удаления TTL ключа %s: %v", ttlKey.String(), err)
-		}
-		if s.silentMode {
-			continue
-		}
-		s.publishTTLExpiredEvent(key, lastValue, expiredAt)
+func (s *datastorage) checkExpiredTTLKeys() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := s.expireDueTTLKeys(ctx, time.Now()); err != nil {
+		log.Printf("ошибка при проверке TTL ключей: %v", err)
 	}
 }
 
@@ -1366,76 +1745,49 @@ func (s *datastorage) publishTTLExpiredEvent(key ds.Key, lastValue []byte, expir
 }
 
 func (s *datastorage) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
-	err := s.Datastore.PutWithTTL(ctx, key, value, ttl)
+	if err := s.ValidateValue(key, value); err != nil {
+		return err
+	}
+	op := s.withTTLPolicy(batchOp{key: key, value: value, ttl: ttl, clearContentType: true})
+	err := s.applyOp(ctx, op)
 	if err != nil {
 		return err
 	}
 	if !s.silentMode {
 		s.publishEvent(EventPut, key, value)
 	}
-	if s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled {
-		s.registerTTLKey(key, time.Now().Add(ttl))
-	}
+	s.trackTTLWrite(op)
 	return nil
 }
 
-func (s *datastorage) registerTTLKey(key ds.Key, expiresAt time.Time) {
-	s.ttlMu.Lock()
-	defer s.ttlMu.Unlock()
-	ttlKey := ds.NewKey(TTLNameSpace).ChildString(key.String())
-	err := s.Datastore.Put(context.Background(), ttlKey, []byte(expiresAt.Format(time.RFC3339)))
-	if err != nil {
-		log.Printf("ошибка регистрации TTL ключа %s: %v", key.String(), err)
-	}
+// ListTTLKeys возвращает зарегистрированные ключи с TTL в порядке истечения.
+func (s *datastorage) ListTTLKeys(ctx context.Context) ([]TTLKeyStatus, error) {
+	return s.ttlStatuses(ctx, ds.NewKey("/"), time.Time{})
 }
 
-func (s *datastorage) ListTTLKeys(ctx context.Context) ([]TTLKeyStatus, error) {
+func (s *datastorage) ttlStatuses(ctx context.Context, prefix ds.Key, until time.Time) ([]TTLKeyStatus, error) {
 	var results []TTLKeyStatus
-	keysCh, errCh, err := s.Keys(ctx, ds.NewKey(TTLNameSpace))
-	if err != nil {
-		return nil, fmt.Errorf("ошибка получения ключей: %w", err)
-	}
 	now := time.Now()
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case err, ok := <-errCh:
-			if ok && err != nil {
-				return nil, err
-			}
-		case key, ok := <-keysCh:
-			if !ok {
-				sort.Slice(results, func(i, j int) bool {
-					if results[i].ExpiresAt == nil && results[j].ExpiresAt == nil {
-						return results[i].Key.String() < results[j].Key.String()
-					}
-					if results[i].ExpiresAt == nil {
-						return false
-					}
-					if results[j].ExpiresAt == nil {
-						return true
-					}
-					return results[i].ExpiresAt.Before(*results[j].ExpiresAt)
-				})
-				return results, nil
-			}
-			originalKeyStr := key.String()[len(TTLNameSpace)+1:] // +1 для слэша
-			key = ds.NewKey(originalKeyStr)
-			status := TTLKeyStatus{
-				Key: key,
-			}
-			expiration, err := s.Datastore.GetExpiration(ctx, key)
-			if err != nil {
-				continue
-			}
-			status.HasTTL = true
-			status.ExpiresAt = &expiration
-			status.TimeLeft = time.Until(expiration)
-			status.IsExpired = now.After(expiration)
-			results = append(results, status)
+	err := s.scanTTLIndex(until, func(key ds.Key, expiresAt time.Time) bool {
+		if prefix.String() != "/" && !prefix.Equal(key) && !prefix.IsAncestorOf(key) {
+			return true
 		}
+		results = append(results, TTLKeyStatus{
+			Key:       key,
+			ExpiresAt: &expiresAt,
+			TimeLeft:  expiresAt.Sub(now),
+			IsExpired: now.After(expiresAt),
+			HasTTL:    true,
+		})
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса TTL: %w", err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 func (s *datastorage) ExtendTTL(ctx context.Context, key ds.Key, extension time.Duration) error {
@@ -1456,15 +1808,11 @@ func (s *datastorage) ExtendTTL(ctx context.Context, key ds.Key, extension time.
 	if currentTTL <= 0 {
 		newTTL = extension
 	}
-	err = s.Datastore.SetTTL(ctx, key, newTTL)
+	err = s.setTTLWithContentType(ctx, key, newTTL)
 	if err != nil {
 		return fmt.Errorf("ошибка установки нового TTL: %w", err)
 	}
-	if s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled {
-		if _, err := s.Datastore.Get(ctx, key); err == nil {
-			s.registerTTLKey(key, now.Add(newTTL))
-		}
-	}
+	s.registerTTLKey(key, now.Add(newTTL))
 	return nil
 }
 
@@ -1476,115 +1824,38 @@ func (s *datastorage) SetTTL(ctx context.Context, key ds.Key, originalTTL time.D
 	if !exists {
 		return fmt.Errorf("ключ %s не существует", key.String())
 	}
-	err = s.Datastore.SetTTL(ctx, key, originalTTL)
+	err = s.setTTLWithContentType(ctx, key, originalTTL)
 	if err != nil {
 		return fmt.Errorf("ошибка обновления TTL: %w", err)
 	}
-	s.ttlMu.RLock()
-	monitorEnabled := s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled
-	s.ttlMu.RUnlock()
-	if monitorEnabled {
-		if _, err := s.Datastore.Get(ctx, key); err == nil {
-			s.registerTTLKey(key, time.Now().Add(originalTTL))
-		}
-	}
+	s.registerTTLKey(key, time.Now().Add(originalTTL))
 	return nil
 }
 
 func (s *datastorage) CleanupExpiredKeys(ctx context.Context) (int, error) {
-	keysCh, errCh, err := s.Keys(ctx, ds.NewKey(TTLNameSpace))
-	if err != nil {
-		return 0, fmt.Errorf("ошибка получения ключей: %w", err)
-	}
-	now := time.Now()
-	expiredKeys := []ds.Key{}
-	for {
-		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
-		case err, ok := <-errCh:
-			if ok && err != nil {
-				return 0, err
-			}
-		case key, ok := <-keysCh:
-			if !ok {
-				goto cleanup
-			}
-			originalKeyStr := key.String()[len(TTLNameSpace)+1:] // +1 для слэша
-			key = ds.NewKey(originalKeyStr)
-			expiration, err := s.Datastore.GetExpiration(ctx, key)
-			if err != nil {
-				if err == ds.ErrNotFound {
-					expiredKeys = append(expiredKeys, key)
-				}
-				continue
-			}
-			if now.After(expiration) {
-				expiredKeys = append(expiredKeys, key)
-			}
-		}
-	}
-
-cleanup:
-	if len(expiredKeys) == 0 {
-		return 0, nil
-	}
-	batch, err := s.Batch(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка создания batch: %w", err)
-	}
-	for _, key := range expiredKeys {
-		var lastValue []byte
-		if value, err := s.Datastore.Get(ctx, key); err == nil {
-			lastValue = value
-		}
-		err = batch.Delete(ctx, key)
-		if err != nil {
-			return len(expiredKeys), fmt.Errorf("ошибка добавления в batch: %w", err)
-		}
-		ttlKey := ds.NewKey(TTLNameSpace).ChildString(key.String())
-		err = batch.Delete(ctx, ttlKey)
-		if err != nil {
-			return len(expiredKeys), fmt.Errorf("ошибка удаления TTL ключа из batch: %w", err)
-		}
-		if !s.silentMode {
-			s.publishTTLExpiredEvent(key, lastValue, now)
-		}
-	}
-	err = batch.Commit(ctx)
-	if err != nil {
-		return len(expiredKeys), fmt.Errorf("ошибка коммита batch: %w", err)
-	}
-	return len(expiredKeys), nil
+	return s.expireDueTTLKeys(ctx, time.Now())
 }
 
 func (s *datastorage) SetTTLBatch(ctx context.Context, keys []ds.Key, ttl time.Duration) error {
 	for _, key := range keys {
-		err := s.Datastore.SetTTL(ctx, key, ttl)
+		err := s.setTTLWithContentType(ctx, key, ttl)
 		if err != nil {
 			return fmt.Errorf("ошибка установки TTL для ключа %s: %w", key.String(), err)
 		}
-		if s.ttlMonitorConfig != nil && s.ttlMonitorConfig.Enabled {
-			if _, err := s.Datastore.Get(ctx, key); err == nil {
-				s.registerTTLKey(key, time.Now().Add(ttl))
-			}
-		}
+		s.registerTTLKey(key, time.Now().Add(ttl))
 	}
 	return nil
 }
 
 func (s *datastorage) GetExpiringKeys(ctx context.Context, prefix ds.Key, within time.Duration) ([]TTLKeyStatus, error) {
-	allKeys, err := s.ListTTLKeys(ctx) // только ключи с TTL
+	statuses, err := s.ttlStatuses(ctx, prefix, time.Now().Add(within))
 	if err != nil {
 		return nil, err
 	}
-	var expiringKeys []TTLKeyStatus
-	now := time.Now()
-	for _, keyStatus := range allKeys {
-		if keyStatus.HasTTL && keyStatus.ExpiresAt != nil {
-			if keyStatus.ExpiresAt.After(now) && keyStatus.TimeLeft <= within {
-				expiringKeys = append(expiringKeys, keyStatus)
-			}
+	expiringKeys := make([]TTLKeyStatus, 0, len(statuses))
+	for _, keyStatus := range statuses {
+		if !keyStatus.IsExpired {
+			expiringKeys = append(expiringKeys, keyStatus)
 		}
 	}
 	return expiringKeys, nil
@@ -0,0 +1,415 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// EventSubscription - фильтр подписки EventStream; пустые поля - все ключи
+// и все типы событий. OnGap вызывается, когда часть событий потеряна.
+type EventSubscription struct {
+	Patterns []string
+	Events   []string
+	OnGap    func(EventGap)
+}
+
+// EventGap сообщает о событиях, которые подписка не получила: пока клиент
+// был отключен, они вытеснены из журнала сервера (среди событий журнала с
+// номерами [From, To)) или сервер перезапускался (Restarted).
+type EventGap struct {
+	SubscriptionID string
+	From           uint64
+	To             uint64
+	Restarted      bool
+}
+
+// GapSubscriber - подписчик RemoteDatastoreAdapter, которому нужно знать о
+// потерянных событиях. Локальный датастор таких пропусков не создает.
+type GapSubscriber interface {
+	Subscriber
+	OnGap(ctx context.Context, gap EventGap)
+}
+
+// EventStream - подписки на события сервера через /api/v1/ws. После обрыва
+// соединение восстанавливается, и подписки продолжаются с последнего
+// полученного события, если сервер не перезапускался.
+type EventStream struct {
+	client *APIClient
+
+	mu         sync.Mutex
+	conn       *websocket.Conn
+	epoch      string
+	maxUnacked int
+	subs       map[string]*streamSubscription
+	pending    map[string]chan error
+
+	writeMu       sync.Mutex
+	connected     chan struct{}
+	connectedOnce sync.Once
+	closed        chan struct{}
+	once          sync.Once
+	wg            sync.WaitGroup
+}
+
+type streamSubscription struct {
+	spec    EventSubscription
+	handler func(WSEvent)
+	// started - сервер подтвердил подписку, cursor - seq, с которого ее
+	// можно продолжить
+	started bool
+	cursor  uint64
+	unacked int
+}
+
+// OpenEventStream подключается к WebSocket эндпоинту сервера в фоне.
+func (c *APIClient) OpenEventStream() *EventStream {
+	es := &EventStream{
+		client:    c,
+		subs:      make(map[string]*streamSubscription),
+		pending:   make(map[string]chan error),
+		connected: make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	es.wg.Add(1)
+	go es.run()
+	return es
+}
+
+func (c *APIClient) dialWebSocket(ctx context.Context) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+	}
+	if transport, ok := c.client.Transport.(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.NetDialContext = transport.DialContext
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// http:// -> ws://, https:// -> wss://
+	wsURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/api/v1/ws"
+	conn, resp, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			if _, apiErr := c.parseResponse(resp); apiErr != nil {
+				return nil, fmt.Errorf("ошибка подключения WebSocket: %w", apiErr)
+			}
+		}
+		return nil, fmt.Errorf("ошибка подключения WebSocket: %w", err)
+	}
+	return conn, nil
+}
+
+// Subscribe регистрирует подписку. Если соединение установлено, ждет
+// ответа сервера; иначе подписка отправится после подключения. Повторная
+// подписка с тем же id заменяет прежнюю.
+func (es *EventStream) Subscribe(id string, spec EventSubscription, handler func(WSEvent)) error {
+	// Как и у локального датастора, события после Subscribe не должны
+	// теряться, поэтому до первого подключения ждем его
+	select {
+	case <-es.connected:
+	case <-es.closed:
+		return fmt.Errorf("поток событий закрыт")
+	case <-time.After(wsWriteWait):
+	}
+
+	reply := make(chan error, 1)
+
+	es.mu.Lock()
+	sub := &streamSubscription{spec: spec, handler: handler}
+	es.subs[id] = sub
+	conn := es.conn
+	if conn != nil {
+		es.pending[id] = reply
+	}
+	msg := es.subscribeMessage(id, sub)
+	es.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	if err := es.send(conn, msg); err != nil {
+		// Соединение оборвалось: подписка отправится после переподключения
+		return nil
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-time.After(wsWriteWait):
+		return fmt.Errorf("сервер не ответил на подписку %s", id)
+	case <-es.closed:
+		return fmt.Errorf("поток событий закрыт")
+	}
+}
+
+// Unsubscribe удаляет подписку.
+func (es *EventStream) Unsubscribe(id string) error {
+	es.mu.Lock()
+	delete(es.subs, id)
+	conn := es.conn
+	es.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return es.send(conn, WSClientMessage{Type: "unsubscribe", ID: id})
+}
+
+// Close закрывает соединение и останавливает переподключение.
+func (es *EventStream) Close() error {
+	es.once.Do(func() {
+		close(es.closed)
+		es.mu.Lock()
+		if es.conn != nil {
+			es.writeMu.Lock()
+			es.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			es.writeMu.Unlock()
+			es.conn.Close()
+		}
+		es.mu.Unlock()
+	})
+	es.wg.Wait()
+	return nil
+}
+
+func (es *EventStream) send(conn *websocket.Conn, msg WSClientMessage) error {
+	es.writeMu.Lock()
+	defer es.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+// subscribeMessage продолжает подписку после последнего полученного
+// события; после перезапуска сервера (другой epoch) - с начала его журнала.
+// Вызывается под es.mu.
+func (es *EventStream) subscribeMessage(id string, sub *streamSubscription) WSClientMessage {
+	msg := WSClientMessage{
+		Type:     "subscribe",
+		ID:       id,
+		Patterns: sub.spec.Patterns,
+		Events:   sub.spec.Events,
+		Ack:      true,
+	}
+	if sub.started {
+		since := sub.cursor
+		msg.Since = &since
+	}
+	return msg
+}
+
+func (es *EventStream) run() {
+	defer es.wg.Done()
+
+	backoff := time.Second
+	for {
+		if es.session() {
+			backoff = time.Second
+		}
+
+		select {
+		case <-es.closed:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// session держит одно соединение до его обрыва и сообщает, удалось ли
+// подключиться.
+func (es *EventStream) session() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-es.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer cancel()
+
+	conn, err := es.client.dialWebSocket(ctx)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(wsWriteWait))
+	})
+
+	var welcome WSServerMessage
+	if err := conn.ReadJSON(&welcome); err != nil || welcome.Type != "welcome" {
+		return false
+	}
+
+	es.mu.Lock()
+	select {
+	case <-es.closed:
+		es.mu.Unlock()
+		return false
+	default:
+	}
+	var gaps []func()
+	if welcome.Epoch != es.epoch {
+		for id, sub := range es.subs {
+			if sub.started && sub.spec.OnGap != nil {
+				gaps = append(gaps, sub.gap(EventGap{SubscriptionID: id, Restarted: true}))
+			}
+			sub.cursor = 0
+		}
+	}
+	es.epoch = welcome.Epoch
+	es.maxUnacked = welcome.MaxUnacked
+	es.conn = conn
+	messages := make([]WSClientMessage, 0, len(es.subs))
+	for id, sub := range es.subs {
+		sub.unacked = 0
+		messages = append(messages, es.subscribeMessage(id, sub))
+	}
+	es.mu.Unlock()
+	es.connectedOnce.Do(func() { close(es.connected) })
+
+	for _, gap := range gaps {
+		gap()
+	}
+
+	defer func() {
+		es.mu.Lock()
+		es.conn = nil
+		for id, reply := range es.pending {
+			reply <- nil
+			delete(es.pending, id)
+		}
+		es.mu.Unlock()
+	}()
+
+	for _, msg := range messages {
+		if err := es.send(conn, msg); err != nil {
+			return true
+		}
+	}
+
+	for {
+		var msg WSServerMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return true
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		if err := es.dispatch(conn, msg); err != nil {
+			return true
+		}
+	}
+}
+
+func (es *EventStream) dispatch(conn *websocket.Conn, msg WSServerMessage) error {
+	es.mu.Lock()
+	sub := es.subs[msg.ID]
+	reply := es.pending[msg.ID]
+
+	switch msg.Type {
+	case "subscribed":
+		delete(es.pending, msg.ID)
+		if sub != nil {
+			sub.started = true
+			sub.cursor = max(sub.cursor, msg.Seq)
+		}
+		es.mu.Unlock()
+		if reply != nil {
+			reply <- nil
+		}
+		return nil
+
+	case "error":
+		delete(es.pending, msg.ID)
+		// Отклоненная сервером подписка не восстанавливается
+		if sub != nil && !sub.started {
+			delete(es.subs, msg.ID)
+		}
+		es.mu.Unlock()
+		if reply != nil {
+			reply <- errors.New(msg.Error)
+		}
+		return nil
+
+	case "event":
+		if sub == nil || msg.Event == nil {
+			es.mu.Unlock()
+			return nil
+		}
+		sub.cursor = msg.Event.Seq
+		sub.unacked++
+		ack := sub.unacked >= max(es.maxUnacked/2, 1)
+		if ack {
+			sub.unacked = 0
+		}
+		handler := sub.handler
+		es.mu.Unlock()
+
+		handler(*msg.Event)
+		if ack {
+			return es.send(conn, WSClientMessage{Type: "ack", ID: msg.ID, Seq: msg.Event.Seq})
+		}
+		return nil
+
+	case "gap":
+		// События до msg.Seq потеряны, продолжаем с доступных
+		if sub == nil || msg.Seq <= sub.cursor+1 {
+			break
+		}
+		gap := sub.gap(EventGap{SubscriptionID: msg.ID, From: sub.cursor + 1, To: msg.Seq})
+		sub.cursor = msg.Seq - 1
+		es.mu.Unlock()
+		gap()
+		return nil
+	}
+
+	es.mu.Unlock()
+	return nil
+}
+
+// gap готовит вызов OnGap для выполнения вне es.mu.
+func (sub *streamSubscription) gap(gap EventGap) func() {
+	onGap := sub.spec.OnGap
+	return func() {
+		if onGap != nil {
+			onGap(gap)
+		}
+	}
+}
+
+// toEvent восстанавливает событие датастора из сообщения сервера. Целые
+// числа в Metadata после JSON становятся float64, их возвращаем в int,
+// как у локального датастора.
+func (e *WSEvent) toEvent() Event {
+	for name, value := range e.Metadata {
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			e.Metadata[name] = int(f)
+		}
+	}
+	return Event{
+		Type:      StringToEventType(e.Type),
+		Key:       ds.RawKey(e.Key),
+		Value:     e.Value,
+		Timestamp: e.Timestamp,
+		Metadata:  e.Metadata,
+	}
+}
@@ -0,0 +1,469 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ds "github.com/ipfs/go-datastore"
+)
+
+const (
+	wsEventsSubscriberID = "api-ws-events"
+
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsReadLimit    = 64 << 10
+	// wsDeliverBatch - сколько событий журнала подписка просматривает за проход
+	wsDeliverBatch = 256
+)
+
+// WSClientMessage - сообщение клиента в /api/v1/ws. Type: subscribe,
+// unsubscribe, ack, ping.
+type WSClientMessage struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+	Events   []string `json:"events,omitempty"`
+	// Since - продолжить после события с этим seq; без него подписка
+	// получает только новые события.
+	Since *uint64 `json:"since,omitempty"`
+	// Ack включает подтверждения: сервер держит не больше MaxUnacked
+	// неподтвержденных событий подписки.
+	Ack bool   `json:"ack,omitempty"`
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// WSServerMessage - сообщение сервера. Type: welcome, subscribed,
+// unsubscribed, event, gap, error, pong. Gap сообщает, что события до Seq
+// вытеснены из журнала и подписка продолжит с Seq.
+type WSServerMessage struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id,omitempty"`
+	Epoch      string   `json:"epoch,omitempty"`
+	Seq        uint64   `json:"seq,omitempty"`
+	MaxUnacked int      `json:"max_unacked,omitempty"`
+	Event      *WSEvent `json:"event,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// WSEvent - событие датастора с номером в журнале сервера.
+type WSEvent struct {
+	Seq       uint64         `json:"seq"`
+	Type      string         `json:"type"`
+	Key       string         `json:"key"`
+	Value     []byte         `json:"value"`
+	Timestamp time.Time      `json:"timestamp"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// eventLog - кольцевой журнал последних событий для продолжения подписок
+// после переподключения. Номера событий действуют в пределах epoch: после
+// перезапуска сервера клиент начинает заново.
+type eventLog struct {
+	mu     sync.Mutex
+	epoch  string
+	events []WSEvent
+	count  int
+	next   uint64
+	notify chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newEventLog(size int) *eventLog {
+	if size <= 0 {
+		size = 10000
+	}
+	epoch := make([]byte, 8)
+	rand.Read(epoch)
+	return &eventLog{
+		epoch:  hex.EncodeToString(epoch),
+		events: make([]WSEvent, size),
+		next:   1,
+		notify: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *eventLog) append(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events[l.next%uint64(len(l.events))] = WSEvent{
+		Seq:       l.next,
+		Type:      EventTypeToString(event.Type),
+		Key:       event.Key.String(),
+		Value:     event.Value,
+		Timestamp: event.Timestamp,
+		Metadata:  event.Metadata,
+	}
+	l.next++
+	if l.count < len(l.events) {
+		l.count++
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// wait возвращает канал, который закроется при следующем событии.
+func (l *eventLog) wait() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.notify
+}
+
+// last - номер последнего записанного события.
+func (l *eventLog) last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next - 1
+}
+
+// read возвращает до limit событий после after. Если часть событий уже
+// вытеснена, gap - номер первого доступного события.
+func (l *eventLog) read(after uint64, limit int) (events []WSEvent, gap uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	first := l.next - uint64(l.count)
+	start := after + 1
+	if start < first {
+		gap = first
+		start = first
+	}
+	for seq := start; seq < l.next && len(events) < limit; seq++ {
+		events = append(events, l.events[seq%uint64(len(l.events))])
+	}
+	return events, gap
+}
+
+// close завершает все WebSocket соединения.
+func (l *eventLog) close() {
+	l.once.Do(func() { close(l.closed) })
+}
+
+// matchPattern сопоставляет ключ с шаблоном подписки. Шаблон без
+// спецсимволов - префикс; с ними - path.Match, суффикс "/**" совпадает с
+// любыми потомками.
+func matchPattern(pattern, key string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		prefix := ds.NewKey(pattern)
+		return prefix.String() == "/" || prefix.String() == key || strings.HasPrefix(key, prefix.String()+"/")
+	}
+
+	if base, ok := strings.CutSuffix(pattern, "/**"); ok {
+		depth := strings.Count(base, "/")
+		segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+		if len(segments) <= depth {
+			return false
+		}
+		matched, _ := path.Match(base, "/"+strings.Join(segments[:depth], "/"))
+		return matched || (base == "" && depth == 0)
+	}
+
+	matched, _ := path.Match(pattern, key)
+	return matched
+}
+
+// patternBase - часть шаблона до первого спецсимвола, по ней проверяется
+// право подписки.
+func patternBase(pattern string) ds.Key {
+	if i := strings.IndexAny(pattern, "*?["); i >= 0 {
+		pattern = pattern[:strings.LastIndex(pattern[:i], "/")+1]
+	}
+	return ds.NewKey(pattern)
+}
+
+// canSubscribe проверяет, что под базой шаблона есть ключи, на которые у
+// токена есть право подписки; остальные события отсеиваются при доставке.
+func canSubscribe(token *APIToken, base ds.Key) bool {
+	if token.Allows(PermissionSubscribe, base) {
+		return true
+	}
+	for _, scope := range token.Scopes {
+		if scope.Permission != PermissionSubscribe && scope.Permission != PermissionAdmin {
+			continue
+		}
+		if base.String() == "/" || ds.NewKey(scope.Prefix).IsDescendantOf(base) {
+			return true
+		}
+	}
+	return false
+}
+
+type wsSubscription struct {
+	id       string
+	patterns []string
+	types    map[string]bool
+	cursor   uint64
+	ack      bool
+	// unacked - номера отправленных и еще не подтвержденных событий
+	unacked []uint64
+}
+
+func (sub *wsSubscription) matches(event *WSEvent) bool {
+	if sub.types != nil && !sub.types[event.Type] {
+		return false
+	}
+	for _, pattern := range sub.patterns {
+		if matchPattern(pattern, event.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsConn - одно WebSocket соединение. Подписками и записью в сокет владеет
+// только writeLoop; читающая горутина передает ему сообщения клиента.
+type wsConn struct {
+	s        *APIServer
+	conn     *websocket.Conn
+	token    *APIToken
+	subs     map[string]*wsSubscription
+	messages chan WSClientMessage
+	done     chan struct{}
+}
+
+// Events handlers
+
+func (s *APIServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	if s.config.EnableCORS {
+		upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже отправил ответ с ошибкой
+		return
+	}
+
+	c := &wsConn{
+		s:        s,
+		conn:     conn,
+		token:    requestToken(r),
+		subs:     make(map[string]*wsSubscription),
+		messages: make(chan WSClientMessage),
+		done:     make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// ErrCloseSent - клиент закрыл соединение, и библиотека уже ответила
+		err := c.writeLoop()
+		if err != nil && err != websocket.ErrCloseSent && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			s.logger.Printf("Ошибка WebSocket %s: %v", r.RemoteAddr, err)
+		}
+		conn.Close()
+	}()
+
+	c.readLoop()
+	close(c.done)
+	wg.Wait()
+}
+
+func (c *wsConn) readLoop() {
+	c.conn.SetReadLimit(wsReadLimit)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg WSClientMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		select {
+		case c.messages <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsConn) write(msg WSServerMessage) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *wsConn) writeLoop() error {
+	events := c.s.events
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	if err := c.write(WSServerMessage{
+		Type:       "welcome",
+		Epoch:      events.epoch,
+		Seq:        events.last(),
+		MaxUnacked: c.s.config.WSMaxUnacked,
+	}); err != nil {
+		return err
+	}
+
+	// ready подставляется вместо ожидания, пока журнал прочитан не до конца
+	ready := make(chan struct{})
+	close(ready)
+
+	for {
+		wait := events.wait()
+		pending, err := c.deliver()
+		if err != nil {
+			return err
+		}
+		if pending {
+			wait = ready
+		}
+
+		select {
+		case msg := <-c.messages:
+			if err := c.handle(msg); err != nil {
+				return err
+			}
+		case <-wait:
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return err
+			}
+		case <-c.done:
+			return nil
+		case <-events.closed:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			return c.conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "сервер останавливается"))
+		}
+	}
+}
+
+// deliver отправляет подписчикам следующую порцию событий журнала и
+// сообщает, осталось ли что-то непрочитанным.
+func (c *wsConn) deliver() (bool, error) {
+	pending := false
+	for _, sub := range c.subs {
+		limit := wsDeliverBatch
+		if sub.ack {
+			limit = min(limit, c.s.config.WSMaxUnacked-len(sub.unacked))
+			if limit <= 0 {
+				continue
+			}
+		}
+
+		events, gap := c.s.events.read(sub.cursor, limit)
+		if gap > 0 {
+			if err := c.write(WSServerMessage{Type: "gap", ID: sub.id, Seq: gap}); err != nil {
+				return false, err
+			}
+		}
+		if len(events) == limit {
+			pending = true
+		}
+
+		for i := range events {
+			event := &events[i]
+			sub.cursor = event.Seq
+			if !sub.matches(event) {
+				continue
+			}
+			if c.token != nil && !c.token.Allows(PermissionSubscribe, ds.RawKey(event.Key)) {
+				continue
+			}
+			if err := c.write(WSServerMessage{Type: "event", ID: sub.id, Seq: event.Seq, Event: event}); err != nil {
+				return false, err
+			}
+			if sub.ack {
+				sub.unacked = append(sub.unacked, event.Seq)
+				if len(sub.unacked) >= c.s.config.WSMaxUnacked {
+					break
+				}
+			}
+		}
+	}
+	return pending, nil
+}
+
+func (c *wsConn) handle(msg WSClientMessage) error {
+	switch msg.Type {
+	case "subscribe":
+		sub, err := c.subscription(msg)
+		if err != nil {
+			return c.write(WSServerMessage{Type: "error", ID: msg.ID, Error: err.Error()})
+		}
+		// Повторная подписка с тем же ID заменяет прежнюю
+		c.subs[sub.id] = sub
+		return c.write(WSServerMessage{Type: "subscribed", ID: sub.id, Seq: sub.cursor})
+
+	case "unsubscribe":
+		delete(c.subs, msg.ID)
+		return c.write(WSServerMessage{Type: "unsubscribed", ID: msg.ID})
+
+	case "ack":
+		sub, ok := c.subs[msg.ID]
+		if !ok {
+			return c.write(WSServerMessage{Type: "error", ID: msg.ID, Error: "подписка не найдена"})
+		}
+		// Подтверждение накопительное: все события до seq включительно
+		n := 0
+		for n < len(sub.unacked) && sub.unacked[n] <= msg.Seq {
+			n++
+		}
+		sub.unacked = sub.unacked[n:]
+		return nil
+
+	case "ping":
+		return c.write(WSServerMessage{Type: "pong", ID: msg.ID, Seq: c.s.events.last()})
+	}
+
+	return c.write(WSServerMessage{Type: "error", ID: msg.ID, Error: fmt.Sprintf("неизвестный тип сообщения: %q", msg.Type)})
+}
+
+func (c *wsConn) subscription(msg WSClientMessage) (*wsSubscription, error) {
+	if msg.ID == "" {
+		return nil, fmt.Errorf("требуется ID подписки")
+	}
+
+	sub := &wsSubscription{id: msg.ID, patterns: msg.Patterns, ack: msg.Ack}
+	if len(sub.patterns) == 0 {
+		sub.patterns = []string{"/"}
+	}
+	for _, pattern := range sub.patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("шаблон должен начинаться с '/': %q", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("неверный шаблон %q: %v", pattern, err)
+		}
+		if c.token != nil && !canSubscribe(c.token, patternBase(pattern)) {
+			return nil, fmt.Errorf("Недостаточно прав: требуется %s для %s", PermissionSubscribe, patternBase(pattern))
+		}
+	}
+
+	if len(msg.Events) > 0 {
+		sub.types = make(map[string]bool, len(msg.Events))
+		for _, name := range msg.Events {
+			if EventTypeToString(StringToEventType(name)) != name {
+				return nil, fmt.Errorf("неизвестный тип события: %q", name)
+			}
+			sub.types[name] = true
+		}
+	}
+
+	if msg.Since != nil {
+		sub.cursor = *msg.Since
+	} else {
+		sub.cursor = c.s.events.last()
+	}
+	return sub, nil
+}
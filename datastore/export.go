@@ -0,0 +1,702 @@
+package datastore
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"ues-lite/tid"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/itchyny/gojq"
+	"github.com/tidwall/gjson"
+)
+
+// --- Export / Import
+
+const (
+	// Форматы записей экспорта
+	ExportFormatSimple    = "simple"
+	ExportFormatFull      = "full"
+	ExportFormatValueOnly = "value-only"
+
+	// Кодировки потока экспорта
+	ExportEncodingJSONL = "jsonl"
+	ExportEncodingJSON  = "json"
+	ExportEncodingCSV   = "csv"
+
+	CompressionGzip = "gzip"
+	CompressionZip  = "zip"
+	CompressionTar  = "tar"
+
+	// Генерация ключей при импорте
+	ImportIDUnixNano = "unix-nano"
+	ImportIDTID      = "tid"
+
+	// transferProgressEvery - период вызова Progress в записях.
+	transferProgressEvery = 10000
+	importMaxLineSize     = 1024 * 1024
+)
+
+type ExportFeatures interface {
+	// Export пишет записи под префиксом в w. Обработка значения выполняется
+	// в порядке extract, patch, jq; результат jq null пропускает запись.
+	Export(ctx context.Context, w io.Writer, opts ExportOptions) (*TransferStats, error)
+	// Import загружает JSON Lines: каждая строка становится записью с
+	// новым ключом под префиксом. Поток может быть gzip, zip или tar
+	// архивом - формат определяется по содержимому.
+	Import(ctx context.Context, r io.Reader, opts ImportOptions) (*TransferStats, error)
+}
+
+type ExportOptions struct {
+	Prefix ds.Key
+	// Format - формат записи: simple, full, value-only (по умолчанию).
+	Format string
+	// Encoding - jsonl (по умолчанию), json (массив) или csv (key,value).
+	Encoding string
+	// Compression - gzip, zip, tar или пусто.
+	Compression string
+	// Name - имя файла внутри zip/tar архива.
+	Name       string
+	Extract    string
+	Patch      []string
+	JQ         string
+	Limit      int
+	Start      string // первый ключ, включительно
+	End        string // последний ключ, включительно
+	Metadata   bool   // метаданные в формате full
+	SkipSystem bool
+	Progress   func(TransferStats)
+	OnError    func(key string, err error)
+}
+
+type ImportOptions struct {
+	Prefix    ds.Key
+	IDType    string // unix-nano (по умолчанию) или tid
+	ClockID   uint
+	Extract   string
+	Patch     []string
+	JQ        string
+	BatchSize int
+	// Name - имя источника в отчете о прогрессе.
+	Name     string
+	Progress func(TransferStats)
+	OnError  func(key string, err error)
+}
+
+// TransferStats - прогресс и итог экспорта или импорта. Для архивов
+// Progress вызывается с Done по завершении каждого файла.
+type TransferStats struct {
+	File      string `json:"file,omitempty"`
+	Processed int    `json:"processed"`
+	Skipped   int    `json:"skipped"`
+	Errors    int    `json:"errors"`
+	Done      bool   `json:"done"`
+}
+
+// ExportRecord - запись формата full.
+type ExportRecord struct {
+	Key       string            `json:"key"`
+	Value     string            `json:"value"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Size      int               `json:"size,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+func (o *ExportOptions) setDefaults() {
+	if o.Prefix.String() == "" {
+		o.Prefix = ds.NewKey("/")
+	}
+	if o.Format == "" {
+		o.Format = ExportFormatValueOnly
+	}
+	if o.Encoding == "" {
+		o.Encoding = ExportEncodingJSONL
+	}
+	if o.Name == "" {
+		o.Name = "export." + o.Encoding
+	}
+}
+
+func (o ExportOptions) validate() error {
+	switch o.Format {
+	case ExportFormatSimple, ExportFormatFull, ExportFormatValueOnly:
+	default:
+		return fmt.Errorf("неизвестный формат: %s", o.Format)
+	}
+	switch o.Encoding {
+	case ExportEncodingJSONL, ExportEncodingJSON, ExportEncodingCSV:
+	default:
+		return fmt.Errorf("неизвестная кодировка: %s", o.Encoding)
+	}
+	switch o.Compression {
+	case "", CompressionGzip, CompressionZip, CompressionTar:
+	default:
+		return fmt.Errorf("неизвестное сжатие: %s", o.Compression)
+	}
+	return nil
+}
+
+func (s *datastorage) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*TransferStats, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var code *gojq.Code
+	if opts.JQ != "" {
+		var err error
+		code, err = CompileJQ(opts.JQ, "$key")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка компиляции jq выражения '%s': %w", opts.JQ, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	kvChan, errChan, err := s.Iterator(ctx, opts.Prefix, false)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании итератора: %w", err)
+	}
+
+	out, err := newExportWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &TransferStats{File: opts.Name}
+	reject := func(key string, err error) {
+		stats.Skipped++
+		stats.Errors++
+		if opts.OnError != nil {
+			opts.OnError(key, err)
+		}
+	}
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			if err != nil {
+				return stats, fmt.Errorf("ошибка при итерации: %w", err)
+			}
+
+		case kv, ok := <-kvChan:
+			if !ok {
+				break loop
+			}
+			keyStr := kv.Key.String()
+
+			if opts.Start != "" && keyStr < opts.Start {
+				stats.Skipped++
+				continue
+			}
+			if opts.End != "" && keyStr > opts.End {
+				break loop
+			}
+			if opts.SkipSystem && strings.HasPrefix(keyStr, "/_system/") {
+				stats.Skipped++
+				continue
+			}
+			if opts.Limit > 0 && stats.Processed >= opts.Limit {
+				break loop
+			}
+
+			line, err := exportLine(kv, opts, code)
+			if err != nil {
+				reject(keyStr, err)
+				continue
+			}
+			if line == nil {
+				stats.Skipped++
+				continue
+			}
+			if err := out.write(keyStr, line); err != nil {
+				return stats, fmt.Errorf("ошибка записи: %w", err)
+			}
+			stats.Processed++
+			if opts.Progress != nil && stats.Processed%transferProgressEvery == 0 {
+				opts.Progress(*stats)
+			}
+		}
+	}
+
+	if err := out.close(); err != nil {
+		return stats, fmt.Errorf("ошибка записи: %w", err)
+	}
+	stats.Done = true
+	if opts.Progress != nil {
+		opts.Progress(*stats)
+	}
+	return stats, nil
+}
+
+// exportLine формирует строку экспорта; nil - запись отфильтрована jq.
+func exportLine(kv KeyValue, opts ExportOptions, code *gojq.Code) ([]byte, error) {
+	keyStr := kv.Key.String()
+
+	var line []byte
+	if opts.Format == ExportFormatValueOnly {
+		line = kv.Value
+	} else {
+		record, err := exportRecord(kv, opts.Format, opts.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		line, err = json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации: %w", err)
+		}
+	}
+
+	if opts.Extract != "" {
+		line = []byte(gjson.GetBytes(line, opts.Extract).String())
+	}
+	if len(opts.Patch) > 0 {
+		line = applyPatchStrings(line, opts.Patch)
+	}
+	if code != nil {
+		transformed, err := applyJQToLine(code, line, keyStr)
+		if err != nil {
+			return nil, err
+		}
+		if string(transformed) == "null" {
+			return nil, nil
+		}
+		line = transformed
+	}
+	return line, nil
+}
+
+func exportRecord(kv KeyValue, format string, includeMetadata bool) (any, error) {
+	keyStr := kv.Key.String()
+	valueStr := string(kv.Value)
+
+	switch format {
+	case ExportFormatSimple:
+		return map[string]string{
+			"key":   keyStr,
+			"value": valueStr,
+		}, nil
+
+	case ExportFormatFull:
+		record := ExportRecord{
+			Key:       keyStr,
+			Value:     valueStr,
+			Timestamp: time.Now().Unix(),
+			Size:      len(kv.Value),
+		}
+		if includeMetadata {
+			record.Metadata = make(map[string]string)
+			switch {
+			case json.Valid(kv.Value):
+				record.Metadata["content_type"] = "json"
+			case valueStr == strings.ToValidUTF8(valueStr, ""):
+				record.Metadata["content_type"] = "text"
+			default:
+				record.Metadata["content_type"] = "binary"
+			}
+			for i, part := range strings.Split(strings.Trim(keyStr, "/"), "/") {
+				if part != "" {
+					record.Metadata[fmt.Sprintf("key_part_%d", i)] = part
+				}
+			}
+		}
+		return record, nil
+
+	default:
+		return nil, fmt.Errorf("неизвестный формат: %s", format)
+	}
+}
+
+// applyJQToLine применяет jq к JSON строке и возвращает первый результат;
+// без результатов - null.
+func applyJQToLine(code *gojq.Code, line []byte, keyStr string) ([]byte, error) {
+	var input any
+	if err := json.Unmarshal(line, &input); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+	result, ok := code.Run(input, keyStr).Next()
+	if !ok {
+		return []byte("null"), nil
+	}
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("ошибка выполнения jq: %w", err)
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации результата jq: %w", err)
+	}
+	return out, nil
+}
+
+// exportWriter кодирует строки экспорта и упаковывает поток.
+type exportWriter struct {
+	buf      *bufio.Writer
+	csv      *csv.Writer
+	encoding string
+	count    int
+	finish   func() error
+}
+
+func newExportWriter(w io.Writer, opts ExportOptions) (*exportWriter, error) {
+	ew := &exportWriter{encoding: opts.Encoding, finish: func() error { return nil }}
+
+	var target io.Writer = w
+	switch opts.Compression {
+	case CompressionGzip:
+		gz := gzip.NewWriter(w)
+		target = gz
+		ew.finish = gz.Close
+
+	case CompressionZip:
+		zw := zip.NewWriter(w)
+		f, err := zw.Create(opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		target = f
+		ew.finish = zw.Close
+
+	case CompressionTar:
+		// Заголовок tar содержит размер файла, поэтому поток
+		// собирается во временном файле.
+		tmp, err := os.CreateTemp("", "ues-export-*")
+		if err != nil {
+			return nil, err
+		}
+		target = tmp
+		ew.finish = func() error {
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			size, err := tmp.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			tw := tar.NewWriter(w)
+			if err := tw.WriteHeader(&tar.Header{
+				Name:    opts.Name,
+				Mode:    0644,
+				Size:    size,
+				ModTime: time.Now(),
+			}); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tmp); err != nil {
+				return err
+			}
+			return tw.Close()
+		}
+	}
+
+	ew.buf = bufio.NewWriter(target)
+	switch opts.Encoding {
+	case ExportEncodingCSV:
+		ew.csv = csv.NewWriter(ew.buf)
+		if err := ew.csv.Write([]string{"key", "value"}); err != nil {
+			return nil, err
+		}
+	case ExportEncodingJSON:
+		if _, err := ew.buf.WriteString("["); err != nil {
+			return nil, err
+		}
+	}
+	return ew, nil
+}
+
+func (ew *exportWriter) write(key string, line []byte) error {
+	defer func() { ew.count++ }()
+	switch ew.encoding {
+	case ExportEncodingCSV:
+		return ew.csv.Write([]string{key, string(line)})
+	case ExportEncodingJSON:
+		if ew.count > 0 {
+			if err := ew.buf.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		// value-only экспорт не-JSON значения оформляется строкой
+		if !json.Valid(line) {
+			line, _ = json.Marshal(string(line))
+		}
+		_, err := ew.buf.Write(line)
+		return err
+	default:
+		if _, err := ew.buf.Write(line); err != nil {
+			return err
+		}
+		return ew.buf.WriteByte('\n')
+	}
+}
+
+func (ew *exportWriter) close() error {
+	switch ew.encoding {
+	case ExportEncodingCSV:
+		ew.csv.Flush()
+		if err := ew.csv.Error(); err != nil {
+			return err
+		}
+	case ExportEncodingJSON:
+		if _, err := ew.buf.WriteString("]\n"); err != nil {
+			return err
+		}
+	}
+	if err := ew.buf.Flush(); err != nil {
+		return err
+	}
+	return ew.finish()
+}
+
+func (s *datastorage) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*TransferStats, error) {
+	if opts.Prefix.String() == "" {
+		opts.Prefix = ds.NewKey("/")
+	}
+	if opts.IDType == "" {
+		opts.IDType = ImportIDUnixNano
+	}
+	if opts.IDType != ImportIDUnixNano && opts.IDType != ImportIDTID {
+		return nil, fmt.Errorf("неизвестный тип ID: %s", opts.IDType)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	imp := &importer{s: s, opts: opts, total: &TransferStats{File: opts.Name}}
+	if opts.JQ != "" {
+		code, err := CompileJQ(opts.JQ, "$key")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка компиляции jq выражения '%s': %w", opts.JQ, err)
+		}
+		imp.code = code
+	}
+	if opts.IDType == ImportIDTID {
+		imp.clock = tid.NewTIDClock(opts.ClockID)
+	}
+
+	err := imp.readSource(ctx, opts.Name, r)
+	imp.total.Done = err == nil
+	return imp.total, err
+}
+
+type importer struct {
+	s     *datastorage
+	opts  ImportOptions
+	code  *gojq.Code
+	clock tid.TIDClock
+	total *TransferStats
+}
+
+// readSource определяет формат потока по сигнатуре и загружает
+// JSON Lines файлы из gzip, zip и tar архивов.
+func (imp *importer) readSource(ctx context.Context, name string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(512)
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".tgz")
+		return imp.readSource(ctx, name, gz)
+
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return imp.readZip(ctx, br)
+
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		tr := tar.NewReader(br)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if header.Typeflag == tar.TypeReg && isJSONLName(header.Name) {
+				if err := imp.readLines(ctx, header.Name, tr); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		return imp.readLines(ctx, name, br)
+	}
+}
+
+// readZip сохраняет архив во временный файл: zip читается с конца.
+func (imp *importer) readZip(ctx context.Context, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "ues-import-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isJSONLName(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = imp.readLines(ctx, f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isJSONLName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jsonl", ".ndjson", ".json":
+		return true
+	}
+	return false
+}
+
+func (imp *importer) nextKey() ds.Key {
+	var keyID string
+	if imp.opts.IDType == ImportIDTID {
+		keyID = imp.clock.Next().String()
+	} else {
+		keyID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	if imp.opts.Prefix.String() == "/" {
+		return ds.NewKey(keyID)
+	}
+	return imp.opts.Prefix.ChildString(keyID)
+}
+
+func (imp *importer) readLines(ctx context.Context, name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineSize)
+
+	stats := TransferStats{File: name}
+	reject := func(key string, err error) {
+		stats.Errors++
+		if imp.opts.OnError != nil {
+			imp.opts.OnError(key, err)
+		}
+	}
+	defer func() {
+		imp.total.Processed += stats.Processed
+		imp.total.Skipped += stats.Skipped
+		imp.total.Errors += stats.Errors
+	}()
+
+	batch, err := imp.s.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	pending := 0
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		key := imp.nextKey()
+		if !json.Valid(line) {
+			reject(key.String(), fmt.Errorf("некорректный JSON"))
+			continue
+		}
+
+		value := append([]byte(nil), line...)
+		if imp.opts.Extract != "" {
+			value = []byte(gjson.GetBytes(value, imp.opts.Extract).String())
+		}
+		if len(imp.opts.Patch) > 0 {
+			value = applyPatchStrings(value, imp.opts.Patch)
+		}
+		if imp.code != nil {
+			transformed, err := applyJQToLine(imp.code, value, key.String())
+			if err != nil {
+				reject(key.String(), err)
+				continue
+			}
+			if string(transformed) == "null" {
+				stats.Skipped++
+				continue
+			}
+			value = transformed
+		}
+
+		if err := batch.Put(ctx, key, value); err != nil {
+			reject(key.String(), err)
+			continue
+		}
+		pending++
+		stats.Processed++
+
+		if pending >= imp.opts.BatchSize {
+			if err := batch.Commit(ctx); err != nil {
+				return fmt.Errorf("ошибка коммита batch: %w", err)
+			}
+			batch, err = imp.s.Batch(ctx)
+			if err != nil {
+				return fmt.Errorf("ошибка создания нового batch: %w", err)
+			}
+			pending = 0
+		}
+		if imp.opts.Progress != nil && stats.Processed%transferProgressEvery == 0 {
+			imp.opts.Progress(stats)
+		}
+	}
+
+	if pending > 0 {
+		if err := batch.Commit(ctx); err != nil {
+			return fmt.Errorf("ошибка финального коммита: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	stats.Done = true
+	if imp.opts.Progress != nil {
+		imp.opts.Progress(stats)
+	}
+	return nil
+}
@@ -0,0 +1,662 @@
+package datastore
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/itchyny/gojq"
+	"github.com/tidwall/gjson"
+)
+
+// --- Secondary indexes
+
+const (
+	IndexesNamespace    = "/_system/ds-indexes"
+	IndexDefsNamespace  = "/_system/ds-index-defs"
+	indexCommitAttempts = 3
+)
+
+type IndexValueType string
+
+const (
+	IndexTypeString IndexValueType = "string"
+	IndexTypeNumber IndexValueType = "number"
+)
+
+// IndexConfig - описание вторичного индекса. Значение извлекается из JSON
+// по gjson-пути (Path) или jq-выражению (JQ); массивы и несколько результатов
+// jq индексируются поэлементно.
+type IndexConfig struct {
+	Name      string         `json:"name"`
+	Prefix    string         `json:"prefix"`
+	Path      string         `json:"path,omitempty"`
+	JQ        string         `json:"jq,omitempty"`
+	Type      IndexValueType `json:"type,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type IndexEntry struct {
+	Value any    `json:"value"`
+	Key   ds.Key `json:"key"`
+}
+
+type IndexFeatures interface {
+	CreateIndex(ctx context.Context, config IndexConfig) error
+	DropIndex(ctx context.Context, name string) error
+	RebuildIndex(ctx context.Context, name string) error
+	ListIndexes() []IndexConfig
+	LookupIndex(ctx context.Context, name string, value any) ([]ds.Key, error)
+	RangeIndex(ctx context.Context, name string, from, to any) ([]IndexEntry, error)
+}
+
+type secondaryIndex struct {
+	config IndexConfig
+	code   *gojq.Code
+}
+
+func newSecondaryIndex(config IndexConfig) (*secondaryIndex, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("имя индекса не может быть пустым")
+	}
+	if strings.Contains(config.Name, "/") {
+		return nil, fmt.Errorf("имя индекса не может содержать '/'")
+	}
+	if config.Prefix == "" {
+		return nil, fmt.Errorf("префикс индекса не может быть пустым")
+	}
+	if (config.Path == "") == (config.JQ == "") {
+		return nil, fmt.Errorf("требуется ровно одно из: path или jq")
+	}
+	switch config.Type {
+	case "":
+		config.Type = IndexTypeString
+	case IndexTypeString, IndexTypeNumber:
+	default:
+		return nil, fmt.Errorf("неизвестный тип индекса: %s", config.Type)
+	}
+	idx := &secondaryIndex{config: config}
+	if config.JQ != "" {
+		code, err := CompileJQ(config.JQ)
+		if err != nil {
+			return nil, err
+		}
+		idx.code = code
+	}
+	return idx, nil
+}
+
+func (idx *secondaryIndex) matches(key ds.Key) bool {
+	prefix := ds.NewKey(idx.config.Prefix)
+	if strings.HasPrefix(key.String(), "/_system/") {
+		return false
+	}
+	return prefix.String() == "/" || prefix.IsAncestorOf(key)
+}
+
+func (idx *secondaryIndex) keyPrefix() string {
+	return ds.NewKey(IndexesNamespace).ChildString(idx.config.Name).String() + "/"
+}
+
+func (idx *secondaryIndex) entryKey(encoded string, key ds.Key) ds.Key {
+	return ds.NewKey(IndexesNamespace).ChildString(idx.config.Name).ChildString(encoded).Child(key)
+}
+
+// values извлекает из значения закодированные значения индекса.
+func (idx *secondaryIndex) values(ctx context.Context, value []byte) []string {
+	if value == nil {
+		return nil
+	}
+	var raw []any
+	if idx.code != nil {
+		var input any
+		if err := json.Unmarshal(value, &input); err != nil {
+			return nil
+		}
+		iter := idx.code.RunWithContext(ctx, input)
+		for {
+			out, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if _, isErr := out.(error); isErr {
+				return nil
+			}
+			raw = append(raw, out)
+		}
+	} else {
+		res := gjson.GetBytes(value, idx.config.Path)
+		if !res.Exists() {
+			return nil
+		}
+		items := []gjson.Result{res}
+		if res.IsArray() {
+			items = res.Array()
+		}
+		for _, item := range items {
+			raw = append(raw, item.Value())
+		}
+	}
+
+	seen := make(map[string]struct{}, len(raw))
+	encoded := make([]string, 0, len(raw))
+	for _, v := range raw {
+		enc, err := idx.encode(v)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[enc]; ok {
+			continue
+		}
+		seen[enc] = struct{}{}
+		encoded = append(encoded, enc)
+	}
+	return encoded
+}
+
+// encode кодирует значение так, чтобы лексикографический порядок
+// закодированных строк совпадал с порядком значений.
+func (idx *secondaryIndex) encode(v any) (string, error) {
+	if idx.config.Type == IndexTypeNumber {
+		var f float64
+		switch t := v.(type) {
+		case float64:
+			f = t
+		case int:
+			f = float64(t)
+		case int64:
+			f = float64(t)
+		case json.Number:
+			var err error
+			if f, err = t.Float64(); err != nil {
+				return "", err
+			}
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(t, 64); err != nil {
+				return "", fmt.Errorf("значение %q не является числом", t)
+			}
+		default:
+			return "", fmt.Errorf("значение %v не является числом", v)
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return "n" + fmt.Sprintf("%016x", bits), nil
+	}
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return "", fmt.Errorf("пустое значение")
+	case string:
+		s = t
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(t)
+	default:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return "", err
+		}
+		s = string(data)
+	}
+	return "s" + hex.EncodeToString([]byte(s)), nil
+}
+
+func (idx *secondaryIndex) decode(encoded string) any {
+	if len(encoded) < 1 {
+		return nil
+	}
+	switch encoded[0] {
+	case 'n':
+		bits, err := strconv.ParseUint(encoded[1:], 16, 64)
+		if err != nil {
+			return nil
+		}
+		if bits&(1<<63) != 0 {
+			bits &^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits)
+	case 's':
+		data, err := hex.DecodeString(encoded[1:])
+		if err != nil {
+			return nil
+		}
+		return string(data)
+	}
+	return nil
+}
+
+// update обновляет записи индекса для ключа внутри транзакции.
+func (idx *secondaryIndex) update(ctx context.Context, txn ds.Txn, key ds.Key, oldValue, newValue []byte) error {
+	oldVals := idx.values(ctx, oldValue)
+	newVals := idx.values(ctx, newValue)
+	keep := make(map[string]struct{}, len(newVals))
+	for _, v := range newVals {
+		keep[v] = struct{}{}
+	}
+	for _, v := range oldVals {
+		if _, ok := keep[v]; ok {
+			continue
+		}
+		if err := txn.Delete(ctx, idx.entryKey(v, key)); err != nil {
+			return err
+		}
+	}
+	for _, v := range newVals {
+		if err := txn.Put(ctx, idx.entryKey(v, key), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- datastorage
+
+type indexRegistry struct {
+	mu      sync.RWMutex
+	indexes map[string]*secondaryIndex
+	// opMu сериализует записи с построением индексов: запись держит RLock от
+	// выбора индексов ключа до коммита, CreateIndex, DropIndex и
+	// RebuildIndex - Lock.
+	opMu sync.RWMutex
+	// generation меняется при создании и удалении индекса; транзакция,
+	// начатая до изменения, не коммитится.
+	generation uint64
+}
+
+func (s *datastorage) indexesFor(key ds.Key) []*secondaryIndex {
+	s.indexReg.mu.RLock()
+	defer s.indexReg.mu.RUnlock()
+	var out []*secondaryIndex
+	for _, idx := range s.indexReg.indexes {
+		if idx.matches(key) {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+func (s *datastorage) hasIndexesFor(ops []batchOp) bool {
+	s.indexReg.mu.RLock()
+	empty := len(s.indexReg.indexes) == 0
+	s.indexReg.mu.RUnlock()
+	if empty {
+		return false
+	}
+	for _, op := range ops {
+		if len(s.indexesFor(op.key)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// applyOp выполняет одиночную операцию записи, обновляя индексы при необходимости.
+func (s *datastorage) applyOp(ctx context.Context, op batchOp) error {
+	s.indexReg.opMu.RLock()
+	defer s.indexReg.opMu.RUnlock()
+	// Удаление и запись снимают тип содержимого ключа той же транзакцией
+	if op.isDelete || op.cond != nil || op.contentType != "" || op.clearContentType || len(s.indexesFor(op.key)) > 0 {
+		return s.commitWithIndexes(ctx, []batchOp{op})
+	}
+	switch {
+	case op.ttl > 0:
+		return s.Datastore.PutWithTTL(ctx, op.key, op.value, op.ttl)
+	default:
+		return s.Datastore.Put(ctx, op.key, op.value)
+	}
+}
+
+// commitWithIndexes применяет операции и обновляет вторичные индексы
+// в одной транзакции badger. Слишком большие наборы операций делятся
+// на части, каждая из которых атомарна; пакеты, которые делить нельзя,
+// применяются commitAtomic.
+func (s *datastorage) commitWithIndexes(ctx context.Context, ops []batchOp) error {
+	err := s.commitAtomic(ctx, ops)
+	if errors.Is(err, ErrBatchTooBig) && len(ops) > 1 {
+		half := len(ops) / 2
+		if err := s.commitWithIndexes(ctx, ops[:half]); err != nil {
+			return err
+		}
+		return s.commitWithIndexes(ctx, ops[half:])
+	}
+	return err
+}
+
+// commitAtomic применяет операции одной транзакцией badger, повторяя ее
+// при конфликте; не помещающиеся в транзакцию операции отклоняются с
+// ErrBatchTooBig.
+func (s *datastorage) commitAtomic(ctx context.Context, ops []batchOp) error {
+	var err error
+	for attempt := 0; attempt < indexCommitAttempts; attempt++ {
+		err = s.tryCommitWithIndexes(ctx, ops)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			return fmt.Errorf("%w: %d операций", ErrBatchTooBig, len(ops))
+		}
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *datastorage) tryCommitWithIndexes(ctx context.Context, ops []batchOp) error {
+	txn, err := s.Datastore.NewTransaction(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard(ctx)
+
+	for _, op := range ops {
+		if err := s.writeInTxn(ctx, txn, op); err != nil {
+			return err
+		}
+	}
+	return txn.Commit(ctx)
+}
+
+// writeInTxn выполняет операцию в транзакции badger: проверяет условие
+// ETag, обновляет тип содержимого и вторичные индексы ключа.
+func (s *datastorage) writeInTxn(ctx context.Context, txn ds.Txn, op batchOp) error {
+	indexes := s.indexesFor(op.key)
+	var oldValue []byte
+	var err error
+	if op.cond != nil || len(indexes) > 0 {
+		oldValue, err = txn.Get(ctx, op.key)
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	if op.cond != nil {
+		if err := op.cond.check(op.key, oldValue); err != nil {
+			return err
+		}
+	}
+	switch {
+	case op.isDelete:
+		err = txn.Delete(ctx, op.key)
+	case op.ttl > 0:
+		err = txn.(ds.TTL).PutWithTTL(ctx, op.key, op.value, op.ttl)
+	default:
+		err = txn.Put(ctx, op.key, op.value)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeContentTypeInTxn(ctx, txn, op); err != nil {
+		return fmt.Errorf("ошибка записи типа содержимого: %w", err)
+	}
+	newValue := op.value
+	if op.isDelete {
+		newValue = nil
+	}
+	for _, idx := range indexes {
+		if err := idx.update(ctx, txn, op.key, oldValue, newValue); err != nil {
+			return fmt.Errorf("ошибка обновления индекса %s: %w", idx.config.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *datastorage) loadIndexes(ctx context.Context) error {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: IndexDefsNamespace})
+	if err != nil {
+		return fmt.Errorf("ошибка запроса индексов: %w", err)
+	}
+	defer results.Close()
+	s.indexReg.mu.Lock()
+	defer s.indexReg.mu.Unlock()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		var config IndexConfig
+		if err := json.Unmarshal(res.Value, &config); err != nil {
+			log.Printf("некорректное описание индекса %s: %v", res.Key, err)
+			continue
+		}
+		idx, err := newSecondaryIndex(config)
+		if err != nil {
+			log.Printf("ошибка загрузки индекса %s: %v", config.Name, err)
+			continue
+		}
+		s.indexReg.indexes[config.Name] = idx
+	}
+	return nil
+}
+
+// CreateIndex строит индекс под opMu: записи ждут окончания построения,
+// поэтому индекс не теряет и не дублирует изменения, сделанные во время
+// построения.
+func (s *datastorage) CreateIndex(ctx context.Context, config IndexConfig) error {
+	config.CreatedAt = time.Now()
+	idx, err := newSecondaryIndex(config)
+	if err != nil {
+		return err
+	}
+	s.indexReg.opMu.Lock()
+	defer s.indexReg.opMu.Unlock()
+	s.indexReg.mu.Lock()
+	if _, exists := s.indexReg.indexes[config.Name]; exists {
+		s.indexReg.mu.Unlock()
+		return fmt.Errorf("индекс %s уже существует", config.Name)
+	}
+	s.indexReg.indexes[config.Name] = idx
+	s.indexReg.generation++
+	s.indexReg.mu.Unlock()
+
+	data, err := json.Marshal(idx.config)
+	if err == nil {
+		err = s.Datastore.Put(ctx, ds.NewKey(IndexDefsNamespace).ChildString(config.Name), data)
+	}
+	if err == nil {
+		err = s.buildIndex(ctx, idx)
+	}
+	if err != nil {
+		s.indexReg.mu.Lock()
+		delete(s.indexReg.indexes, config.Name)
+		s.indexReg.mu.Unlock()
+		return fmt.Errorf("ошибка создания индекса %s: %w", config.Name, err)
+	}
+	return nil
+}
+
+func (s *datastorage) DropIndex(ctx context.Context, name string) error {
+	s.indexReg.opMu.Lock()
+	defer s.indexReg.opMu.Unlock()
+	s.indexReg.mu.Lock()
+	idx, ok := s.indexReg.indexes[name]
+	delete(s.indexReg.indexes, name)
+	s.indexReg.generation++
+	s.indexReg.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("индекс %s не найден", name)
+	}
+	if err := s.Datastore.Delete(ctx, ds.NewKey(IndexDefsNamespace).ChildString(name)); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	return s.clearIndex(ctx, idx)
+}
+
+func (s *datastorage) RebuildIndex(ctx context.Context, name string) error {
+	s.indexReg.opMu.Lock()
+	defer s.indexReg.opMu.Unlock()
+	idx, err := s.getIndex(name)
+	if err != nil {
+		return err
+	}
+	if err := s.clearIndex(ctx, idx); err != nil {
+		return err
+	}
+	return s.buildIndex(ctx, idx)
+}
+
+func (s *datastorage) ListIndexes() []IndexConfig {
+	s.indexReg.mu.RLock()
+	defer s.indexReg.mu.RUnlock()
+	out := make([]IndexConfig, 0, len(s.indexReg.indexes))
+	for _, idx := range s.indexReg.indexes {
+		out = append(out, idx.config)
+	}
+	return out
+}
+
+func (s *datastorage) LookupIndex(ctx context.Context, name string, value any) ([]ds.Key, error) {
+	entries, err := s.RangeIndex(ctx, name, value, value)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]ds.Key, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	return keys, nil
+}
+
+// RangeIndex возвращает записи индекса со значениями в диапазоне [from, to].
+// nil в качестве границы означает отсутствие ограничения.
+func (s *datastorage) RangeIndex(ctx context.Context, name string, from, to any) ([]IndexEntry, error) {
+	idx, err := s.getIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	var encFrom, encTo string
+	if from != nil {
+		if encFrom, err = idx.encode(from); err != nil {
+			return nil, err
+		}
+	}
+	if to != nil {
+		if encTo, err = idx.encode(to); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := idx.keyPrefix()
+	entries := []IndexEntry{}
+	err = s.Datastore.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek([]byte(prefix + encFrom)); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			encoded, sourceKey, ok := strings.Cut(string(it.Item().Key())[len(prefix):], "/")
+			if !ok {
+				continue
+			}
+			if encTo != "" && encoded > encTo {
+				break
+			}
+			// Badger удаляет ключи по TTL без обновления индекса, поэтому
+			// запись сверяется с текущим значением: ключ мог истечь или быть
+			// создан заново с другим значением
+			item, err := txn.Get([]byte("/" + sourceKey))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(idx.values(ctx, value), encoded) {
+				continue
+			}
+			entries = append(entries, IndexEntry{
+				Value: idx.decode(encoded),
+				Key:   ds.NewKey(sourceKey),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *datastorage) getIndex(name string) (*secondaryIndex, error) {
+	s.indexReg.mu.RLock()
+	defer s.indexReg.mu.RUnlock()
+	idx, ok := s.indexReg.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("индекс %s не найден", name)
+	}
+	return idx, nil
+}
+
+func (s *datastorage) buildIndex(ctx context.Context, idx *secondaryIndex) error {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: idx.config.Prefix})
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		key := ds.NewKey(res.Key)
+		if !idx.matches(key) {
+			continue
+		}
+		for _, v := range idx.values(ctx, res.Value) {
+			if err := batch.Put(ctx, idx.entryKey(v, key), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+func (s *datastorage) clearIndex(ctx context.Context, idx *secondaryIndex) error {
+	results, err := s.Datastore.Query(ctx, query.Query{
+		Prefix:   ds.NewKey(IndexesNamespace).ChildString(idx.config.Name).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := batch.Delete(ctx, ds.NewKey(res.Key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestLookupIndexStaleEntry(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.CreateIndex(ctx, IndexConfig{Name: "n", Prefix: "/data", Path: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	key := ds.NewKey("/data/a")
+	if err := store.Put(ctx, key, []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Значение меняется в обход индекса, как при истечении TTL в badger и
+	// повторном создании ключа
+	if err := store.(*datastorage).Datastore.Put(ctx, key, []byte(`{"n":2}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.LookupIndex(ctx, "n", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("индекс вернул %v для устаревшего значения", keys)
+	}
+}
+
+func TestTxnCommitAfterCreateIndex(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	txn, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Put(ctx, ds.NewKey("/data/a"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Запись транзакции сделана без нового индекса и не попала бы в него
+	if err := store.CreateIndex(ctx, IndexConfig{Name: "n", Prefix: "/data", Path: "n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); !errors.Is(err, ErrTxnConflict) {
+		t.Fatalf("коммит после создания индекса: %v, ожидался ErrTxnConflict", err)
+	}
+}
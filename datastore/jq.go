@@ -0,0 +1,217 @@
+package datastore
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"ues-lite/tid"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/itchyny/gojq"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+// --- Compiled jq cache
+
+const DefaultJQCacheSize = 256
+
+// jqCache - ограниченный LRU-кэш скомпилированных jq-программ. Ключ кэша -
+// выражение вместе с именами переменных.
+type jqCache struct {
+	mu       sync.Mutex
+	capacity int
+	options  []gojq.CompilerOption
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type jqCacheEntry struct {
+	key  string
+	code *gojq.Code
+}
+
+func newJQCache(capacity int, options ...gojq.CompilerOption) *jqCache {
+	if capacity <= 0 {
+		capacity = DefaultJQCacheSize
+	}
+	return &jqCache{
+		capacity: capacity,
+		options:  options,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *jqCache) compile(expr string, variables ...string) (*gojq.Code, error) {
+	cacheKey := expr + "\x00" + strings.Join(variables, ",")
+
+	c.mu.Lock()
+	if el, ok := c.items[cacheKey]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*jqCacheEntry).code, nil
+	}
+	c.mu.Unlock()
+
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка парсинга jq-запроса: %w", err)
+	}
+	options := append([]gojq.CompilerOption{gojq.WithVariables(variables)}, c.options...)
+	code, err := gojq.Compile(query, options...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка компиляции jq-запроса: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[cacheKey]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*jqCacheEntry).code, nil
+	}
+	c.items[cacheKey] = c.order.PushFront(&jqCacheEntry{key: cacheKey, code: code})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*jqCacheEntry).key)
+	}
+	return code, nil
+}
+
+var defaultJQCache = newJQCache(DefaultJQCacheSize, jqFunctions()...)
+
+// CompileJQ компилирует jq-выражение с пользовательскими функциями
+// (key_*, tid_*, cid_parse) через общий кэш пакета.
+func CompileJQ(expr string, variables ...string) (*gojq.Code, error) {
+	return defaultJQCache.compile(expr, variables...)
+}
+
+// compileJQ компилирует jq-выражение через кэш датастора; в отличие от
+// CompileJQ, программе доступна функция get для чтения ключей.
+func (s *datastorage) compileJQ(expr string, variables ...string) (*gojq.Code, error) {
+	return s.jqCache.compile(expr, variables...)
+}
+
+// --- Custom jq functions
+
+func jqFunctions() []gojq.CompilerOption {
+	return []gojq.CompilerOption{
+		gojq.WithFunction("key_name", 0, 0, jqKeyFunc(func(k ds.Key) any { return k.Name() })),
+		gojq.WithFunction("key_type", 0, 0, jqKeyFunc(func(k ds.Key) any { return k.Type() })),
+		gojq.WithFunction("key_parent", 0, 0, jqKeyFunc(func(k ds.Key) any { return k.Parent().String() })),
+		gojq.WithFunction("key_namespaces", 0, 0, jqKeyFunc(func(k ds.Key) any {
+			namespaces := k.Namespaces()
+			out := make([]any, len(namespaces))
+			for i, ns := range namespaces {
+				out[i] = ns
+			}
+			return out
+		})),
+		gojq.WithFunction("key_child", 1, 1, func(v any, args []any) any {
+			key, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("key_child: ожидается строка, получено %T", v)
+			}
+			child, ok := args[0].(string)
+			if !ok {
+				return fmt.Errorf("key_child: ожидается строка, получено %T", args[0])
+			}
+			return ds.NewKey(key).ChildString(child).String()
+		}),
+		gojq.WithFunction("tid_decode", 0, 0, func(v any, _ []any) any {
+			t, err := jqParseTID(v)
+			if err != nil {
+				return err
+			}
+			return map[string]any{
+				"time":        t.Time().Format(time.RFC3339Nano),
+				"unix_micros": int(t.Time().UnixMicro()),
+				"clock_id":    int(t.ClockID()),
+			}
+		}),
+		gojq.WithFunction("tid_time", 0, 0, func(v any, _ []any) any {
+			t, err := jqParseTID(v)
+			if err != nil {
+				return err
+			}
+			return t.Time().Format(time.RFC3339Nano)
+		}),
+		gojq.WithFunction("cid_parse", 0, 0, func(v any, _ []any) any {
+			str, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("cid_parse: ожидается строка, получено %T", v)
+			}
+			c, err := cid.Decode(str)
+			if err != nil {
+				return fmt.Errorf("cid_parse: %w", err)
+			}
+			result := map[string]any{
+				"cid":     c.String(),
+				"version": int(c.Version()),
+				"codec":   multicodec.Code(c.Type()).String(),
+			}
+			if decoded, err := multihash.Decode(c.Hash()); err == nil {
+				result["hash"] = decoded.Name
+				result["digest_length"] = decoded.Length
+			}
+			return result
+		}),
+	}
+}
+
+func jqKeyFunc(fn func(ds.Key) any) func(any, []any) any {
+	return func(v any, _ []any) any {
+		key, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("ожидается ключ-строка, получено %T", v)
+		}
+		return fn(ds.NewKey(key))
+	}
+}
+
+func jqParseTID(v any) (tid.TID, error) {
+	str, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("ожидается TID-строка, получено %T", v)
+	}
+	t, err := tid.ParseTID(str)
+	if err != nil {
+		return "", fmt.Errorf("некорректный TID %q: %w", str, err)
+	}
+	return t, nil
+}
+
+// jqGetFunction возвращает функцию get, читающую значение ключа из датастора:
+// `"/users/1" | get` или `get("/users/1")`. JSON разбирается, иначе значение
+// возвращается строкой; отсутствующий ключ дает null.
+func (s *datastorage) jqGetFunction() gojq.CompilerOption {
+	return gojq.WithFunction("get", 0, 1, func(v any, args []any) any {
+		if len(args) == 1 {
+			v = args[0]
+		}
+		key, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("get: ожидается ключ-строка, получено %T", v)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		value, err := s.Datastore.Get(ctx, ds.NewKey(key))
+		if err == ds.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		var out any
+		if err := json.Unmarshal(value, &out); err != nil {
+			return string(value)
+		}
+		return out
+	})
+}
@@ -0,0 +1,266 @@
+package datastore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// ListenerConfig описывает один слушатель сервера. Network - "tcp" или
+// "unix"; для unix Address - путь к сокету.
+type ListenerConfig struct {
+	Network     string      `json:"network"`
+	Address     string      `json:"address"`
+	SocketMode  os.FileMode `json:"socket_mode,omitempty"`
+	SocketUser  string      `json:"socket_user,omitempty"`
+	SocketGroup string      `json:"socket_group,omitempty"`
+	TLS         *TLSConfig  `json:"tls,omitempty"`
+}
+
+// TLSConfig настройки TLS слушателя. При заданном ClientCAFile сервер
+// проверяет клиентские сертификаты (mTLS); без RequireClientCert
+// соединения без сертификата тоже принимаются.
+type TLSConfig struct {
+	CertFile          string `json:"cert_file"`
+	KeyFile           string `json:"key_file"`
+	ClientCAFile      string `json:"client_ca_file,omitempty"`
+	RequireClientCert bool   `json:"require_client_cert,omitempty"`
+}
+
+// String возвращает адрес слушателя в формате эндпоинта клиента
+func (lc ListenerConfig) String() string {
+	scheme := "http"
+	if lc.TLS != nil {
+		scheme = "https"
+	}
+	if lc.Network == "unix" {
+		scheme = "unix"
+	}
+	return scheme + "://" + lc.Address
+}
+
+// listenerConfigs возвращает слушатели из конфигурации; без явного списка
+// сервер слушает Host:Port по TCP.
+func (c *Config) listenerConfigs() []ListenerConfig {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []ListenerConfig{{
+		Network: "tcp",
+		Address: net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+	}}
+}
+
+// openListeners открывает все слушатели; при ошибке уже открытые закрываются.
+func openListeners(configs []ListenerConfig) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(configs))
+	for _, lc := range configs {
+		ln, err := openListener(lc)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("ошибка открытия слушателя %s: %w", lc, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func openListener(lc ListenerConfig) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+
+	switch lc.Network {
+	case "", "tcp", "tcp4", "tcp6":
+		network := lc.Network
+		if network == "" {
+			network = "tcp"
+		}
+		ln, err = net.Listen(network, lc.Address)
+	case "unix":
+		ln, err = listenUnix(lc)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип слушателя: %s", lc.Network)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lc.TLS != nil {
+		tlsConfig, err := lc.TLS.serverConfig()
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	return ln, nil
+}
+
+// listenUnix создает Unix сокет. Оставшийся от прежнего процесса файл
+// удаляется, если к нему никто не подключен.
+func listenUnix(lc ListenerConfig) (net.Listener, error) {
+	if lc.Address == "" {
+		return nil, errors.New("не указан путь к сокету")
+	}
+
+	if info, err := os.Lstat(lc.Address); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s существует и не является сокетом", lc.Address)
+		}
+		if conn, err := net.DialTimeout("unix", lc.Address, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("сокет %s уже используется", lc.Address)
+		}
+		if err := os.Remove(lc.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", lc.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if lc.SocketMode != 0 {
+		if err := os.Chmod(lc.Address, lc.SocketMode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("ошибка установки прав сокета: %w", err)
+		}
+	}
+
+	if lc.SocketUser != "" || lc.SocketGroup != "" {
+		uid, gid, err := lookupOwner(lc.SocketUser, lc.SocketGroup)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		if err := os.Lchown(lc.Address, uid, gid); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("ошибка смены владельца сокета: %w", err)
+		}
+	}
+
+	return ln, nil
+}
+
+// lookupOwner принимает имена или числовые идентификаторы; -1 оставляет
+// значение без изменений.
+func lookupOwner(userName, groupName string) (int, int, error) {
+	uid, gid := -1, -1
+
+	if userName != "" {
+		if id, err := strconv.Atoi(userName); err == nil {
+			uid = id
+		} else {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("пользователь %s не найден: %w", userName, err)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if groupName != "" {
+		if id, err := strconv.Atoi(groupName); err == nil {
+			gid = id
+		} else {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("группа %s не найдена: %w", groupName, err)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+func (tc *TLSConfig) serverConfig() (*tls.Config, error) {
+	if tc.CertFile == "" || tc.KeyFile == "" {
+		return nil, errors.New("для TLS требуются cert_file и key_file")
+	}
+
+	cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки сертификата: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if tc.ClientCAFile != "" {
+		pool, err := loadCertPool(tc.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if tc.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if tc.RequireClientCert {
+		return nil, errors.New("require_client_cert требует client_ca_file")
+	}
+
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("в %s нет PEM сертификатов", path)
+	}
+	return pool, nil
+}
+
+// ClientTLSConfig настройки TLS клиента: собственный CA сервера и
+// клиентский сертификат для mTLS.
+type ClientTLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+func (tc *ClientTLSConfig) clientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         tc.ServerName,
+		InsecureSkipVerify: tc.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if tc.CAFile != "" {
+		pool, err := loadCertPool(tc.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки клиентского сертификата: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,908 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// openAPIParam - параметр строки запроса или заголовок операции.
+type openAPIParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+func queryParam(name, typ, description string) openAPIParam {
+	return openAPIParam{Name: name, In: "query", Type: typ, Description: description}
+}
+
+func headerParam(name, description string) openAPIParam {
+	return openAPIParam{Name: name, In: "header", Type: "string", Description: description}
+}
+
+// openAPIOperation описывает маршрут в спецификации OpenAPI. Request -
+// значение типа JSON-тела запроса, Response - типа поля data ответа.
+// RequestTypes и ResponseTypes - типы содержимого тел вне JSON и вне
+// конверта APIResponse.
+type openAPIOperation struct {
+	Summary       string
+	Tag           string
+	Params        []openAPIParam
+	Request       any
+	RequestTypes  []string
+	Response      any
+	ResponseTypes []string
+	// Status - код успешного ответа, по умолчанию 200
+	Status int
+	// Codes - остальные возможные коды ответа
+	Codes []int
+	// ErrorData - тип data в ответах с кодами Codes вместо стандартного
+	ErrorData any
+	// Public - маршрут доступен без авторизации
+	Public bool
+	// Optional - маршрут регистрируется не при любой конфигурации
+	Optional bool
+}
+
+var (
+	keysQueryParams = []openAPIParam{
+		queryParam("prefix", "string", "Префикс ключей"),
+		queryParam("keys_only", "boolean", "Только ключи без значений"),
+		queryParam("limit", "integer", "Максимум ключей"),
+	}
+	streamQueryParams = []openAPIParam{
+		queryParam("prefix", "string", "Префикс ключей"),
+		queryParam("include_keys", "boolean", "Добавлять ключи в записи"),
+	}
+	putKeyOperation = openAPIOperation{
+		Summary: "Записать значение ключа: тело целиком с типом из Content-Type или JSON {value, encoding, content_type, keep_content_type, ttl}",
+		Tag:     "keys",
+		Params: []openAPIParam{
+			queryParam("ttl", "string", "TTL для тела не в JSON, например 1h"),
+			queryParam("keep_content_type", "boolean", "Оставить сохраненный тип, если тело без Content-Type"),
+			headerParam("If-Match", "Записать, только если текущий ETag совпадает; * - если ключ существует"),
+			headerParam("If-None-Match", "Записать, только если ETag не совпадает; * - если ключа нет"),
+		},
+		Request:      APIPutRequest{},
+		RequestTypes: []string{"application/octet-stream", "text/plain"},
+		Response:     APIPutResponse{},
+		Status:       http.StatusCreated,
+		Codes:        []int{http.StatusBadRequest, http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInsufficientStorage},
+	}
+	txnPutKeyOperation = openAPIOperation{
+		Summary: "Записать ключ в транзакции: тело и тип - как у PUT /api/v1/keys/{key}",
+		Tag:     "transactions",
+		Params: []openAPIParam{
+			queryParam("ttl", "string", "TTL для тела не в JSON, например 1h"),
+			queryParam("keep_content_type", "boolean", "Оставить сохраненный тип, если тело без Content-Type"),
+			headerParam("If-Match", "Записать, только если текущий ETag совпадает; * - если ключ существует"),
+			headerParam("If-None-Match", "Записать, только если ETag не совпадает; * - если ключа нет"),
+		},
+		Request:      APIPutRequest{},
+		RequestTypes: []string{"application/octet-stream", "text/plain"},
+		Codes:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGone, http.StatusPreconditionFailed, http.StatusUnprocessableEntity},
+	}
+)
+
+// openAPIOperations - описания всех маршрутов API по ключу "МЕТОД путь",
+// путь в нотации OpenAPI. ValidateOpenAPI сверяет их с маршрутизатором.
+var openAPIOperations = map[string]openAPIOperation{
+	"GET /api/v1/health": {Summary: "Проверка состояния сервера", Tag: "basic", Response: APIHealthResponse{}, Public: true},
+	"GET /api/v1/keys": {
+		Summary: "Список ключей",
+		Tag:     "keys",
+		Params: append(keysQueryParams[:len(keysQueryParams):len(keysQueryParams)],
+			queryParam("start", "string", "Начальный ключ включительно"),
+			queryParam("end", "string", "Конечный ключ включительно"),
+			queryParam("reverse", "boolean", "Обход по убыванию ключей"),
+			queryParam("cursor", "string", "next_cursor предыдущей страницы"),
+		),
+		Response: APIListKeysResponse{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/keys/{key}/info": {
+		Summary:  "Информация о ключе: размер, тип, TTL, ETag, схемы",
+		Tag:      "keys",
+		Params:   []openAPIParam{queryParam("format", "string", "base64 - значение всегда в base64")},
+		Response: APIKeyInfo{},
+		Codes:    []int{http.StatusNotFound},
+	},
+	"POST /api/v1/keys/{key}/query": {
+		Summary:  "JQ запрос к значению ключа",
+		Tag:      "jq",
+		Request:  JQSingleRequest{},
+		Response: APIJQSingleResponse{},
+		Codes:    []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/v1/keys/{key}": {
+		Summary: "Значение ключа; с format=raw, Accept: application/octet-stream, text/plain или сохраненным типом, а также с Range - тело как есть",
+		Tag:     "keys",
+		Params: []openAPIParam{
+			queryParam("format", "string", "json, base64 или raw"),
+			headerParam("If-None-Match", "ETag, при совпадении - 304"),
+			headerParam("Range", "Диапазон байт значения, например bytes=0-1023"),
+			headerParam("If-Range", "ETag: диапазон отдается, только если значение не изменилось"),
+		},
+		Response:      APIKeyInfo{},
+		ResponseTypes: []string{"application/octet-stream", "text/plain"},
+		Codes:         []int{http.StatusPartialContent, http.StatusNotModified, http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable},
+	},
+	"PUT /api/v1/keys/{key}":  putKeyOperation,
+	"POST /api/v1/keys/{key}": putKeyOperation,
+	"DELETE /api/v1/keys/{key}": {
+		Summary: "Удалить ключ",
+		Tag:     "keys",
+		Params:  []openAPIParam{headerParam("If-Match", "Удалить, только если текущий ETag совпадает")},
+		Codes:   []int{http.StatusPreconditionFailed},
+	},
+	"POST /api/v1/search": {
+		Summary:  "Поиск подстроки в ключах и значениях",
+		Tag:      "basic",
+		Request:  SearchRequest{},
+		Response: APISearchResponse{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/stats": {Summary: "Статистика датастора", Tag: "basic", Response: APIStatsResponse{}},
+	"DELETE /api/v1/clear": {
+		Summary: "Удалить все ключи",
+		Tag:     "basic",
+		Params:  []openAPIParam{queryParam("confirm", "boolean", "Должен быть true")},
+		Codes:   []int{http.StatusBadRequest},
+	},
+
+	"POST /api/v1/query": {
+		Summary:       "JQ запрос по ключам; со stream=true или Accept: application/x-ndjson - поток результатов",
+		Tag:           "jq",
+		Request:       JQQueryRequest{},
+		Response:      APIJQQueryResponse{},
+		ResponseTypes: []string{"application/x-ndjson"},
+		Codes:         []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/query/aggregate": {
+		Summary:  "JQ агрегация по ключам",
+		Tag:      "jq",
+		Request:  APIJQAggregateRequest{},
+		Response: APIJQAggregateResponse{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+
+	"POST /api/v1/txn": {
+		Summary:  "Открыть транзакцию",
+		Tag:      "transactions",
+		Request:  APIBeginTxnRequest{},
+		Response: APITxnResponse{},
+		Status:   http.StatusCreated,
+		Codes:    []int{http.StatusBadRequest, http.StatusTooManyRequests},
+	},
+	"GET /api/v1/txn/{id}/keys": {
+		Summary:  "Список ключей в транзакции",
+		Tag:      "transactions",
+		Params:   keysQueryParams,
+		Response: APIListKeysResponse{},
+		Codes:    []int{http.StatusNotFound, http.StatusGone},
+	},
+	"GET /api/v1/txn/{id}/keys/{key}": {
+		Summary:       "Значение ключа в транзакции",
+		Tag:           "transactions",
+		Params:        []openAPIParam{queryParam("format", "string", "json, base64 или raw"), headerParam("Range", "Диапазон байт значения")},
+		Response:      APIKeyInfo{},
+		ResponseTypes: []string{"application/octet-stream", "text/plain"},
+		Codes:         []int{http.StatusPartialContent, http.StatusNotFound, http.StatusGone, http.StatusRequestedRangeNotSatisfiable},
+	},
+	"PUT /api/v1/txn/{id}/keys/{key}":    txnPutKeyOperation,
+	"POST /api/v1/txn/{id}/keys/{key}":   txnPutKeyOperation,
+	"DELETE /api/v1/txn/{id}/keys/{key}": {Summary: "Удалить ключ в транзакции", Tag: "transactions", Codes: []int{http.StatusNotFound, http.StatusGone}},
+	"POST /api/v1/txn/{id}/commit": {
+		Summary: "Зафиксировать транзакцию",
+		Tag:     "transactions",
+		Codes:   []int{http.StatusNotFound, http.StatusConflict, http.StatusGone, http.StatusUnprocessableEntity},
+	},
+	"POST /api/v1/txn/{id}/discard": {Summary: "Отменить транзакцию", Tag: "transactions", Codes: []int{http.StatusNotFound, http.StatusGone}},
+
+	"GET /api/v1/schemas": {
+		Summary:  "Список схем",
+		Tag:      "schemas",
+		Params:   []openAPIParam{queryParam("key", "string", "Только схемы, действующие для ключа")},
+		Response: APISchemasListResponse{},
+	},
+	"POST /api/v1/schemas": {
+		Summary: "Зарегистрировать схему",
+		Tag:     "schemas",
+		Request: KeySchema{},
+		Status:  http.StatusCreated,
+		Codes:   []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/schemas/validate": {
+		Summary:  "Проверить значение по схемам ключа",
+		Tag:      "schemas",
+		Request:  APIValidateRequest{},
+		Response: APIValidateResponse{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/schemas/{name}": {Summary: "Удалить схему", Tag: "schemas", Codes: []int{http.StatusNotFound}},
+
+	"GET /api/v1/views": {Summary: "Список views", Tag: "views", Response: APIViewsListResponse{}},
+	"POST /api/v1/views": {
+		Summary:  "Создать view",
+		Tag:      "views",
+		Request:  ViewConfig{},
+		Response: APIViewResponse{},
+		Status:   http.StatusCreated,
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/views/{id}": {Summary: "View с конфигурацией и статистикой", Tag: "views", Response: APIViewResponse{}, Codes: []int{http.StatusNotFound}},
+	"PUT /api/v1/views/{id}": {
+		Summary:  "Обновить view",
+		Tag:      "views",
+		Request:  ViewConfig{},
+		Response: APIViewResponse{},
+		Codes:    []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"DELETE /api/v1/views/{id}": {Summary: "Удалить view", Tag: "views", Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/views/{id}/execute": {
+		Summary: "Выполнить view",
+		Tag:     "views",
+		Params: []openAPIParam{
+			queryParam("start", "string", "Начальный ключ"),
+			queryParam("end", "string", "Конечный ключ"),
+			queryParam("reverse", "boolean", "Результаты по убыванию ключей"),
+			queryParam("limit", "integer", "Максимум результатов"),
+			queryParam("cursor", "string", "next_cursor предыдущей страницы"),
+		},
+		Response: APIViewExecuteResponse{},
+		Codes:    []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/v1/views/{id}/refresh": {Summary: "Обновить кеш view", Tag: "views", Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/views/refresh":      {Summary: "Обновить кеш всех views", Tag: "views"},
+	"GET /api/v1/views/{id}/stats":    {Summary: "Статистика view", Tag: "views", Response: ViewStats{}, Codes: []int{http.StatusNotFound}},
+
+	"GET /api/v1/indexes": {Summary: "Список вторичных индексов", Tag: "indexes", Response: APIIndexesListResponse{}},
+	"POST /api/v1/indexes": {
+		Summary:  "Создать индекс",
+		Tag:      "indexes",
+		Request:  IndexConfig{},
+		Response: IndexConfig{},
+		Status:   http.StatusCreated,
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/indexes/{name}":       {Summary: "Удалить индекс", Tag: "indexes", Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/indexes/{name}/rebuild": {Summary: "Перестроить индекс", Tag: "indexes", Codes: []int{http.StatusNotFound}},
+	"GET /api/v1/indexes/{name}/lookup": {
+		Summary:  "Ключи с точным значением индекса",
+		Tag:      "indexes",
+		Params:   []openAPIParam{queryParam("value", "string", "Значение; JSON-литерал или строка")},
+		Response: APIIndexLookupResponse{},
+		Codes:    []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/v1/indexes/{name}/range": {
+		Summary: "Записи индекса в диапазоне значений",
+		Tag:     "indexes",
+		Params: []openAPIParam{
+			queryParam("from", "string", "Нижняя граница включительно"),
+			queryParam("to", "string", "Верхняя граница не включительно"),
+			queryParam("limit", "integer", "Максимум записей"),
+		},
+		Response: APIIndexRangeResponse{},
+		Codes:    []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+
+	"POST /api/v1/transform": {
+		Summary:  "Трансформация ключей",
+		Tag:      "transform",
+		Request:  TransformRequest{},
+		Response: TransformSummary{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/transform/jq": {
+		Summary:  "Трансформация JQ выражением",
+		Tag:      "transform",
+		Request:  TransformJQRequest{},
+		Response: TransformSummary{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/transform/patch": {
+		Summary:  "Трансформация JSON Patch",
+		Tag:      "transform",
+		Request:  TransformPatchRequest{},
+		Response: TransformSummary{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/transform/js": {
+		Summary:  "Трансформация JavaScript",
+		Tag:      "transform",
+		Request:  TransformJSRequest{},
+		Response: TransformSummary{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/transform/journal": {Summary: "Журналы трансформаций", Tag: "transform", Response: APITransformJournalsResponse{}},
+	"POST /api/v1/transform/journal/{id}/revert": {
+		Summary:  "Откатить трансформацию по журналу",
+		Tag:      "transform",
+		Response: TransformSummary{},
+		Codes:    []int{http.StatusNotFound},
+	},
+	"DELETE /api/v1/transform/journal/{id}": {Summary: "Удалить журнал трансформации", Tag: "transform", Codes: []int{http.StatusNotFound}},
+	"GET /api/v1/transform/jobs":            {Summary: "Задания трансформации, которые токен может изменять", Tag: "transform", Response: APITransformJobsResponse{}},
+	"POST /api/v1/transform/jobs": {
+		Summary:  "Запустить фоновое задание трансформации",
+		Tag:      "transform",
+		Request:  TransformJobRequest{},
+		Response: TransformJob{},
+		Status:   http.StatusAccepted,
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/transform/jobs/{id}":           {Summary: "Состояние задания", Tag: "transform", Response: TransformJob{}, Codes: []int{http.StatusNotFound}},
+	"DELETE /api/v1/transform/jobs/{id}":        {Summary: "Удалить задание", Tag: "transform", Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/transform/jobs/{id}/cancel":   {Summary: "Отменить задание", Tag: "transform", Status: http.StatusAccepted, Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/transform/jobs/{id}/resume":   {Summary: "Возобновить задание", Tag: "transform", Response: TransformJob{}, Status: http.StatusAccepted, Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/transform/jobs/{id}/throttle": {Summary: "Изменить скорость задания", Tag: "transform", Request: APIThrottleRequest{}, Codes: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	"GET /api/v1/ttl/stats": {
+		Summary:  "Статистика TTL",
+		Tag:      "ttl",
+		Params:   []openAPIParam{queryParam("prefix", "string", "Префикс ключей")},
+		Response: TTLStats{},
+	},
+	"GET /api/v1/ttl/keys": {
+		Summary: "Ключи с TTL",
+		Tag:     "ttl",
+		Params: []openAPIParam{
+			queryParam("prefix", "string", "Префикс ключей"),
+			queryParam("within", "string", "Только истекающие в этот срок, например 10m"),
+		},
+		Response: APITTLKeysResponse{},
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/ttl/cleanup": {Summary: "Удалить истекшие ключи", Tag: "ttl", Response: APITTLCleanupResponse{}},
+	"POST /api/v1/ttl/batch": {
+		Summary: "Установить TTL для нескольких ключей",
+		Tag:     "ttl",
+		Request: APITTLBatchRequest{},
+		Codes:   []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/ttl/policies": {
+		Summary:  "Политики TTL",
+		Tag:      "ttl",
+		Params:   []openAPIParam{queryParam("key", "string", "Только политика, действующая для ключа")},
+		Response: APITTLPoliciesResponse{},
+	},
+	"POST /api/v1/ttl/policies": {
+		Summary: "Установить политику TTL для префикса",
+		Tag:     "ttl",
+		Request: TTLPolicy{},
+		Status:  http.StatusCreated,
+		Codes:   []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/ttl/policies/{prefix}": {Summary: "Удалить политику TTL", Tag: "ttl", Codes: []int{http.StatusNotFound}},
+	"POST /api/v1/ttl/{key}/extend": {
+		Summary: "Продлить TTL ключа",
+		Tag:     "ttl",
+		Request: APIExtendTTLRequest{},
+		Codes:   []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/ttl/{key}/refresh": {Summary: "Обновить TTL ключа (не реализовано)", Tag: "ttl", Codes: []int{http.StatusNotImplemented}},
+
+	"GET /api/v1/stream": {
+		Summary: "Поток ключей в выбранном формате",
+		Tag:     "streaming",
+		Params: append([]openAPIParam{
+			queryParam("format", "string", "json, jsonl, csv, sse, binary или xml"),
+			queryParam("jq", "string", "JQ фильтр значений"),
+			queryParam("limit", "integer", "Максимум записей"),
+		}, streamQueryParams...),
+		ResponseTypes: []string{"application/json", "application/x-ndjson", "text/csv", "text/event-stream", "application/octet-stream", "application/xml"},
+		Codes:         []int{http.StatusBadRequest},
+	},
+	"GET /api/v1/stream/events": {Summary: "События датастора (SSE)", Tag: "streaming", ResponseTypes: []string{"text/event-stream"}},
+	"GET /api/v1/stream/json":   {Summary: "Поток ключей JSON-массивом", Tag: "streaming", Params: streamQueryParams, ResponseTypes: []string{"application/json"}},
+	"GET /api/v1/stream/jsonl":  {Summary: "Поток ключей JSON Lines", Tag: "streaming", Params: streamQueryParams, ResponseTypes: []string{"application/x-ndjson"}},
+	"GET /api/v1/stream/csv":    {Summary: "Поток ключей CSV", Tag: "streaming", Params: streamQueryParams, ResponseTypes: []string{"text/csv"}},
+	"GET /api/v1/stream/sse": {
+		Summary:       "Поток ключей и событий (SSE)",
+		Tag:           "streaming",
+		Params:        []openAPIParam{queryParam("prefix", "string", "Префикс ключей")},
+		ResponseTypes: []string{"text/event-stream"},
+	},
+	"GET /api/v1/ws": {
+		Summary: "WebSocket подписки на события: сообщения клиента - WSClientMessage, сервера - WSServerMessage",
+		Tag:     "streaming",
+		Status:  http.StatusSwitchingProtocols,
+		Codes:   []int{http.StatusBadRequest},
+	},
+
+	"POST /api/v1/batch": {
+		Summary:   "Пакет операций put/delete: с atomic=true все или ни одной одной транзакцией, по умолчанию каждая независимо (ошибка операции не отменяет остальные); если не выполнена ни одна - код ошибки",
+		Tag:       "basic",
+		Request:   BatchRequest{},
+		Response:  APIBatchResponse{},
+		Codes:     []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInsufficientStorage},
+		ErrorData: APIBatchResponse{},
+	},
+
+	"GET /api/v1/subscriptions": {Summary: "JS подписки", Tag: "subscriptions", Response: APISubscriptionsListResponse{}},
+	"POST /api/v1/subscriptions": {
+		Summary: "Создать JS подписку",
+		Tag:     "subscriptions",
+		Request: SubscriptionRequest{},
+		Status:  http.StatusCreated,
+		Codes:   []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/subscriptions/{id}": {Summary: "Удалить JS подписку", Tag: "subscriptions", Codes: []int{http.StatusNotFound}},
+
+	"GET /api/v1/export": {
+		Summary: "Экспорт ключей; итог - в трейлерах X-Export-Processed и X-Export-Skipped",
+		Tag:     "transfer",
+		Params: []openAPIParam{
+			queryParam("prefix", "string", "Префикс ключей"),
+			queryParam("format", "string", "Формат записей"),
+			queryParam("encoding", "string", "Кодировка значений"),
+			queryParam("compression", "string", "gzip, zip или tar"),
+			queryParam("name", "string", "Имя файла"),
+			queryParam("extract", "string", "JSON Pointer извлекаемой части значения"),
+			queryParam("patch", "string", "JSON Patch для значений"),
+			queryParam("jq", "string", "JQ выражение для значений"),
+			queryParam("start", "string", "Начальный ключ"),
+			queryParam("end", "string", "Конечный ключ"),
+			queryParam("metadata", "boolean", "Добавлять метаданные"),
+			queryParam("skip_system", "boolean", "Пропускать системные ключи; без права admin всегда true"),
+			queryParam("limit", "integer", "Максимум записей"),
+		},
+		ResponseTypes: []string{"application/x-ndjson", "application/gzip", "application/zip", "application/x-tar"},
+		Codes:         []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/import": {
+		Summary: "Импорт JSON Lines; с progress=true ответ - поток ImportEvent",
+		Tag:     "transfer",
+		Params: []openAPIParam{
+			queryParam("prefix", "string", "Префикс ключей"),
+			queryParam("id_type", "string", "Способ формирования ключей"),
+			queryParam("extract", "string", "JSON Pointer извлекаемой части записи"),
+			queryParam("patch", "string", "JSON Patch для записей"),
+			queryParam("jq", "string", "JQ выражение для записей"),
+			queryParam("name", "string", "Имя источника"),
+			queryParam("clock_id", "integer", "Идентификатор часов для TID"),
+			queryParam("batch_size", "integer", "Размер пакета записи"),
+			queryParam("progress", "boolean", "Поток событий прогресса"),
+		},
+		RequestTypes:  []string{"application/x-ndjson", "application/gzip", "application/zip", "application/x-tar", "multipart/form-data"},
+		Response:      APIImportResponse{},
+		ResponseTypes: []string{"application/x-ndjson"},
+		Codes:         []int{http.StatusBadRequest},
+	},
+
+	"POST /api/v1/system/mode": {Summary: "Включить или выключить тихий режим", Tag: "system", Request: APISetModeRequest{}, Response: APISystemModeResponse{}},
+	"POST /api/v1/system/gc":   {Summary: "Сборка мусора", Tag: "system"},
+	"GET /api/v1/system/backup": {
+		Summary:       "Снимок датастора; версия - в трейлере X-Snapshot-Version",
+		Tag:           "system",
+		Params:        []openAPIParam{queryParam("since", "integer", "Инкрементальный снимок после версии")},
+		ResponseTypes: []string{"application/octet-stream"},
+		Codes:         []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/system/restore": {Summary: "Восстановить снимок", Tag: "system", RequestTypes: []string{"application/octet-stream"}},
+	"GET /api/v1/system/tokens":   {Summary: "Токены доступа", Tag: "system", Response: []APIToken{}},
+	"POST /api/v1/system/tokens": {
+		Summary:  "Создать токен доступа",
+		Tag:      "system",
+		Request:  APICreateTokenRequest{},
+		Response: APICreateTokenResponse{},
+		Status:   http.StatusCreated,
+		Codes:    []int{http.StatusBadRequest},
+	},
+	"DELETE /api/v1/system/tokens/{id}": {Summary: "Отозвать токен", Tag: "system", Codes: []int{http.StatusNotFound}},
+	"GET /api/v1/system/whoami":         {Summary: "Токен текущего запроса и его квота", Tag: "system", Response: APIWhoAmIResponse{}},
+
+	"GET /api/v1/docs":         {Summary: "HTML документация", Tag: "docs", ResponseTypes: []string{"text/html"}},
+	"GET /api/v1/openapi.json": {Summary: "Эта спецификация", Tag: "docs", ResponseTypes: []string{"application/json"}},
+	"GET /metrics": {
+		Summary:       "Метрики Prometheus",
+		Tag:           "system",
+		ResponseTypes: []string{"text/plain"},
+		Public:        true,
+		Optional:      true,
+	},
+}
+
+// openAPIRoute - маршрут маршрутизатора в нотации OpenAPI.
+type openAPIRoute struct {
+	Method string
+	Path   string
+}
+
+func (r openAPIRoute) String() string {
+	return r.Method + " " + r.Path
+}
+
+// muxVarPattern - переменная пути gorilla/mux с регулярным выражением,
+// например {key:.*}.
+var muxVarPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// openAPIRoutes возвращает маршруты router с методами; маршруты без
+// методов (корневой обработчик) в спецификацию не входят.
+func openAPIRoutes(router *mux.Router) ([]openAPIRoute, error) {
+	var routes []openAPIRoute
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		path := muxVarPattern.ReplaceAllString(tmpl, "{$1}")
+		for _, method := range methods {
+			routes = append(routes, openAPIRoute{Method: method, Path: path})
+		}
+		return nil
+	})
+	return routes, err
+}
+
+// ValidateOpenAPI сверяет маршруты сервера с описаниями спецификации:
+// ошибка перечисляет маршруты без описания и описания без маршрута.
+func (s *APIServer) ValidateOpenAPI() error {
+	return validateOpenAPI(s.newRouter())
+}
+
+func validateOpenAPI(router *mux.Router) error {
+	routes, err := openAPIRoutes(router)
+	if err != nil {
+		return fmt.Errorf("ошибка обхода маршрутов: %w", err)
+	}
+
+	registered := make(map[string]bool, len(routes))
+	var problems []string
+	for _, route := range routes {
+		registered[route.String()] = true
+		if _, ok := openAPIOperations[route.String()]; !ok {
+			problems = append(problems, fmt.Sprintf("маршрут %s не описан в спецификации", route))
+		}
+	}
+	for name, op := range openAPIOperations {
+		if !registered[name] && !op.Optional {
+			problems = append(problems, fmt.Sprintf("описание %s без маршрута", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("спецификация OpenAPI расходится с маршрутами:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// openAPICache - спецификация, собранная при первом запросе.
+type openAPICache struct {
+	once sync.Once
+	spec []byte
+	err  error
+}
+
+func (s *APIServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.openapi.once.Do(func() {
+		var spec map[string]any
+		spec, s.openapi.err = s.buildOpenAPI()
+		if s.openapi.err == nil {
+			s.openapi.spec, s.openapi.err = json.MarshalIndent(spec, "", "  ")
+		}
+	})
+	if s.openapi.err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка построения спецификации: %v", s.openapi.err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openapi.spec)
+}
+
+// buildOpenAPI строит документ OpenAPI 3 по маршрутам сервера. Маршруты без
+// описания попадают в документ с пометкой, чтобы спецификация не теряла
+// пути; ValidateOpenAPI сообщает о них.
+func (s *APIServer) buildOpenAPI() (map[string]any, error) {
+	routes, err := openAPIRoutes(s.newRouter())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обхода маршрутов: %w", err)
+	}
+
+	gen := &openAPISchemas{schemas: make(map[string]any)}
+	gen.schemaFor(reflect.TypeOf(APIResponse{}))
+
+	paths := make(map[string]map[string]any)
+	for _, route := range routes {
+		op, ok := openAPIOperations[route.String()]
+		if !ok {
+			op = openAPIOperation{Summary: "Нет описания", Tag: "undocumented"}
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]any)
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = gen.operation(route, op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "UES Datastore API",
+			"version":     "1.0.0",
+			"description": "Ответы JSON обернуты в APIResponse: полезная нагрузка - в data, описание ошибки - в error.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}},
+	}, nil
+}
+
+// openAPISchemas строит JSON Schema типов по их json-тегам и собирает
+// именованные структуры в components.schemas.
+type openAPISchemas struct {
+	schemas map[string]any
+}
+
+func (g *openAPISchemas) operation(route openAPIRoute, op openAPIOperation) map[string]any {
+	result := map[string]any{
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+		"operationId": operationID(route),
+	}
+	if op.Public {
+		result["security"] = []any{}
+	}
+
+	var params []any
+	for _, name := range pathParams(route.Path) {
+		param := map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}}
+		if name == "key" || name == "prefix" {
+			param["description"] = "Ключ датастора, может содержать /"
+		}
+		params = append(params, param)
+	}
+	for _, p := range op.Params {
+		params = append(params, map[string]any{
+			"name":        p.Name,
+			"in":          p.In,
+			"description": p.Description,
+			"schema":      map[string]any{"type": p.Type},
+		})
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+
+	if op.Request != nil || len(op.RequestTypes) > 0 {
+		content := map[string]any{}
+		if op.Request != nil {
+			content["application/json"] = map[string]any{"schema": g.schemaFor(reflect.TypeOf(op.Request))}
+		}
+		for _, ct := range op.RequestTypes {
+			content[ct] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		}
+		result["requestBody"] = map[string]any{"content": content}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responses := map[string]any{strconv.Itoa(status): g.successResponse(status, op)}
+	for _, code := range op.Codes {
+		responses[strconv.Itoa(code)] = g.errorResponse(code, op.ErrorData)
+	}
+	codes := []int{http.StatusInternalServerError}
+	if !op.Public {
+		codes = append(codes, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, code := range codes {
+		if _, ok := responses[strconv.Itoa(code)]; !ok {
+			responses[strconv.Itoa(code)] = g.errorResponse(code, nil)
+		}
+	}
+	result["responses"] = responses
+	return result
+}
+
+func (g *openAPISchemas) successResponse(status int, op openAPIOperation) map[string]any {
+	response := map[string]any{"description": http.StatusText(status)}
+	if status == http.StatusSwitchingProtocols {
+		g.schemaFor(reflect.TypeOf(WSClientMessage{}))
+		g.schemaFor(reflect.TypeOf(WSServerMessage{}))
+		return response
+	}
+
+	content := map[string]any{}
+	if op.Response != nil || len(op.ResponseTypes) == 0 {
+		content["application/json"] = map[string]any{"schema": g.envelope(op.Response)}
+	}
+	for _, ct := range op.ResponseTypes {
+		if _, ok := content[ct]; ok {
+			continue
+		}
+		content[ct] = map[string]any{"schema": rawSchema(ct)}
+	}
+	response["content"] = content
+	return response
+}
+
+// rawSchema - схема тела вне JSON: двоичное для application/octet-stream,
+// иначе строка.
+func rawSchema(contentType string) map[string]any {
+	if contentType == "application/octet-stream" {
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+	return map[string]any{"type": "string"}
+}
+
+// errorResponse описывает ответ с ошибкой: без data операции 412 и 422
+// несут в data текущий ETag и нарушения схем, 304 - без тела, 206 - часть
+// значения.
+func (g *openAPISchemas) errorResponse(code int, data any) map[string]any {
+	response := map[string]any{"description": http.StatusText(code)}
+	switch {
+	case code == http.StatusNotModified:
+		return response
+	case code == http.StatusPartialContent:
+		response["content"] = map[string]any{"application/octet-stream": map[string]any{"schema": rawSchema("application/octet-stream")}}
+		return response
+	case data != nil:
+	case code == http.StatusPreconditionFailed:
+		data = PreconditionFailedError{}
+	case code == http.StatusUnprocessableEntity:
+		data = SchemaValidationError{}
+	}
+	response["content"] = map[string]any{
+		"application/json": map[string]any{"schema": g.envelope(data)},
+	}
+	return response
+}
+
+// envelope - схема APIResponse с типом поля data.
+func (g *openAPISchemas) envelope(data any) map[string]any {
+	ref := g.schemaFor(reflect.TypeOf(APIResponse{}))
+	if data == nil {
+		return ref
+	}
+	return map[string]any{
+		"allOf": []any{ref, map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": g.schemaFor(reflect.TypeOf(data))},
+		}},
+	}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	dsKeyType    = reflect.TypeOf(ds.Key{})
+	rawJSONType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (g *openAPISchemas) schemaFor(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "format": "int64", "description": "Длительность в наносекундах"}
+	case dsKeyType:
+		return map[string]any{"type": "string"}
+	case rawJSONType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// Заглушка до построения защищает от рекурсивных типов
+			g.schemas[t.Name()] = map[string]any{}
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *openAPISchemas) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	g.fields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// fields добавляет поля структуры по правилам encoding/json: тег задает
+// имя, "-" скрывает поле, встроенные структуры без тега раскрываются.
+func (g *openAPISchemas) fields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props)
+			continue
+		}
+		if !f.IsExported() || ft.Kind() == reflect.Func || ft.Kind() == reflect.Chan {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		if strings.Contains(opts, "string") {
+			props[name] = map[string]any{"type": "string"}
+			continue
+		}
+		props[name] = g.schemaFor(f.Type)
+	}
+}
+
+// pathParams возвращает имена переменных пути в нотации OpenAPI.
+func pathParams(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			names = append(names, strings.Trim(part, "{}"))
+		}
+	}
+	return names
+}
+
+// operationID строит идентификатор операции из метода и пути, например
+// get_keys_key_info для GET /api/v1/keys/{key}/info.
+func operationID(route openAPIRoute) string {
+	path := strings.TrimPrefix(route.Path, "/api/v1")
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		part = strings.Trim(part, "{}")
+		part = strings.NewReplacer(".", "_", "-", "_").Replace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.ToLower(route.Method) + "_" + strings.Join(parts, "_")
+}
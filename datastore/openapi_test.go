@@ -0,0 +1,33 @@
+package datastore
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testOpenAPIServer() *APIServer {
+	config := DefaultConfig()
+	config.EnableMetrics = false
+	config.LogRequests = false
+	return NewAPIServer(nil, config)
+}
+
+func TestValidateOpenAPI(t *testing.T) {
+	if err := testOpenAPIServer().ValidateOpenAPI(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOpenAPIUndocumentedRoute(t *testing.T) {
+	router := testOpenAPIServer().newRouter()
+	router.HandleFunc("/api/v1/undocumented", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	err := validateOpenAPI(router)
+	if err == nil {
+		t.Fatal("маршрут без описания не найден")
+	}
+	if !strings.Contains(err.Error(), "GET /api/v1/undocumented") {
+		t.Fatalf("ошибка не называет маршрут: %v", err)
+	}
+}
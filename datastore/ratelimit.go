@@ -0,0 +1,427 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/time/rate"
+)
+
+// rateClass - бюджет запросов, из которого списывается запрос.
+type rateClass int
+
+const (
+	rateRead rateClass = iota
+	rateWrite
+	rateExpensive
+)
+
+func (c rateClass) String() string {
+	switch c {
+	case rateWrite:
+		return "write"
+	case rateExpensive:
+		return "expensive"
+	}
+	return "read"
+}
+
+// expensivePaths - эндпоинты с полным обходом ключей, у них отдельный бюджет.
+var expensivePaths = []string{"/api/v1/query", "/api/v1/search", "/api/v1/transform"}
+
+func classifyRequest(r *http.Request) rateClass {
+	for _, path := range expensivePaths {
+		if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+			return rateExpensive
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return rateRead
+	}
+	return rateWrite
+}
+
+// clientLimiters хранит бюджеты клиентов; клиенты без запросов дольше
+// idleTTL удаляются.
+type clientLimiters struct {
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	limits    [3]rateLimit
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+type rateLimit struct {
+	rps   float64
+	burst int
+}
+
+type clientLimiter struct {
+	limiters [3]*rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientLimiters(config *Config) *clientLimiters {
+	cl := &clientLimiters{
+		clients: make(map[string]*clientLimiter),
+		idleTTL: config.RateLimitIdleTTL,
+	}
+	cl.limits[rateRead] = rateLimit{config.RateLimitRPS, config.RateLimitBurst}
+	cl.limits[rateWrite] = rateLimit{config.WriteRateLimitRPS, config.WriteRateLimitBurst}
+	cl.limits[rateExpensive] = rateLimit{config.ExpensiveRateLimitRPS, config.ExpensiveRateLimitBurst}
+	if cl.idleTTL <= 0 {
+		cl.idleTTL = 10 * time.Minute
+	}
+	return cl
+}
+
+// limiter возвращает лимитер клиента для класса; nil - класс не ограничен.
+func (cl *clientLimiters) limiter(client string, class rateClass) *rate.Limiter {
+	limit := cl.limits[class]
+	if limit.rps <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if now.Sub(cl.lastSweep) > cl.idleTTL {
+		for id, c := range cl.clients {
+			if now.Sub(c.lastSeen) > cl.idleTTL {
+				delete(cl.clients, id)
+			}
+		}
+		cl.lastSweep = now
+	}
+
+	c, ok := cl.clients[client]
+	if !ok {
+		c = &clientLimiter{}
+		cl.clients[client] = c
+	}
+	c.lastSeen = now
+	if c.limiters[class] == nil {
+		c.limiters[class] = rate.NewLimiter(rate.Limit(limit.rps), limit.burst)
+	}
+	return c.limiters[class]
+}
+
+// clientID - токен запроса, иначе адрес клиента.
+func (s *APIServer) clientID(r *http.Request) string {
+	if token := requestToken(r); token != nil {
+		return "token:" + token.ID
+	}
+	if s.config.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return "ip:" + strings.TrimSpace(ip)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Unix сокет не сообщает адрес клиента
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// setRateLimitHeaders выставляет заголовки RateLimit-* по состоянию бюджета.
+func setRateLimitHeaders(w http.ResponseWriter, lim *rate.Limiter, class rateClass, now time.Time) {
+	burst := lim.Burst()
+	tokens := math.Max(lim.TokensAt(now), 0)
+	reset := 0
+	if missing := float64(burst) - tokens; missing > 0 {
+		reset = int(math.Ceil(missing / float64(lim.Limit())))
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;name=%q", burst,
+		int(math.Ceil(float64(burst)/float64(lim.Limit()))), class.String()))
+}
+
+// Quotas
+
+// quotaUsage - занятое токеном место под префиксами с правом записи.
+type quotaUsage struct {
+	Keys      int64     `json:"keys"`
+	Bytes     int64     `json:"bytes"`
+	MaxKeys   int64     `json:"max_keys,omitempty"`
+	MaxBytes  int64     `json:"max_bytes,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// quotaTracker кеширует использование квот на QuotaCheckInterval; между
+// пересчетами принятые записи добавляются к кешу, поэтому квота
+// соблюдается приблизительно.
+type quotaTracker struct {
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+func hasQuota(token *APIToken) bool {
+	return token != nil && (token.MaxKeys > 0 || token.MaxBytes > 0)
+}
+
+// writePrefixes - префиксы с правом записи без вложенных друг в друга.
+func writePrefixes(token *APIToken) []ds.Key {
+	var prefixes []ds.Key
+	for _, scope := range token.Scopes {
+		if scope.Permission == PermissionWrite || scope.Permission == PermissionAdmin {
+			prefixes = append(prefixes, ds.NewKey(scope.Prefix))
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i].String()) < len(prefixes[j].String())
+	})
+
+	var result []ds.Key
+	for _, prefix := range prefixes {
+		covered := false
+		for _, kept := range result {
+			if kept.String() == "/" || kept.Equal(prefix) || kept.IsAncestorOf(prefix) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			result = append(result, prefix)
+		}
+	}
+	return result
+}
+
+// storesData сообщает, что запрос записывает значения из тела: только
+// такие запросы проверяются по квоте.
+func storesData(r *http.Request) bool {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		return false
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	switch {
+	case strings.HasPrefix(path, "/keys/") && !strings.HasSuffix(path, "/query"):
+		return true
+	case strings.HasPrefix(path, "/txn/") && strings.Contains(path, "/keys/"):
+		return true
+	case path == "/batch" || path == "/import":
+		return true
+	}
+	return false
+}
+
+// transformsData сообщает, что запрос записывает результат преобразования:
+// его размер заранее неизвестен, поэтому после успешного запроса
+// использование пересчитывается заново.
+func transformsData(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	switch strings.TrimPrefix(r.URL.Path, "/api/v1") {
+	case "/transform", "/transform/jq", "/transform/patch", "/transform/js", "/transform/jobs":
+		return true
+	}
+	return false
+}
+
+func (s *APIServer) quotaUsage(ctx context.Context, token *APIToken) (quotaUsage, error) {
+	s.quotas.mu.Lock()
+	if cached, ok := s.quotas.usage[token.ID]; ok && time.Since(cached.CheckedAt) < s.config.QuotaCheckInterval {
+		usage := *cached
+		s.quotas.mu.Unlock()
+		return usage, nil
+	}
+	s.quotas.mu.Unlock()
+
+	usage := quotaUsage{MaxKeys: token.MaxKeys, MaxBytes: token.MaxBytes, CheckedAt: time.Now()}
+	for _, prefix := range writePrefixes(token) {
+		results, err := s.ds.Query(ctx, query.Query{Prefix: prefix.String(), KeysOnly: true, ReturnsSizes: true})
+		if err != nil {
+			return usage, err
+		}
+		for result := range results.Next() {
+			if result.Error != nil {
+				results.Close()
+				return usage, result.Error
+			}
+			if strings.HasPrefix(result.Key, "/_system") {
+				continue
+			}
+			usage.Keys++
+			usage.Bytes += int64(result.Size)
+		}
+		results.Close()
+	}
+
+	s.quotas.mu.Lock()
+	s.quotas.usage[token.ID] = &usage
+	s.quotas.mu.Unlock()
+	return usage, nil
+}
+
+// addQuotaUsage учитывает принятую запись до следующего пересчета.
+func (s *APIServer) addQuotaUsage(token *APIToken, bytes int64) {
+	s.quotas.mu.Lock()
+	defer s.quotas.mu.Unlock()
+	if usage, ok := s.quotas.usage[token.ID]; ok {
+		usage.Keys++
+		usage.Bytes += bytes
+	}
+}
+
+// resetQuotaUsage сбрасывает кеш, чтобы следующая проверка пересчитала
+// фактически занятое место.
+func (s *APIServer) resetQuotaUsage(token *APIToken) {
+	s.quotas.mu.Lock()
+	defer s.quotas.mu.Unlock()
+	delete(s.quotas.usage, token.ID)
+}
+
+// checkQuota отклоняет запись size байт, которая превысит квоту токена.
+// Фактический размер тела ограничивает quotaBody.
+func (s *APIServer) checkQuota(w http.ResponseWriter, r *http.Request, token *APIToken, size int64) (quotaUsage, bool) {
+	usage, err := s.quotaUsage(r.Context(), token)
+	if err != nil {
+		s.sendErrorResponse(w, r, fmt.Sprintf("Ошибка проверки квоты: %v", err), http.StatusInternalServerError)
+		return usage, false
+	}
+
+	switch {
+	case token.MaxKeys > 0 && usage.Keys >= token.MaxKeys:
+		s.sendErrorResponse(w, r, fmt.Sprintf("Превышена квота ключей: %d из %d", usage.Keys, token.MaxKeys), http.StatusInsufficientStorage)
+		return usage, false
+	case token.MaxBytes > 0 && usage.Bytes+size > token.MaxBytes:
+		s.sendErrorResponse(w, r, fmt.Sprintf("Превышена квота хранилища: %d из %d байт", usage.Bytes, token.MaxBytes), http.StatusInsufficientStorage)
+		return usage, false
+	}
+	return usage, true
+}
+
+var errQuotaExceeded = errors.New("превышена квота хранилища")
+
+// quotaBody считает байты, прочитанные из тела запроса, и прерывает чтение
+// сверх остатка квоты: у chunked тела нет Content-Length.
+type quotaBody struct {
+	io.ReadCloser
+	limit    int64 // остаток квоты; < 0 - без ограничения
+	read     int64
+	exceeded bool
+}
+
+func (b *quotaBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errQuotaExceeded
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.limit >= 0 && b.read > b.limit {
+		b.exceeded = true
+		return n, errQuotaExceeded
+	}
+	return n, err
+}
+
+// quotaResponseWriter заменяет ошибку обработчика на 507, если чтение тела
+// прервала квота.
+type quotaResponseWriter struct {
+	responseWrapper
+	s        *APIServer
+	r        *http.Request
+	body     *quotaBody
+	replaced bool
+}
+
+func (w *quotaResponseWriter) WriteHeader(code int) {
+	if w.body.exceeded && code >= http.StatusBadRequest {
+		w.replaced = true
+		w.s.sendErrorResponse(&w.responseWrapper, w.r, fmt.Sprintf("Превышена квота хранилища: тело больше %d байт", w.body.limit), http.StatusInsufficientStorage)
+		return
+	}
+	w.responseWrapper.WriteHeader(code)
+}
+
+func (w *quotaResponseWriter) Write(p []byte) (int, error) {
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.responseWrapper.Write(p)
+}
+
+func (s *APIServer) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || r.URL.Path == "/api/v1/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		class := classifyRequest(r)
+		if s.limiters != nil {
+			if lim := s.limiters.limiter(s.clientID(r), class); lim != nil {
+				now := time.Now()
+				reservation := lim.ReserveN(now, 1)
+				if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+					retryAfter := time.Second
+					if reservation.OK() {
+						retryAfter = reservation.DelayFrom(now)
+						reservation.CancelAt(now)
+					}
+					setRateLimitHeaders(w, lim, class, now)
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+					s.sendErrorResponse(w, r, "Превышен лимит запросов", http.StatusTooManyRequests)
+					return
+				}
+				setRateLimitHeaders(w, lim, class, now)
+			}
+		}
+
+		token := requestToken(r)
+		if !hasQuota(token) || !storesData(r) && !transformsData(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if transformsData(r) {
+			if _, ok := s.checkQuota(w, r, token, 0); !ok {
+				return
+			}
+			wrapped := &responseWrapper{ResponseWriter: w}
+			next.ServeHTTP(wrapped, r)
+			if wrapped.status < http.StatusMultipleChoices {
+				s.resetQuotaUsage(token)
+			}
+			return
+		}
+
+		usage, ok := s.checkQuota(w, r, token, max(r.ContentLength, 0))
+		if !ok {
+			return
+		}
+		body := &quotaBody{ReadCloser: r.Body, limit: -1}
+		if token.MaxBytes > 0 {
+			body.limit = token.MaxBytes - usage.Bytes
+		}
+		r.Body = body
+		wrapped := &quotaResponseWriter{responseWrapper: responseWrapper{ResponseWriter: w}, s: s, r: r, body: body}
+		next.ServeHTTP(wrapped, r)
+		switch {
+		case body.exceeded:
+			// Часть пакета или импорта могла быть записана до отказа
+			s.resetQuotaUsage(token)
+		case wrapped.status < http.StatusMultipleChoices:
+			s.addQuotaUsage(token, body.read)
+		}
+	})
+}
@@ -2,9 +2,13 @@ package datastore
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"sync"
 	"time"
+	"ues-lite/lexicon"
+	"unicode/utf8"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
@@ -123,42 +127,15 @@ func (rd *RemoteDatastore) GetSize(ctx context.Context, key ds.Key) (int, error)
 	return rd.client.GetSize(ctx, key)
 }
 
+// Query получает ключи префикса через ListKeys, фильтры, порядок, смещение
+// и лимит применяются на клиенте.
 func (rd *RemoteDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
-	// Конвертируем query в ListKeys запрос
 	keys, err := rd.client.ListKeys(ctx, q.Prefix, q.KeysOnly, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	// Создаем результаты в слайсе
-	var results []query.Result
-
-	for _, item := range keys {
-		if q.KeysOnly {
-			if keyStr, ok := item.(string); ok {
-				results = append(results, query.Result{
-					Entry: query.Entry{Key: keyStr},
-				})
-			}
-		} else {
-			if keyInfo, ok := item.(map[string]interface{}); ok {
-				if keyStr, ok := keyInfo["key"].(string); ok {
-					valueStr := ""
-					if val, ok := keyInfo["value"].(string); ok {
-						valueStr = val
-					}
-					results = append(results, query.Result{
-						Entry: query.Entry{
-							Key:   keyStr,
-							Value: []byte(valueStr),
-						},
-					})
-				}
-			}
-		}
-	}
-
-	return &RemoteResults{results: results, index: 0}, nil
+	return applyQuery(q, keysToResults(keys, q.KeysOnly)), nil
 }
 
 func (rd *RemoteDatastore) Batch(ctx context.Context) (ds.Batch, error) {
@@ -169,6 +146,16 @@ func (rd *RemoteDatastore) Batch(ctx context.Context) (ds.Batch, error) {
 	}, nil
 }
 
+// AtomicBatch - пакет, который сервер применяет одной транзакцией; так
+// коммитится и обычный Batch.
+func (rd *RemoteDatastore) AtomicBatch(ctx context.Context) (ConditionalBatch, error) {
+	return &RemoteBatch{
+		client: rd.client,
+		ctx:    ctx,
+		ops:    make([]BatchOperation, 0),
+	}, nil
+}
+
 func (rd *RemoteDatastore) Close() error {
 	// HTTP клиент не требует явного закрытия
 	return nil
@@ -194,16 +181,16 @@ func (rd *RemoteDatastore) CollectGarbage(ctx context.Context) error {
 	return rd.client.GC(ctx)
 }
 
-// Реализация интерфейса ds.TxnDatastore (упрощенная)
+// Реализация интерфейса ds.TxnDatastore
 
+// NewTransaction открывает транзакцию на сервере: чтения видят снимок на
+// момент начала и собственные записи, записи применяются атомарно при Commit.
 func (rd *RemoteDatastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
-	// Удаленный датастор не поддерживает настоящие транзакции
-	// Возвращаем batch как транзакцию
-	batch, err := rd.Batch(ctx)
+	id, err := rd.client.BeginTxn(ctx, readOnly, 0)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("ошибка открытия транзакции: %w", err)
 	}
-	return &RemoteTxn{batch: batch.(*RemoteBatch), readOnly: readOnly}, nil
+	return &RemoteTxn{client: rd.client, id: id, readOnly: readOnly}, nil
 }
 
 // RemoteBatch реализует ds.Batch для удаленного датастора
@@ -213,11 +200,50 @@ type RemoteBatch struct {
 	ops    []BatchOperation
 }
 
+var _ ConditionalBatch = (*RemoteBatch)(nil)
+
+// putOperation - операция записи; значения, которые не являются
+// корректным UTF-8, передаются в base64.
+func putOperation(key ds.Key, value []byte) BatchOperation {
+	op := BatchOperation{Op: "put", Key: key.String(), Value: string(value)}
+	if !utf8.Valid(value) {
+		op.Value = base64.StdEncoding.EncodeToString(value)
+		op.Encoding = "base64"
+	}
+	return op
+}
+
 func (rb *RemoteBatch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	rb.ops = append(rb.ops, putOperation(key, value))
+	return nil
+}
+
+func (rb *RemoteBatch) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	op := putOperation(key, value)
+	op.TTL = ttl
+	rb.ops = append(rb.ops, op)
+	return nil
+}
+
+func (rb *RemoteBatch) PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	op := putOperation(key, value)
+	op.IfMatch = etag
+	rb.ops = append(rb.ops, op)
+	return nil
+}
+
+func (rb *RemoteBatch) PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	op := putOperation(key, value)
+	op.IfNoneMatch = etag
+	rb.ops = append(rb.ops, op)
+	return nil
+}
+
+func (rb *RemoteBatch) DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error {
 	rb.ops = append(rb.ops, BatchOperation{
-		Op:    "put",
-		Key:   key.String(),
-		Value: string(value),
+		Op:      "delete",
+		Key:     key.String(),
+		IfMatch: etag,
 	})
 	return nil
 }
@@ -243,89 +269,107 @@ func (rb *RemoteBatch) Commit(ctx context.Context) error {
 	return err
 }
 
-// RemoteTxn реализует ds.Txn для удаленного датастора
+var _ ContentTypeTxn = (*RemoteTxn)(nil)
+
+// RemoteTxn реализует ds.Txn поверх серверной транзакции
 type RemoteTxn struct {
-	batch    *RemoteBatch
+	client   *APIClient
+	id       string
 	readOnly bool
 }
 
 func (rt *RemoteTxn) Get(ctx context.Context, key ds.Key) ([]byte, error) {
-	return rt.batch.client.Get(ctx, key)
+	return rt.client.TxnGet(ctx, rt.id, key)
 }
 
 func (rt *RemoteTxn) Put(ctx context.Context, key ds.Key, value []byte) error {
 	if rt.readOnly {
 		return fmt.Errorf("cannot put in read-only transaction")
 	}
-	return rt.batch.Put(ctx, key, value)
+	return rt.client.TxnPut(ctx, rt.id, key, value)
+}
+
+func (rt *RemoteTxn) PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error {
+	if rt.readOnly {
+		return fmt.Errorf("cannot put in read-only transaction")
+	}
+	return rt.client.TxnPutWithOptions(ctx, rt.id, key, value, opts)
 }
 
 func (rt *RemoteTxn) Delete(ctx context.Context, key ds.Key) error {
 	if rt.readOnly {
 		return fmt.Errorf("cannot delete in read-only transaction")
 	}
-	return rt.batch.Delete(ctx, key)
+	return rt.client.TxnDelete(ctx, rt.id, key)
 }
 
 func (rt *RemoteTxn) Has(ctx context.Context, key ds.Key) (bool, error) {
-	return rt.batch.client.Has(ctx, key)
+	_, err := rt.client.TxnGet(ctx, rt.id, key)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func (rt *RemoteTxn) GetSize(ctx context.Context, key ds.Key) (int, error) {
-	return rt.batch.client.GetSize(ctx, key)
+	value, err := rt.client.TxnGet(ctx, rt.id, key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
 }
 
 func (rt *RemoteTxn) Query(ctx context.Context, q query.Query) (query.Results, error) {
-	// В транзакции используем обычный запрос
-	keys, err := rt.batch.client.ListKeys(ctx, q.Prefix, q.KeysOnly, 0)
+	keys, err := rt.client.TxnListKeys(ctx, rt.id, q.Prefix, q.KeysOnly, 0)
 	if err != nil {
 		return nil, err
 	}
+	return applyQuery(q, keysToResults(keys, q.KeysOnly)), nil
+}
 
-	var results []query.Result
-	for _, item := range keys {
-		if q.KeysOnly {
-			if keyStr, ok := item.(string); ok {
-				results = append(results, query.Result{
-					Entry: query.Entry{Key: keyStr},
-				})
-			}
-		} else {
-			if keyInfo, ok := item.(map[string]interface{}); ok {
-				if keyStr, ok := keyInfo["key"].(string); ok {
-					valueStr := ""
-					if val, ok := keyInfo["value"].(string); ok {
-						valueStr = val
-					}
-					results = append(results, query.Result{
-						Entry: query.Entry{
-							Key:   keyStr,
-							Value: []byte(valueStr),
-						},
-					})
-				}
-			}
-		}
+// applyQuery применяет к ключам префикса остальные условия запроса.
+func applyQuery(q query.Query, results []query.Result) query.Results {
+	entries := make([]query.Entry, len(results))
+	for i, result := range results {
+		entries[i] = result.Entry
 	}
-
-	return &RemoteResults{results: results, index: 0}, nil
+	naive := q
+	naive.Prefix = ""
+	return query.NaiveQueryApply(naive, query.ResultsWithEntries(q, entries))
 }
 
 func (rt *RemoteTxn) Commit(ctx context.Context) error {
-	if rt.readOnly {
-		return nil
-	}
-	return rt.batch.Commit(ctx)
+	return rt.client.TxnCommit(ctx, rt.id)
 }
 
 func (rt *RemoteTxn) Discard(ctx context.Context) {
-	// Очищаем операции без коммита
-	rt.batch.ops = rt.batch.ops[:0]
+	rt.client.TxnDiscard(ctx, rt.id)
+}
+
+// keysToResults преобразует список ключей из ответа API в результаты запроса.
+func keysToResults(keys []interface{}, keysOnly bool) []query.Result {
+	var results []query.Result
+	for _, item := range keys {
+		kv, err := entryKeyValue(item)
+		if err != nil {
+			results = append(results, query.Result{Error: err})
+			continue
+		}
+		entry := query.Entry{Key: kv.Key.String()}
+		if !keysOnly {
+			entry.Value = kv.Value
+		}
+		results = append(results, query.Result{Entry: entry})
+	}
+	return results
 }
 
 // RemoteDatastoreAdapter адаптирует RemoteDatastore к полному интерфейсу Datastore
 type RemoteDatastoreAdapter struct {
 	*RemoteDatastore
+
+	eventsMu sync.Mutex
+	events   *EventStream
 }
 
 func NewRemoteDatastoreAdapter(endpoint string) (*RemoteDatastoreAdapter, error) {
@@ -347,62 +391,36 @@ func NewRemoteDatastoreAdapterWithAuth(endpoint, token string) (*RemoteDatastore
 // Реализация расширенного интерфейса Datastore
 
 func (r *RemoteDatastoreAdapter) Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error) {
-	keys, err := r.client.ListKeys(ctx, prefix.String(), keysOnly, 0)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	kvChan := make(chan KeyValue, len(keys))
-	errChan := make(chan error, 1)
-
-	go func() {
-		defer close(kvChan)
-		defer close(errChan)
-
-		for _, item := range keys {
-			if keysOnly {
-				if keyStr, ok := item.(string); ok {
-					kvChan <- KeyValue{
-						Key: ds.NewKey(keyStr),
-					}
-				}
-			} else {
-				if keyInfo, ok := item.(map[string]interface{}); ok {
-					if keyStr, ok := keyInfo["key"].(string); ok {
-						valueStr := ""
-						if val, ok := keyInfo["value"].(string); ok {
-							valueStr = val
-						}
-						kvChan <- KeyValue{
-							Key:   ds.NewKey(keyStr),
-							Value: []byte(valueStr),
-						}
-					}
-				}
-			}
-		}
-	}()
+	return r.Scan(ctx, ScanOptions{Prefix: prefix, KeysOnly: keysOnly})
+}
 
+// Scan обходит диапазон постранично по курсорам продолжения сервера.
+func (r *RemoteDatastoreAdapter) Scan(ctx context.Context, opts ScanOptions) (<-chan KeyValue, <-chan error, error) {
+	kvChan, errChan := r.client.IterateKeys(ctx, ListKeysOptions{
+		Prefix:   opts.Prefix.String(),
+		Start:    opts.Start.String(),
+		End:      opts.End.String(),
+		Reverse:  opts.Reverse,
+		KeysOnly: opts.KeysOnly,
+	})
 	return kvChan, errChan, nil
 }
 
 func (r *RemoteDatastoreAdapter) Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <-chan error, error) {
-	keys, err := r.client.ListKeys(ctx, prefix.String(), true, 0)
-	if err != nil {
-		return nil, nil, err
-	}
+	kvChan, kvErrc := r.client.IterateKeys(ctx, ListKeysOptions{Prefix: prefix.String(), KeysOnly: true})
 
-	keyChan := make(chan ds.Key, len(keys))
+	keyChan := make(chan ds.Key, defaultKeysPageSize)
 	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(keyChan)
 		defer close(errChan)
 
-		for _, item := range keys {
-			if keyStr, ok := item.(string); ok {
-				keyChan <- ds.NewKey(keyStr)
-			}
+		for kv := range kvChan {
+			keyChan <- kv.Key
+		}
+		if err := <-kvErrc; err != nil {
+			errChan <- err
 		}
 	}()
 
@@ -453,22 +471,54 @@ func (r *RemoteDatastoreAdapter) SetSilentMode(silent bool) {
 
 // Подписки и события
 
+// eventStream возвращает общее WebSocket соединение подписок; create -
+// открыть его при первой подписке.
+func (r *RemoteDatastoreAdapter) eventStream(create bool) *EventStream {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	if r.events == nil && create {
+		r.events = r.client.OpenEventStream()
+	}
+	return r.events
+}
+
+// Subscribe подписывает на события сервера через /api/v1/ws. Ошибка
+// подписки (например, нет права subscribe) не возвращается интерфейсом,
+// подписчик просто не получает событий. Подписчик с GapSubscriber узнает
+// о событиях, потерянных при переподключении.
 func (r *RemoteDatastoreAdapter) Subscribe(subscriber Subscriber) {
-	// Удаленный датастор не поддерживает локальные подписки
-	// События должны обрабатываться через WebSockets или SSE
+	spec := EventSubscription{}
+	if gs, ok := subscriber.(GapSubscriber); ok {
+		spec.OnGap = func(gap EventGap) {
+			gs.OnGap(context.Background(), gap)
+		}
+	}
+	r.eventStream(true).Subscribe(subscriber.ID(), spec, func(event WSEvent) {
+		subscriber.OnEvent(context.Background(), event.toEvent())
+	})
 }
 
 func (r *RemoteDatastoreAdapter) Unsubscribe(subscriberID string) {
-	// No-op для удаленного датастора
+	if events := r.eventStream(false); events != nil {
+		events.Unsubscribe(subscriberID)
+	}
 }
 
 func (r *RemoteDatastoreAdapter) SubscribeFunc(id string, handler EventHandler) {
-	// No-op для удаленного датастора
+	r.Subscribe(NewFuncSubscriber(id, handler))
 }
 
 func (r *RemoteDatastoreAdapter) SubscribeChannel(id string, buffer int) *ChannelSubscriber {
-	// Возвращаем пустой подписчик
-	return NewChannelSubscriber(id, buffer)
+	sub := NewChannelSubscriber(id, buffer)
+	r.Subscribe(sub)
+	return sub
+}
+
+func (r *RemoteDatastoreAdapter) Close() error {
+	if events := r.eventStream(false); events != nil {
+		events.Close()
+	}
+	return r.RemoteDatastore.Close()
 }
 
 // JS Подписки
@@ -503,30 +553,7 @@ func (r *RemoteDatastoreAdapter) RemoveJSSubscription(ctx context.Context, id st
 // JQ запросы
 
 func (r *RemoteDatastoreAdapter) QueryJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (<-chan JQResult, <-chan error, error) {
-	results, err := r.client.QueryJQ(ctx, jqQuery, opts)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	resultChan := make(chan JQResult, len(results))
-	errorChan := make(chan error, 1)
-
-	go func() {
-		defer close(resultChan)
-		defer close(errorChan)
-
-		for _, result := range results {
-			if key, ok := result["key"].(string); ok {
-				jqResult := JQResult{
-					Key:   ds.NewKey(key),
-					Value: result["value"],
-				}
-				resultChan <- jqResult
-			}
-		}
-	}()
-
-	return resultChan, errorChan, nil
+	return r.client.QueryJQ(ctx, jqQuery, opts)
 }
 
 func (r *RemoteDatastoreAdapter) AggregateJQ(ctx context.Context, jqQuery string, opts *JQQueryOptions) (interface{}, error) {
@@ -539,10 +566,65 @@ func (r *RemoteDatastoreAdapter) QueryJQSingle(ctx context.Context, key ds.Key,
 
 // Transform операции
 
-func (r *RemoteDatastoreAdapter) Transform(ctx context.Context, key ds.Key, opts *TransformOptions) (*TransformSummary, error) {
+func (r *RemoteDatastoreAdapter) Transform(ctx context.Context, prefix ds.Key, extract string, patchs []string, jqTransform string) error {
+	_, err := r.client.Transform(ctx, ds.Key{}, &TransformOptions{
+		Prefix:       prefix,
+		Extract:      extract,
+		Patches:      patchs,
+		JQ:           jqTransform,
+		IgnoreErrors: true,
+	})
+	return err
+}
+
+func (r *RemoteDatastoreAdapter) RunTransform(ctx context.Context, opts *TransformOptions) (*TransformSummary, error) {
+	var key ds.Key
+	if opts != nil {
+		key = opts.Key
+	}
 	return r.client.Transform(ctx, key, opts)
 }
 
+func (r *RemoteDatastoreAdapter) RevertTransform(ctx context.Context, journalID string) (*TransformSummary, error) {
+	return r.client.RevertTransform(ctx, journalID)
+}
+
+func (r *RemoteDatastoreAdapter) ListTransformJournals(ctx context.Context) ([]TransformJournal, error) {
+	return r.client.ListTransformJournals(ctx)
+}
+
+func (r *RemoteDatastoreAdapter) DeleteTransformJournal(ctx context.Context, journalID string) error {
+	return r.client.DeleteTransformJournal(ctx, journalID)
+}
+
+func (r *RemoteDatastoreAdapter) StartTransformJob(ctx context.Context, opts *TransformOptions, rateLimit float64) (*TransformJob, error) {
+	return r.client.StartTransformJob(ctx, opts, rateLimit)
+}
+
+func (r *RemoteDatastoreAdapter) GetTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	return r.client.GetTransformJob(ctx, id)
+}
+
+func (r *RemoteDatastoreAdapter) ListTransformJobs(ctx context.Context) ([]TransformJob, error) {
+	return r.client.ListTransformJobs(ctx)
+}
+
+func (r *RemoteDatastoreAdapter) CancelTransformJob(ctx context.Context, id string) error {
+	return r.client.CancelTransformJob(ctx, id)
+}
+
+func (r *RemoteDatastoreAdapter) ResumeTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	return r.client.ResumeTransformJob(ctx, id)
+}
+
+func (r *RemoteDatastoreAdapter) ThrottleTransformJob(ctx context.Context, id string, rateLimit float64) error {
+	return r.client.ThrottleTransformJob(ctx, id, rateLimit)
+}
+
+func (r *RemoteDatastoreAdapter) DeleteTransformJob(ctx context.Context, id string) error {
+	return r.client.DeleteTransformJob(ctx, id)
+}
+
 func (r *RemoteDatastoreAdapter) TransformWithJQ(ctx context.Context, key ds.Key, jqExpression string, opts *TransformOptions) (*TransformSummary, error) {
 	return r.client.TransformWithJQ(ctx, key, jqExpression, opts)
 }
@@ -551,6 +633,92 @@ func (r *RemoteDatastoreAdapter) TransformWithPatch(ctx context.Context, key ds.
 	return r.client.TransformWithPatch(ctx, key, patchOps, opts)
 }
 
+func (r *RemoteDatastoreAdapter) TransformWithJS(ctx context.Context, key ds.Key, script string, opts *TransformOptions) (*TransformSummary, error) {
+	return r.client.TransformWithJS(ctx, key, script, opts)
+}
+
+// Schemas
+
+func (r *RemoteDatastoreAdapter) RegisterSchema(ctx context.Context, schema KeySchema) error {
+	return r.client.RegisterSchema(ctx, schema)
+}
+
+func (r *RemoteDatastoreAdapter) RemoveSchema(ctx context.Context, name string) error {
+	return r.client.RemoveSchema(ctx, name)
+}
+
+func (r *RemoteDatastoreAdapter) ListSchemas() []KeySchema {
+	schemas, err := r.client.ListSchemas(context.Background(), ds.Key{})
+	if err != nil {
+		return nil
+	}
+	return schemas
+}
+
+func (r *RemoteDatastoreAdapter) SchemasFor(key ds.Key) []KeySchema {
+	schemas, err := r.client.ListSchemas(context.Background(), key)
+	if err != nil {
+		return nil
+	}
+	return schemas
+}
+
+func (r *RemoteDatastoreAdapter) ValidateValue(key ds.Key, value []byte) error {
+	return r.client.ValidateValue(context.Background(), key, value)
+}
+
+// SetLexiconRegistry не поддерживается удаленно: реестр lexicon подключается
+// на стороне сервера.
+func (r *RemoteDatastoreAdapter) SetLexiconRegistry(registry *lexicon.Registry) {}
+
+// Snapshots
+
+func (r *RemoteDatastoreAdapter) Snapshot(ctx context.Context, w io.Writer, sinceVersion uint64) (uint64, error) {
+	return r.client.Snapshot(ctx, w, sinceVersion)
+}
+
+func (r *RemoteDatastoreAdapter) Restore(ctx context.Context, rd io.Reader) error {
+	return r.client.Restore(ctx, rd)
+}
+
+// Export/Import
+
+func (r *RemoteDatastoreAdapter) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*TransferStats, error) {
+	return r.client.Export(ctx, w, opts)
+}
+
+func (r *RemoteDatastoreAdapter) Import(ctx context.Context, rd io.Reader, opts ImportOptions) (*TransferStats, error) {
+	return r.client.Import(ctx, rd, opts)
+}
+
+// Conditional writes
+
+func (r *RemoteDatastoreAdapter) GetWithETag(ctx context.Context, key ds.Key) ([]byte, string, error) {
+	return r.client.GetWithETag(ctx, key)
+}
+
+func (r *RemoteDatastoreAdapter) PutIfMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	return r.client.PutIfMatch(ctx, key, value, etag)
+}
+
+func (r *RemoteDatastoreAdapter) PutIfNoneMatch(ctx context.Context, key ds.Key, value []byte, etag string) error {
+	return r.client.PutIfNoneMatch(ctx, key, value, etag)
+}
+
+func (r *RemoteDatastoreAdapter) DeleteIfMatch(ctx context.Context, key ds.Key, etag string) error {
+	return r.client.DeleteIfMatch(ctx, key, etag)
+}
+
+// Content types
+
+func (r *RemoteDatastoreAdapter) PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error {
+	return r.client.PutWithOptions(ctx, key, value, opts)
+}
+
+func (r *RemoteDatastoreAdapter) GetContentType(ctx context.Context, key ds.Key) (string, error) {
+	return r.client.GetContentType(ctx, key)
+}
+
 // Views
 
 func (r *RemoteDatastoreAdapter) CreateView(ctx context.Context, config ViewConfig) (View, error) {
@@ -615,6 +783,10 @@ func (r *RemoteDatastoreAdapter) ExecuteView(ctx context.Context, id string) ([]
 	return r.client.ExecuteView(ctx, id)
 }
 
+func (r *RemoteDatastoreAdapter) ExecuteViewWithRange(ctx context.Context, id string, start, end ds.Key) ([]ViewResult, error) {
+	return r.client.ExecuteViewWithRange(ctx, id, start, end)
+}
+
 func (r *RemoteDatastoreAdapter) GetViewCached(ctx context.Context, id string) ([]ViewResult, bool, error) {
 	// Для удаленного датастора всегда выполняем запрос
 	results, err := r.client.ExecuteView(ctx, id)
@@ -634,6 +806,36 @@ func (r *RemoteDatastoreAdapter) CreateSimpleView(ctx context.Context, id, name,
 	return r.CreateView(ctx, config)
 }
 
+// Индексы
+
+func (r *RemoteDatastoreAdapter) CreateIndex(ctx context.Context, config IndexConfig) error {
+	return r.client.CreateIndex(ctx, config)
+}
+
+func (r *RemoteDatastoreAdapter) DropIndex(ctx context.Context, name string) error {
+	return r.client.DropIndex(ctx, name)
+}
+
+func (r *RemoteDatastoreAdapter) RebuildIndex(ctx context.Context, name string) error {
+	return r.client.RebuildIndex(ctx, name)
+}
+
+func (r *RemoteDatastoreAdapter) ListIndexes() []IndexConfig {
+	configs, err := r.client.ListIndexes(context.Background())
+	if err != nil {
+		return nil
+	}
+	return configs
+}
+
+func (r *RemoteDatastoreAdapter) LookupIndex(ctx context.Context, name string, value any) ([]ds.Key, error) {
+	return r.client.LookupIndex(ctx, name, value)
+}
+
+func (r *RemoteDatastoreAdapter) RangeIndex(ctx context.Context, name string, from, to any) ([]IndexEntry, error) {
+	return r.client.RangeIndex(ctx, name, from, to)
+}
+
 // TTL мониторинг
 
 func (r *RemoteDatastoreAdapter) EnableTTLMonitoring(config *TTLMonitorConfig) error {
@@ -743,8 +945,7 @@ func (rv *RemoteView) Execute(ctx context.Context) ([]ViewResult, error) {
 }
 
 func (rv *RemoteView) ExecuteWithRange(ctx context.Context, start, end ds.Key) ([]ViewResult, error) {
-	// Удаленный API не поддерживает диапазоны напрямую, выполняем обычный запрос
-	return rv.Execute(ctx)
+	return rv.client.ExecuteViewWithRange(ctx, rv.config.ID, start, end)
 }
 
 func (rv *RemoteView) Refresh(ctx context.Context) error {
@@ -807,3 +1008,63 @@ func (r *RemoteDatastoreAdapter) Sync(ctx context.Context, prefix ds.Key) error
 func (r *RemoteDatastoreAdapter) GetTTLStats(ctx context.Context, prefix ds.Key) (*TTLStats, error) {
 	return r.client.GetTTLStats(ctx, prefix)
 }
+
+func (r *RemoteDatastoreAdapter) ListTTLKeys(ctx context.Context) ([]TTLKeyStatus, error) {
+	return r.client.ListTTLKeys(ctx, ds.Key{}, 0)
+}
+
+func (r *RemoteDatastoreAdapter) GetExpiringKeys(ctx context.Context, prefix ds.Key, within time.Duration) ([]TTLKeyStatus, error) {
+	return r.client.ListTTLKeys(ctx, prefix, within)
+}
+
+func (r *RemoteDatastoreAdapter) ExtendTTL(ctx context.Context, key ds.Key, extension time.Duration) error {
+	return r.client.ExtendTTL(ctx, key, extension)
+}
+
+func (r *RemoteDatastoreAdapter) SetTTLBatch(ctx context.Context, keys []ds.Key, ttl time.Duration) error {
+	return r.client.SetTTLBatch(ctx, keys, ttl)
+}
+
+func (r *RemoteDatastoreAdapter) CleanupExpiredKeys(ctx context.Context) (int, error) {
+	return r.client.CleanupExpiredKeys(ctx)
+}
+
+func (r *RemoteDatastoreAdapter) SetTTLPolicy(ctx context.Context, policy TTLPolicy) error {
+	return r.client.SetTTLPolicy(ctx, policy)
+}
+
+func (r *RemoteDatastoreAdapter) RemoveTTLPolicy(ctx context.Context, prefix ds.Key) error {
+	return r.client.RemoveTTLPolicy(ctx, prefix)
+}
+
+func (r *RemoteDatastoreAdapter) ListTTLPolicies() []TTLPolicy {
+	policies, err := r.client.ListTTLPolicies(context.Background(), ds.Key{})
+	if err != nil {
+		return nil
+	}
+	return policies
+}
+
+func (r *RemoteDatastoreAdapter) TTLPolicyFor(key ds.Key) (TTLPolicy, bool) {
+	policies, err := r.client.ListTTLPolicies(context.Background(), key)
+	if err != nil || len(policies) == 0 {
+		return TTLPolicy{}, false
+	}
+	return policies[0], true
+}
+
+func (r *RemoteDatastoreAdapter) CreateToken(ctx context.Context, spec TokenSpec) (string, *APIToken, error) {
+	return r.client.CreateToken(ctx, spec)
+}
+
+func (r *RemoteDatastoreAdapter) ListTokens(ctx context.Context) ([]APIToken, error) {
+	return r.client.ListTokens(ctx)
+}
+
+func (r *RemoteDatastoreAdapter) RevokeToken(ctx context.Context, id string) error {
+	return r.client.RevokeToken(ctx, id)
+}
+
+func (r *RemoteDatastoreAdapter) AuthenticateToken(ctx context.Context, secret string) (*APIToken, error) {
+	return r.client.AuthenticateToken(ctx, secret)
+}
@@ -13,15 +13,16 @@ import (
 
 // RemoteDatastoreConfig конфигурация для удаленного датастора
 type RemoteDatastoreConfig struct {
-	Endpoint      string        `json:"endpoint"`
-	AuthToken     string        `json:"auth_token,omitempty"`
-	Timeout       time.Duration `json:"timeout"`
-	RetryAttempts int           `json:"retry_attempts"`
-	RetryDelay    time.Duration `json:"retry_delay"`
-	UserAgent     string        `json:"user_agent"`
-	EnableMetrics bool          `json:"enable_metrics"`
-	MaxIdleConns  int           `json:"max_idle_conns"`
-	IdleTimeout   time.Duration `json:"idle_timeout"`
+	Endpoint      string           `json:"endpoint"`
+	AuthToken     string           `json:"auth_token,omitempty"`
+	Timeout       time.Duration    `json:"timeout"`
+	RetryAttempts int              `json:"retry_attempts"`
+	RetryDelay    time.Duration    `json:"retry_delay"`
+	UserAgent     string           `json:"user_agent"`
+	EnableMetrics bool             `json:"enable_metrics"`
+	MaxIdleConns  int              `json:"max_idle_conns"`
+	IdleTimeout   time.Duration    `json:"idle_timeout"`
+	TLS           *ClientTLSConfig `json:"tls,omitempty"`
 }
 
 // DefaultRemoteDatastoreConfig возвращает конфигурацию по умолчанию
@@ -56,6 +57,12 @@ func (b *RemoteDatastoreBuilder) WithAuth(token string) *RemoteDatastoreBuilder
 	return b
 }
 
+// WithTLS задает CA сервера и клиентский сертификат для mTLS
+func (b *RemoteDatastoreBuilder) WithTLS(tlsConfig *ClientTLSConfig) *RemoteDatastoreBuilder {
+	b.config.TLS = tlsConfig
+	return b
+}
+
 // WithTimeout устанавливает таймаут
 func (b *RemoteDatastoreBuilder) WithTimeout(timeout time.Duration) *RemoteDatastoreBuilder {
 	b.config.Timeout = timeout
@@ -96,18 +103,11 @@ func (b *RemoteDatastoreBuilder) Build() (*RemoteDatastoreAdapter, error) {
 	}
 
 	// Создаем клиент
-	var client *APIClient
-	var err error
-
-	if b.config.AuthToken != "" {
-		client, err = NewAPIClientWithAuth(b.config.Endpoint, b.config.AuthToken)
-	} else {
-		client, err = NewAPIClient(b.config.Endpoint)
-	}
-
+	client, err := NewAPIClientWithTLS(b.config.Endpoint, b.config.TLS)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create API client: %w", err)
 	}
+	client.token = b.config.AuthToken
 
 	// Настраиваем клиент
 	client.client.Timeout = b.config.Timeout
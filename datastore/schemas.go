@@ -0,0 +1,809 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"ues-lite/lexicon"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// --- Key-space schemas
+
+const (
+	SchemasNamespace       = "/_system/ds-schemas"
+	maxSchemaViolations    = 50
+	schemaWildcard         = "*"
+	schemaWildcardAnyDepth = "**"
+)
+
+// KeySchema привязывает JSON Schema или lexicon ID к шаблону ключей.
+// В шаблоне * соответствует одному сегменту ключа, ** - любому числу
+// сегментов: /users/* - прямые потомки /users, /users/** - все ключи под ним.
+// Если ключу соответствует несколько схем, значение должно пройти все.
+type KeySchema struct {
+	Name      string          `json:"name"`
+	Pattern   string          `json:"pattern"`
+	Schema    json.RawMessage `json:"schema,omitempty"`
+	Lexicon   string          `json:"lexicon,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SchemaViolation - нарушение схемы; Path - JSON Pointer внутри значения.
+type SchemaViolation struct {
+	Schema  string `json:"schema"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaValidationError возвращается Put, PutWithTTL и Batch.Commit, если
+// значение не соответствует схемам ключа.
+type SchemaValidationError struct {
+	Key        ds.Key            `json:"key"`
+	Violations []SchemaViolation `json:"violations"`
+}
+
+func (e *SchemaValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return fmt.Sprintf("значение ключа %s не соответствует схеме", e.Key)
+	}
+	v := e.Violations[0]
+	msg := fmt.Sprintf("значение ключа %s не соответствует схеме %s: %s: %s", e.Key, v.Schema, pointerOrRoot(v.Path), v.Message)
+	if len(e.Violations) > 1 {
+		msg += fmt.Sprintf(" (и еще %d)", len(e.Violations)-1)
+	}
+	return msg
+}
+
+type SchemaFeatures interface {
+	RegisterSchema(ctx context.Context, schema KeySchema) error
+	RemoveSchema(ctx context.Context, name string) error
+	ListSchemas() []KeySchema
+	SchemasFor(key ds.Key) []KeySchema
+	ValidateValue(key ds.Key, value []byte) error
+	SetLexiconRegistry(registry *lexicon.Registry)
+}
+
+type keySchema struct {
+	config  KeySchema
+	pattern []string
+	root    *jsonSchema
+}
+
+type schemaRegistry struct {
+	mu       sync.RWMutex
+	schemas  map[string]*keySchema
+	lexicons *lexicon.Registry
+}
+
+func newKeySchema(config KeySchema) (*keySchema, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("имя схемы не может быть пустым")
+	}
+	if strings.Contains(config.Name, "/") {
+		return nil, fmt.Errorf("имя схемы не может содержать '/'")
+	}
+	if !strings.HasPrefix(config.Pattern, "/") {
+		return nil, fmt.Errorf("шаблон ключей должен начинаться с '/'")
+	}
+	if strings.HasPrefix(config.Pattern, "/_system") {
+		return nil, fmt.Errorf("схемы для системных ключей не поддерживаются")
+	}
+	if (len(config.Schema) == 0) == (config.Lexicon == "") {
+		return nil, fmt.Errorf("требуется ровно одно из: schema, lexicon")
+	}
+
+	ks := &keySchema{config: config, pattern: splitKeyPattern(config.Pattern)}
+	if len(config.Schema) > 0 {
+		var raw any
+		if err := json.Unmarshal(config.Schema, &raw); err != nil {
+			return nil, fmt.Errorf("некорректный JSON схемы: %w", err)
+		}
+		root, err := compileJSONSchema(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка компиляции схемы %s: %w", config.Name, err)
+		}
+		ks.root = root
+	}
+	return ks, nil
+}
+
+func splitKeyPattern(pattern string) []string {
+	trimmed := strings.Trim(pattern, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func (ks *keySchema) matches(key ds.Key) bool {
+	return matchKeyPattern(ks.pattern, splitKeyPattern(key.String()))
+}
+
+func matchKeyPattern(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if p == schemaWildcardAnyDepth {
+			rest := pattern[i+1:]
+			for j := i; j <= len(segments); j++ {
+				if matchKeyPattern(rest, segments[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(segments) || (p != schemaWildcard && p != segments[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+func (s *datastorage) schemasFor(key ds.Key) []*keySchema {
+	if strings.HasPrefix(key.String(), "/_system/") {
+		return nil
+	}
+	s.schemaReg.mu.RLock()
+	defer s.schemaReg.mu.RUnlock()
+	var out []*keySchema
+	for _, ks := range s.schemaReg.schemas {
+		if ks.matches(key) {
+			out = append(out, ks)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].config.Name < out[j].config.Name })
+	return out
+}
+
+// ValidateValue проверяет значение по всем схемам, которым соответствует
+// ключ. Возвращает *SchemaValidationError со списком нарушений.
+func (s *datastorage) ValidateValue(key ds.Key, value []byte) error {
+	schemas := s.schemasFor(key)
+	if len(schemas) == 0 {
+		return nil
+	}
+
+	var violations []SchemaViolation
+	for _, ks := range schemas {
+		violations = append(violations, s.validateWithSchema(ks, value)...)
+	}
+	if len(violations) > 0 {
+		return &SchemaValidationError{Key: key, Violations: violations}
+	}
+	return nil
+}
+
+func (s *datastorage) validateWithSchema(ks *keySchema, value []byte) []SchemaViolation {
+	name := ks.config.Name
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return []SchemaViolation{{Schema: name, Message: "значение не является корректным JSON"}}
+	}
+
+	if ks.root != nil {
+		v := &schemaValidator{schema: name}
+		v.validate(ks.root, doc, "")
+		return v.violations
+	}
+
+	s.schemaReg.mu.RLock()
+	registry := s.schemaReg.lexicons
+	s.schemaReg.mu.RUnlock()
+	if registry == nil {
+		return []SchemaViolation{{Schema: name, Message: "реестр lexicon не подключен"}}
+	}
+	if err := registry.ValidateData(ks.config.Lexicon, lexiconValue(doc)); err != nil {
+		return []SchemaViolation{{Schema: name, Message: err.Error()}}
+	}
+	return nil
+}
+
+// lexiconValue приводит числа JSON к int64/float64, как ожидает lexicon.Registry.
+func lexiconValue(v any) any {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]any:
+		for k, item := range x {
+			x[k] = lexiconValue(item)
+		}
+	case []any:
+		for i, item := range x {
+			x[i] = lexiconValue(item)
+		}
+	}
+	return v
+}
+
+// validateOps проверяет значения batch до записи.
+func (s *datastorage) validateOps(ops []batchOp) error {
+	if !s.hasSchemas() {
+		return nil
+	}
+	for _, op := range ops {
+		if op.isDelete {
+			continue
+		}
+		if err := s.ValidateValue(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *datastorage) hasSchemas() bool {
+	s.schemaReg.mu.RLock()
+	defer s.schemaReg.mu.RUnlock()
+	return len(s.schemaReg.schemas) > 0
+}
+
+// RegisterSchema создает или заменяет схему. Уже записанные значения не
+// проверяются; их соответствие видно в /keys/{key}/info. Схема с Lexicon
+// требует реестра, подключенного через SetLexiconRegistry.
+func (s *datastorage) RegisterSchema(ctx context.Context, schema KeySchema) error {
+	if schema.CreatedAt.IsZero() {
+		schema.CreatedAt = time.Now()
+	}
+	ks, err := newKeySchema(schema)
+	if err != nil {
+		return err
+	}
+	if schema.Lexicon != "" {
+		s.schemaReg.mu.RLock()
+		registry := s.schemaReg.lexicons
+		s.schemaReg.mu.RUnlock()
+		if registry == nil {
+			return fmt.Errorf("реестр lexicon не подключен, схема %s не может ссылаться на %s", schema.Name, schema.Lexicon)
+		}
+		if _, err := registry.GetSchema(schema.Lexicon); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	if err := s.Datastore.Put(ctx, ds.NewKey(SchemasNamespace).ChildString(schema.Name), data); err != nil {
+		return fmt.Errorf("ошибка сохранения схемы: %w", err)
+	}
+
+	s.schemaReg.mu.Lock()
+	s.schemaReg.schemas[schema.Name] = ks
+	s.schemaReg.mu.Unlock()
+	return nil
+}
+
+func (s *datastorage) RemoveSchema(ctx context.Context, name string) error {
+	s.schemaReg.mu.Lock()
+	defer s.schemaReg.mu.Unlock()
+	if _, ok := s.schemaReg.schemas[name]; !ok {
+		return fmt.Errorf("схема %s не найдена", name)
+	}
+	if err := s.Datastore.Delete(ctx, ds.NewKey(SchemasNamespace).ChildString(name)); err != nil {
+		return fmt.Errorf("ошибка удаления схемы: %w", err)
+	}
+	delete(s.schemaReg.schemas, name)
+	return nil
+}
+
+func (s *datastorage) ListSchemas() []KeySchema {
+	s.schemaReg.mu.RLock()
+	defer s.schemaReg.mu.RUnlock()
+	out := make([]KeySchema, 0, len(s.schemaReg.schemas))
+	for _, ks := range s.schemaReg.schemas {
+		out = append(out, ks.config)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *datastorage) SchemasFor(key ds.Key) []KeySchema {
+	schemas := s.schemasFor(key)
+	out := make([]KeySchema, len(schemas))
+	for i, ks := range schemas {
+		out[i] = ks.config
+	}
+	return out
+}
+
+// SetLexiconRegistry подключает реестр lexicon для схем с полем Lexicon.
+func (s *datastorage) SetLexiconRegistry(registry *lexicon.Registry) {
+	s.schemaReg.mu.Lock()
+	defer s.schemaReg.mu.Unlock()
+	s.schemaReg.lexicons = registry
+}
+
+func (s *datastorage) loadSchemas(ctx context.Context) error {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: SchemasNamespace})
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	s.schemaReg.mu.Lock()
+	defer s.schemaReg.mu.Unlock()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		var config KeySchema
+		if err := json.Unmarshal(res.Value, &config); err != nil {
+			log.Printf("некорректная схема %s: %v", res.Key, err)
+			continue
+		}
+		ks, err := newKeySchema(config)
+		if err != nil {
+			log.Printf("ошибка загрузки схемы %s: %v", config.Name, err)
+			continue
+		}
+		s.schemaReg.schemas[config.Name] = ks
+	}
+	return nil
+}
+
+// --- JSON Schema subset
+
+// jsonSchema - скомпилированное подмножество JSON Schema: type, enum, const,
+// properties, required, additionalProperties, items, числовые и строковые
+// ограничения, allOf/anyOf/oneOf/not и локальные $ref на $defs/definitions.
+type jsonSchema struct {
+	boolean              *bool
+	types                []string
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	items                *jsonSchema
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	multipleOf           *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minItems             *int
+	maxItems             *int
+	uniqueItems          bool
+	minProperties        *int
+	maxProperties        *int
+	allOf                []*jsonSchema
+	anyOf                []*jsonSchema
+	oneOf                []*jsonSchema
+	not                  *jsonSchema
+	ref                  *jsonSchema
+}
+
+type schemaCompiler struct {
+	defs map[string]*jsonSchema
+}
+
+func compileJSONSchema(raw any) (*jsonSchema, error) {
+	c := &schemaCompiler{defs: make(map[string]*jsonSchema)}
+	if obj, ok := raw.(map[string]any); ok {
+		// Определения создаются заранее, чтобы $ref мог ссылаться рекурсивно.
+		for _, section := range []string{"$defs", "definitions"} {
+			defs, _ := obj[section].(map[string]any)
+			for name := range defs {
+				c.defs["#/"+section+"/"+name] = &jsonSchema{}
+			}
+		}
+		for _, section := range []string{"$defs", "definitions"} {
+			defs, _ := obj[section].(map[string]any)
+			for name, def := range defs {
+				compiled, err := c.compile(def)
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s: %w", section, name, err)
+				}
+				*c.defs["#/"+section+"/"+name] = *compiled
+			}
+		}
+	}
+	return c.compile(raw)
+}
+
+func (c *schemaCompiler) compile(raw any) (*jsonSchema, error) {
+	if b, ok := raw.(bool); ok {
+		return &jsonSchema{boolean: &b}, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("схема должна быть объектом или boolean")
+	}
+
+	sc := &jsonSchema{}
+	var err error
+
+	if ref, ok := obj["$ref"].(string); ok {
+		if ref == "#" {
+			return nil, fmt.Errorf("рекурсивный $ref на корень не поддерживается")
+		}
+		target, ok := c.defs[ref]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный $ref: %s", ref)
+		}
+		sc.ref = target
+	}
+
+	switch t := obj["type"].(type) {
+	case string:
+		sc.types = []string{t}
+	case []any:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("type должен быть строкой или массивом строк")
+			}
+			sc.types = append(sc.types, name)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("type должен быть строкой или массивом строк")
+	}
+	for _, t := range sc.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("неизвестный type: %s", t)
+		}
+	}
+
+	if enum, ok := obj["enum"].([]any); ok {
+		sc.enum = enum
+	}
+	if v, ok := obj["const"]; ok {
+		sc.constValue, sc.hasConst = v, true
+	}
+
+	if props, ok := obj["properties"].(map[string]any); ok {
+		sc.properties = make(map[string]*jsonSchema, len(props))
+		for name, prop := range props {
+			if sc.properties[name], err = c.compile(prop); err != nil {
+				return nil, fmt.Errorf("properties/%s: %w", name, err)
+			}
+		}
+	}
+	if required, ok := obj["required"].([]any); ok {
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("required должен быть массивом строк")
+			}
+			sc.required = append(sc.required, name)
+		}
+	}
+	if ap, ok := obj["additionalProperties"]; ok {
+		if sc.additionalProperties, err = c.compile(ap); err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+	}
+	if items, ok := obj["items"]; ok {
+		if sc.items, err = c.compile(items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+
+	sc.minimum = schemaFloat(obj, "minimum")
+	sc.maximum = schemaFloat(obj, "maximum")
+	sc.exclusiveMinimum = schemaFloat(obj, "exclusiveMinimum")
+	sc.exclusiveMaximum = schemaFloat(obj, "exclusiveMaximum")
+	sc.multipleOf = schemaFloat(obj, "multipleOf")
+	sc.minLength = schemaInt(obj, "minLength")
+	sc.maxLength = schemaInt(obj, "maxLength")
+	sc.minItems = schemaInt(obj, "minItems")
+	sc.maxItems = schemaInt(obj, "maxItems")
+	sc.minProperties = schemaInt(obj, "minProperties")
+	sc.maxProperties = schemaInt(obj, "maxProperties")
+	sc.uniqueItems, _ = obj["uniqueItems"].(bool)
+
+	if pattern, ok := obj["pattern"].(string); ok {
+		if sc.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+	}
+
+	for keyword, target := range map[string]*[]*jsonSchema{"allOf": &sc.allOf, "anyOf": &sc.anyOf, "oneOf": &sc.oneOf} {
+		list, ok := obj[keyword].([]any)
+		if !ok {
+			continue
+		}
+		for i, item := range list {
+			compiled, err := c.compile(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%d: %w", keyword, i, err)
+			}
+			*target = append(*target, compiled)
+		}
+	}
+	if not, ok := obj["not"]; ok {
+		if sc.not, err = c.compile(not); err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+	}
+
+	return sc, nil
+}
+
+func schemaFloat(obj map[string]any, name string) *float64 {
+	if v, ok := obj[name].(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+func schemaInt(obj map[string]any, name string) *int {
+	if v, ok := obj[name].(float64); ok {
+		i := int(v)
+		return &i
+	}
+	return nil
+}
+
+type schemaValidator struct {
+	schema     string
+	violations []SchemaViolation
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	if len(v.violations) < maxSchemaViolations {
+		v.violations = append(v.violations, SchemaViolation{Schema: v.schema, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// valid проверяет значение без сбора нарушений (для anyOf/oneOf/not).
+func (sc *jsonSchema) valid(value any) bool {
+	v := &schemaValidator{}
+	v.validate(sc, value, "")
+	return len(v.violations) == 0
+}
+
+func (v *schemaValidator) validate(sc *jsonSchema, value any, path string) {
+	if sc.boolean != nil {
+		if !*sc.boolean {
+			v.fail(path, "значение запрещено схемой")
+		}
+		return
+	}
+	if sc.ref != nil {
+		v.validate(sc.ref, value, path)
+	}
+
+	if len(sc.types) > 0 {
+		actual := jsonTypeOf(value)
+		ok := false
+		for _, t := range sc.types {
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			v.fail(path, "ожидается %s, получено %s", strings.Join(sc.types, " или "), actual)
+			return
+		}
+	}
+
+	if sc.enum != nil {
+		found := false
+		for _, item := range sc.enum {
+			if jsonEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "значение не входит в enum")
+		}
+	}
+	if sc.hasConst && !jsonEqual(sc.constValue, value) {
+		v.fail(path, "значение не равно const")
+	}
+
+	switch x := value.(type) {
+	case map[string]any:
+		v.validateObject(sc, x, path)
+	case []any:
+		v.validateArray(sc, x, path)
+	case string:
+		length := len([]rune(x))
+		if sc.minLength != nil && length < *sc.minLength {
+			v.fail(path, "длина строки меньше %d", *sc.minLength)
+		}
+		if sc.maxLength != nil && length > *sc.maxLength {
+			v.fail(path, "длина строки больше %d", *sc.maxLength)
+		}
+		if sc.pattern != nil && !sc.pattern.MatchString(x) {
+			v.fail(path, "строка не соответствует pattern %s", sc.pattern)
+		}
+	case json.Number:
+		v.validateNumber(sc, x, path)
+	}
+
+	for _, sub := range sc.allOf {
+		v.validate(sub, value, path)
+	}
+	if len(sc.anyOf) > 0 {
+		ok := false
+		for _, sub := range sc.anyOf {
+			if sub.valid(value) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			v.fail(path, "значение не соответствует ни одной схеме anyOf")
+		}
+	}
+	if len(sc.oneOf) > 0 {
+		matched := 0
+		for _, sub := range sc.oneOf {
+			if sub.valid(value) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "значение должно соответствовать ровно одной схеме oneOf, соответствует %d", matched)
+		}
+	}
+	if sc.not != nil && sc.not.valid(value) {
+		v.fail(path, "значение соответствует схеме not")
+	}
+}
+
+func (v *schemaValidator) validateObject(sc *jsonSchema, obj map[string]any, path string) {
+	for _, name := range sc.required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path+"/"+escapePointer(name), "обязательное поле отсутствует")
+		}
+	}
+	if sc.minProperties != nil && len(obj) < *sc.minProperties {
+		v.fail(path, "полей меньше %d", *sc.minProperties)
+	}
+	if sc.maxProperties != nil && len(obj) > *sc.maxProperties {
+		v.fail(path, "полей больше %d", *sc.maxProperties)
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fieldPath := path + "/" + escapePointer(name)
+		if prop, ok := sc.properties[name]; ok {
+			v.validate(prop, obj[name], fieldPath)
+		} else if sc.additionalProperties != nil {
+			if sc.additionalProperties.boolean != nil && !*sc.additionalProperties.boolean {
+				v.fail(fieldPath, "дополнительное поле не разрешено")
+			} else {
+				v.validate(sc.additionalProperties, obj[name], fieldPath)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(sc *jsonSchema, arr []any, path string) {
+	if sc.minItems != nil && len(arr) < *sc.minItems {
+		v.fail(path, "элементов меньше %d", *sc.minItems)
+	}
+	if sc.maxItems != nil && len(arr) > *sc.maxItems {
+		v.fail(path, "элементов больше %d", *sc.maxItems)
+	}
+	if sc.items != nil {
+		for i, item := range arr {
+			v.validate(sc.items, item, path+"/"+strconv.Itoa(i))
+		}
+	}
+	if sc.uniqueItems {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.fail(path+"/"+strconv.Itoa(j), "элемент повторяет элемент %d", i)
+				}
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(sc *jsonSchema, n json.Number, path string) {
+	f, err := n.Float64()
+	if err != nil {
+		v.fail(path, "некорректное число")
+		return
+	}
+	if sc.minimum != nil && f < *sc.minimum {
+		v.fail(path, "значение меньше %v", *sc.minimum)
+	}
+	if sc.maximum != nil && f > *sc.maximum {
+		v.fail(path, "значение больше %v", *sc.maximum)
+	}
+	if sc.exclusiveMinimum != nil && f <= *sc.exclusiveMinimum {
+		v.fail(path, "значение должно быть больше %v", *sc.exclusiveMinimum)
+	}
+	if sc.exclusiveMaximum != nil && f >= *sc.exclusiveMaximum {
+		v.fail(path, "значение должно быть меньше %v", *sc.exclusiveMaximum)
+	}
+	if sc.multipleOf != nil && *sc.multipleOf > 0 {
+		if q := f / *sc.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "значение не кратно %v", *sc.multipleOf)
+		}
+	}
+}
+
+func jsonTypeOf(value any) string {
+	switch x := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := x.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual сравнивает JSON-значения; числа сравниваются по значению.
+func jsonEqual(a, b any) bool {
+	if fa, ok := jsonFloat(a); ok {
+		fb, ok := jsonFloat(b)
+		return ok && fa == fb
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func jsonFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+func pointerOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+// --- Snapshots
+
+// restoreMaxPendingWrites - число незавершенных записей badger при Restore.
+const restoreMaxPendingWrites = 256
+
+// SnapshotFeatures - резервные копии в формате badger backup. В отличие от
+// экспорта в JSONL, снимок сохраняет TTL, бинарные значения и служебные
+// ключи (индексы, схемы, политики TTL, view и подписки).
+type SnapshotFeatures interface {
+	// Snapshot пишет в w записи, измененные после версии sinceVersion
+	// (0 - полный снимок), включая удаления. Возвращает версию, которую
+	// нужно передать следующему вызову для инкрементального снимка.
+	Snapshot(ctx context.Context, w io.Writer, sinceVersion uint64) (uint64, error)
+	// Restore загружает снимок, созданный Snapshot. Инкрементальные снимки
+	// применяются по порядку поверх полного. Загружать снимок следует в
+	// пустое хранилище: записи сохраняют версии из снимка, и существующие
+	// значения тех же ключей могут оказаться новее восстановленных.
+	Restore(ctx context.Context, r io.Reader) error
+}
+
+func (s *datastorage) Snapshot(ctx context.Context, w io.Writer, sinceVersion uint64) (uint64, error) {
+	stream := s.Datastore.DB.NewStream()
+	stream.LogPrefix = "ues-ds.Snapshot"
+	stream.SinceTs = sinceVersion
+	last, err := stream.Backup(ctxWriter{ctx: ctx, w: w}, sinceVersion)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания снимка: %w", err)
+	}
+	// Итератор badger отбирает версии строго больше SinceTs, поэтому
+	// следующему снимку передается последняя записанная версия.
+	return max(last, sinceVersion), nil
+}
+
+// ctxWriter прерывает Backup при отмене контекста: badger не принимает
+// контекст, но останавливает поток при ошибке записи.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// Restore не должен выполняться одновременно с записью в хранилище: badger
+// загружает снимок в обход транзакций.
+func (s *datastorage) Restore(ctx context.Context, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Datastore.DB.Load(r, restoreMaxPendingWrites); err != nil {
+		return fmt.Errorf("ошибка восстановления снимка: %w", err)
+	}
+	s.reloadRegistries(ctx)
+	s.wakeTTLMonitor()
+	return nil
+}
+
+// reloadRegistries перечитывает конфигурацию, восстановленную вместе со
+// служебными ключами. Задания трансформации не перезапускаются.
+func (s *datastorage) reloadRegistries(ctx context.Context) {
+	if err := s.loadJSSubscriptions(ctx); err != nil {
+		log.Printf("ошибка загрузки JS подписок: %v", err)
+	}
+	if err := s.loadIndexes(ctx); err != nil {
+		log.Printf("ошибка загрузки индексов: %v", err)
+	}
+	if err := s.loadSchemas(ctx); err != nil {
+		log.Printf("ошибка загрузки схем: %v", err)
+	}
+	if err := s.loadTTLPolicies(ctx); err != nil {
+		log.Printf("ошибка загрузки политик TTL: %v", err)
+	}
+	if err := s.viewManager.LoadViewConfigs(ctx); err != nil {
+		log.Printf("ошибка загрузки views: %v", err)
+	}
+	if err := s.viewManager.RefreshAllViews(ctx); err != nil {
+		log.Printf("ошибка обновления views: %v", err)
+	}
+}
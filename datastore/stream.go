@@ -0,0 +1,411 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/itchyny/gojq"
+)
+
+// --- Streaming
+
+type StreamFormat string
+
+const (
+	StreamFormatJSON   StreamFormat = "json"   // массив записей
+	StreamFormatJSONL  StreamFormat = "jsonl"  // запись на строку
+	StreamFormatCSV    StreamFormat = "csv"    // key,value
+	StreamFormatSSE    StreamFormat = "sse"    // data: <запись>
+	StreamFormatBinary StreamFormat = "binary" // длина и байты ключа, длина и байты значения
+	StreamFormatXML    StreamFormat = "xml"
+	StreamFormatYAML   StreamFormat = "yaml"
+)
+
+// StreamOptions - параметры выгрузки. Запись - значение ключа (JSON или
+// строка), с IncludeKeys - объект {key, value}. JQFilter применяется к
+// значению с $key; TreatAsString и IgnoreErrors - как TreatAsString и
+// IgnoreParseError в JQQueryOptions.
+type StreamOptions struct {
+	Format        StreamFormat
+	Prefix        ds.Key
+	JQFilter      string
+	IncludeKeys   bool
+	Limit         int
+	BufferSize    int
+	TreatAsString bool
+	IgnoreErrors  bool
+	Timeout       time.Duration
+	// Headers - дополнительные заголовки ответа для SSE
+	Headers map[string]string
+}
+
+// StreamFeatures - выгрузка ключей и событий в форматах HTTP API.
+type StreamFeatures interface {
+	StreamTo(ctx context.Context, w io.Writer, opts *StreamOptions) error
+	// StreamEvents пишет события датастора в формате SSE до отмены ctx.
+	StreamEvents(ctx context.Context, w io.Writer, opts *StreamOptions) error
+	StreamJSON(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error
+	StreamJSONL(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error
+	StreamCSV(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error
+	StreamSSE(ctx context.Context, w io.Writer, headers map[string]string) error
+}
+
+var _ StreamFeatures = (*datastorage)(nil)
+
+// StreamPipeline - выгрузка с заранее заданными параметрами.
+type StreamPipeline struct {
+	opts *StreamOptions
+}
+
+// Run выполняет выгрузку на датасторе store.
+func (p *StreamPipeline) Run(ctx context.Context, store StreamFeatures, w io.Writer) error {
+	return store.StreamTo(ctx, w, p.opts)
+}
+
+func (s *datastorage) StreamTo(ctx context.Context, w io.Writer, opts *StreamOptions) error {
+	if opts == nil {
+		opts = DefaultStreamOptions()
+	}
+	prefix := opts.Prefix
+	if prefix.String() == "" {
+		prefix = ds.NewKey("/")
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	sw, err := newStreamWriter(w, opts.Format)
+	if err != nil {
+		return err
+	}
+
+	var code *gojq.Code
+	if opts.JQFilter != "" {
+		query, err := gojq.Parse(opts.JQFilter)
+		if err != nil {
+			return fmt.Errorf("ошибка парсинга jq-запроса: %w", err)
+		}
+		if code, err = gojq.Compile(query, gojq.WithVariables([]string{"$key"})); err != nil {
+			return fmt.Errorf("ошибка компиляции jq-запроса: %w", err)
+		}
+	}
+
+	iterCtx, stop := context.WithCancel(ctx)
+	in, errc, err := s.Iterator(iterCtx, prefix, false)
+	if err != nil {
+		stop()
+		return err
+	}
+	// Iterator блокируется на отправке, пока канал не дочитан
+	defer func() {
+		stop()
+		for range in {
+		}
+	}()
+	count := 0
+	for kv := range in {
+		if strings.HasPrefix(kv.Key.String(), "/_system/") {
+			continue
+		}
+		if code == nil {
+			if opts.Limit > 0 && count >= opts.Limit {
+				break
+			}
+			// binary отдает значение без преобразования
+			if sw.format == StreamFormatBinary {
+				err = sw.writeRaw(kv.Key, kv.Value)
+			} else {
+				err = sw.write(kv.Key, streamValue(kv.Value), opts.IncludeKeys)
+			}
+			if err != nil {
+				return err
+			}
+			count++
+			continue
+		}
+
+		var input any
+		if err := json.Unmarshal(kv.Value, &input); err != nil {
+			switch {
+			case opts.TreatAsString:
+				input = string(kv.Value)
+			case opts.IgnoreErrors:
+				continue
+			default:
+				return fmt.Errorf("значение ключа %s не является JSON: %w", kv.Key, err)
+			}
+		}
+		results := code.RunWithContext(ctx, input, kv.Key.String())
+		for {
+			v, ok := results.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				if opts.IgnoreErrors {
+					continue
+				}
+				return fmt.Errorf("ошибка jq для ключа %s: %w", kv.Key, err)
+			}
+			// null - ключ отфильтрован
+			if v == nil {
+				continue
+			}
+			if opts.Limit > 0 && count >= opts.Limit {
+				break
+			}
+			if err := sw.write(kv.Key, v, opts.IncludeKeys); err != nil {
+				return err
+			}
+			count++
+		}
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+	}
+	stop()
+	for range in {
+	}
+	if err := <-errc; err != nil && err != context.Canceled {
+		return err
+	}
+	return sw.close()
+}
+
+func (s *datastorage) StreamJSON(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error {
+	return s.StreamTo(ctx, w, &StreamOptions{Format: StreamFormatJSON, Prefix: prefix, IncludeKeys: includeKeys})
+}
+
+func (s *datastorage) StreamJSONL(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error {
+	return s.StreamTo(ctx, w, &StreamOptions{Format: StreamFormatJSONL, Prefix: prefix, IncludeKeys: includeKeys})
+}
+
+func (s *datastorage) StreamCSV(ctx context.Context, w io.Writer, prefix ds.Key, includeKeys bool) error {
+	return s.StreamTo(ctx, w, &StreamOptions{Format: StreamFormatCSV, Prefix: prefix, IncludeKeys: includeKeys})
+}
+
+// StreamSSE пишет события в ответ HTTP с заголовками SSE и headers.
+func (s *datastorage) StreamSSE(ctx context.Context, w io.Writer, headers map[string]string) error {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+		for name, value := range headers {
+			rw.Header().Set(name, value)
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+	return s.StreamEvents(ctx, w, &StreamOptions{Format: StreamFormatSSE})
+}
+
+// StreamEvents пишет события под opts.Prefix; при переполнении буфера
+// подписки события пропускаются, как и у ChannelSubscriber.
+func (s *datastorage) StreamEvents(ctx context.Context, w io.Writer, opts *StreamOptions) error {
+	buffer := 100
+	prefix := ""
+	if opts != nil {
+		if opts.BufferSize > 0 {
+			buffer = opts.BufferSize
+		}
+		if opts.Prefix.String() != "" && opts.Prefix.String() != "/" {
+			prefix = opts.Prefix.String()
+		}
+	}
+
+	sub := NewChannelSubscriber(fmt.Sprintf("stream-events-%d", time.Now().UnixNano()), buffer)
+	s.Subscribe(sub)
+	defer s.Unsubscribe(sub.ID())
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-sub.Events():
+			if prefix != "" && !event.Key.Equal(ds.NewKey(prefix)) && !event.Key.IsDescendantOf(ds.NewKey(prefix)) {
+				continue
+			}
+			data, err := json.Marshal(map[string]any{
+				"type":      EventTypeToString(event.Type),
+				"key":       event.Key.String(),
+				"value":     streamValue(event.Value),
+				"timestamp": event.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", EventTypeToString(event.Type), data); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// streamValue - значение записи: JSON как есть, иначе строка.
+func streamValue(value []byte) any {
+	if value == nil {
+		return nil
+	}
+	if json.Valid(value) {
+		return json.RawMessage(value)
+	}
+	return string(value)
+}
+
+// streamWriter кодирует записи выгрузки в заданном формате.
+type streamWriter struct {
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	format  StreamFormat
+	flusher http.Flusher
+	count   int
+}
+
+type streamXMLItem struct {
+	XMLName xml.Name `xml:"item"`
+	Key     string   `xml:"key,attr,omitempty"`
+	Value   string   `xml:",chardata"`
+}
+
+func newStreamWriter(w io.Writer, format StreamFormat) (*streamWriter, error) {
+	if format == "" {
+		format = StreamFormatJSON
+	}
+	sw := &streamWriter{buf: bufio.NewWriter(w), format: format}
+	sw.flusher, _ = w.(http.Flusher)
+
+	var err error
+	switch format {
+	case StreamFormatJSON:
+		_, err = sw.buf.WriteString("[")
+	case StreamFormatCSV:
+		sw.csv = csv.NewWriter(sw.buf)
+		err = sw.csv.Write([]string{"key", "value"})
+	case StreamFormatXML:
+		_, err = sw.buf.WriteString(xml.Header + "<items>\n")
+	case StreamFormatJSONL, StreamFormatSSE, StreamFormatBinary, StreamFormatYAML:
+	default:
+		return nil, fmt.Errorf("неизвестный формат стрима: %s", format)
+	}
+	return sw, err
+}
+
+func (sw *streamWriter) write(key ds.Key, value any, includeKeys bool) error {
+	defer func() { sw.count++ }()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации значения %s: %w", key, err)
+	}
+	// CSV, XML и binary хранят строковое значение без кавычек JSON
+	text := string(data)
+	if str, ok := value.(string); ok {
+		text = str
+	}
+
+	record := data
+	if includeKeys {
+		record, err = json.Marshal(map[string]any{"key": key.String(), "value": value})
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации записи %s: %w", key, err)
+		}
+	}
+
+	switch sw.format {
+	case StreamFormatJSON:
+		if sw.count > 0 {
+			if err := sw.buf.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		_, err = sw.buf.Write(record)
+	case StreamFormatJSONL:
+		_, err = fmt.Fprintf(sw.buf, "%s\n", record)
+	case StreamFormatYAML:
+		// JSON - корректный поток YAML
+		_, err = fmt.Fprintf(sw.buf, "- %s\n", record)
+	case StreamFormatSSE:
+		_, err = fmt.Fprintf(sw.buf, "data: %s\n\n", record)
+	case StreamFormatCSV:
+		err = sw.csv.Write([]string{key.String(), text})
+	case StreamFormatXML:
+		item := streamXMLItem{Value: text}
+		if includeKeys {
+			item.Key = key.String()
+		}
+		var out []byte
+		if out, err = xml.Marshal(item); err == nil {
+			_, err = fmt.Fprintf(sw.buf, "%s\n", out)
+		}
+	case StreamFormatBinary:
+		err = sw.writeFrame([]byte(key.String()))
+		if err == nil {
+			err = sw.writeFrame([]byte(text))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Потоковые форматы отдаются клиенту по мере записи
+	if sw.flusher != nil && (sw.format == StreamFormatSSE || sw.format == StreamFormatJSONL) {
+		if err := sw.buf.Flush(); err != nil {
+			return err
+		}
+		sw.flusher.Flush()
+	}
+	return nil
+}
+
+// writeRaw пишет кадры binary с байтами значения как есть.
+func (sw *streamWriter) writeRaw(key ds.Key, value []byte) error {
+	sw.count++
+	if err := sw.writeFrame([]byte(key.String())); err != nil {
+		return err
+	}
+	return sw.writeFrame(value)
+}
+
+func (sw *streamWriter) writeFrame(data []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := sw.buf.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := sw.buf.Write(data)
+	return err
+}
+
+func (sw *streamWriter) close() error {
+	switch sw.format {
+	case StreamFormatJSON:
+		if _, err := sw.buf.WriteString("]\n"); err != nil {
+			return err
+		}
+	case StreamFormatCSV:
+		sw.csv.Flush()
+		if err := sw.csv.Error(); err != nil {
+			return err
+		}
+	case StreamFormatXML:
+		if _, err := sw.buf.WriteString("</items>\n"); err != nil {
+			return err
+		}
+	}
+	return sw.buf.Flush()
+}
@@ -0,0 +1,292 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// --- API tokens
+
+const TokensNamespace = "/_system/ds-tokens"
+
+// TokenPermission - право токена на ключи под префиксом области.
+type TokenPermission string
+
+const (
+	PermissionRead      TokenPermission = "read"
+	PermissionWrite     TokenPermission = "write"
+	PermissionSubscribe TokenPermission = "subscribe"
+	// PermissionAdmin включает остальные права под префиксом; admin на "/"
+	// дает доступ к системным операциям (clear, gc, снимки, токены).
+	PermissionAdmin TokenPermission = "admin"
+)
+
+var (
+	ErrTokenInvalid = errors.New("недействительный токен")
+	ErrTokenExpired = errors.New("срок действия токена истек")
+	ErrTokenRevoked = errors.New("токен отозван")
+)
+
+// TokenScope ограничивает право префиксом ключей.
+type TokenScope struct {
+	Permission TokenPermission `json:"permission"`
+	Prefix     string          `json:"prefix"`
+}
+
+// APIToken - именованный токен доступа. Секрет не хранится, только его
+// SHA-256. MaxKeys и MaxBytes ограничивают данные под префиксами с правом
+// записи (0 - без ограничения).
+type APIToken struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Scopes    []TokenScope `json:"scopes"`
+	MaxKeys   int64        `json:"max_keys,omitempty"`
+	MaxBytes  int64        `json:"max_bytes,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	RevokedAt *time.Time   `json:"revoked_at,omitempty"`
+	Hash      string       `json:"hash,omitempty"`
+}
+
+// TokenSpec - параметры нового токена; TTL 0 - бессрочный.
+type TokenSpec struct {
+	Name     string        `json:"name"`
+	Scopes   []TokenScope  `json:"scopes"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	MaxKeys  int64         `json:"max_keys,omitempty"`
+	MaxBytes int64         `json:"max_bytes,omitempty"`
+}
+
+type TokenFeatures interface {
+	// CreateToken возвращает секрет токена; он показывается только один раз.
+	CreateToken(ctx context.Context, spec TokenSpec) (string, *APIToken, error)
+	ListTokens(ctx context.Context) ([]APIToken, error)
+	RevokeToken(ctx context.Context, id string) error
+	AuthenticateToken(ctx context.Context, secret string) (*APIToken, error)
+}
+
+func tokenKey(id string) ds.Key {
+	return ds.NewKey(TokensNamespace).ChildString(id)
+}
+
+// ParseTokenScope разбирает область в формате "permission:/prefix"; без
+// префикса область распространяется на все ключи.
+func ParseTokenScope(s string) (TokenScope, error) {
+	permission, prefix, _ := strings.Cut(s, ":")
+	scope := TokenScope{Permission: TokenPermission(permission), Prefix: prefix}
+	if err := validateTokenScope(&scope); err != nil {
+		return TokenScope{}, err
+	}
+	return scope, nil
+}
+
+func validateTokenScope(scope *TokenScope) error {
+	switch scope.Permission {
+	case PermissionRead, PermissionWrite, PermissionSubscribe, PermissionAdmin:
+	default:
+		return fmt.Errorf("неизвестное право: %q", scope.Permission)
+	}
+	if scope.Prefix == "" {
+		scope.Prefix = "/"
+	}
+	if !strings.HasPrefix(scope.Prefix, "/") {
+		return fmt.Errorf("префикс области должен начинаться с '/'")
+	}
+	scope.Prefix = ds.NewKey(scope.Prefix).String()
+	return nil
+}
+
+// Allows проверяет право на ключ. Системные ключи доступны только admin.
+func (t *APIToken) Allows(permission TokenPermission, key ds.Key) bool {
+	system := strings.HasPrefix(key.String(), "/_system")
+	for _, scope := range t.Scopes {
+		if scope.Permission != permission && scope.Permission != PermissionAdmin {
+			continue
+		}
+		if system && scope.Permission != PermissionAdmin {
+			continue
+		}
+		prefix := ds.NewKey(scope.Prefix)
+		if prefix.String() == "/" || prefix.Equal(key) || prefix.IsAncestorOf(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAny проверяет, есть ли у токена право хотя бы на один префикс.
+func (t *APIToken) AllowsAny(permission TokenPermission) bool {
+	for _, scope := range t.Scopes {
+		if scope.Permission == permission || scope.Permission == PermissionAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Active сообщает, что токен не отозван и не истек.
+func (t *APIToken) Active() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *datastorage) CreateToken(ctx context.Context, spec TokenSpec) (string, *APIToken, error) {
+	if spec.Name == "" {
+		return "", nil, fmt.Errorf("требуется имя токена")
+	}
+	if len(spec.Scopes) == 0 {
+		return "", nil, fmt.Errorf("требуется хотя бы одна область")
+	}
+	if spec.TTL < 0 {
+		return "", nil, fmt.Errorf("TTL токена не может быть отрицательным")
+	}
+	if spec.MaxKeys < 0 || spec.MaxBytes < 0 {
+		return "", nil, fmt.Errorf("квоты токена не могут быть отрицательными")
+	}
+	scopes := make([]TokenScope, len(spec.Scopes))
+	for i, scope := range spec.Scopes {
+		if err := validateTokenScope(&scope); err != nil {
+			return "", nil, err
+		}
+		scopes[i] = scope
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	// Идентификатор в секрете позволяет найти запись без перебора
+	secret := id + "." + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	token := &APIToken{
+		ID:        id,
+		Name:      spec.Name,
+		Scopes:    scopes,
+		MaxKeys:   spec.MaxKeys,
+		MaxBytes:  spec.MaxBytes,
+		CreatedAt: time.Now(),
+		Hash:      hashTokenSecret(secret),
+	}
+	if spec.TTL > 0 {
+		expiresAt := token.CreatedAt.Add(spec.TTL)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.saveToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+
+	token.Hash = ""
+	return secret, token, nil
+}
+
+func (s *datastorage) saveToken(ctx context.Context, token *APIToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := s.Datastore.Put(ctx, tokenKey(token.ID), data); err != nil {
+		return fmt.Errorf("ошибка сохранения токена: %w", err)
+	}
+	return nil
+}
+
+func (s *datastorage) getToken(ctx context.Context, id string) (*APIToken, error) {
+	data, err := s.Datastore.Get(ctx, tokenKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var token APIToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("ошибка чтения токена %s: %w", id, err)
+	}
+	return &token, nil
+}
+
+func (s *datastorage) ListTokens(ctx context.Context) ([]APIToken, error) {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: TokensNamespace})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	tokens := []APIToken{}
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		var token APIToken
+		if err := json.Unmarshal(result.Value, &token); err != nil {
+			continue
+		}
+		token.Hash = ""
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (s *datastorage) RevokeToken(ctx context.Context, id string) error {
+	token, err := s.getToken(ctx, id)
+	if err != nil {
+		if errors.Is(err, ds.ErrNotFound) {
+			return fmt.Errorf("токен %s не найден", id)
+		}
+		return err
+	}
+	if token.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	return s.saveToken(ctx, token)
+}
+
+func (s *datastorage) AuthenticateToken(ctx context.Context, secret string) (*APIToken, error) {
+	id, _, ok := strings.Cut(secret, ".")
+	if !ok || id == "" {
+		return nil, ErrTokenInvalid
+	}
+	token, err := s.getToken(ctx, id)
+	if err != nil {
+		if errors.Is(err, ds.ErrNotFound) {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashTokenSecret(secret))) != 1 {
+		return nil, ErrTokenInvalid
+	}
+	if token.RevokedAt != nil {
+		return nil, ErrTokenRevoked
+	}
+	if !token.Active() {
+		return nil, ErrTokenExpired
+	}
+	token.Hash = ""
+	return token, nil
+}
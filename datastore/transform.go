@@ -0,0 +1,773 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"ues-lite/js"
+	"ues-lite/tid"
+
+	"github.com/dop251/goja"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/tidwall/sjson"
+)
+
+// --- Transform with dry-run and journal
+
+const (
+	TransformJournalNamespace     = "/_system/ds-transform-journal"
+	TransformJournalDataNamespace = "/_system/ds-transform-journal-data"
+	DefaultTransformMaxChanges    = 100
+	maxTransformFailures          = 100
+)
+
+// TransformOptions описывает трансформацию значений под префиксом (или одного
+// ключа Key). Порядок применения: JQ, либо Extract -> Patches -> PatchOps.
+// Script (тело JS-функции) используется вместо остальных способов.
+type TransformOptions struct {
+	Prefix       ds.Key        `json:"prefix,omitempty"`
+	Key          ds.Key        `json:"key,omitempty"`
+	Extract      string        `json:"extract,omitempty"`
+	Patches      []string      `json:"patches,omitempty"`
+	PatchOps     []PatchOp     `json:"patch_ops,omitempty"`
+	JQ           string        `json:"jq,omitempty"`
+	Script       string        `json:"script,omitempty"`
+	DryRun       bool          `json:"dry_run,omitempty"`
+	IgnoreErrors bool          `json:"ignore_errors,omitempty"`
+	NoJournal    bool          `json:"no_journal,omitempty"`
+	MaxChanges   int           `json:"max_changes,omitempty"` // число diff в ответе dry-run
+	BatchSize    int           `json:"batch_size,omitempty"`
+	Timeout      time.Duration `json:"timeout,omitempty"`
+	// AllowKey дополнительно проверяет каждый ключ, в который пишет скрипт
+	// (например, право токена API); не сохраняется с заданием.
+	AllowKey func(key ds.Key) bool `json:"-"`
+}
+
+// ErrTransformKeyForbidden - скрипт трансформации пишет в ключ вне ее
+// области, в системное пространство или в ключ, отклоненный AllowKey.
+var ErrTransformKeyForbidden = errors.New("запись в ключ запрещена")
+
+// PatchOp - операция в стиле JSON Patch (add, replace, remove) с путем вида /a/b/0.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+type TransformChange struct {
+	Key    ds.Key `json:"key"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type TransformFailure struct {
+	Key   ds.Key `json:"key"`
+	Error string `json:"error"`
+}
+
+type TransformSummary struct {
+	JournalID string             `json:"journal_id,omitempty"`
+	DryRun    bool               `json:"dry_run"`
+	Scanned   int                `json:"scanned"`
+	Changed   int                `json:"changed"`
+	Unchanged int                `json:"unchanged"`
+	Errors    int                `json:"errors"`
+	Changes   []TransformChange  `json:"changes,omitempty"`
+	Failures  []TransformFailure `json:"failures,omitempty"`
+	StartedAt time.Time          `json:"started_at"`
+	Duration  time.Duration      `json:"duration"`
+}
+
+type TransformJournalStatus string
+
+const (
+	TransformJournalRunning   TransformJournalStatus = "running"
+	TransformJournalCommitted TransformJournalStatus = "committed"
+	TransformJournalFailed    TransformJournalStatus = "failed"
+	TransformJournalReverted  TransformJournalStatus = "reverted"
+)
+
+// TransformJournal - запись журнала примененной трансформации.
+type TransformJournal struct {
+	ID         string                 `json:"id"`
+	Status     TransformJournalStatus `json:"status"`
+	Options    TransformOptions       `json:"options"`
+	Changed    int                    `json:"changed"`
+	Error      string                 `json:"error,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	FinishedAt time.Time              `json:"finished_at,omitempty"`
+	RevertedAt time.Time              `json:"reverted_at,omitempty"`
+}
+
+// transformJournalEntry хранит исходное значение ключа и хеш записанного,
+// чтобы откат не затер изменения, сделанные после трансформации.
+type transformJournalEntry struct {
+	Existed   bool   `json:"existed"`
+	Before    []byte `json:"before,omitempty"`
+	AfterHash string `json:"after_hash"`
+}
+
+type TransformFeatures interface {
+	RunTransform(ctx context.Context, opts *TransformOptions) (*TransformSummary, error)
+	RevertTransform(ctx context.Context, journalID string) (*TransformSummary, error)
+	ListTransformJournals(ctx context.Context) ([]TransformJournal, error)
+	DeleteTransformJournal(ctx context.Context, journalID string) error
+}
+
+// transformWrite - изменение одного ключа; Value == nil означает удаление.
+// KeepOriginal - ключ мог уже меняться этой трансформацией (записи JS-скрипта
+// в произвольные ключи), поэтому в журнале сохраняется самое первое значение.
+type transformWrite struct {
+	Key          ds.Key
+	Value        []byte
+	Before       []byte
+	Exists       bool
+	KeepOriginal bool
+}
+
+// RunTransform применяет трансформацию. В режиме DryRun ничего не пишет и
+// возвращает diff измененных ключей; иначе коммитит изменения пачками и,
+// если не указан NoJournal, сохраняет исходные значения для RevertTransform.
+func (s *datastorage) RunTransform(ctx context.Context, opts *TransformOptions) (*TransformSummary, error) {
+	if opts == nil {
+		opts = &TransformOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = BatchSize
+	}
+	maxChanges := opts.MaxChanges
+	if maxChanges <= 0 {
+		maxChanges = DefaultTransformMaxChanges
+	}
+
+	tr, err := s.newTransformer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &TransformSummary{DryRun: opts.DryRun, StartedAt: time.Now()}
+	defer func() { summary.Duration = time.Since(summary.StartedAt) }()
+
+	var journal *TransformJournal
+	if !opts.DryRun && !opts.NoJournal {
+		journal = &TransformJournal{
+			ID:        tid.NewTIDNow(0).String(),
+			Status:    TransformJournalRunning,
+			Options:   *opts,
+			CreatedAt: summary.StartedAt,
+		}
+		if err := s.putTransformJournal(ctx, journal); err != nil {
+			return nil, err
+		}
+		summary.JournalID = journal.ID
+	}
+
+	pending := make([]transformWrite, 0, batchSize)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := s.commitTransformWritesSplit(ctx, journal, pending)
+		pending = pending[:0]
+		return err
+	}
+
+	err = s.scanTransformSource(ctx, opts, func(key ds.Key, value []byte) error {
+		summary.Scanned++
+		writes, err := tr.apply(ctx, key, value)
+		if err != nil {
+			summary.addFailure(key, err)
+			if opts.IgnoreErrors {
+				return nil
+			}
+			return fmt.Errorf("ошибка трансформации для ключа %s: %w", key, err)
+		}
+		if len(writes) == 0 {
+			summary.Unchanged++
+			return nil
+		}
+		summary.Changed += len(writes)
+		if opts.DryRun {
+			summary.addChanges(writes, maxChanges)
+			return nil
+		}
+		pending = append(pending, writes...)
+		if len(pending) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	if journal != nil {
+		journal.Changed = summary.Changed
+		journal.FinishedAt = time.Now()
+		journal.Status = TransformJournalCommitted
+		if err != nil {
+			journal.Status = TransformJournalFailed
+			journal.Error = err.Error()
+		}
+		if jerr := s.putTransformJournal(context.Background(), journal); jerr != nil && err == nil {
+			err = jerr
+		}
+	}
+
+	return summary, err
+}
+
+// scanTransformSource обходит ключ opts.Key либо все ключи под opts.Prefix,
+// пропуская системные.
+func (s *datastorage) scanTransformSource(ctx context.Context, opts *TransformOptions, fn func(ds.Key, []byte) error) error {
+	if k := opts.Key.String(); k != "" && k != "/" {
+		value, err := s.Datastore.Get(ctx, opts.Key)
+		if err != nil {
+			return err
+		}
+		return fn(opts.Key, value)
+	}
+
+	prefix := opts.Prefix.String()
+	if prefix == "" {
+		prefix = "/"
+	}
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: prefix})
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res, ok := <-results.Next():
+			if !ok {
+				return nil
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+			if strings.HasPrefix(res.Key, "/_system/") && !strings.HasPrefix(prefix, "/_system/") {
+				continue
+			}
+			if err := fn(ds.NewKey(res.Key), res.Value); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// transformer применяет TransformOptions к одному ключу. jq и JS
+// компилируются один раз на всю трансформацию.
+type transformer struct {
+	s      *datastorage
+	opts   *TransformOptions
+	script *goja.Program
+}
+
+func (s *datastorage) newTransformer(opts *TransformOptions) (*transformer, error) {
+	tr := &transformer{s: s, opts: opts}
+	if opts.Script != "" {
+		if opts.JQ != "" || opts.Extract != "" || len(opts.Patches) > 0 || len(opts.PatchOps) > 0 {
+			return nil, fmt.Errorf("script нельзя сочетать с jq, extract и patch")
+		}
+		prog, err := js.CompileFunction("transform", opts.Script, "key", "value")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка компиляции скрипта: %w", err)
+		}
+		tr.script = prog
+		return tr, nil
+	}
+	if opts.JQ != "" {
+		if _, err := s.compileJQ(opts.JQ); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+// apply возвращает записи для ключа; пустой результат - значение не изменилось.
+func (tr *transformer) apply(ctx context.Context, key ds.Key, value []byte) ([]transformWrite, error) {
+	if tr.script != nil {
+		return tr.applyScript(ctx, key, value)
+	}
+	out, err := tr.s.transformValue(ctx, value, tr.opts)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(out, value) {
+		return nil, nil
+	}
+	return []transformWrite{{Key: key, Value: out, Before: value, Exists: true}}, nil
+}
+
+// applyScript вызывает JS-функцию с аргументами key и value (JSON разбирается,
+// иначе строка). Результат: undefined - без изменений, null - удалить ключ,
+// массив объектов {key, value} - набор записей (value: null удаляет ключ),
+// иначе новое значение. Строки записываются как есть, остальное - как JSON.
+// Запись вне области трансформации отклоняется (см. checkScriptKey).
+func (tr *transformer) applyScript(ctx context.Context, key ds.Key, value []byte) ([]transformWrite, error) {
+	var input any = string(value)
+	if json.Valid(value) {
+		input = js.JSON(value)
+	}
+	out, err := js.CallProgram(ctx, tr.script, key.String(), input)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения скрипта: %w", err)
+	}
+
+	if out == js.Undefined {
+		return nil, nil
+	}
+	items, ok := scriptWriteList(out)
+	if !ok {
+		items = []map[string]any{{"key": key.String(), "value": out}}
+	}
+
+	writes := make([]transformWrite, 0, len(items))
+	for _, item := range items {
+		w := transformWrite{Key: ds.NewKey(item["key"].(string))}
+		if err := tr.checkScriptKey(w.Key); err != nil {
+			return nil, err
+		}
+		if v := item["value"]; v != nil {
+			if w.Value, err = encodeScriptValue(v); err != nil {
+				return nil, fmt.Errorf("ошибка кодирования значения для %s: %w", w.Key, err)
+			}
+		}
+		if w.Key.Equal(key) {
+			w.Before, w.Exists = value, true
+		} else {
+			current, err := tr.s.Datastore.Get(ctx, w.Key)
+			if err != nil && err != ds.ErrNotFound {
+				return nil, err
+			}
+			w.Before, w.Exists = current, err == nil
+		}
+		if !w.Exists && w.Value == nil {
+			continue
+		}
+		if w.Exists && w.Value != nil && bytes.Equal(w.Before, w.Value) {
+			continue
+		}
+		w.KeepOriginal = true
+		writes = append(writes, w)
+	}
+	return writes, nil
+}
+
+// checkScriptKey допускает записи скрипта только в ключ или префикс
+// трансформации, кроме системного пространства.
+func (tr *transformer) checkScriptKey(key ds.Key) error {
+	if strings.HasPrefix(key.String(), "/_system") {
+		return fmt.Errorf("%w: %s - системный ключ", ErrTransformKeyForbidden, key)
+	}
+	scope := transformScope(tr.opts)
+	if s := scope.String(); s != "" && s != "/" && !scope.Equal(key) && !scope.IsAncestorOf(key) {
+		return fmt.Errorf("%w: %s вне %s", ErrTransformKeyForbidden, key, scope)
+	}
+	if tr.opts.AllowKey != nil && !tr.opts.AllowKey(key) {
+		return fmt.Errorf("%w: %s", ErrTransformKeyForbidden, key)
+	}
+	return nil
+}
+
+// transformScope - ключ или префикс, который изменяет трансформация. Пустой
+// Key после чтения задания из JSON становится "/", как и в
+// scanTransformSource он означает, что ключ не задан.
+func transformScope(opts *TransformOptions) ds.Key {
+	if k := opts.Key.String(); k != "" && k != "/" {
+		return opts.Key
+	}
+	return ds.NewKey(opts.Prefix.String())
+}
+
+// scriptWriteList распознает результат скрипта как список записей: непустой
+// массив, каждый элемент которого - объект со строковым key и полем value.
+func scriptWriteList(out any) ([]map[string]any, bool) {
+	list, ok := out.([]any)
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	items := make([]map[string]any, len(list))
+	for i, el := range list {
+		item, ok := el.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := item["key"].(string); !ok {
+			return nil, false
+		}
+		if _, ok := item["value"]; !ok {
+			return nil, false
+		}
+		items[i] = item
+	}
+	return items, true
+}
+
+func encodeScriptValue(v any) ([]byte, error) {
+	if str, ok := v.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(v)
+}
+
+func (s *datastorage) transformValue(ctx context.Context, value []byte, opts *TransformOptions) ([]byte, error) {
+	out, err := s.applyTransformation(ctx, value, opts.Extract, opts.Patches, opts.JQ)
+	if err != nil {
+		return nil, err
+	}
+	if opts.JQ == "" && len(opts.PatchOps) > 0 {
+		out, err = applyPatchOps(out, opts.PatchOps)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func applyPatchOps(value []byte, ops []PatchOp) ([]byte, error) {
+	out := value
+	for _, op := range ops {
+		path := patchPathToSJSON(op.Path)
+		if path == "" {
+			return nil, fmt.Errorf("пустой путь в patch операции %s", op.Op)
+		}
+		var err error
+		switch op.Op {
+		case "add", "replace":
+			out, err = sjson.SetBytes(out, path, op.Value)
+		case "remove":
+			out, err = sjson.DeleteBytes(out, path)
+		default:
+			return nil, fmt.Errorf("неподдерживаемая patch операция: %s", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка patch операции %s %s: %w", op.Op, op.Path, err)
+		}
+	}
+	return out, nil
+}
+
+// patchPathToSJSON переводит JSON Pointer (/a/b/0, /a/-) в путь sjson (a.b.0, a.-1).
+func patchPathToSJSON(pointer string) string {
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, p := range parts {
+		p = strings.ReplaceAll(p, "~1", "/")
+		p = strings.ReplaceAll(p, "~0", "~")
+		if p == "-" {
+			p = "-1"
+		}
+		p = strings.ReplaceAll(p, ".", `\.`)
+		parts[i] = p
+	}
+	return strings.Join(parts, ".")
+}
+
+// commitTransformWrites фиксирует изменения вместе с записями журнала и
+// служебными записями system (например, курсором задания) одной
+// транзакцией; не помещающиеся в нее изменения отклоняются с ErrBatchTooBig.
+func (s *datastorage) commitTransformWrites(ctx context.Context, journal *TransformJournal, writes []transformWrite, system ...batchOp) error {
+	var err error
+	pb := s.newAtomicBatch()
+
+	entries := make(map[ds.Key]*transformJournalEntry)
+	var order []ds.Key
+	for _, w := range writes {
+		if journal != nil {
+			entry, seen := entries[w.Key]
+			if !seen {
+				entry = &transformJournalEntry{Existed: w.Exists, Before: w.Before}
+				if w.KeepOriginal {
+					if err := s.loadOriginalJournalEntry(ctx, journal.ID, w.Key, entry); err != nil {
+						return err
+					}
+				}
+				entries[w.Key] = entry
+				order = append(order, w.Key)
+			}
+			entry.AfterHash = valueHash(w.Value)
+		}
+		if w.Value == nil {
+			err = pb.Delete(ctx, w.Key)
+		} else {
+			err = pb.Put(ctx, w.Key, w.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range order {
+		data, err := json.Marshal(entries[key])
+		if err != nil {
+			return err
+		}
+		pb.putSystem(transformJournalDataKey(journal.ID, key), data)
+	}
+	for _, op := range system {
+		pb.putSystem(op.key, op.value)
+	}
+
+	if err := pb.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка коммита batch: %w", err)
+	}
+	return nil
+}
+
+// commitTransformWritesSplit фиксирует изменения трансформации без курсора:
+// слишком большая пачка делится пополам, каждая половина коммитится вместе
+// со своими записями журнала.
+func (s *datastorage) commitTransformWritesSplit(ctx context.Context, journal *TransformJournal, writes []transformWrite) error {
+	err := s.commitTransformWrites(ctx, journal, writes)
+	if errors.Is(err, ErrBatchTooBig) && len(writes) > 1 {
+		half := len(writes) / 2
+		if err := s.commitTransformWritesSplit(ctx, journal, writes[:half]); err != nil {
+			return err
+		}
+		return s.commitTransformWritesSplit(ctx, journal, writes[half:])
+	}
+	return err
+}
+
+// loadOriginalJournalEntry подставляет в entry исходное значение ключа, если
+// он уже был записан в журнал этой трансформации.
+func (s *datastorage) loadOriginalJournalEntry(ctx context.Context, journalID string, key ds.Key, entry *transformJournalEntry) error {
+	data, err := s.Datastore.Get(ctx, transformJournalDataKey(journalID, key))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var original transformJournalEntry
+	if err := json.Unmarshal(data, &original); err != nil {
+		return fmt.Errorf("некорректная запись журнала для %s: %w", key, err)
+	}
+	entry.Existed, entry.Before = original.Existed, original.Before
+	return nil
+}
+
+// RevertTransform восстанавливает значения, сохраненные в журнале. Ключи,
+// измененные после трансформации, не трогаются и попадают в Failures.
+func (s *datastorage) RevertTransform(ctx context.Context, journalID string) (*TransformSummary, error) {
+	journal, err := s.getTransformJournal(ctx, journalID)
+	if err != nil {
+		return nil, err
+	}
+	if journal.Status == TransformJournalReverted {
+		return nil, fmt.Errorf("трансформация %s уже откачена", journalID)
+	}
+	if journal.Status == TransformJournalRunning {
+		return nil, fmt.Errorf("трансформация %s еще выполняется", journalID)
+	}
+
+	summary := &TransformSummary{JournalID: journalID, StartedAt: time.Now()}
+	defer func() { summary.Duration = time.Since(summary.StartedAt) }()
+
+	prefix := ds.NewKey(TransformJournalDataNamespace).ChildString(journalID)
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	batch, err := s.Batch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	pending := 0
+
+	for res := range results.Next() {
+		if res.Error != nil {
+			return summary, res.Error
+		}
+		summary.Scanned++
+		key := ds.NewKey(strings.TrimPrefix(res.Key, prefix.String()))
+
+		var entry transformJournalEntry
+		if err := json.Unmarshal(res.Value, &entry); err != nil {
+			summary.addFailure(key, fmt.Errorf("некорректная запись журнала: %w", err))
+			continue
+		}
+
+		current, err := s.Datastore.Get(ctx, key)
+		if err != nil && err != ds.ErrNotFound {
+			return summary, err
+		}
+		if err == ds.ErrNotFound {
+			current = nil
+		}
+		if valueHash(current) != entry.AfterHash {
+			summary.addFailure(key, fmt.Errorf("ключ изменен после трансформации"))
+			continue
+		}
+
+		if entry.Existed {
+			err = batch.Put(ctx, key, entry.Before)
+		} else {
+			err = batch.Delete(ctx, key)
+		}
+		if err != nil {
+			return summary, err
+		}
+		summary.Changed++
+		pending++
+
+		if pending >= BatchSize {
+			if err := batch.Commit(ctx); err != nil {
+				return summary, fmt.Errorf("ошибка коммита batch: %w", err)
+			}
+			if batch, err = s.Batch(ctx); err != nil {
+				return summary, fmt.Errorf("ошибка создания batch: %w", err)
+			}
+			pending = 0
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return summary, fmt.Errorf("ошибка коммита batch: %w", err)
+	}
+
+	journal.Status = TransformJournalReverted
+	journal.RevertedAt = time.Now()
+	if err := s.putTransformJournal(ctx, journal); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+func (s *datastorage) ListTransformJournals(ctx context.Context) ([]TransformJournal, error) {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: TransformJournalNamespace})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	journals := []TransformJournal{}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		var journal TransformJournal
+		if err := json.Unmarshal(res.Value, &journal); err != nil {
+			continue
+		}
+		journals = append(journals, journal)
+	}
+	return journals, nil
+}
+
+func (s *datastorage) DeleteTransformJournal(ctx context.Context, journalID string) error {
+	if _, err := s.getTransformJournal(ctx, journalID); err != nil {
+		return err
+	}
+	prefix := ds.NewKey(TransformJournalDataNamespace).ChildString(journalID)
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := batch.Delete(ctx, ds.NewKey(res.Key)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(ctx, ds.NewKey(TransformJournalNamespace).ChildString(journalID)); err != nil {
+		return err
+	}
+	return batch.Commit(ctx)
+}
+
+func (s *datastorage) getTransformJournal(ctx context.Context, journalID string) (*TransformJournal, error) {
+	data, err := s.Datastore.Get(ctx, ds.NewKey(TransformJournalNamespace).ChildString(journalID))
+	if err == ds.ErrNotFound {
+		return nil, fmt.Errorf("журнал трансформации %s не найден", journalID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var journal TransformJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("некорректный журнал трансформации %s: %w", journalID, err)
+	}
+	return &journal, nil
+}
+
+func (s *datastorage) putTransformJournal(ctx context.Context, journal *TransformJournal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	if err := s.Datastore.Put(ctx, ds.NewKey(TransformJournalNamespace).ChildString(journal.ID), data); err != nil {
+		return fmt.Errorf("ошибка сохранения журнала трансформации: %w", err)
+	}
+	return nil
+}
+
+func transformJournalDataKey(journalID string, key ds.Key) ds.Key {
+	return ds.NewKey(TransformJournalDataNamespace).ChildString(journalID).Child(key)
+}
+
+func (summary *TransformSummary) addChanges(writes []transformWrite, maxChanges int) {
+	for _, w := range writes {
+		if len(summary.Changes) >= maxChanges {
+			return
+		}
+		change := TransformChange{Key: w.Key, After: diffValue(w.Value)}
+		if w.Exists {
+			change.Before = diffValue(w.Before)
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+}
+
+func (summary *TransformSummary) addFailure(key ds.Key, err error) {
+	summary.Errors++
+	if len(summary.Failures) < maxTransformFailures {
+		summary.Failures = append(summary.Failures, TransformFailure{Key: key, Error: err.Error()})
+	}
+}
+
+// valueHash возвращает хеш значения; для отсутствующего ключа - пустую строку.
+func valueHash(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffValue представляет значение в diff: JSON как есть, иначе строкой;
+// отсутствующее значение - null.
+func diffValue(value []byte) any {
+	if value == nil {
+		return nil
+	}
+	if json.Valid(value) {
+		return json.RawMessage(value)
+	}
+	return string(value)
+}
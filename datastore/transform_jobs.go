@@ -0,0 +1,601 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"ues-lite/tid"
+
+	badger "github.com/dgraph-io/badger/v4"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/time/rate"
+)
+
+// --- Background transform jobs
+
+const (
+	TransformJobsNamespace = "/_system/ds-transform-jobs"
+)
+
+type TransformJobStatus string
+
+const (
+	TransformJobRunning     TransformJobStatus = "running"
+	TransformJobInterrupted TransformJobStatus = "interrupted" // остановлено закрытием или падением процесса
+	TransformJobCancelled   TransformJobStatus = "cancelled"
+	TransformJobFailed      TransformJobStatus = "failed"
+	TransformJobCompleted   TransformJobStatus = "completed"
+)
+
+// TransformJob - фоновая трансформация префикса. Изменения коммитятся пачками
+// по Options.BatchSize вместе с курсором (последним обработанным ключом),
+// поэтому прерванное задание продолжается с места остановки.
+type TransformJob struct {
+	ID         string             `json:"id"`
+	Status     TransformJobStatus `json:"status"`
+	Options    TransformOptions   `json:"options"`
+	RateLimit  float64            `json:"rate_limit,omitempty"` // ключей в секунду, 0 - без ограничения
+	Cursor     string             `json:"cursor,omitempty"`
+	Progress   TransformSummary   `json:"progress"`
+	Error      string             `json:"error,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	FinishedAt time.Time          `json:"finished_at,omitempty"`
+}
+
+type TransformJobFeatures interface {
+	StartTransformJob(ctx context.Context, opts *TransformOptions, rateLimit float64) (*TransformJob, error)
+	GetTransformJob(ctx context.Context, id string) (*TransformJob, error)
+	ListTransformJobs(ctx context.Context) ([]TransformJob, error)
+	CancelTransformJob(ctx context.Context, id string) error
+	ResumeTransformJob(ctx context.Context, id string) (*TransformJob, error)
+	ThrottleTransformJob(ctx context.Context, id string, rateLimit float64) error
+	DeleteTransformJob(ctx context.Context, id string) error
+}
+
+// transformJobRunner - состояние выполняющегося задания.
+type transformJobRunner struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	cancelled bool
+	rateLimit float64
+	limiter   *rate.Limiter
+}
+
+func newTransformJobRunner(rateLimit float64, cancel context.CancelFunc) *transformJobRunner {
+	r := &transformJobRunner{cancel: cancel, limiter: rate.NewLimiter(rate.Inf, 1)}
+	r.setRate(rateLimit)
+	return r
+}
+
+func (r *transformJobRunner) setRate(rateLimit float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rateLimit = rateLimit
+	if rateLimit <= 0 {
+		r.limiter.SetLimit(rate.Inf)
+		return
+	}
+	burst := int(rateLimit)
+	if burst < 1 {
+		burst = 1
+	}
+	r.limiter.SetLimit(rate.Limit(rateLimit))
+	r.limiter.SetBurst(burst)
+}
+
+func (r *transformJobRunner) state() (rateLimit float64, cancelled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rateLimit, r.cancelled
+}
+
+// StartTransformJob запускает трансформацию префикса в фоне. rateLimit
+// ограничивает число обрабатываемых ключей в секунду (0 - без ограничения).
+func (s *datastorage) StartTransformJob(ctx context.Context, opts *TransformOptions, rateLimit float64) (*TransformJob, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("не заданы параметры трансформации")
+	}
+	if k := opts.Key.String(); k != "" && k != "/" {
+		return nil, fmt.Errorf("фоновое задание работает только с префиксом")
+	}
+	if opts.JQ == "" && opts.Script == "" && opts.Extract == "" && len(opts.Patches) == 0 && len(opts.PatchOps) == 0 {
+		return nil, fmt.Errorf("не задана трансформация")
+	}
+	if _, err := s.newTransformer(opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &TransformJob{
+		ID:        tid.NewTIDNow(0).String(),
+		Status:    TransformJobRunning,
+		Options:   *opts,
+		RateLimit: rateLimit,
+		Progress:  TransformSummary{DryRun: opts.DryRun, StartedAt: now},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	job.Options.Timeout = 0
+	if !opts.DryRun && !opts.NoJournal {
+		job.Progress.JournalID = job.ID
+	}
+
+	if err := s.putTransformJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := s.launchTransformJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ResumeTransformJob продолжает прерванное, отмененное или упавшее задание
+// с сохраненного курсора.
+func (s *datastorage) ResumeTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	s.jobsMu.Lock()
+	_, running := s.jobs[id]
+	s.jobsMu.Unlock()
+	if running {
+		return nil, fmt.Errorf("задание %s уже выполняется", id)
+	}
+
+	job, err := s.getTransformJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == TransformJobCompleted {
+		return nil, fmt.Errorf("задание %s уже завершено", id)
+	}
+
+	job.Status = TransformJobRunning
+	job.Error = ""
+	job.FinishedAt = time.Time{}
+	job.UpdatedAt = time.Now()
+	if err := s.putTransformJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := s.launchTransformJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *datastorage) launchTransformJob(job *TransformJob) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := newTransformJobRunner(job.RateLimit, cancel)
+
+	s.jobsMu.Lock()
+	if s.jobsClosed {
+		s.jobsMu.Unlock()
+		cancel()
+		return fmt.Errorf("датастор закрывается")
+	}
+	if _, exists := s.jobs[job.ID]; exists {
+		s.jobsMu.Unlock()
+		cancel()
+		return fmt.Errorf("задание %s уже выполняется", job.ID)
+	}
+	s.jobs[job.ID] = runner
+	s.jobsWg.Add(1)
+	s.jobsMu.Unlock()
+
+	go func() {
+		defer s.jobsWg.Done()
+		defer func() {
+			s.jobsMu.Lock()
+			delete(s.jobs, job.ID)
+			s.jobsMu.Unlock()
+			cancel()
+		}()
+		s.runTransformJob(ctx, runner, job)
+	}()
+	return nil
+}
+
+func (s *datastorage) runTransformJob(ctx context.Context, runner *transformJobRunner, job *TransformJob) {
+	opts := &job.Options
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = BatchSize
+	}
+	maxChanges := opts.MaxChanges
+	if maxChanges <= 0 {
+		maxChanges = DefaultTransformMaxChanges
+	}
+
+	tr, err := s.newTransformer(opts)
+	if err != nil {
+		s.finishTransformJob(job, nil, err)
+		return
+	}
+
+	var journal *TransformJournal
+	if job.Progress.JournalID != "" {
+		journal = &TransformJournal{
+			ID:        job.ID,
+			Status:    TransformJournalRunning,
+			Options:   *opts,
+			Changed:   job.Progress.Changed,
+			CreatedAt: job.CreatedAt,
+		}
+		if err := s.putTransformJournal(ctx, journal); err != nil {
+			s.finishTransformJob(job, journal, err)
+			return
+		}
+	}
+	s.publishTransformJobEvent(job)
+
+	// Пачка после начала обработки доводится до коммита: отмена проверяется
+	// только между ключами, чтобы прерванный jq или скрипт не засчитывался
+	// как ошибка.
+	workCtx := context.WithoutCancel(ctx)
+
+	for err == nil {
+		var chunk []KeyValue
+		chunk, err = s.scanTransformChunk(ctx, opts.Prefix, job.Cursor, batchSize)
+		if err != nil || len(chunk) == 0 {
+			break
+		}
+
+		// Прогресс пачки применяется к копии задания и сохраняется вместе с
+		// изменениями; при ошибке коммита задание остается на прежнем курсоре.
+		next := *job
+		writes := make([]transformWrite, 0, len(chunk))
+		for _, kv := range chunk {
+			if err = runner.limiter.Wait(ctx); err != nil {
+				break
+			}
+			kvWrites, terr := tr.apply(workCtx, kv.Key, kv.Value)
+			if terr != nil && !opts.IgnoreErrors {
+				err = fmt.Errorf("ошибка трансформации для ключа %s: %w", kv.Key, terr)
+				break
+			}
+			next.Progress.Scanned++
+			next.Cursor = kv.Key.String()
+			if terr != nil {
+				next.Progress.addFailure(kv.Key, terr)
+				continue
+			}
+			if len(kvWrites) == 0 {
+				next.Progress.Unchanged++
+				continue
+			}
+			next.Progress.Changed += len(kvWrites)
+			if opts.DryRun {
+				next.Progress.addChanges(kvWrites, maxChanges)
+				continue
+			}
+			writes = append(writes, kvWrites...)
+		}
+
+		if next.Cursor == job.Cursor {
+			break
+		}
+		next.RateLimit, _ = runner.state()
+		next.UpdatedAt = time.Now()
+		next.Progress.Duration = next.UpdatedAt.Sub(next.Progress.StartedAt)
+		if cerr := s.commitTransformJobChunk(workCtx, journal, &next, writes); cerr != nil {
+			// Пачка не помещается в транзакцию: повторяем ее с прежнего
+			// курсора пачками меньшего размера
+			if err == nil && errors.Is(cerr, ErrBatchTooBig) && batchSize > 1 {
+				batchSize /= 2
+				continue
+			}
+			if err == nil {
+				err = cerr
+			}
+			break
+		}
+		*job = next
+		s.publishTransformJobEvent(job)
+	}
+
+	s.finishTransformJob(job, journal, err)
+}
+
+// commitTransformJobChunk сохраняет изменения пачки, записи журнала и
+// обновленное состояние задания одной транзакцией: курсор не может
+// опередить изменения, которые он покрывает.
+func (s *datastorage) commitTransformJobChunk(ctx context.Context, journal *TransformJournal, job *TransformJob, writes []transformWrite) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	jobKey := ds.NewKey(TransformJobsNamespace).ChildString(job.ID)
+	if len(writes) == 0 {
+		if err := s.Datastore.Put(ctx, jobKey, data); err != nil {
+			return fmt.Errorf("ошибка сохранения задания трансформации: %w", err)
+		}
+		return nil
+	}
+	return s.commitTransformWrites(ctx, journal, writes, batchOp{key: jobKey, value: data})
+}
+
+// finishTransformJob фиксирует итоговый статус задания и его журнала.
+func (s *datastorage) finishTransformJob(job *TransformJob, journal *TransformJournal, err error) {
+	rateLimit, cancelled := s.transformJobState(job.ID)
+	job.RateLimit = rateLimit
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		job.Status = TransformJobCompleted
+		job.FinishedAt = now
+	case cancelled:
+		job.Status = TransformJobCancelled
+		job.FinishedAt = now
+	case errors.Is(err, context.Canceled):
+		job.Status = TransformJobInterrupted
+	default:
+		job.Status = TransformJobFailed
+		job.Error = err.Error()
+		job.FinishedAt = now
+	}
+	job.UpdatedAt = now
+	job.Progress.Duration = now.Sub(job.Progress.StartedAt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.putTransformJob(ctx, job); err != nil {
+		log.Printf("ошибка сохранения задания трансформации %s: %v", job.ID, err)
+	}
+	if journal != nil {
+		journal.Changed = job.Progress.Changed
+		journal.FinishedAt = now
+		journal.Status = TransformJournalCommitted
+		if job.Status != TransformJobCompleted {
+			journal.Status = TransformJournalFailed
+			journal.Error = fmt.Sprintf("задание %s: %s", job.ID, job.Status)
+		}
+		if err := s.putTransformJournal(ctx, journal); err != nil {
+			log.Printf("ошибка сохранения журнала трансформации %s: %v", job.ID, err)
+		}
+	}
+	s.publishTransformJobEvent(job)
+}
+
+func (s *datastorage) transformJobState(id string) (rateLimit float64, cancelled bool) {
+	s.jobsMu.Lock()
+	runner, ok := s.jobs[id]
+	s.jobsMu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return runner.state()
+}
+
+// scanTransformChunk читает до limit ключей под префиксом строго после after.
+// Каждая пачка читается в отдельной транзакции, чтобы не держать снимок
+// на все время задания.
+func (s *datastorage) scanTransformChunk(ctx context.Context, prefixKey ds.Key, after string, limit int) ([]KeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	prefix := "/"
+	if p := prefixKey.String(); p != "/" && p != "" {
+		prefix = p + "/"
+	}
+	seek := prefix
+	if after > seek {
+		seek = after
+	}
+	includeSystem := strings.HasPrefix(prefix, "/_system/")
+
+	chunk := make([]KeyValue, 0, limit)
+	err := s.Datastore.DB.View(func(txn *badger.Txn) error {
+		itOpts := badger.DefaultIteratorOptions
+		itOpts.Prefix = []byte(prefix)
+		it := txn.NewIterator(itOpts)
+		defer it.Close()
+		for it.Seek([]byte(seek)); it.Valid() && len(chunk) < limit; it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			if key == after {
+				continue
+			}
+			if !includeSystem && strings.HasPrefix(key, "/_system/") {
+				continue
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			chunk = append(chunk, KeyValue{Key: ds.RawKey(key), Value: value})
+		}
+		return nil
+	})
+	return chunk, err
+}
+
+func (s *datastorage) CancelTransformJob(ctx context.Context, id string) error {
+	s.jobsMu.Lock()
+	runner, ok := s.jobs[id]
+	s.jobsMu.Unlock()
+	if !ok {
+		if _, err := s.getTransformJob(ctx, id); err != nil {
+			return err
+		}
+		return fmt.Errorf("задание %s не выполняется", id)
+	}
+
+	runner.mu.Lock()
+	runner.cancelled = true
+	runner.mu.Unlock()
+	runner.cancel()
+	return nil
+}
+
+// ThrottleTransformJob меняет ограничение скорости задания; для
+// выполняющегося задания действует сразу.
+func (s *datastorage) ThrottleTransformJob(ctx context.Context, id string, rateLimit float64) error {
+	if rateLimit < 0 {
+		return fmt.Errorf("ограничение скорости не может быть отрицательным")
+	}
+
+	s.jobsMu.Lock()
+	runner, ok := s.jobs[id]
+	s.jobsMu.Unlock()
+	if ok {
+		runner.setRate(rateLimit)
+		return nil
+	}
+
+	job, err := s.getTransformJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	job.RateLimit = rateLimit
+	job.UpdatedAt = time.Now()
+	return s.putTransformJob(ctx, job)
+}
+
+func (s *datastorage) GetTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	job, err := s.getTransformJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rateLimit, _ := s.transformJobState(id); job.Status == TransformJobRunning {
+		job.RateLimit = rateLimit
+	}
+	return job, nil
+}
+
+func (s *datastorage) ListTransformJobs(ctx context.Context) ([]TransformJob, error) {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: TransformJobsNamespace})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	jobs := []TransformJob{}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		var job TransformJob
+		if err := json.Unmarshal(res.Value, &job); err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// DeleteTransformJob удаляет запись задания; журнал трансформации
+// сохраняется и удаляется отдельно.
+func (s *datastorage) DeleteTransformJob(ctx context.Context, id string) error {
+	s.jobsMu.Lock()
+	_, running := s.jobs[id]
+	s.jobsMu.Unlock()
+	if running {
+		return fmt.Errorf("задание %s выполняется, сначала отмените его", id)
+	}
+	if _, err := s.getTransformJob(ctx, id); err != nil {
+		return err
+	}
+	return s.Datastore.Delete(ctx, ds.NewKey(TransformJobsNamespace).ChildString(id))
+}
+
+func (s *datastorage) getTransformJob(ctx context.Context, id string) (*TransformJob, error) {
+	data, err := s.Datastore.Get(ctx, ds.NewKey(TransformJobsNamespace).ChildString(id))
+	if err == ds.ErrNotFound {
+		return nil, fmt.Errorf("задание трансформации %s не найдено", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job TransformJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("некорректное задание трансформации %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+func (s *datastorage) putTransformJob(ctx context.Context, job *TransformJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := s.Datastore.Put(ctx, ds.NewKey(TransformJobsNamespace).ChildString(job.ID), data); err != nil {
+		return fmt.Errorf("ошибка сохранения задания трансформации: %w", err)
+	}
+	return nil
+}
+
+// loadTransformJobs помечает задания, оставшиеся в статусе running после
+// падения процесса, как прерванные; продолжить их можно через ResumeTransformJob.
+func (s *datastorage) loadTransformJobs(ctx context.Context) error {
+	jobs, err := s.ListTransformJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status != TransformJobRunning {
+			continue
+		}
+		job.Status = TransformJobInterrupted
+		job.UpdatedAt = time.Now()
+		if err := s.putTransformJob(ctx, job); err != nil {
+			return err
+		}
+		if journal, err := s.getTransformJournal(ctx, job.ID); err == nil && journal.Status == TransformJournalRunning {
+			journal.Status = TransformJournalFailed
+			journal.Error = fmt.Sprintf("задание %s: %s", job.ID, job.Status)
+			if err := s.putTransformJournal(ctx, journal); err != nil {
+				return err
+			}
+		}
+		log.Printf("задание трансформации %s прервано на ключе %q", job.ID, job.Cursor)
+	}
+	return nil
+}
+
+// stopTransformJobs останавливает выполняющиеся задания при закрытии;
+// они сохраняются со статусом interrupted.
+func (s *datastorage) stopTransformJobs() {
+	s.jobsMu.Lock()
+	s.jobsClosed = true
+	for _, runner := range s.jobs {
+		runner.cancel()
+	}
+	s.jobsMu.Unlock()
+	s.jobsWg.Wait()
+}
+
+func (s *datastorage) publishTransformJobEvent(job *TransformJob) {
+	if s.silentMode {
+		return
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	event := Event{
+		Type:      EventTransformJob,
+		Key:       ds.NewKey(TransformJobsNamespace).ChildString(job.ID),
+		Value:     data,
+		Timestamp: time.Now(),
+		Metadata: map[string]any{
+			"job_id":  job.ID,
+			"status":  string(job.Status),
+			"cursor":  job.Cursor,
+			"scanned": job.Progress.Scanned,
+			"changed": job.Progress.Changed,
+			"errors":  job.Progress.Errors,
+		},
+	}
+	select {
+	case s.eventQueue <- event:
+	default:
+	}
+}
@@ -0,0 +1,45 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestTransformScriptKeyScope(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Put(ctx, ds.NewKey("/data/a"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		opts TransformOptions
+	}{
+		{"вне префикса", TransformOptions{Prefix: ds.NewKey("/data"), Script: `return [{key: "/other/a", value: 1}]`}},
+		{"вне ключа", TransformOptions{Key: ds.NewKey("/data/a"), Script: `return [{key: "/data/b", value: 1}]`}},
+		{"системный ключ", TransformOptions{Script: `return [{key: "/_system/x", value: 1}]`}},
+		{"AllowKey", TransformOptions{
+			Prefix:   ds.NewKey("/data"),
+			Script:   `return [{key: "/data/a/copy", value: 1}]`,
+			AllowKey: func(key ds.Key) bool { return false },
+		}},
+	}
+	for _, c := range cases {
+		if _, err := store.RunTransform(ctx, &c.opts); !errors.Is(err, ErrTransformKeyForbidden) {
+			t.Fatalf("%s: %v, ожидалась ErrTransformKeyForbidden", c.name, err)
+		}
+	}
+	for _, key := range []string{"/other/a", "/data/b", "/_system/x", "/data/a/copy"} {
+		if has, _ := store.Has(ctx, ds.NewKey(key)); has {
+			t.Fatalf("скрипт записал %s", key)
+		}
+	}
+}
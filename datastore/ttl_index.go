@@ -0,0 +1,364 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// --- TTL expiry index
+
+// Реестр TTL хранится в двух видах: /_system/ds-ttls/<key> - время истечения
+// ключа, /_system/ds-ttl-index/<expiresAt>/<key> - те же записи,
+// упорядоченные по времени истечения. Монитор читает только начало индекса
+// до текущего момента и спит до ближайшего истечения.
+const (
+	TTLIndexNamespace   = "/_system/ds-ttl-index"
+	ttlIndexVersionKey  = "/_system/ds-ttl-index-version"
+	ttlIndexStampWidth  = 20
+	ttlExpireBatchSize  = 1000
+	ttlRegistryTimeForm = time.RFC3339Nano
+)
+
+func ttlRegistryKey(key ds.Key) ds.Key {
+	return ds.NewKey(TTLNameSpace).ChildString(key.String())
+}
+
+func ttlIndexStamp(t time.Time) string {
+	nanos := t.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	return fmt.Sprintf("%0*d", ttlIndexStampWidth, nanos)
+}
+
+func ttlIndexKey(expiresAt time.Time, key ds.Key) ds.Key {
+	return ds.RawKey(TTLIndexNamespace + "/" + ttlIndexStamp(expiresAt) + key.String())
+}
+
+// registeredExpiry возвращает время истечения ключа из реестра TTL.
+func (s *datastorage) registeredExpiry(ctx context.Context, key ds.Key) (time.Time, bool) {
+	data, err := s.Datastore.Get(ctx, ttlRegistryKey(key))
+	if err != nil {
+		return time.Time{}, false
+	}
+	expiresAt, err := time.Parse(ttlRegistryTimeForm, string(data))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+func (s *datastorage) registerTTLKey(key ds.Key, expiresAt time.Time) {
+	if err := s.writeTTLRegistration(context.Background(), key, expiresAt); err != nil {
+		log.Printf("ошибка регистрации TTL ключа %s: %v", key.String(), err)
+		return
+	}
+	s.wakeTTLMonitor()
+}
+
+// writeTTLRegistration заменяет запись реестра и индекса одним batch.
+func (s *datastorage) writeTTLRegistration(ctx context.Context, key ds.Key, expiresAt time.Time) error {
+	s.ttlIndexMu.Lock()
+	defer s.ttlIndexMu.Unlock()
+
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.registeredExpiry(ctx, key); ok {
+		if err := batch.Delete(ctx, ttlIndexKey(old, key)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(ctx, ttlRegistryKey(key), []byte(expiresAt.Format(ttlRegistryTimeForm))); err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, ttlIndexKey(expiresAt, key), []byte{}); err != nil {
+		return err
+	}
+	return batch.Commit(ctx)
+}
+
+func (s *datastorage) unregisterTTLKey(ctx context.Context, key ds.Key) {
+	expiresAt, ok := s.registeredExpiry(ctx, key)
+	if !ok {
+		return
+	}
+	if err := s.dropTTLRegistration(ctx, key, expiresAt); err != nil {
+		log.Printf("ошибка удаления ключа из TTL мониторинга: %v", err)
+	}
+}
+
+// dropTTLRegistration удаляет запись индекса expiresAt и запись реестра,
+// если ключ не был перерегистрирован с другим временем.
+func (s *datastorage) dropTTLRegistration(ctx context.Context, key ds.Key, expiresAt time.Time) error {
+	s.ttlIndexMu.Lock()
+	defer s.ttlIndexMu.Unlock()
+
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := batch.Delete(ctx, ttlIndexKey(expiresAt, key)); err != nil {
+		return err
+	}
+	if current, ok := s.registeredExpiry(ctx, key); ok && current.Equal(expiresAt) {
+		if err := batch.Delete(ctx, ttlRegistryKey(key)); err != nil {
+			return err
+		}
+		if err := batch.Delete(ctx, ttlDeadlineKey(key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+// scanTTLIndex перебирает индекс по возрастанию времени истечения до until
+// включительно (нулевое until - весь индекс). fn возвращает false, чтобы
+// остановить перебор.
+func (s *datastorage) scanTTLIndex(until time.Time, fn func(key ds.Key, expiresAt time.Time) bool) error {
+	prefix := []byte(TTLIndexNamespace + "/")
+	var untilStamp string
+	if !until.IsZero() {
+		untilStamp = ttlIndexStamp(until)
+	}
+	return s.Datastore.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			rest := string(it.Item().Key()[len(prefix):])
+			if len(rest) <= ttlIndexStampWidth || rest[ttlIndexStampWidth] != '/' {
+				continue
+			}
+			stamp := rest[:ttlIndexStampWidth]
+			if untilStamp != "" && stamp > untilStamp {
+				return nil
+			}
+			nanos, err := strconv.ParseInt(stamp, 10, 64)
+			if err != nil {
+				continue
+			}
+			if !fn(ds.RawKey(rest[ttlIndexStampWidth:]), time.Unix(0, nanos)) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// nextTTLExpiry возвращает ближайшее время истечения или нулевое время,
+// если индекс пуст.
+func (s *datastorage) nextTTLExpiry() time.Time {
+	var next time.Time
+	err := s.scanTTLIndex(time.Time{}, func(_ ds.Key, expiresAt time.Time) bool {
+		next = expiresAt
+		return false
+	})
+	if err != nil {
+		log.Printf("ошибка чтения индекса TTL: %v", err)
+	}
+	return next
+}
+
+func (s *datastorage) wakeTTLMonitor() {
+	select {
+	case s.ttlWake <- struct{}{}:
+	default:
+	}
+}
+
+type ttlIndexEntry struct {
+	key       ds.Key
+	expiresAt time.Time
+}
+
+// expireDueTTLKeys обрабатывает записи индекса, истекшие к now, порциями по
+// ttlExpireBatchSize и возвращает число удаленных ключей.
+func (s *datastorage) expireDueTTLKeys(ctx context.Context, now time.Time) (int, error) {
+	expired := 0
+	for {
+		due := make([]ttlIndexEntry, 0, ttlExpireBatchSize)
+		err := s.scanTTLIndex(now, func(key ds.Key, expiresAt time.Time) bool {
+			due = append(due, ttlIndexEntry{key: key, expiresAt: expiresAt})
+			return len(due) < ttlExpireBatchSize
+		})
+		if err != nil {
+			return expired, fmt.Errorf("ошибка чтения индекса TTL: %w", err)
+		}
+		for _, entry := range due {
+			if err := ctx.Err(); err != nil {
+				return expired, err
+			}
+			ok, err := s.expireTTLKey(ctx, entry, now)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+		if len(due) < ttlExpireBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// expireTTLKey сверяет запись индекса с TTL ключа в badger: удаляет истекший
+// ключ, переносит запись, если TTL был продлен, и снимает с учета ключ,
+// перезаписанный без TTL.
+func (s *datastorage) expireTTLKey(ctx context.Context, entry ttlIndexEntry, now time.Time) (bool, error) {
+	expiration, err := s.Datastore.GetExpiration(ctx, entry.key)
+	switch {
+	case err != nil && err != ds.ErrNotFound:
+		return false, fmt.Errorf("ошибка получения TTL ключа %s: %w", entry.key, err)
+	case err == nil && expiration.Unix() == 0:
+		return false, s.dropTTLRegistration(ctx, entry.key, entry.expiresAt)
+	case err == nil && expiration.After(now):
+		return false, s.writeTTLRegistration(ctx, entry.key, expiration)
+	}
+
+	var lastValue []byte
+	if value, err := s.Datastore.Get(ctx, entry.key); err == nil {
+		lastValue = value
+	}
+	if err := s.applyOp(ctx, batchOp{isDelete: true, key: entry.key}); err != nil {
+		log.Printf("ошибка удаления истекшего ключа %s: %v", entry.key.String(), err)
+	}
+	if err := s.dropTTLRegistration(ctx, entry.key, entry.expiresAt); err != nil {
+		return false, fmt.Errorf("ошибка удаления TTL ключа %s: %w", entry.key, err)
+	}
+	if !s.silentMode {
+		s.publishTTLExpiredEvent(entry.key, lastValue, entry.expiresAt)
+	}
+	return true, nil
+}
+
+// migrateTTLIndex однократно строит индекс по реестру, записанному до
+// появления индекса.
+func (s *datastorage) migrateTTLIndex(ctx context.Context) error {
+	if has, err := s.Datastore.Has(ctx, ds.NewKey(ttlIndexVersionKey)); err != nil || has {
+		return err
+	}
+	prefix := []byte(TTLNameSpace + "/")
+	var entries []ttlIndexEntry
+	err := s.Datastore.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			expiresAt, err := time.Parse(ttlRegistryTimeForm, string(value))
+			if err != nil {
+				continue
+			}
+			key := ds.RawKey(strings.TrimPrefix(string(it.Item().Key()), TTLNameSpace))
+			entries = append(entries, ttlIndexEntry{key: key, expiresAt: expiresAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := batch.Put(ctx, ttlIndexKey(entry.expiresAt, entry.key), []byte{}); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(ctx, ds.NewKey(ttlIndexVersionKey), []byte("1")); err != nil {
+		return err
+	}
+	return batch.Commit(ctx)
+}
+
+// recoverTTLRegistrations регистрирует ключи, у которых есть TTL в badger,
+// но нет актуальной записи в реестре: записанные до включения мониторинга,
+// загруженные из резервной копии или в обход датастора. Перебор
+// прерывается закрытием done.
+func (s *datastorage) recoverTTLRegistrations(ctx context.Context, done <-chan struct{}) (int, error) {
+	var missing []ttlIndexEntry
+	err := s.Datastore.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		scanned := 0
+		for it.Rewind(); it.Valid(); it.Next() {
+			if scanned++; scanned%1024 == 0 {
+				select {
+				case <-done:
+					return context.Canceled
+				default:
+				}
+			}
+			item := it.Item()
+			if item.ExpiresAt() == 0 {
+				continue
+			}
+			key := string(item.Key())
+			if strings.HasPrefix(key, "/_system/") {
+				continue
+			}
+			expiresAt := time.Unix(int64(item.ExpiresAt()), 0)
+			registered, err := txn.Get([]byte(TTLNameSpace + key))
+			if err == nil {
+				value, err := registered.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if t, err := time.Parse(ttlRegistryTimeForm, string(value)); err == nil && t.Sub(expiresAt).Abs() <= time.Second {
+					continue
+				}
+			} else if err != badger.ErrKeyNotFound {
+				return err
+			}
+			missing = append(missing, ttlIndexEntry{key: ds.RawKey(key), expiresAt: expiresAt})
+		}
+		return nil
+	})
+	if err != nil || len(missing) == 0 {
+		return 0, err
+	}
+
+	s.ttlIndexMu.Lock()
+	defer s.ttlIndexMu.Unlock()
+	batch, err := s.Datastore.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range missing {
+		if old, ok := s.registeredExpiry(ctx, entry.key); ok {
+			if err := batch.Delete(ctx, ttlIndexKey(old, entry.key)); err != nil {
+				return 0, err
+			}
+		}
+		if err := batch.Put(ctx, ttlRegistryKey(entry.key), []byte(entry.expiresAt.Format(ttlRegistryTimeForm))); err != nil {
+			return 0, err
+		}
+		if err := batch.Put(ctx, ttlIndexKey(entry.expiresAt, entry.key), []byte{}); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(missing), nil
+}
@@ -0,0 +1,312 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// --- TTL policies
+
+const (
+	TTLPoliciesNamespace  = "/_system/ds-ttl-policies"
+	TTLDeadlinesNamespace = "/_system/ds-ttl-deadlines"
+	// ttlRefreshThreshold - продление TTL при чтении меньше этого порога
+	// пропускается: badger хранит время истечения с точностью до секунды.
+	ttlRefreshThreshold = time.Second
+)
+
+// TTLPolicy задает TTL для ключей под префиксом. Ключу соответствует
+// политика с самым длинным префиксом.
+//
+//   - DefaultTTL применяется к записи без явного TTL (Put, Batch, транзакции).
+//   - Sliding: каждый Get продлевает TTL ключа на DefaultTTL от момента чтения.
+//   - IdleTimeout: ключ истекает, если его не читали и не записывали
+//     IdleTimeout; явный TTL записи ограничивается этим значением.
+//   - MaxLifetime ограничивает срок жизни от последней записи, в том числе
+//     продления при чтении.
+type TTLPolicy struct {
+	Prefix      string        `json:"prefix"`
+	DefaultTTL  time.Duration `json:"default_ttl,omitempty"`
+	Sliding     bool          `json:"sliding,omitempty"`
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	MaxLifetime time.Duration `json:"max_lifetime,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// TTLStats - сводка по ключам с TTL под префиксом.
+type TTLStats struct {
+	Prefix         string        `json:"prefix"`
+	TotalKeys      int           `json:"total_keys"`
+	ExpiredKeys    int           `json:"expired_keys"`
+	ExpiringSoon   int           `json:"expiring_soon"`
+	NextExpiry     *time.Time    `json:"next_expiry,omitempty"`
+	MonitorEnabled bool          `json:"monitor_enabled"`
+	CheckInterval  time.Duration `json:"check_interval,omitempty"`
+	Policies       []TTLPolicy   `json:"policies"`
+}
+
+// ttlExpiringSoonWindow - окно для TTLStats.ExpiringSoon.
+const ttlExpiringSoonWindow = time.Minute
+
+type TTLPolicyFeatures interface {
+	SetTTLPolicy(ctx context.Context, policy TTLPolicy) error
+	RemoveTTLPolicy(ctx context.Context, prefix ds.Key) error
+	ListTTLPolicies() []TTLPolicy
+	TTLPolicyFor(key ds.Key) (TTLPolicy, bool)
+	GetTTLStats(ctx context.Context, prefix ds.Key) (*TTLStats, error)
+}
+
+type ttlPolicyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]TTLPolicy
+}
+
+func ttlPolicyKey(prefix string) ds.Key {
+	return ds.NewKey(TTLPoliciesNamespace).ChildString(prefix)
+}
+
+func ttlDeadlineKey(key ds.Key) ds.Key {
+	return ds.NewKey(TTLDeadlinesNamespace).ChildString(key.String())
+}
+
+func validateTTLPolicy(policy *TTLPolicy) error {
+	if !strings.HasPrefix(policy.Prefix, "/") {
+		return fmt.Errorf("префикс политики должен начинаться с '/'")
+	}
+	policy.Prefix = ds.NewKey(policy.Prefix).String()
+	if strings.HasPrefix(policy.Prefix, "/_system") {
+		return fmt.Errorf("политики TTL для системных ключей не поддерживаются")
+	}
+	if policy.DefaultTTL < 0 || policy.IdleTimeout < 0 || policy.MaxLifetime < 0 {
+		return fmt.Errorf("длительности политики не могут быть отрицательными")
+	}
+	if policy.Sliding && policy.DefaultTTL == 0 {
+		return fmt.Errorf("sliding требует default_ttl")
+	}
+	if policy.DefaultTTL == 0 && policy.IdleTimeout == 0 && policy.MaxLifetime == 0 {
+		return fmt.Errorf("требуется хотя бы одно из: default_ttl, idle_timeout, max_lifetime")
+	}
+	return nil
+}
+
+// writeTTL возвращает TTL записи: явный TTL или DefaultTTL, ограниченный
+// IdleTimeout и MaxLifetime; 0 - без TTL.
+func (p TTLPolicy) writeTTL(explicit time.Duration) time.Duration {
+	ttl := explicit
+	if ttl <= 0 {
+		ttl = p.DefaultTTL
+	}
+	for _, limit := range []time.Duration{p.IdleTimeout, p.MaxLifetime} {
+		if limit > 0 && (ttl <= 0 || ttl > limit) {
+			ttl = limit
+		}
+	}
+	return ttl
+}
+
+// readWindow - на сколько продлевается TTL при чтении; 0 - не продлевается.
+func (p TTLPolicy) readWindow() time.Duration {
+	window := time.Duration(0)
+	if p.Sliding {
+		window = p.DefaultTTL
+	}
+	if p.IdleTimeout > 0 && (window == 0 || p.IdleTimeout < window) {
+		window = p.IdleTimeout
+	}
+	return window
+}
+
+func (s *datastorage) SetTTLPolicy(ctx context.Context, policy TTLPolicy) error {
+	if err := validateTTLPolicy(&policy); err != nil {
+		return err
+	}
+	policy.CreatedAt = time.Now()
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := s.Datastore.Put(ctx, ttlPolicyKey(policy.Prefix), data); err != nil {
+		return fmt.Errorf("ошибка сохранения политики TTL: %w", err)
+	}
+	s.ttlPolicies.mu.Lock()
+	s.ttlPolicies.policies[policy.Prefix] = policy
+	s.ttlPolicies.mu.Unlock()
+	return nil
+}
+
+func (s *datastorage) RemoveTTLPolicy(ctx context.Context, prefix ds.Key) error {
+	s.ttlPolicies.mu.Lock()
+	defer s.ttlPolicies.mu.Unlock()
+	if _, ok := s.ttlPolicies.policies[prefix.String()]; !ok {
+		return fmt.Errorf("политика TTL для %s не найдена", prefix)
+	}
+	if err := s.Datastore.Delete(ctx, ttlPolicyKey(prefix.String())); err != nil {
+		return fmt.Errorf("ошибка удаления политики TTL: %w", err)
+	}
+	delete(s.ttlPolicies.policies, prefix.String())
+	return nil
+}
+
+func (s *datastorage) ListTTLPolicies() []TTLPolicy {
+	s.ttlPolicies.mu.RLock()
+	defer s.ttlPolicies.mu.RUnlock()
+	policies := make([]TTLPolicy, 0, len(s.ttlPolicies.policies))
+	for _, policy := range s.ttlPolicies.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Prefix < policies[j].Prefix })
+	return policies
+}
+
+func (s *datastorage) TTLPolicyFor(key ds.Key) (TTLPolicy, bool) {
+	if strings.HasPrefix(key.String(), "/_system/") {
+		return TTLPolicy{}, false
+	}
+	s.ttlPolicies.mu.RLock()
+	defer s.ttlPolicies.mu.RUnlock()
+	var best TTLPolicy
+	found := false
+	for prefix, policy := range s.ttlPolicies.policies {
+		p := ds.NewKey(prefix)
+		if prefix != "/" && !p.Equal(key) && !p.IsAncestorOf(key) {
+			continue
+		}
+		if !found || len(prefix) > len(best.Prefix) {
+			best, found = policy, true
+		}
+	}
+	return best, found
+}
+
+func (s *datastorage) loadTTLPolicies(ctx context.Context) error {
+	results, err := s.Datastore.Query(ctx, query.Query{Prefix: TTLPoliciesNamespace})
+	if err != nil {
+		return fmt.Errorf("ошибка запроса политик TTL: %w", err)
+	}
+	defer results.Close()
+	s.ttlPolicies.mu.Lock()
+	defer s.ttlPolicies.mu.Unlock()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		var policy TTLPolicy
+		if err := json.Unmarshal(res.Value, &policy); err != nil {
+			log.Printf("некорректная политика TTL %s: %v", res.Key, err)
+			continue
+		}
+		s.ttlPolicies.policies[policy.Prefix] = policy
+	}
+	return nil
+}
+
+// withTTLPolicy применяет политику префикса к операции записи.
+func (s *datastorage) withTTLPolicy(op batchOp) batchOp {
+	if op.isDelete {
+		return op
+	}
+	if policy, ok := s.TTLPolicyFor(op.key); ok {
+		op.ttl = policy.writeTTL(op.ttl)
+	}
+	return op
+}
+
+// trackTTLWrite регистрирует записанный с TTL ключ и, если политика
+// продлевает TTL при чтении, запоминает предел MaxLifetime.
+func (s *datastorage) trackTTLWrite(op batchOp) {
+	if op.isDelete || op.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	s.registerTTLKey(op.key, now.Add(op.ttl))
+	policy, ok := s.TTLPolicyFor(op.key)
+	if !ok || policy.MaxLifetime == 0 || policy.readWindow() == 0 {
+		return
+	}
+	deadline := now.Add(policy.MaxLifetime).Format(ttlRegistryTimeForm)
+	if err := s.Datastore.Put(context.Background(), ttlDeadlineKey(op.key), []byte(deadline)); err != nil {
+		log.Printf("ошибка сохранения предела TTL ключа %s: %v", op.key, err)
+	}
+}
+
+// touchTTL продлевает TTL прочитанного ключа по политике Sliding/IdleTimeout.
+// Ключи, записанные без TTL, не затрагиваются.
+func (s *datastorage) touchTTL(ctx context.Context, key ds.Key) {
+	policy, ok := s.TTLPolicyFor(key)
+	if !ok {
+		return
+	}
+	window := policy.readWindow()
+	if window == 0 {
+		return
+	}
+	current, ok := s.registeredExpiry(ctx, key)
+	if !ok {
+		return
+	}
+	expiresAt := time.Now().Add(window)
+	if data, err := s.Datastore.Get(ctx, ttlDeadlineKey(key)); err == nil {
+		if deadline, err := time.Parse(ttlRegistryTimeForm, string(data)); err == nil && expiresAt.After(deadline) {
+			expiresAt = deadline
+		}
+	}
+	if expiresAt.Sub(current) < ttlRefreshThreshold {
+		return
+	}
+	if err := s.setTTLWithContentType(ctx, key, time.Until(expiresAt)); err != nil {
+		return
+	}
+	s.registerTTLKey(key, expiresAt)
+}
+
+func (s *datastorage) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	value, err := s.Datastore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.touchTTL(ctx, key)
+	return value, nil
+}
+
+func (s *datastorage) GetTTLStats(ctx context.Context, prefix ds.Key) (*TTLStats, error) {
+	statuses, err := s.ttlStatuses(ctx, prefix, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	stats := &TTLStats{Prefix: prefix.String(), Policies: []TTLPolicy{}}
+	now := time.Now()
+	for _, status := range statuses {
+		stats.TotalKeys++
+		switch {
+		case status.IsExpired:
+			stats.ExpiredKeys++
+		case status.ExpiresAt.Sub(now) <= ttlExpiringSoonWindow:
+			stats.ExpiringSoon++
+		}
+		if !status.IsExpired && stats.NextExpiry == nil {
+			stats.NextExpiry = status.ExpiresAt
+		}
+	}
+	for _, policy := range s.ListTTLPolicies() {
+		p := ds.NewKey(policy.Prefix)
+		if prefix.String() == "/" || p.Equal(prefix) || prefix.IsAncestorOf(p) || p.IsAncestorOf(prefix) || policy.Prefix == "/" {
+			stats.Policies = append(stats.Policies, policy)
+		}
+	}
+	s.ttlMu.RLock()
+	if s.ttlMonitorConfig != nil {
+		stats.MonitorEnabled = s.ttlMonitorConfig.Enabled
+		stats.CheckInterval = s.ttlMonitorConfig.CheckInterval
+	}
+	s.ttlMu.RUnlock()
+	return stats, nil
+}
@@ -0,0 +1,45 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestSlidingTTLKeepsContentType(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	s := store.(*datastorage)
+
+	if err := store.SetTTLPolicy(ctx, TTLPolicy{Prefix: "/session", DefaultTTL: time.Hour, Sliding: true}); err != nil {
+		t.Fatal(err)
+	}
+	key := ds.NewKey("/session/a")
+	if err := store.PutWithOptions(ctx, key, []byte("x"), PutOptions{ContentType: "text/plain", TTL: 10 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	valueExp, err := s.Datastore.GetExpiration(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeExp, err := s.Datastore.GetExpiration(ctx, contentTypeKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(valueExp) < 30*time.Minute {
+		t.Fatalf("TTL не продлен чтением: %v", time.Until(valueExp))
+	}
+	if !typeExp.Equal(valueExp) {
+		t.Fatalf("тип содержимого истекает %v, значение %v", typeExp, valueExp)
+	}
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// --- Transactions
+
+// ErrTxnConflict возвращается Commit, если прочитанные в транзакции ключи
+// были изменены другой записью после ее начала.
+var ErrTxnConflict = errors.New("конфликт транзакции: прочитанные ключи изменены другой записью")
+
+var _ ds.Txn = (*pubsubTxn)(nil)
+var _ ds.TTL = (*pubsubTxn)(nil)
+
+// pubsubTxn - транзакция badger с теми же гарантиями, что и Put: значения
+// проверяются схемами, индексы обновляются в той же транзакции, события
+// публикуются после успешного Commit.
+type pubsubTxn struct {
+	ds.Txn
+	parent     *datastorage
+	ops        []batchOp
+	ttls       []txnTTL
+	silentMode bool
+	generation uint64 // поколение индексов на начало транзакции
+}
+
+func (s *datastorage) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	txn, err := s.Datastore.NewTransaction(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	s.indexReg.mu.RLock()
+	generation := s.indexReg.generation
+	s.indexReg.mu.RUnlock()
+	return &pubsubTxn{
+		Txn:        txn,
+		parent:     s,
+		silentMode: s.silentMode,
+		generation: generation,
+	}, nil
+}
+
+func (t *pubsubTxn) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return t.write(ctx, batchOp{key: key, value: value, clearContentType: true})
+}
+
+func (t *pubsubTxn) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	return t.write(ctx, batchOp{key: key, value: value, ttl: ttl, clearContentType: true})
+}
+
+func (t *pubsubTxn) PutWithOptions(ctx context.Context, key ds.Key, value []byte, opts PutOptions) error {
+	op, err := putOptionsOp(key, value, opts)
+	if err != nil {
+		return err
+	}
+	return t.write(ctx, op)
+}
+
+func (t *pubsubTxn) Delete(ctx context.Context, key ds.Key) error {
+	return t.write(ctx, batchOp{isDelete: true, key: key})
+}
+
+// txnTTL - TTL, установленный в транзакции; регистрируется после Commit.
+type txnTTL struct {
+	key       ds.Key
+	expiresAt time.Time
+}
+
+func (t *pubsubTxn) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	if err := setTTLInTxn(ctx, t.Txn, key, ttl); err != nil {
+		return err
+	}
+	t.ttls = append(t.ttls, txnTTL{key: key, expiresAt: time.Now().Add(ttl)})
+	return nil
+}
+
+func (t *pubsubTxn) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	return t.Txn.(ds.TTL).GetExpiration(ctx, key)
+}
+
+func (t *pubsubTxn) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	value, err := t.Txn.Get(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (t *pubsubTxn) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	return reverseSafeQuery(ctx, q, t.Txn.Query)
+}
+
+func (t *pubsubTxn) write(ctx context.Context, op batchOp) error {
+	if !op.isDelete {
+		if err := t.parent.ValidateValue(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	op = t.parent.withTTLPolicy(op)
+	if err := t.parent.writeInTxn(ctx, t.Txn, op); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *pubsubTxn) Commit(ctx context.Context) error {
+	if err := t.commit(ctx); err != nil {
+		if errors.Is(err, badger.ErrConflict) {
+			return ErrTxnConflict
+		}
+		return err
+	}
+	for _, ttl := range t.ttls {
+		t.parent.registerTTLKey(ttl.key, ttl.expiresAt)
+	}
+	for _, op := range t.ops {
+		switch {
+		case op.isDelete:
+			t.parent.unregisterTTLKey(ctx, op.key)
+		default:
+			t.parent.trackTTLWrite(op)
+		}
+		if t.silentMode {
+			continue
+		}
+		if op.isDelete {
+			t.parent.publishEvent(EventDelete, op.key, nil)
+		} else {
+			t.parent.publishEvent(EventPut, op.key, op.value)
+		}
+	}
+	t.ops = nil
+	t.ttls = nil
+	return nil
+}
+
+// commit фиксирует транзакцию под opMu индексов. Записи, сделанные до
+// создания или удаления индекса, обновили не тот набор индексов, поэтому
+// такая транзакция отклоняется как конфликт.
+func (t *pubsubTxn) commit(ctx context.Context) error {
+	t.parent.indexReg.opMu.RLock()
+	defer t.parent.indexReg.opMu.RUnlock()
+	t.parent.indexReg.mu.RLock()
+	changed := t.parent.indexReg.generation != t.generation
+	t.parent.indexReg.mu.RUnlock()
+	if changed && len(t.ops) > 0 {
+		t.Txn.Discard(ctx)
+		return badger.ErrConflict
+	}
+	return t.Txn.Commit(ctx)
+}
+
+func (t *pubsubTxn) Discard(ctx context.Context) {
+	t.ops = nil
+	t.ttls = nil
+	t.Txn.Discard(ctx)
+}
@@ -0,0 +1,49 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestTxnSetTTL(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	s := store.(*datastorage)
+
+	key := ds.NewKey("/data/a")
+	if err := store.PutWithOptions(ctx, key, []byte("x"), PutOptions{ContentType: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	txn, err := store.NewTransaction(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.(ds.TTL).SetTTL(ctx, key, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.registeredExpiry(ctx, key); !ok {
+		t.Fatal("TTL из транзакции не зарегистрирован")
+	}
+	valueExp, err := s.Datastore.GetExpiration(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeExp, err := s.Datastore.GetExpiration(ctx, contentTypeKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valueExp.IsZero() || !typeExp.Equal(valueExp) {
+		t.Fatalf("тип содержимого истекает %v, значение %v", typeExp, valueExp)
+	}
+}
@@ -0,0 +1,1166 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"ues-lite/js"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/itchyny/gojq"
+)
+
+// --- Views
+
+const (
+	ViewsNamespace     = "/_system/ds-views"
+	ViewsDataNamespace = "/_system/ds-views-data"
+	ViewsMetaNamespace = "/_system/ds-views-meta"
+
+	viewsSubscriberID = "_system-views"
+)
+
+// ViewConfig - описание материализованного представления.
+// Значения из SourcePrefix проходят через FilterScript (JS), затем через
+// TransformScript (JS) или JQTransform (jq); если задан ReduceScript (JS)
+// или ReduceJQ (jq), результаты сворачиваются в одно значение.
+type ViewConfig struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description,omitempty"`
+	SourcePrefix    string        `json:"source_prefix"`
+	FilterScript    string        `json:"filter_script,omitempty"`
+	TransformScript string        `json:"transform_script,omitempty"`
+	JQTransform     string        `json:"jq_transform,omitempty"`
+	ReduceScript    string        `json:"reduce_script,omitempty"`
+	ReduceJQ        string        `json:"reduce_jq,omitempty"`
+	EnableCaching   bool          `json:"enable_caching"`
+	CacheTTL        time.Duration `json:"cache_ttl,omitempty"`
+	AutoRefresh     bool          `json:"auto_refresh"`
+	RefreshDebounce time.Duration `json:"refresh_debounce,omitempty"`
+	MaxResults      int           `json:"max_results,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// ViewResult - одна строка результата view. Для view с reduce
+// возвращается единственная строка с ключом view.
+type ViewResult struct {
+	Key   ds.Key `json:"key"`
+	Value any    `json:"value"`
+}
+
+type ViewStats struct {
+	ID                 string        `json:"id"`
+	ResultCount        int           `json:"result_count"`
+	ExecutionCount     int64         `json:"execution_count"`
+	RefreshCount       int64         `json:"refresh_count"`
+	IncrementalUpdates int64         `json:"incremental_updates"`
+	CacheHits          int64         `json:"cache_hits"`
+	CacheMisses        int64         `json:"cache_misses"`
+	ErrorCount         int64         `json:"error_count"`
+	LastError          string        `json:"last_error,omitempty"`
+	LastExecuted       time.Time     `json:"last_executed"`
+	LastRefreshed      time.Time     `json:"last_refreshed"`
+	LastDuration       time.Duration `json:"last_duration"`
+}
+
+type View interface {
+	ID() string
+	Config() ViewConfig
+	Execute(ctx context.Context) ([]ViewResult, error)
+	ExecuteWithRange(ctx context.Context, start, end ds.Key) ([]ViewResult, error)
+	Refresh(ctx context.Context) error
+	GetCached(ctx context.Context) ([]ViewResult, bool, error)
+	InvalidateCache(ctx context.Context) error
+	Stats() ViewStats
+	UpdateConfig(config ViewConfig) error
+	Close() error
+}
+
+type ViewFeatures interface {
+	CreateView(ctx context.Context, config ViewConfig) (View, error)
+	CreateSimpleView(ctx context.Context, id, name, sourcePrefix, script string) (View, error)
+	GetView(id string) (View, bool)
+	ListViews() []View
+	RemoveView(ctx context.Context, id string) error
+	RefreshView(ctx context.Context, id string) error
+	RefreshAllViews(ctx context.Context) error
+	ExecuteView(ctx context.Context, id string) ([]ViewResult, error)
+	ExecuteViewWithRange(ctx context.Context, id string, start, end ds.Key) ([]ViewResult, error)
+	GetViewCached(ctx context.Context, id string) ([]ViewResult, bool, error)
+	GetViewStats(id string) (ViewStats, bool)
+	SaveViewConfig(ctx context.Context, config ViewConfig) error
+	LoadViewConfigs(ctx context.Context) error
+}
+
+type ViewManager interface {
+	ViewFeatures
+	Close() error
+}
+
+func (s *datastorage) CreateView(ctx context.Context, config ViewConfig) (View, error) {
+	return s.viewManager.CreateView(ctx, config)
+}
+
+func (s *datastorage) CreateSimpleView(ctx context.Context, id, name, sourcePrefix, script string) (View, error) {
+	return s.viewManager.CreateSimpleView(ctx, id, name, sourcePrefix, script)
+}
+
+func (s *datastorage) GetView(id string) (View, bool) {
+	return s.viewManager.GetView(id)
+}
+
+func (s *datastorage) ListViews() []View {
+	return s.viewManager.ListViews()
+}
+
+func (s *datastorage) RemoveView(ctx context.Context, id string) error {
+	return s.viewManager.RemoveView(ctx, id)
+}
+
+func (s *datastorage) RefreshView(ctx context.Context, id string) error {
+	return s.viewManager.RefreshView(ctx, id)
+}
+
+func (s *datastorage) RefreshAllViews(ctx context.Context) error {
+	return s.viewManager.RefreshAllViews(ctx)
+}
+
+func (s *datastorage) ExecuteView(ctx context.Context, id string) ([]ViewResult, error) {
+	return s.viewManager.ExecuteView(ctx, id)
+}
+
+func (s *datastorage) ExecuteViewWithRange(ctx context.Context, id string, start, end ds.Key) ([]ViewResult, error) {
+	return s.viewManager.ExecuteViewWithRange(ctx, id, start, end)
+}
+
+func (s *datastorage) GetViewCached(ctx context.Context, id string) ([]ViewResult, bool, error) {
+	return s.viewManager.GetViewCached(ctx, id)
+}
+
+func (s *datastorage) GetViewStats(id string) (ViewStats, bool) {
+	return s.viewManager.GetViewStats(id)
+}
+
+func (s *datastorage) SaveViewConfig(ctx context.Context, config ViewConfig) error {
+	return s.viewManager.SaveViewConfig(ctx, config)
+}
+
+func (s *datastorage) LoadViewConfigs(ctx context.Context) error {
+	return s.viewManager.LoadViewConfigs(ctx)
+}
+
+// --- DefaultViewManager
+
+type DefaultViewManager struct {
+	s     *datastorage
+	mu    sync.RWMutex
+	views map[string]*materializedView
+}
+
+var _ ViewManager = (*DefaultViewManager)(nil)
+
+func NewViewManager(s *datastorage) *DefaultViewManager {
+	vm := &DefaultViewManager{
+		s:     s,
+		views: make(map[string]*materializedView),
+	}
+	s.Subscribe(NewFuncSubscriber(viewsSubscriberID, vm.onEvent))
+	return vm
+}
+
+func (vm *DefaultViewManager) onEvent(event Event) {
+	switch event.Type {
+	case EventPut, EventDelete, EventTTLExpired:
+	default:
+		return
+	}
+	if strings.HasPrefix(event.Key.String(), "/_system/") {
+		return
+	}
+	vm.mu.RLock()
+	views := make([]*materializedView, 0, len(vm.views))
+	for _, v := range vm.views {
+		views = append(views, v)
+	}
+	vm.mu.RUnlock()
+	for _, v := range views {
+		if !v.matches(event.Key) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := v.applyChange(ctx, event.Key); err != nil {
+			log.Printf("ошибка инкрементального обновления view %s: %v", v.ID(), err)
+		}
+		cancel()
+	}
+}
+
+func (vm *DefaultViewManager) CreateView(ctx context.Context, config ViewConfig) (View, error) {
+	if err := checkViewConfig(&config); err != nil {
+		return nil, err
+	}
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if _, exists := vm.views[config.ID]; exists {
+		return nil, fmt.Errorf("view с ID %s уже существует", config.ID)
+	}
+	now := time.Now()
+	config.CreatedAt = now
+	config.UpdatedAt = now
+	v, err := newMaterializedView(vm.s, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.SaveViewConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	vm.views[config.ID] = v
+	return v, nil
+}
+
+func (vm *DefaultViewManager) CreateSimpleView(ctx context.Context, id, name, sourcePrefix, script string) (View, error) {
+	return vm.CreateView(ctx, ViewConfig{
+		ID:            id,
+		Name:          name,
+		SourcePrefix:  sourcePrefix,
+		FilterScript:  script,
+		EnableCaching: true,
+		AutoRefresh:   true,
+	})
+}
+
+func (vm *DefaultViewManager) GetView(id string) (View, bool) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	v, ok := vm.views[id]
+	if !ok {
+		return nil, false
+	}
+	return v, true
+}
+
+func (vm *DefaultViewManager) getView(id string) (*materializedView, error) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	v, ok := vm.views[id]
+	if !ok {
+		return nil, fmt.Errorf("view %s не найден", id)
+	}
+	return v, nil
+}
+
+func (vm *DefaultViewManager) ListViews() []View {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	views := make([]View, 0, len(vm.views))
+	for _, v := range vm.views {
+		views = append(views, v)
+	}
+	return views
+}
+
+func (vm *DefaultViewManager) RemoveView(ctx context.Context, id string) error {
+	vm.mu.Lock()
+	v, ok := vm.views[id]
+	if ok {
+		delete(vm.views, id)
+	}
+	vm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("view %s не найден", id)
+	}
+	v.Close()
+	if err := v.InvalidateCache(ctx); err != nil {
+		return err
+	}
+	key := ds.NewKey(ViewsNamespace).ChildString(id)
+	if err := vm.s.Datastore.Delete(ctx, key); err != nil && err != ds.ErrNotFound {
+		return fmt.Errorf("ошибка удаления конфигурации view: %w", err)
+	}
+	return nil
+}
+
+func (vm *DefaultViewManager) RefreshView(ctx context.Context, id string) error {
+	v, err := vm.getView(id)
+	if err != nil {
+		return err
+	}
+	return v.Refresh(ctx)
+}
+
+func (vm *DefaultViewManager) RefreshAllViews(ctx context.Context) error {
+	for _, v := range vm.ListViews() {
+		if err := v.Refresh(ctx); err != nil {
+			return fmt.Errorf("ошибка обновления view %s: %w", v.ID(), err)
+		}
+	}
+	return nil
+}
+
+func (vm *DefaultViewManager) ExecuteView(ctx context.Context, id string) ([]ViewResult, error) {
+	v, err := vm.getView(id)
+	if err != nil {
+		return nil, err
+	}
+	return v.Execute(ctx)
+}
+
+func (vm *DefaultViewManager) ExecuteViewWithRange(ctx context.Context, id string, start, end ds.Key) ([]ViewResult, error) {
+	v, err := vm.getView(id)
+	if err != nil {
+		return nil, err
+	}
+	return v.ExecuteWithRange(ctx, start, end)
+}
+
+func (vm *DefaultViewManager) GetViewCached(ctx context.Context, id string) ([]ViewResult, bool, error) {
+	v, err := vm.getView(id)
+	if err != nil {
+		return nil, false, err
+	}
+	return v.GetCached(ctx)
+}
+
+func (vm *DefaultViewManager) GetViewStats(id string) (ViewStats, bool) {
+	v, err := vm.getView(id)
+	if err != nil {
+		return ViewStats{}, false
+	}
+	return v.Stats(), true
+}
+
+func (vm *DefaultViewManager) SaveViewConfig(ctx context.Context, config ViewConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации конфигурации view: %w", err)
+	}
+	key := ds.NewKey(ViewsNamespace).ChildString(config.ID)
+	if err := vm.s.Datastore.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("ошибка сохранения конфигурации view: %w", err)
+	}
+	return nil
+}
+
+func (vm *DefaultViewManager) LoadViewConfigs(ctx context.Context) error {
+	results, err := vm.s.Datastore.Query(ctx, query.Query{Prefix: ViewsNamespace})
+	if err != nil {
+		return fmt.Errorf("ошибка запроса конфигураций view: %w", err)
+	}
+	defer results.Close()
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		var config ViewConfig
+		if err := json.Unmarshal(res.Value, &config); err != nil {
+			log.Printf("некорректная конфигурация view %s: %v", res.Key, err)
+			continue
+		}
+		v, err := newMaterializedView(vm.s, config)
+		if err != nil {
+			log.Printf("ошибка загрузки view %s: %v", config.ID, err)
+			continue
+		}
+		if old, ok := vm.views[config.ID]; ok {
+			old.Close()
+		}
+		vm.views[config.ID] = v
+	}
+	return nil
+}
+
+func (vm *DefaultViewManager) Close() error {
+	vm.s.Unsubscribe(viewsSubscriberID)
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	for _, v := range vm.views {
+		v.Close()
+	}
+	return nil
+}
+
+func checkViewConfig(config *ViewConfig) error {
+	if config.ID == "" {
+		return fmt.Errorf("view ID не может быть пустым")
+	}
+	if strings.Contains(config.ID, "/") {
+		return fmt.Errorf("view ID не может содержать '/'")
+	}
+	if config.SourcePrefix == "" {
+		return fmt.Errorf("view SourcePrefix не может быть пустым")
+	}
+	if config.TransformScript != "" && config.JQTransform != "" {
+		return fmt.Errorf("нельзя одновременно использовать TransformScript и JQTransform")
+	}
+	if config.ReduceScript != "" && config.ReduceJQ != "" {
+		return fmt.Errorf("нельзя одновременно использовать ReduceScript и ReduceJQ")
+	}
+	if config.Name == "" {
+		config.Name = config.ID
+	}
+	if config.RefreshDebounce <= 0 {
+		config.RefreshDebounce = time.Second
+	}
+	return nil
+}
+
+// --- materializedView
+
+// viewMeta хранится в ViewsMetaNamespace и отмечает, что кэш view построен.
+type viewMeta struct {
+	RefreshedAt time.Time `json:"refreshed_at"`
+	Count       int       `json:"count"`
+	Reduced     any       `json:"reduced,omitempty"`
+}
+
+type materializedView struct {
+	s          *datastorage
+	mu         sync.RWMutex
+	opMu       sync.Mutex // сериализует полное и инкрементальное обновление кэша
+	config     ViewConfig
+	jqCode     *gojq.Code
+	reduceCode *gojq.Code
+	stats      ViewStats
+	timer      *time.Timer
+	closed     bool
+}
+
+var _ View = (*materializedView)(nil)
+
+func newMaterializedView(s *datastorage, config ViewConfig) (*materializedView, error) {
+	if err := checkViewConfig(&config); err != nil {
+		return nil, err
+	}
+	v := &materializedView{
+		s:     s,
+		stats: ViewStats{ID: config.ID},
+	}
+	if err := v.setConfig(config); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *materializedView) setConfig(config ViewConfig) error {
+	var jqCode, reduceCode *gojq.Code
+	var err error
+	if config.JQTransform != "" {
+		jqCode, err = v.s.compileJQ(config.JQTransform, "$key")
+		if err != nil {
+			return err
+		}
+	}
+	if config.ReduceJQ != "" {
+		reduceCode, err = v.s.compileJQ(config.ReduceJQ)
+		if err != nil {
+			return err
+		}
+	}
+	v.mu.Lock()
+	v.config = config
+	v.jqCode = jqCode
+	v.reduceCode = reduceCode
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *materializedView) ID() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.config.ID
+}
+
+func (v *materializedView) Config() ViewConfig {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.config
+}
+
+func (v *materializedView) Stats() ViewStats {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.stats
+}
+
+func (v *materializedView) UpdateConfig(config ViewConfig) error {
+	current := v.Config()
+	config.ID = current.ID
+	config.CreatedAt = current.CreatedAt
+	config.UpdatedAt = time.Now()
+	if err := checkViewConfig(&config); err != nil {
+		return err
+	}
+	if err := v.setConfig(config); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := v.InvalidateCache(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации конфигурации view: %w", err)
+	}
+	key := ds.NewKey(ViewsNamespace).ChildString(config.ID)
+	return v.s.Datastore.Put(ctx, key, data)
+}
+
+func (v *materializedView) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.closed = true
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+	}
+	return nil
+}
+
+func (v *materializedView) dataPrefix() ds.Key {
+	return ds.NewKey(ViewsDataNamespace).ChildString(v.ID())
+}
+
+func (v *materializedView) metaKey() ds.Key {
+	return ds.NewKey(ViewsMetaNamespace).ChildString(v.ID())
+}
+
+func (v *materializedView) hasReduce() bool {
+	config := v.Config()
+	return config.ReduceScript != "" || config.ReduceJQ != ""
+}
+
+func (v *materializedView) matches(key ds.Key) bool {
+	prefix := ds.NewKey(v.Config().SourcePrefix)
+	return prefix.String() == "/" || key.Equal(prefix) || prefix.IsAncestorOf(key)
+}
+
+func (v *materializedView) recordError(err error) {
+	v.mu.Lock()
+	v.stats.ErrorCount++
+	v.stats.LastError = err.Error()
+	v.mu.Unlock()
+}
+
+// evaluate применяет фильтр и преобразование к значению. Второй результат
+// false означает, что значение не попадает в view.
+func (v *materializedView) evaluate(ctx context.Context, key ds.Key, value []byte) (any, bool, error) {
+	v.mu.RLock()
+	config := v.config
+	jqCode := v.jqCode
+	v.mu.RUnlock()
+
+	var parsed any
+	if err := json.Unmarshal(value, &parsed); err != nil {
+		parsed = nil
+	}
+
+	data := map[string]any{
+		"key":   key.String(),
+		"value": string(value),
+		"json":  parsed,
+	}
+
+	if config.FilterScript != "" {
+		ok, err := js.Eval(ctx, config.FilterScript, map[string]any{"data": data})
+		if err != nil {
+			return nil, false, fmt.Errorf("ошибка выполнения filter_script: %w", err)
+		}
+		if !isTruthy(ok) {
+			return nil, false, nil
+		}
+	}
+
+	switch {
+	case config.TransformScript != "":
+		out, err := js.Eval(ctx, config.TransformScript, map[string]any{"data": data})
+		if err != nil {
+			return nil, false, fmt.Errorf("ошибка выполнения transform_script: %w", err)
+		}
+		if out == nil {
+			return nil, false, nil
+		}
+		return out, true, nil
+
+	case jqCode != nil:
+		var input any = parsed
+		if input == nil {
+			input = string(value)
+		}
+		iter := jqCode.RunWithContext(ctx, input, key.String())
+		outputs := []any{}
+		for {
+			out, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, isErr := out.(error); isErr {
+				return nil, false, fmt.Errorf("ошибка выполнения jq-запроса: %w", err)
+			}
+			outputs = append(outputs, out)
+		}
+		switch len(outputs) {
+		case 0:
+			return nil, false, nil
+		case 1:
+			return outputs[0], true, nil
+		default:
+			return outputs, true, nil
+		}
+	}
+
+	if parsed != nil {
+		return parsed, true, nil
+	}
+	return string(value), true, nil
+}
+
+func (v *materializedView) reduce(ctx context.Context, results []ViewResult) (any, error) {
+	v.mu.RLock()
+	config := v.config
+	reduceCode := v.reduceCode
+	v.mu.RUnlock()
+
+	items := make([]any, 0, len(results))
+	for _, r := range results {
+		value, err := normalizeJSON(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, map[string]any{
+			"key":   r.Key.String(),
+			"value": value,
+		})
+	}
+
+	if config.ReduceScript != "" {
+		out, err := js.Eval(ctx, config.ReduceScript, map[string]any{"results": items})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка выполнения reduce_script: %w", err)
+		}
+		return out, nil
+	}
+
+	iter := reduceCode.RunWithContext(ctx, items)
+	out, ok := iter.Next()
+	if !ok {
+		return nil, nil
+	}
+	if err, isErr := out.(error); isErr {
+		return nil, fmt.Errorf("ошибка выполнения jq-запроса: %w", err)
+	}
+	return out, nil
+}
+
+func (v *materializedView) reduceResult(ctx context.Context, results []ViewResult) ([]ViewResult, error) {
+	reduced, err := v.reduce(ctx, results)
+	if err != nil {
+		return nil, err
+	}
+	return []ViewResult{{Key: ds.NewKey(v.ID()), Value: reduced}}, nil
+}
+
+// Refresh полностью перестраивает кэш view по исходному префиксу. Метаданные
+// удаляются до очистки и записываются только после успешного построения,
+// поэтому недостроенный кэш не считается действительным.
+func (v *materializedView) Refresh(ctx context.Context) error {
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+
+	start := time.Now()
+	if err := v.s.Datastore.Delete(ctx, v.metaKey()); err != nil && err != ds.ErrNotFound {
+		v.recordError(err)
+		return err
+	}
+	if err := v.clearData(ctx); err != nil {
+		v.recordError(err)
+		return err
+	}
+
+	results, err := v.s.Datastore.Query(ctx, query.Query{Prefix: v.Config().SourcePrefix})
+	if err != nil {
+		v.recordError(err)
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	batch, err := v.s.Datastore.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+
+	dataPrefix := v.dataPrefix()
+	collected := []ViewResult{}
+	count := 0
+	for res := range results.Next() {
+		if res.Error != nil {
+			v.recordError(res.Error)
+			return res.Error
+		}
+		key := ds.NewKey(res.Key)
+		if strings.HasPrefix(key.String(), "/_system/") {
+			continue
+		}
+		value, ok, err := v.evaluate(ctx, key, res.Value)
+		if err != nil {
+			v.recordError(fmt.Errorf("%s: %w", res.Key, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			v.recordError(fmt.Errorf("%s: %w", res.Key, err))
+			continue
+		}
+		if err := batch.Put(ctx, dataPrefix.Child(key), data); err != nil {
+			return fmt.Errorf("ошибка добавления в batch: %w", err)
+		}
+		if v.hasReduce() {
+			collected = append(collected, ViewResult{Key: key, Value: value})
+		}
+		count++
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка коммита batch: %w", err)
+	}
+
+	meta := viewMeta{RefreshedAt: time.Now(), Count: count}
+	if v.hasReduce() {
+		reduced, err := v.reduce(ctx, collected)
+		if err != nil {
+			v.recordError(err)
+			return err
+		}
+		meta.Reduced = reduced
+	}
+	if err := v.putMeta(ctx, meta); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.stats.RefreshCount++
+	v.stats.ResultCount = count
+	v.stats.LastRefreshed = meta.RefreshedAt
+	v.stats.LastDuration = time.Since(start)
+	v.mu.Unlock()
+	return nil
+}
+
+// applyChange инкрементально обновляет кэш для одного исходного ключа.
+func (v *materializedView) applyChange(ctx context.Context, key ds.Key) error {
+	config := v.Config()
+	if !config.EnableCaching || !config.AutoRefresh {
+		return nil
+	}
+
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+
+	meta, ok, err := v.getMeta(ctx)
+	if err != nil || !ok {
+		// Кэш еще не построен - он будет построен при первом выполнении
+		return err
+	}
+
+	// Читаем текущее значение вместо значения из события: события доставляются
+	// конкурентно и могут прийти не по порядку.
+	dataKey := v.dataPrefix().Child(key)
+	existed, err := v.s.Datastore.Has(ctx, dataKey)
+	if err != nil {
+		return err
+	}
+	included := false
+	value, err := v.s.Datastore.Get(ctx, key)
+	switch {
+	case err == nil:
+		out, ok, err := v.evaluate(ctx, key, value)
+		if err != nil {
+			v.recordError(fmt.Errorf("%s: %w", key, err))
+		} else if ok {
+			data, err := json.Marshal(out)
+			if err != nil {
+				return err
+			}
+			if err := v.s.Datastore.Put(ctx, dataKey, data); err != nil {
+				return err
+			}
+			included = true
+		}
+	case err != ds.ErrNotFound:
+		return err
+	}
+	if !included && existed {
+		if err := v.s.Datastore.Delete(ctx, dataKey); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+
+	switch {
+	case included && !existed:
+		meta.Count++
+	case !included && existed:
+		meta.Count--
+	}
+	if err := v.putMeta(ctx, meta); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.stats.IncrementalUpdates++
+	v.stats.ResultCount = meta.Count
+	v.mu.Unlock()
+
+	if v.hasReduce() {
+		v.scheduleReduce()
+	}
+	return nil
+}
+
+// scheduleReduce пересчитывает reduce с задержкой RefreshDebounce,
+// чтобы серия изменений приводила к одному пересчету.
+func (v *materializedView) scheduleReduce() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return
+	}
+	if v.timer != nil {
+		v.timer.Stop()
+	}
+	v.timer = time.AfterFunc(v.config.RefreshDebounce, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := v.recomputeReduce(ctx); err != nil {
+			v.recordError(err)
+			log.Printf("ошибка пересчета reduce для view %s: %v", v.ID(), err)
+		}
+	})
+}
+
+func (v *materializedView) recomputeReduce(ctx context.Context) error {
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+	meta, ok, err := v.getMeta(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	results, err := v.readData(ctx, ds.Key{}, ds.Key{}, 0)
+	if err != nil {
+		return err
+	}
+	reduced, err := v.reduce(ctx, results)
+	if err != nil {
+		return err
+	}
+	meta.Reduced = reduced
+	meta.Count = len(results)
+	return v.putMeta(ctx, meta)
+}
+
+func (v *materializedView) Execute(ctx context.Context) ([]ViewResult, error) {
+	return v.ExecuteWithRange(ctx, ds.Key{}, ds.Key{})
+}
+
+// ExecuteWithRange возвращает результаты для исходных ключей в диапазоне
+// [start, end]. Пустой ключ означает отсутствие границы.
+func (v *materializedView) ExecuteWithRange(ctx context.Context, start, end ds.Key) ([]ViewResult, error) {
+	config := v.Config()
+
+	v.mu.Lock()
+	v.stats.ExecutionCount++
+	v.stats.LastExecuted = time.Now()
+	v.mu.Unlock()
+
+	if !config.EnableCaching {
+		results, err := v.compute(ctx, start, end)
+		if err != nil {
+			v.recordError(err)
+		}
+		return results, err
+	}
+
+	fullRange := start.String() == "" && end.String() == ""
+	if fullRange {
+		if results, ok, err := v.GetCached(ctx); err != nil || ok {
+			return results, err
+		}
+	} else if v.cacheValid(ctx) {
+		if results, ok, err := v.readRange(ctx, start, end); err != nil || ok {
+			v.mu.Lock()
+			v.stats.CacheHits++
+			v.mu.Unlock()
+			return results, err
+		}
+	}
+
+	v.mu.Lock()
+	v.stats.CacheMisses++
+	v.mu.Unlock()
+	if err := v.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if fullRange {
+		results, _, err := v.cached(ctx)
+		return results, err
+	}
+	results, _, err := v.readRange(ctx, start, end)
+	return results, err
+}
+
+// GetCached возвращает закэшированные результаты, если кэш построен и не устарел.
+func (v *materializedView) GetCached(ctx context.Context) ([]ViewResult, bool, error) {
+	if !v.cacheValid(ctx) {
+		return nil, false, nil
+	}
+	results, ok, err := v.cached(ctx)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	v.mu.Lock()
+	v.stats.CacheHits++
+	v.mu.Unlock()
+	return results, true, nil
+}
+
+// cached читает кэш под opMu, чтобы не застать его посреди обновления;
+// false - кэш не построен.
+func (v *materializedView) cached(ctx context.Context) ([]ViewResult, bool, error) {
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+	meta, ok, err := v.getMeta(ctx)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if v.hasReduce() {
+		return []ViewResult{{Key: ds.NewKey(v.ID()), Value: meta.Reduced}}, true, nil
+	}
+	results, err := v.readData(ctx, ds.Key{}, ds.Key{}, v.Config().MaxResults)
+	if err != nil {
+		return nil, false, err
+	}
+	return results, true, nil
+}
+
+func (v *materializedView) cacheValid(ctx context.Context) bool {
+	config := v.Config()
+	if !config.EnableCaching {
+		return false
+	}
+	meta, ok, err := v.getMeta(ctx)
+	if err != nil || !ok {
+		return false
+	}
+	if config.CacheTTL > 0 && time.Since(meta.RefreshedAt) > config.CacheTTL {
+		return false
+	}
+	return true
+}
+
+// readRange читает диапазон кэша под opMu, как cached.
+func (v *materializedView) readRange(ctx context.Context, start, end ds.Key) ([]ViewResult, bool, error) {
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+	if _, ok, err := v.getMeta(ctx); err != nil || !ok {
+		return nil, false, err
+	}
+	if v.hasReduce() {
+		results, err := v.readData(ctx, start, end, 0)
+		if err != nil {
+			return nil, false, err
+		}
+		results, err = v.reduceResult(ctx, results)
+		return results, err == nil, err
+	}
+	results, err := v.readData(ctx, start, end, v.Config().MaxResults)
+	return results, err == nil, err
+}
+
+func (v *materializedView) InvalidateCache(ctx context.Context) error {
+	v.opMu.Lock()
+	defer v.opMu.Unlock()
+	if err := v.s.Datastore.Delete(ctx, v.metaKey()); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	return v.clearData(ctx)
+}
+
+// compute вычисляет view напрямую по исходным данным, минуя кэш.
+func (v *materializedView) compute(ctx context.Context, start, end ds.Key) ([]ViewResult, error) {
+	config := v.Config()
+	results, err := v.s.Datastore.Query(ctx, query.Query{Prefix: config.SourcePrefix})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer results.Close()
+
+	limit := config.MaxResults
+	if v.hasReduce() {
+		limit = 0
+	}
+
+	out := []ViewResult{}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if !inKeyRange(res.Key, start, end) {
+			if end.String() != "" && res.Key > end.String() {
+				break
+			}
+			continue
+		}
+		key := ds.NewKey(res.Key)
+		if strings.HasPrefix(key.String(), "/_system/") {
+			continue
+		}
+		value, ok, err := v.evaluate(ctx, key, res.Value)
+		if err != nil {
+			v.recordError(fmt.Errorf("%s: %w", res.Key, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		out = append(out, ViewResult{Key: key, Value: value})
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+
+	if v.hasReduce() {
+		return v.reduceResult(ctx, out)
+	}
+	return out, nil
+}
+
+func (v *materializedView) readData(ctx context.Context, start, end ds.Key, limit int) ([]ViewResult, error) {
+	prefix := v.dataPrefix().String()
+	results, err := v.s.Datastore.Query(ctx, query.Query{Prefix: prefix})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша view: %w", err)
+	}
+	defer results.Close()
+
+	out := []ViewResult{}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		sourceKey := res.Key[len(prefix):]
+		if !inKeyRange(sourceKey, start, end) {
+			if end.String() != "" && sourceKey > end.String() {
+				break
+			}
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(res.Value, &value); err != nil {
+			return nil, fmt.Errorf("поврежденный кэш view для ключа %s: %w", sourceKey, err)
+		}
+		out = append(out, ViewResult{Key: ds.NewKey(sourceKey), Value: value})
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (v *materializedView) clearData(ctx context.Context) error {
+	results, err := v.s.Datastore.Query(ctx, query.Query{
+		Prefix:   v.dataPrefix().String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка чтения кэша view: %w", err)
+	}
+	defer results.Close()
+	batch, err := v.s.Datastore.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка создания batch: %w", err)
+	}
+	for res := range results.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := batch.Delete(ctx, ds.NewKey(res.Key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+func (v *materializedView) getMeta(ctx context.Context) (viewMeta, bool, error) {
+	var meta viewMeta
+	data, err := v.s.Datastore.Get(ctx, v.metaKey())
+	if err == ds.ErrNotFound {
+		return meta, false, nil
+	}
+	if err != nil {
+		return meta, false, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false, nil
+	}
+	return meta, true, nil
+}
+
+func (v *materializedView) putMeta(ctx context.Context, meta viewMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return v.s.Datastore.Put(ctx, v.metaKey(), data)
+}
+
+// --- helpers
+
+func inKeyRange(key string, start, end ds.Key) bool {
+	if start.String() != "" && key < start.String() {
+		return false
+	}
+	if end.String() != "" && key > end.String() {
+		return false
+	}
+	return true
+}
+
+func isTruthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case int64:
+		return t != 0
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	default:
+		return true
+	}
+}
+
+// normalizeJSON приводит значение к типам encoding/json, которые ожидает gojq.
+func normalizeJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
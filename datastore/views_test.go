@@ -0,0 +1,47 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+func TestViewFailedRefreshInvalidatesCache(t *testing.T) {
+	store, err := NewDatastorage(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.Put(ctx, ds.NewKey("/data/a"), []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	view, err := store.CreateView(ctx, ViewConfig{
+		ID:            "sum",
+		Name:          "sum",
+		SourcePrefix:  "/data",
+		ReduceJQ:      `if length > 1 then error("слишком много") else length end`,
+		EnableCaching: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := view.GetCached(ctx); err != nil || !ok {
+		t.Fatalf("кэш после обновления: %v %v", ok, err)
+	}
+
+	if err := store.Put(ctx, ds.NewKey("/data/b"), []byte(`{"n":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Refresh(ctx); err == nil {
+		t.Fatal("ожидалась ошибка reduce")
+	}
+	if _, ok, err := view.GetCached(ctx); err != nil || ok {
+		t.Fatalf("недостроенный кэш считается действительным: %v %v", ok, err)
+	}
+}
@@ -2,6 +2,7 @@ package js
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"reflect"
 	"strings"
@@ -17,11 +18,18 @@ import (
 
 var vmsPool *RuntimePool
 
+var (
+	helpersPool     *RuntimePool
+	helpersPoolOnce sync.Once
+)
+
 type RuntimePool struct {
 	pool sync.Pool
 }
 
-func NewRuntimePool() *RuntimePool {
+// NewRuntimePool создает пул VM; binds вызываются для каждой новой VM
+// после общих биндингов (require, console, process, buffer).
+func NewRuntimePool(binds ...func(vm *goja.Runtime)) *RuntimePool {
 
 	requireRegistry := new(require.Registry)
 
@@ -38,6 +46,9 @@ func NewRuntimePool() *RuntimePool {
 			New: func() any {
 				vm := goja.New()
 				sharedBinds(vm)
+				for _, bind := range binds {
+					bind(vm)
+				}
 				return vm
 			},
 		},
@@ -86,6 +97,71 @@ func Eval(ctx context.Context, code string, params map[string]any) (any, error)
 	return result.Export(), nil
 }
 
+// Undefined возвращается CallProgram, если функция вернула undefined,
+// чтобы его можно было отличить от null.
+var Undefined = undefined{}
+
+type undefined struct{}
+
+// JSON - аргумент CallProgram, который передается в скрипт обычным
+// JS-значением (через JSON.parse), а не оберткой над Go-структурой.
+type JSON []byte
+
+// CompileFunction компилирует тело функции с параметрами params.
+// Результат выполняется через CallProgram.
+func CompileFunction(name, body string, params ...string) (*goja.Program, error) {
+	code := "(function(" + strings.Join(params, ", ") + ") {\n" + body + "\n})"
+	return goja.Compile(name, code, false)
+}
+
+// CallProgram вызывает функцию, скомпилированную CompileFunction, в VM из пула
+// с биндингами $lo и lancet. Выполнение прерывается при отмене ctx.
+func CallProgram(ctx context.Context, prog *goja.Program, args ...any) (result any, err error) {
+	helpersPoolOnce.Do(func() {
+		helpersPool = NewRuntimePool(LoBinds, InitLancetBindings)
+	})
+	vm := helpersPool.Get()
+	defer helpersPool.Put(vm)
+
+	stop := context.AfterFunc(ctx, func() { vm.Interrupt(ctx.Err()) })
+	defer func() {
+		stop()
+		vm.ClearInterrupt()
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic при выполнении скрипта: %v", r)
+		}
+	}()
+
+	fnValue, err := vm.RunProgram(prog)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := goja.AssertFunction(fnValue)
+	if !ok {
+		return nil, fmt.Errorf("программа не является функцией")
+	}
+	values := make([]goja.Value, len(args))
+	for i, arg := range args {
+		raw, ok := arg.(JSON)
+		if !ok {
+			values[i] = vm.ToValue(arg)
+			continue
+		}
+		parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+		if values[i], err = parse(goja.Undefined(), vm.ToValue(string(raw))); err != nil {
+			return nil, err
+		}
+	}
+	out, err := fn(goja.Undefined(), values...)
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(out) {
+		return Undefined, nil
+	}
+	return out.Export(), nil
+}
+
 var (
 	_ goja.FieldNameMapper = (*FieldMapper)(nil)
 )